@@ -0,0 +1,572 @@
+// Package acl holds the users allowed to use the API and what each of them
+// may do. A user is granted command categories and key patterns; a command
+// is allowed when the user holds every category it belongs to and, for
+// commands on a key, the key matches one of the user's patterns.
+package acl
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Category groups commands for permissions
+type Category string
+
+const (
+	Read   Category = "read"
+	Write  Category = "write"
+	Admin  Category = "admin"
+	List   Category = "list"
+	String Category = "string"
+	Stream Category = "stream"
+	Queue  Category = "queue"
+	Lock   Category = "lock"
+	JSON   Category = "json"
+	Search Category = "search"
+	PubSub Category = "pubsub"
+)
+
+// All grants every category
+const All Category = "all"
+
+var categories = []Category{Read, Write, Admin, List, String, Stream, Queue, Lock, JSON, Search, PubSub}
+
+// DefaultUser is used for requests without credentials
+const DefaultUser = "default"
+
+var (
+	ErrUnknownUser     = errors.New("unknown user")
+	ErrBadCredentials  = errors.New("invalid credentials")
+	ErrDisabled        = errors.New("user is disabled")
+	ErrNoPermission    = errors.New("no permission")
+	ErrUnknownCategory = errors.New("unknown category")
+	ErrInvalidPattern  = errors.New("invalid key pattern")
+	ErrInvalidPassword = errors.New("invalid password")
+)
+
+// MaxPasswordLen is the longest password bcrypt can hash
+const MaxPasswordLen = 72
+
+// User is one ACL identity. Secrets are only kept hashed: passwords with
+// bcrypt and API keys, which are random, with SHA-256.
+type User struct {
+	Name       string     `json:"name"`
+	Enabled    bool       `json:"enabled"`
+	NoPass     bool       `json:"nopass,omitempty"`
+	Passwords  []string   `json:"passwords,omitempty"`
+	APIKeys    []string   `json:"api_keys,omitempty"`
+	Categories []Category `json:"categories"`
+	Keys       []string   `json:"keys"`
+	// Namespaces limits the namespaces the user may select. Empty allows
+	// all of them.
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+// Can reports whether u holds every category in need
+func (u *User) Can(need ...Category) bool {
+	for _, n := range need {
+		ok := false
+		for _, c := range u.Categories {
+			if c == n || c == All {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// CanAccess reports whether key matches one of u's key patterns
+func (u *User) CanAccess(key string) bool {
+	for _, p := range u.Keys {
+		if matchKey(p, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanUseNamespace reports whether db matches one of u's namespace patterns
+func (u *User) CanUseNamespace(db string) bool {
+	if len(u.Namespaces) == 0 {
+		return true
+	}
+	for _, p := range u.Namespaces {
+		if ok, _ := path.Match(p, db); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Spec is the editable part of a user. Passwords are given in plain text
+// and hashed before they are stored.
+type Spec struct {
+	Enabled    bool       `json:"enabled"`
+	NoPass     bool       `json:"nopass"`
+	Passwords  []string   `json:"passwords"`
+	Categories []Category `json:"categories"`
+	Keys       []string   `json:"keys"`
+	Namespaces []string   `json:"namespaces"`
+}
+
+// Registry holds the users and saves them to a file after every change when
+// one is configured
+type Registry struct {
+	mu    sync.RWMutex
+	users map[string]*User
+	file  string
+
+	// verified maps a bcrypt hash to the SHA-256 of the password last
+	// checked against it, so a client sending its password with every
+	// request pays for bcrypt once
+	verifiedMu sync.Mutex
+	verified   map[string][sha256.Size]byte
+}
+
+// New returns a registry containing only the default user, which needs no
+// password and may do everything, so a server without ACL configuration
+// behaves as before
+func New() *Registry {
+	return &Registry{users: map[string]*User{
+		DefaultUser: defaultUser(),
+	}}
+}
+
+func defaultUser() *User {
+	return &User{
+		Name:       DefaultUser,
+		Enabled:    true,
+		NoPass:     true,
+		Categories: []Category{All},
+		Keys:       []string{"*"},
+	}
+}
+
+// Load reads users from file and saves later changes back to it. A missing
+// file is created with the default user.
+func Load(file string) (*Registry, error) {
+	r := New()
+	r.file = file
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, r.saveLocked()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var users []*User
+	if err := json.Unmarshal(data, &users); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", file, err)
+	}
+	r.users = make(map[string]*User, len(users))
+	for _, u := range users {
+		if err := validate(u.Categories, u.Keys, u.Namespaces); err != nil {
+			return nil, fmt.Errorf("%s: user %s: %w", file, u.Name, err)
+		}
+		r.users[u.Name] = u
+	}
+	return r, nil
+}
+
+// Authenticate checks a user name and password. A password stored as a
+// SHA-256 hash by an older version is rehashed with bcrypt once it is used.
+func (r *Registry) Authenticate(name, password string) (*User, error) {
+	r.mu.RLock()
+	u, ok := r.users[name]
+	if ok {
+		u = u.clone()
+	}
+	r.mu.RUnlock()
+	if !ok {
+		// Take as long as a wrong password would, so that the time to
+		// answer does not tell which users exist
+		r.matchPassword(nil, password)
+		return nil, ErrBadCredentials
+	}
+	if !u.NoPass {
+		matched, legacy := r.matchPassword(u.Passwords, password)
+		if matched == "" {
+			return nil, ErrBadCredentials
+		}
+		if legacy {
+			r.upgradePassword(name, matched, password)
+		}
+	}
+	if !u.Enabled {
+		return nil, ErrDisabled
+	}
+	return u, nil
+}
+
+// AuthenticateKey finds the user an API key belongs to
+func (r *Registry) AuthenticateKey(key string) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, u := range r.users {
+		if matchHash(u.APIKeys, key) {
+			if !u.Enabled {
+				return nil, ErrDisabled
+			}
+			return u.clone(), nil
+		}
+	}
+	return nil, ErrBadCredentials
+}
+
+// Identify returns a user whose identity was already proven by other
+// means, such as a verified client certificate
+func (r *Registry) Identify(name string) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	u, ok := r.users[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownUser, name)
+	}
+	if !u.Enabled {
+		return nil, ErrDisabled
+	}
+	return u.clone(), nil
+}
+
+// Anonymous returns the default user for requests without credentials, if
+// it is enabled and needs no password
+func (r *Registry) Anonymous() (*User, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	u, ok := r.users[DefaultUser]
+	if !ok || !u.Enabled || !u.NoPass {
+		return nil, false
+	}
+	return u.clone(), true
+}
+
+// Lookup returns a user by name
+func (r *Registry) Lookup(name string) (*User, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	u, ok := r.users[name]
+	if !ok {
+		return nil, false
+	}
+	return u.clone(), true
+}
+
+// Users returns every user sorted by name
+func (r *Registry) Users() []*User {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]*User, 0, len(r.users))
+	for _, u := range r.users {
+		out = append(out, u.clone())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// SetUser creates or replaces a user. API keys of an existing user are kept.
+func (r *Registry) SetUser(name string, spec Spec) (*User, error) {
+	if name == "" {
+		return nil, fmt.Errorf("%w: empty name", ErrUnknownUser)
+	}
+	if err := validate(spec.Categories, spec.Keys, spec.Namespaces); err != nil {
+		return nil, err
+	}
+
+	u := &User{
+		Name:       name,
+		Enabled:    spec.Enabled,
+		NoPass:     spec.NoPass,
+		Categories: append([]Category{}, spec.Categories...),
+		Keys:       append([]string{}, spec.Keys...),
+		Namespaces: append([]string(nil), spec.Namespaces...),
+	}
+	for _, p := range spec.Passwords {
+		h, err := hashPassword(p)
+		if err != nil {
+			return nil, err
+		}
+		u.Passwords = append(u.Passwords, h)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	prev, had := r.users[name]
+	if had {
+		u.APIKeys = prev.APIKeys
+	}
+	r.users[name] = u
+	if err := r.saveLocked(); err != nil {
+		if had {
+			r.users[name] = prev
+		} else {
+			delete(r.users, name)
+		}
+		return nil, err
+	}
+	if had {
+		r.forget(prev.Passwords)
+	}
+	return u.clone(), nil
+}
+
+// DeleteUser removes a user
+func (r *Registry) DeleteUser(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.users[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownUser, name)
+	}
+	delete(r.users, name)
+	if err := r.saveLocked(); err != nil {
+		r.users[name] = u
+		return err
+	}
+	r.forget(u.Passwords)
+	return nil
+}
+
+// NewAPIKey generates an API key for a user. The key is only returned
+// here; the registry keeps its hash.
+func (r *Registry) NewAPIKey(name string) (string, error) {
+	var b [24]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	key := hex.EncodeToString(b[:])
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.users[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownUser, name)
+	}
+	prev := u.APIKeys
+	u.APIKeys = append(append([]string{}, prev...), hash(key))
+	if err := r.saveLocked(); err != nil {
+		u.APIKeys = prev
+		return "", err
+	}
+	return key, nil
+}
+
+// RevokeAPIKeys removes every API key of a user
+func (r *Registry) RevokeAPIKeys(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.users[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownUser, name)
+	}
+	prev := u.APIKeys
+	u.APIKeys = nil
+	if err := r.saveLocked(); err != nil {
+		u.APIKeys = prev
+		return err
+	}
+	return nil
+}
+
+func (r *Registry) saveLocked() error {
+	if r.file == "" {
+		return nil
+	}
+	users := make([]*User, 0, len(r.users))
+	for _, u := range r.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+	data, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// The file holds password hashes, so keep it private
+	tmp, err := os.CreateTemp(filepath.Dir(r.file), filepath.Base(r.file)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), r.file)
+}
+
+// validate checks categories and patterns, each pattern with the grammar
+// it is matched with: matchKey for keys and path.Match for namespaces
+func validate(cats []Category, keys, namespaces []string) error {
+	for _, c := range cats {
+		if c == All {
+			continue
+		}
+		known := false
+		for _, k := range categories {
+			if c == k {
+				known = true
+			}
+		}
+		if !known {
+			return fmt.Errorf("%w: %s", ErrUnknownCategory, c)
+		}
+	}
+	for _, k := range keys {
+		if err := checkKeyPattern(k); err != nil {
+			return fmt.Errorf("%w: %q: %v", ErrInvalidPattern, k, err)
+		}
+	}
+	for _, ns := range namespaces {
+		if _, err := path.Match(ns, ""); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidPattern, ns)
+		}
+	}
+	return nil
+}
+
+func (u *User) clone() *User {
+	c := *u
+	c.Passwords = append([]string(nil), u.Passwords...)
+	c.APIKeys = append([]string(nil), u.APIKeys...)
+	c.Categories = append([]Category(nil), u.Categories...)
+	c.Keys = append([]string(nil), u.Keys...)
+	c.Namespaces = append([]string(nil), u.Namespaces...)
+	return &c
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func matchHash(hashes []string, secret string) bool {
+	h := []byte(hash(secret))
+	found := false
+	for _, candidate := range hashes {
+		if subtle.ConstantTimeCompare([]byte(candidate), h) == 1 {
+			found = true
+		}
+	}
+	return found
+}
+
+func hashPassword(password string) (string, error) {
+	if len(password) > MaxPasswordLen {
+		return "", fmt.Errorf("%w: longer than %d bytes", ErrInvalidPassword, MaxPasswordLen)
+	}
+	h, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidPassword, err)
+	}
+	return string(h), nil
+}
+
+// isLegacy reports whether a stored password hash is the SHA-256 hex that
+// older versions used instead of bcrypt
+func isLegacy(h string) bool {
+	return len(h) == 2*sha256.Size && !strings.HasPrefix(h, "$")
+}
+
+// dummyHash is compared against when there is no bcrypt hash to check a
+// password with
+var dummyHash = sync.OnceValue(func() []byte {
+	h, err := bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+	if err != nil {
+		panic(fmt.Sprintf("acl: hash dummy password: %v", err))
+	}
+	return h
+})
+
+// matchPassword returns the hash in hashes that password matches, and
+// whether it is a legacy hash. When it finds no match it has always run at
+// least one bcrypt comparison, whatever hashes holds.
+func (r *Registry) matchPassword(hashes []string, password string) (string, bool) {
+	sum := sha256.Sum256([]byte(password))
+	compared := false
+	for _, h := range hashes {
+		if isLegacy(h) {
+			if matchHash([]string{h}, password) {
+				return h, true
+			}
+			continue
+		}
+		r.verifiedMu.Lock()
+		seen, ok := r.verified[h]
+		r.verifiedMu.Unlock()
+		if ok && subtle.ConstantTimeCompare(seen[:], sum[:]) == 1 {
+			return h, false
+		}
+		compared = true
+		if bcrypt.CompareHashAndPassword([]byte(h), []byte(password)) == nil {
+			r.verifiedMu.Lock()
+			if r.verified == nil {
+				r.verified = make(map[string][sha256.Size]byte)
+			}
+			r.verified[h] = sum
+			r.verifiedMu.Unlock()
+			return h, false
+		}
+	}
+	if !compared {
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+	}
+	return "", false
+}
+
+// forget drops the verified passwords of hashes that are no longer stored
+func (r *Registry) forget(hashes []string) {
+	r.verifiedMu.Lock()
+	defer r.verifiedMu.Unlock()
+	for _, h := range hashes {
+		delete(r.verified, h)
+	}
+}
+
+// upgradePassword replaces the legacy hash of a user's password with a
+// bcrypt one. If that fails the legacy hash is kept, as it still works.
+func (r *Registry) upgradePassword(name, legacy, password string) {
+	h, err := hashPassword(password)
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.users[name]
+	if !ok {
+		return
+	}
+	for i, p := range u.Passwords {
+		if p == legacy {
+			prev := u.Passwords
+			u.Passwords = append([]string(nil), prev...)
+			u.Passwords[i] = h
+			if err := r.saveLocked(); err != nil {
+				u.Passwords = prev
+			}
+			return
+		}
+	}
+}
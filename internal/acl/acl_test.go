@@ -0,0 +1,89 @@
+package acl
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestKeyPatterns(t *testing.T) {
+	tests := []struct {
+		pattern string
+		valid   bool
+		match   []string
+		miss    []string
+	}{
+		{"user:*", true, []string{"user:", "user:1/2"}, []string{"users"}},
+		{"a?c", true, []string{"abc", "a/c"}, []string{"ac"}},
+		{"[a-c]x", true, []string{"ax", "cx"}, []string{"dx"}},
+		{"[^a]x", true, []string{"bx"}, []string{"ax"}},
+		{"\\[x\\]", true, []string{"[x]"}, []string{"x"}},
+		{"[\\]]", true, []string{"]"}, []string{"\\"}},
+		// path.Match rejects a trailing "\", matchKey matches it literally
+		{"dir\\", true, []string{"dir\\"}, []string{"dir"}},
+		{"\xff*", true, []string{"\xff\xfe"}, []string{"\xfe"}},
+		// Sets that are never closed
+		{"[a", false, nil, nil},
+		{"x[^", false, nil, nil},
+		{"[a\\]", false, nil, nil},
+	}
+	r := New()
+	for _, tt := range tests {
+		_, err := r.SetUser("u", Spec{Enabled: true, NoPass: true, Categories: []Category{All}, Keys: []string{tt.pattern}})
+		if tt.valid != (err == nil) {
+			t.Errorf("SetUser with key pattern %q: err = %v, want valid %v", tt.pattern, err, tt.valid)
+			continue
+		}
+		if err != nil {
+			if !errors.Is(err, ErrInvalidPattern) {
+				t.Errorf("pattern %q: err = %v, want ErrInvalidPattern", tt.pattern, err)
+			}
+			continue
+		}
+		u, _ := r.Lookup("u")
+		for _, key := range tt.match {
+			if !u.CanAccess(key) {
+				t.Errorf("pattern %q does not match %q", tt.pattern, key)
+			}
+		}
+		for _, key := range tt.miss {
+			if u.CanAccess(key) {
+				t.Errorf("pattern %q matches %q", tt.pattern, key)
+			}
+		}
+	}
+
+	if _, err := r.SetUser("u", Spec{Enabled: true, Namespaces: []string{"[a"}}); !errors.Is(err, ErrInvalidPattern) {
+		t.Errorf("namespace pattern %q: err = %v, want ErrInvalidPattern", "[a", err)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	r := New()
+	if _, err := r.SetUser("alice", Spec{Enabled: true, Passwords: []string{"secret"}, Categories: []Category{Read}, Keys: []string{"*"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.SetUser("nobody", Spec{Enabled: true, Categories: []Category{Read}, Keys: []string{"*"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Authenticate("alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	timeOf := func(name, password string) time.Duration {
+		start := time.Now()
+		if _, err := r.Authenticate(name, password); !errors.Is(err, ErrBadCredentials) {
+			t.Fatalf("Authenticate(%s, %s) = %v, want ErrBadCredentials", name, password, err)
+		}
+		return time.Since(start)
+	}
+	timeOf("ghost", "warm up") // hashes the dummy password
+	wrong := timeOf("alice", "wrong")
+	// An unknown user and a user without passwords still pay for bcrypt,
+	// so neither answers much faster than a wrong password
+	for _, name := range []string{"ghost", "nobody"} {
+		if d := timeOf(name, "wrong"); d < wrong/4 {
+			t.Errorf("rejecting %s took %v, a wrong password %v", name, d, wrong)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Package certs builds the server TLS configuration and reloads the
+// certificate, key and client CA bundle from disk without a restart.
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Client certificate policies
+const (
+	// ClientAuthNone does not ask for client certificates
+	ClientAuthNone = "none"
+	// ClientAuthVerify verifies a client certificate when one is sent
+	ClientAuthVerify = "verify"
+	// ClientAuthRequire rejects connections without a valid certificate
+	ClientAuthRequire = "require"
+)
+
+// Config names the files the TLS configuration is loaded from
+type Config struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is a PEM bundle of CAs that client certificates must
+	// chain to. It is required unless ClientAuth is ClientAuthNone.
+	ClientCAFile string
+	ClientAuth   string
+}
+
+// Reloader serves the most recently loaded certificate and CA pool
+type Reloader struct {
+	cfg Config
+	log *slog.Logger
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+	modTime time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New loads the files named in cfg
+func New(cfg Config, log *slog.Logger) (*Reloader, error) {
+	switch cfg.ClientAuth {
+	case "", ClientAuthNone:
+		cfg.ClientAuth = ClientAuthNone
+	case ClientAuthVerify, ClientAuthRequire:
+		if cfg.ClientCAFile == "" {
+			return nil, errors.New("tls: client certificate verification needs a client CA file")
+		}
+	default:
+		return nil, fmt.Errorf("tls: unknown client auth mode %q", cfg.ClientAuth)
+	}
+
+	r := &Reloader{cfg: cfg, log: log}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the certificate, key and client CAs again. On error the
+// previous ones stay in use.
+func (r *Reloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("tls: load key pair: %w", err)
+	}
+
+	var pool *x509.CertPool
+	if r.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("tls: read client CA: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("tls: no certificates in %s", r.cfg.ClientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert, r.pool, r.modTime = &cert, pool, r.latestModTime()
+	r.mu.Unlock()
+	return nil
+}
+
+// TLSConfig returns a server configuration that picks up reloaded files on
+// the next handshake
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				ClientCAs:    r.pool,
+			}
+			switch r.cfg.ClientAuth {
+			case ClientAuthVerify:
+				cfg.ClientAuth = tls.VerifyClientCertIfGiven
+			case ClientAuthRequire:
+				cfg.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			return cfg, nil
+		},
+	}
+}
+
+// Watch reloads the files whenever one of them changes, checking every
+// interval, until Stop is called
+func (r *Reloader) Watch(interval time.Duration) {
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	go func() {
+		defer close(r.done)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				r.mu.RLock()
+				changed := r.latestModTime().After(r.modTime)
+				r.mu.RUnlock()
+				if !changed {
+					continue
+				}
+				if err := r.Reload(); err != nil {
+					r.log.Error("reload certificates failed", "err", err)
+				} else {
+					r.log.Info("certificates reloaded")
+				}
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends Watch
+func (r *Reloader) Stop() {
+	if r.stop == nil {
+		return
+	}
+	close(r.stop)
+	<-r.done
+}
+
+func (r *Reloader) latestModTime() time.Time {
+	var latest time.Time
+	for _, f := range []string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.ClientCAFile} {
+		if f == "" {
+			continue
+		}
+		if fi, err := os.Stat(f); err == nil && fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest
+}
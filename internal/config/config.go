@@ -0,0 +1,270 @@
+// Package config loads server settings from defaults, a YAML or TOML file,
+// environment variables and command line flags, in increasing order of
+// precedence, and lets safe settings be changed while the server runs.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EnvPrefix is prepended to setting names to form environment variables,
+// e.g. expiry.interval is read from DATASTORE_EXPIRY_INTERVAL
+const EnvPrefix = "DATASTORE_"
+
+var (
+	ErrUnknownSetting = errors.New("unknown setting")
+	ErrImmutable      = errors.New("setting cannot be changed at runtime")
+	ErrNoConfigFile   = errors.New("server was started without a config file")
+	ErrConflict       = errors.New("conflicting settings")
+)
+
+// Config holds every server setting
+type Config struct {
+	Listen         string
+	GRPCListen     string
+	MemcacheListen string
+	MemcacheDB     string
+
+	ExpiryInterval time.Duration
+
+	PersistenceFile     string
+	PersistenceInterval time.Duration
+
+	MaxMemory      int64
+	EvictionPolicy string
+
+	LogFile             string
+	LogLevel            string
+	LogFormat           string
+	LogRedact           bool
+	LogSampleInitial    int
+	LogSampleThereafter int
+
+	ShutdownTimeout time.Duration
+
+	SlowLogThreshold time.Duration
+	SlowLogMaxLen    int
+
+	ACLFile   string
+	QuotaFile string
+
+	TLSCert           string
+	TLSKey            string
+	TLSClientCA       string
+	TLSClientAuth     string
+	TLSReloadInterval time.Duration
+
+	RaftID        string
+	RaftAddr      string
+	RaftAdvertise string
+	RaftDir       string
+	RaftPeers     string
+}
+
+// Default returns the settings used when nothing else is configured
+func Default() Config {
+	return Config{
+		Listen:              ":3000",
+		MemcacheDB:          "0",
+		ExpiryInterval:      5 * time.Second,
+		PersistenceInterval: time.Minute,
+		EvictionPolicy:      "noeviction",
+		LogLevel:            "info",
+		LogFormat:           "text",
+		LogRedact:           true,
+		LogSampleInitial:    100,
+		LogSampleThereafter: 100,
+		ShutdownTimeout:     10 * time.Second,
+		SlowLogThreshold:    10 * time.Millisecond,
+		SlowLogMaxLen:       128,
+		TLSClientAuth:       "none",
+		TLSReloadInterval:   30 * time.Second,
+		RaftAddr:            "127.0.0.1:7000",
+	}
+}
+
+// Manager owns the live configuration
+type Manager struct {
+	mu     sync.Mutex
+	cfg    Config
+	file   string
+	hooks  []func(Config)
+	format format
+}
+
+// Load builds the configuration from defaults, the file named by -config,
+// the environment and the remaining flags in args
+func Load(args []string) (*Manager, error) {
+	fs := flag.NewFlagSet("datastore", flag.ContinueOnError)
+	file := fs.String("config", "", "path to a YAML or TOML config file")
+	flagged := map[string]string{}
+	for _, s := range settings {
+		name := s.name
+		fs.Func(s.flagName(), s.usage, func(v string) error {
+			flagged[name] = v
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	m := &Manager{cfg: Default(), file: *file, format: formatOf(*file)}
+
+	if m.file != "" {
+		data, err := os.ReadFile(m.file)
+		if err != nil {
+			return nil, fmt.Errorf("read config: %w", err)
+		}
+		values, err := m.format.parse(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", m.file, err)
+		}
+		for name, v := range values {
+			if err := m.apply(name, v); err != nil {
+				return nil, fmt.Errorf("%s: %w", m.file, err)
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(s.envName()); ok {
+			if err := m.apply(s.name, v); err != nil {
+				return nil, fmt.Errorf("%s: %w", s.envName(), err)
+			}
+		}
+	}
+
+	for name, v := range flagged {
+		if err := m.apply(name, v); err != nil {
+			return nil, fmt.Errorf("-%s: %w", strings.ReplaceAll(name, ".", "-"), err)
+		}
+	}
+	// A replicated node rebuilds its state from the raft snapshot and log
+	// in raft.dir; loading a snapshot file first would apply the log on top
+	// of state that already holds it
+	if m.cfg.RaftID != "" && m.cfg.PersistenceFile != "" {
+		return nil, fmt.Errorf("%w: persistence.file cannot be used with raft.id", ErrConflict)
+	}
+	return m, nil
+}
+
+// Config returns a copy of the current settings
+func (m *Manager) Config() Config {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cfg
+}
+
+// OnChange registers fn to be called with the new settings after every
+// successful Set
+func (m *Manager) OnChange(fn func(Config)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, fn)
+}
+
+// Get returns the settings whose names match a glob pattern
+func (m *Manager) Get(pattern string) map[string]string {
+	if pattern == "" {
+		pattern = "*"
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := map[string]string{}
+	for _, s := range settings {
+		if ok, _ := path.Match(pattern, s.name); ok {
+			out[s.name] = s.get(&m.cfg)
+		}
+	}
+	return out
+}
+
+// Set changes a runtime-mutable setting
+func (m *Manager) Set(name, value string) error {
+	s, ok := lookup(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownSetting, name)
+	}
+	if !s.mutable {
+		return fmt.Errorf("%w: %s", ErrImmutable, name)
+	}
+
+	m.mu.Lock()
+	if s.replicated && m.cfg.RaftID != "" {
+		m.mu.Unlock()
+		// Members with different limits would evict and reject different
+		// writes while applying the same log
+		return fmt.Errorf("%w: %s must be the same on every raft member", ErrImmutable, name)
+	}
+	if err := s.set(&m.cfg, value); err != nil {
+		m.mu.Unlock()
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	cfg := m.cfg
+	hooks := append([]func(Config){}, m.hooks...)
+	m.mu.Unlock()
+
+	for _, fn := range hooks {
+		fn(cfg)
+	}
+	return nil
+}
+
+// Rewrite saves the current settings back to the config file the server
+// was started with. Settings equal to their default are left out.
+func (m *Manager) Rewrite() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.file == "" {
+		return ErrNoConfigFile
+	}
+
+	def := Default()
+	values := map[string]string{}
+	for _, s := range settings {
+		if v := s.get(&m.cfg); v != s.get(&def) {
+			values[s.name] = v
+		}
+	}
+
+	tmp := m.file + ".tmp"
+	if err := os.WriteFile(tmp, []byte(m.format.render(values)), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.file)
+}
+
+// File returns the path of the config file, if any
+func (m *Manager) File() string {
+	return m.file
+}
+
+func (m *Manager) apply(name, value string) error {
+	s, ok := lookup(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownSetting, name)
+	}
+	if err := s.set(&m.cfg, value); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSetReplicatedSettings(t *testing.T) {
+	for _, tt := range []struct {
+		args []string
+		want error
+	}{
+		{nil, nil},
+		{[]string{"-raft-id", "n1"}, ErrImmutable},
+	} {
+		m, err := Load(tt.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, value := range map[string]string{"memory.max": "1mb", "memory.policy": "volatile-ttl"} {
+			before := m.Get(name)[name]
+			err := m.Set(name, value)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("%v: Set(%s) = %v, want %v", tt.args, name, err, tt.want)
+			}
+			want := value
+			if tt.want != nil {
+				want = before
+			}
+			if got := m.Get(name)[name]; got != want {
+				t.Errorf("%v: %s = %q after Set, want %q", tt.args, name, got, want)
+			}
+		}
+		// Other runtime settings stay mutable
+		if err := m.Set("log.level", "debug"); err != nil {
+			t.Errorf("%v: Set(log.level) = %v", tt.args, err)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// format is a config file syntax. Only the subset needed for flat settings
+// grouped into sections is supported: scalars, nested maps, and lists of
+// scalars, which are joined with commas.
+type format int
+
+const (
+	formatYAML format = iota
+	formatTOML
+)
+
+func formatOf(file string) format {
+	if strings.EqualFold(filepath.Ext(file), ".toml") {
+		return formatTOML
+	}
+	return formatYAML
+}
+
+func (f format) parse(data string) (map[string]string, error) {
+	if f == formatTOML {
+		return parseTOML(data)
+	}
+	return parseYAML(data)
+}
+
+func (f format) render(values map[string]string) string {
+	if f == formatTOML {
+		return renderTOML(values)
+	}
+	return renderYAML(values)
+}
+
+func parseYAML(data string) (map[string]string, error) {
+	type level struct {
+		indent int
+		key    string
+	}
+	out := map[string]string{}
+	var stack []level
+	var listKey string
+
+	for n, raw := range strings.Split(data, "\n") {
+		line := strings.TrimRight(stripComment(raw), " \r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if lead := line[:len(line)-len(strings.TrimLeft(line, " \t"))]; strings.Contains(lead, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", n+1)
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "- ") {
+			if listKey == "" {
+				return nil, fmt.Errorf("line %d: list item without a key", n+1)
+			}
+			item := unquote(strings.TrimSpace(line[2:]))
+			if out[listKey] != "" {
+				item = out[listKey] + "," + item
+			}
+			out[listKey] = item
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key: value", n+1)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+
+		parts := make([]string, 0, len(stack)+1)
+		for _, l := range stack {
+			parts = append(parts, l.key)
+		}
+		full := strings.Join(append(parts, key), ".")
+
+		if value == "" {
+			stack = append(stack, level{indent: indent, key: key})
+			listKey = full
+			continue
+		}
+		listKey = ""
+		if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+			out[full] = inlineList(value)
+			continue
+		}
+		out[full] = unquote(value)
+	}
+	return out, nil
+}
+
+func parseTOML(data string) (map[string]string, error) {
+	out := map[string]string{}
+	section := ""
+	for n, raw := range strings.Split(data, "\n") {
+		line := strings.TrimSpace(stripComment(raw))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: unterminated table header", n+1)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", n+1)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if section != "" {
+			key = section + "." + key
+		}
+		if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+			out[key] = inlineList(value)
+			continue
+		}
+		out[key] = unquote(value)
+	}
+	return out, nil
+}
+
+func renderYAML(values map[string]string) string {
+	var b strings.Builder
+	section := ""
+	for _, name := range sortedKeys(values) {
+		head, key, nested := strings.Cut(name, ".")
+		if !nested {
+			if section != "" {
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(&b, "%s: %s\n", name, strconv.Quote(values[name]))
+			section = ""
+			continue
+		}
+		if head != section {
+			if b.Len() > 0 {
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(&b, "%s:\n", head)
+			section = head
+		}
+		fmt.Fprintf(&b, "  %s: %s\n", key, strconv.Quote(values[name]))
+	}
+	return b.String()
+}
+
+func renderTOML(values map[string]string) string {
+	var b strings.Builder
+	names := sortedKeys(values)
+	for _, name := range names {
+		if !strings.Contains(name, ".") {
+			fmt.Fprintf(&b, "%s = %s\n", name, strconv.Quote(values[name]))
+		}
+	}
+	section := ""
+	for _, name := range names {
+		head, key, nested := strings.Cut(name, ".")
+		if !nested {
+			continue
+		}
+		if head != section {
+			if b.Len() > 0 {
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(&b, "[%s]\n", head)
+			section = head
+		}
+		fmt.Fprintf(&b, "%s = %s\n", key, strconv.Quote(values[name]))
+	}
+	return b.String()
+}
+
+// stripComment removes a # comment that is not inside a quoted string
+func stripComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+		case quote == 0 && r == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func unquote(v string) string {
+	if len(v) >= 2 {
+		if v[0] == '"' && v[len(v)-1] == '"' {
+			if s, err := strconv.Unquote(v); err == nil {
+				return s
+			}
+		}
+		if v[0] == '\'' && v[len(v)-1] == '\'' {
+			return v[1 : len(v)-1]
+		}
+	}
+	return v
+}
+
+func inlineList(v string) string {
+	inner := strings.TrimSpace(v[1 : len(v)-1])
+	if inner == "" {
+		return ""
+	}
+	items := strings.Split(inner, ",")
+	for i, item := range items {
+		items[i] = unquote(strings.TrimSpace(item))
+	}
+	return strings.Join(items, ",")
+}
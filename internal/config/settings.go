@@ -0,0 +1,269 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setting describes one configurable value. Its name is used as the key in
+// config files (with dots separating sections), the CONFIG API and, with
+// dots replaced, as the flag and environment variable name.
+type setting struct {
+	name    string
+	usage   string
+	mutable bool
+	get     func(*Config) string
+	set     func(*Config, string) error
+
+	// replicated settings must be equal on every raft member, so they
+	// cannot be changed at runtime on a replicated node
+	replicated bool
+}
+
+func (s setting) flagName() string {
+	return strings.ReplaceAll(s.name, ".", "-")
+}
+
+func (s setting) envName() string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(s.name))
+}
+
+var settings = []setting{
+	stringSetting("listen", "HTTP listen address", false,
+		func(c *Config) *string { return &c.Listen }),
+	stringSetting("grpc.listen", "gRPC listen address (empty disables)", false,
+		func(c *Config) *string { return &c.GRPCListen }),
+	stringSetting("memcache.listen", "memcached protocol listen address (empty disables)", false,
+		func(c *Config) *string { return &c.MemcacheListen }),
+	stringSetting("memcache.db", "namespace served over the memcached protocol", false,
+		func(c *Config) *string { return &c.MemcacheDB }),
+	durationSetting("expiry.interval", "how often expired keys are removed", true,
+		func(c *Config) *time.Duration { return &c.ExpiryInterval }),
+	stringSetting("persistence.file", "snapshot file loaded at start and saved periodically (empty disables)", false,
+		func(c *Config) *string { return &c.PersistenceFile }),
+	durationSetting("persistence.interval", "how often the snapshot file is saved (0 saves only on shutdown)", true,
+		func(c *Config) *time.Duration { return &c.PersistenceInterval }),
+	{
+		name:    "memory.max",
+		usage:   "memory limit for stored data, e.g. 256mb (0 is unlimited)",
+		mutable: true,
+		get:     func(c *Config) string { return formatBytes(c.MaxMemory) },
+		set: func(c *Config, v string) error {
+			n, err := parseBytes(v)
+			if err != nil {
+				return err
+			}
+			c.MaxMemory = n
+			return nil
+		},
+		replicated: true,
+	},
+	{
+		name:    "memory.policy",
+		usage:   "what to do when memory.max is reached: noeviction or volatile-ttl",
+		mutable: true,
+		get:     func(c *Config) string { return c.EvictionPolicy },
+		set: func(c *Config, v string) error {
+			if v != "noeviction" && v != "volatile-ttl" {
+				return fmt.Errorf("unknown eviction policy %q", v)
+			}
+			c.EvictionPolicy = v
+			return nil
+		},
+		replicated: true,
+	},
+	stringSetting("log.file", "file logs are appended to (empty logs to stderr)", true,
+		func(c *Config) *string { return &c.LogFile }),
+	{
+		name:    "log.level",
+		usage:   "minimum level logged: debug, info, warn or error",
+		mutable: true,
+		get:     func(c *Config) string { return c.LogLevel },
+		set: func(c *Config, v string) error {
+			switch v = strings.ToLower(v); v {
+			case "debug", "info", "warn", "error":
+				c.LogLevel = v
+				return nil
+			}
+			return fmt.Errorf("unknown log level %q", v)
+		},
+	},
+	{
+		name:    "log.format",
+		usage:   "log output format: text or json",
+		mutable: false,
+		get:     func(c *Config) string { return c.LogFormat },
+		set: func(c *Config, v string) error {
+			if v != "text" && v != "json" {
+				return fmt.Errorf("unknown log format %q", v)
+			}
+			c.LogFormat = v
+			return nil
+		},
+	},
+	boolSetting("log.redact", "replace keys in logs with a short hash", true,
+		func(c *Config) *bool { return &c.LogRedact }),
+	intSetting("log.sample.initial", "debug and info records logged per message each second before sampling (0 disables sampling)", false,
+		func(c *Config) *int { return &c.LogSampleInitial }),
+	intSetting("log.sample.thereafter", "after the initial records, log every Nth record of the same message", false,
+		func(c *Config) *int { return &c.LogSampleThereafter }),
+	durationSetting("shutdown.timeout", "how long in-flight requests may take to finish on shutdown", true,
+		func(c *Config) *time.Duration { return &c.ShutdownTimeout }),
+	durationSetting("slowlog.threshold", "commands taking at least this long are added to the slow log", true,
+		func(c *Config) *time.Duration { return &c.SlowLogThreshold }),
+	intSetting("slowlog.max-len", "number of slow log entries kept (0 disables the slow log)", true,
+		func(c *Config) *int { return &c.SlowLogMaxLen }),
+	stringSetting("acl.file", "JSON file ACL users are loaded from and saved to (empty keeps users in memory)", false,
+		func(c *Config) *string { return &c.ACLFile }),
+	stringSetting("quota.file", "JSON file tenant quotas are loaded from and saved to (empty keeps them in memory)", false,
+		func(c *Config) *string { return &c.QuotaFile }),
+	stringSetting("tls.cert", "PEM certificate for the HTTP API; enables TLS together with tls.key", false,
+		func(c *Config) *string { return &c.TLSCert }),
+	stringSetting("tls.key", "PEM private key for tls.cert", false,
+		func(c *Config) *string { return &c.TLSKey }),
+	stringSetting("tls.client-ca", "PEM bundle of CAs client certificates must chain to", false,
+		func(c *Config) *string { return &c.TLSClientCA }),
+	{
+		name:    "tls.client-auth",
+		usage:   "client certificates: none, verify (when sent) or require",
+		mutable: false,
+		get:     func(c *Config) string { return c.TLSClientAuth },
+		set: func(c *Config, v string) error {
+			if v != "none" && v != "verify" && v != "require" {
+				return fmt.Errorf("unknown client auth mode %q", v)
+			}
+			c.TLSClientAuth = v
+			return nil
+		},
+	},
+	durationSetting("tls.reload-interval", "how often certificate files are checked for changes (0 only reloads on SIGHUP)", false,
+		func(c *Config) *time.Duration { return &c.TLSReloadInterval }),
+	stringSetting("raft.id", "node id; enables raft replication when set", false,
+		func(c *Config) *string { return &c.RaftID }),
+	stringSetting("raft.addr", "raft RPC listen address", false,
+		func(c *Config) *string { return &c.RaftAddr }),
+	stringSetting("raft.advertise", "API base URL other nodes redirect clients to", false,
+		func(c *Config) *string { return &c.RaftAdvertise }),
+	stringSetting("raft.dir", "directory for the raft log and snapshots (default raft-<id>)", false,
+		func(c *Config) *string { return &c.RaftDir }),
+	stringSetting("raft.peers", "initial members as id=host:port,... (empty to join an existing group)", false,
+		func(c *Config) *string { return &c.RaftPeers }),
+}
+
+func lookup(name string) (setting, bool) {
+	for _, s := range settings {
+		if s.name == name {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+func stringSetting(name, usage string, mutable bool, field func(*Config) *string) setting {
+	return setting{
+		name:    name,
+		usage:   usage,
+		mutable: mutable,
+		get:     func(c *Config) string { return *field(c) },
+		set: func(c *Config, v string) error {
+			*field(c) = v
+			return nil
+		},
+	}
+}
+
+func durationSetting(name, usage string, mutable bool, field func(*Config) *time.Duration) setting {
+	return setting{
+		name:    name,
+		usage:   usage,
+		mutable: mutable,
+		get:     func(c *Config) string { return field(c).String() },
+		set: func(c *Config, v string) error {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return err
+			}
+			if d < 0 {
+				return fmt.Errorf("duration must not be negative")
+			}
+			*field(c) = d
+			return nil
+		},
+	}
+}
+
+func intSetting(name, usage string, mutable bool, field func(*Config) *int) setting {
+	return setting{
+		name:    name,
+		usage:   usage,
+		mutable: mutable,
+		get:     func(c *Config) string { return strconv.Itoa(*field(c)) },
+		set: func(c *Config, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return err
+			}
+			if n < 0 {
+				return fmt.Errorf("value must not be negative")
+			}
+			*field(c) = n
+			return nil
+		},
+	}
+}
+
+func boolSetting(name, usage string, mutable bool, field func(*Config) *bool) setting {
+	return setting{
+		name:    name,
+		usage:   usage,
+		mutable: mutable,
+		get:     func(c *Config) string { return strconv.FormatBool(*field(c)) },
+		set: func(c *Config, v string) error {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return err
+			}
+			*field(c) = b
+			return nil
+		},
+	}
+}
+
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"gb", 1 << 30},
+	{"mb", 1 << 20},
+	{"kb", 1 << 10},
+	{"b", 1},
+}
+
+// parseBytes accepts a plain number of bytes or one suffixed with b, kb,
+// mb or gb
+func parseBytes(v string) (int64, error) {
+	s := strings.ToLower(strings.TrimSpace(v))
+	mult := int64(1)
+	for _, u := range byteUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mult = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", v)
+	}
+	return n * mult, nil
+}
+
+func formatBytes(n int64) string {
+	for _, u := range byteUnits {
+		if n != 0 && u.size > 1 && n%u.size == 0 {
+			return strconv.FormatInt(n/u.size, 10) + u.suffix
+		}
+	}
+	return strconv.FormatInt(n, 10)
+}
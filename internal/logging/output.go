@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// Output is an io.Writer that appends to a file, or stderr when no file is
+// set, and can be pointed at a different file while loggers are using it
+type Output struct {
+	mu   sync.Mutex
+	path string
+	w    io.Writer
+	file *os.File
+}
+
+func NewOutput() *Output {
+	return &Output{w: os.Stderr}
+}
+
+func (o *Output) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.w.Write(p)
+}
+
+// SetFile switches output to path, or back to stderr when path is empty
+func (o *Output) SetFile(path string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if path == o.path {
+		return nil
+	}
+
+	var f *os.File
+	var w io.Writer = os.Stderr
+	if path != "" {
+		var err error
+		f, err = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		w = f
+	}
+	if o.file != nil {
+		o.file.Close()
+	}
+	o.file, o.w, o.path = f, w, path
+	return nil
+}
+
+// Close closes the current log file, if any
+func (o *Output) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.file == nil {
+		return nil
+	}
+	err := o.file.Close()
+	o.file, o.w, o.path = nil, os.Stderr, ""
+	return err
+}
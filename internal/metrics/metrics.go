@@ -0,0 +1,340 @@
+// Package metrics implements the subset of Prometheus instrumentation the
+// server needs: counters, gauges and histograms with labels, rendered in
+// the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefBuckets are latency buckets in seconds, matching the Prometheus client
+// defaults
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metric is anything the registry can render
+type metric interface {
+	describe() (name, help, kind string)
+	write(w *bufio.Writer, name string)
+}
+
+// Registry holds metrics in registration order
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+	names   map[string]bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+func (r *Registry) register(m metric) {
+	name, _, _ := m.describe()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.names[name] = true
+	r.metrics = append(r.metrics, m)
+}
+
+// WriteTo renders every metric in the text exposition format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, m := range metrics {
+		name, help, kind := m.describe()
+		fmt.Fprintf(bw, "# HELP %s %s\n", name, escapeHelp(help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", name, kind)
+		m.write(bw, name)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ContentType is the media type of the text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d desc) describe() (string, string, string) {
+	return d.name, d.help, d.kind
+}
+
+// series keeps one child per distinct label value combination
+type series[T any] struct {
+	mu       sync.Mutex
+	children map[string]*T
+	values   map[string][]string
+	create   func() *T
+}
+
+func (s *series[T]) with(labels int, values []string) *T {
+	if len(values) != labels {
+		panic(fmt.Sprintf("metrics: got %d label values, want %d", len(values), labels))
+	}
+	key := strings.Join(values, "\xff")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.children[key]; ok {
+		return c
+	}
+	if s.children == nil {
+		s.children = make(map[string]*T)
+		s.values = make(map[string][]string)
+	}
+	c := s.create()
+	s.children[key] = c
+	// Callers may pass strings backed by reused buffers
+	owned := make([]string, len(values))
+	for i, v := range values {
+		owned[i] = strings.Clone(v)
+	}
+	s.values[key] = owned
+	return c
+}
+
+// each visits children sorted by label values so output is stable
+func (s *series[T]) each(fn func(values []string, c *T)) {
+	s.mu.Lock()
+	keys := make([]string, 0, len(s.children))
+	for k := range s.children {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	children := make([]*T, len(keys))
+	values := make([][]string, len(keys))
+	for i, k := range keys {
+		children[i], values[i] = s.children[k], s.values[k]
+	}
+	s.mu.Unlock()
+
+	for i := range keys {
+		fn(values[i], children[i])
+	}
+}
+
+// Counter is a monotonically increasing value
+type Counter struct {
+	bits atomic.Uint64
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+func (c *Counter) Add(v float64) {
+	for {
+		old := c.bits.Load()
+		if c.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+func (c *Counter) value() float64 {
+	return math.Float64frombits(c.bits.Load())
+}
+
+// CounterVec is a family of counters partitioned by labels
+type CounterVec struct {
+	desc
+	series[Counter]
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{desc: desc{name, help, "counter", labels}}
+	v.create = func() *Counter { return &Counter{} }
+	r.register(v)
+	return v
+}
+
+func (v *CounterVec) With(values ...string) *Counter {
+	return v.with(len(v.labels), values)
+}
+
+func (v *CounterVec) write(w *bufio.Writer, name string) {
+	v.each(func(values []string, c *Counter) {
+		writeSample(w, name, v.labels, values, "", "", c.value())
+	})
+}
+
+// Histogram counts observations into cumulative buckets
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+func (h *Histogram) write(w *bufio.Writer, name string, labels, values []string) {
+	h.mu.Lock()
+	counts := append([]uint64(nil), h.counts...)
+	count, sum := h.count, h.sum
+	h.mu.Unlock()
+
+	var cum uint64
+	for i, b := range h.buckets {
+		cum += counts[i]
+		writeSample(w, name+"_bucket", labels, values, "le", formatFloat(b), float64(cum))
+	}
+	writeSample(w, name+"_bucket", labels, values, "le", "+Inf", float64(count))
+	writeSample(w, name+"_sum", labels, values, "", "", sum)
+	writeSample(w, name+"_count", labels, values, "", "", float64(count))
+}
+
+// HistogramVec is a family of histograms partitioned by labels
+type HistogramVec struct {
+	desc
+	series[Histogram]
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	v := &HistogramVec{desc: desc{name, help, "histogram", labels}}
+	v.create = func() *Histogram { return newHistogram(buckets) }
+	r.register(v)
+	return v
+}
+
+func (v *HistogramVec) With(values ...string) *Histogram {
+	return v.with(len(v.labels), values)
+}
+
+func (v *HistogramVec) write(w *bufio.Writer, name string) {
+	v.each(func(values []string, h *Histogram) {
+		h.write(w, name, v.labels, values)
+	})
+}
+
+// Sample is one labelled value reported by a func metric
+type Sample struct {
+	Labels []string
+	Value  float64
+}
+
+// funcMetric reads its values when the registry is rendered. It is used for
+// state owned elsewhere, such as the number of keys in the store.
+type funcMetric struct {
+	desc
+	fn func() []Sample
+}
+
+// NewGaugeFunc registers a gauge whose samples are produced by fn at
+// scrape time. Each sample must carry one value per label.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() []Sample, labels ...string) {
+	r.register(&funcMetric{desc{name, help, "gauge", labels}, fn})
+}
+
+// NewCounterFunc is like NewGaugeFunc for values that only increase
+func (r *Registry) NewCounterFunc(name, help string, fn func() []Sample, labels ...string) {
+	r.register(&funcMetric{desc{name, help, "counter", labels}, fn})
+}
+
+func (m *funcMetric) write(w *bufio.Writer, name string) {
+	for _, s := range m.fn() {
+		writeSample(w, name, m.labels, s.Labels, "", "", s.Value)
+	}
+}
+
+// Value is a convenience for func metrics without labels
+func Value(v float64) []Sample {
+	return []Sample{{Value: v}}
+}
+
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraName, extraValue string, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			writeLabel(w, l, values[i])
+		}
+		if extraName != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			writeLabel(w, extraName, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func writeLabel(w *bufio.Writer, name, value string) {
+	w.WriteString(name)
+	w.WriteString(`="`)
+	w.WriteString(labelEscaper.Replace(value))
+	w.WriteByte('"')
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
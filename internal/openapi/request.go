@@ -0,0 +1,135 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"strings"
+)
+
+// Index finds the operation a request is for
+type Index struct {
+	routes []route
+}
+
+type route struct {
+	method   string
+	segments []string
+	literals int
+	op       *Operation
+}
+
+// NewIndex indexes the operations of doc by method and path
+func NewIndex(doc *Document) *Index {
+	ix := &Index{}
+	for path, item := range doc.Paths {
+		segments := strings.Split(strings.Trim(path, "/"), "/")
+		literals := 0
+		for _, s := range segments {
+			if !isParam(s) {
+				literals++
+			}
+		}
+		for method, op := range item {
+			ix.routes = append(ix.routes, route{strings.ToUpper(method), segments, literals, op})
+		}
+	}
+	return ix
+}
+
+func isParam(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+// Find returns the operation for a request, or nil if none matches. A path
+// parameter matches one segment; where several routes match, the one with
+// the most literal segments wins.
+func (ix *Index) Find(method, path string) *Operation {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	var best *route
+	for i := range ix.routes {
+		r := &ix.routes[i]
+		if r.method != method || len(r.segments) != len(segments) {
+			continue
+		}
+		if best != nil && best.literals >= r.literals {
+			continue
+		}
+		match := true
+		for j, s := range r.segments {
+			if !isParam(s) && s != segments[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			best = r
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return best.op
+}
+
+// ValidateQuery checks the query parameters of a request
+func (op *Operation) ValidateQuery(query map[string]string) error {
+	for _, p := range op.Parameters {
+		if p.In != "query" {
+			continue
+		}
+		// A flag given without a value counts as absent, as for fiber
+		v, ok := query[p.Name]
+		if !ok || v == "" {
+			if p.Required {
+				return invalid("query."+p.Name, "is required")
+			}
+			continue
+		}
+		if err := p.Schema.ValidateParam("query."+p.Name, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateBody checks the body of a request. Only JSON bodies are
+// checked; other content types the operation accepts are passed through.
+func (op *Operation) ValidateBody(contentType string, body []byte) error {
+	rb := op.RequestBody
+	if rb == nil {
+		return nil
+	}
+	media, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		media = ""
+	}
+	if media != "application/json" && media != "" {
+		if _, ok := rb.Content[media]; !ok {
+			return invalid("body", "content type %s is not accepted", media)
+		}
+		// A raw body is the value itself, which may be empty
+		return nil
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		if rb.Required {
+			return invalid("body", "is required")
+		}
+		return nil
+	}
+	if media == "" {
+		return nil
+	}
+	mt, ok := rb.Content["application/json"]
+	if !ok {
+		return invalid("body", "content type %s is not accepted", media)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return invalid("body", "is not valid JSON")
+	}
+	return mt.Schema.Validate("body", v)
+}
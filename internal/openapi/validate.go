@@ -0,0 +1,154 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ValidationError describes why a value does not match a schema
+type ValidationError struct {
+	// Field is where the value was found, e.g. "body.count" or "query.px"
+	Field  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Field + ": " + e.Reason
+}
+
+func invalid(field, format string, args ...interface{}) error {
+	return &ValidationError{Field: field, Reason: fmt.Sprintf(format, args...)}
+}
+
+// Validate checks v, as decoded by encoding/json, against the schema.
+// field names v in the error. Properties not in the schema are allowed,
+// as in JSON Schema.
+func (s *Schema) Validate(field string, v interface{}) error {
+	if s == nil || s.Ref != "" {
+		return nil
+	}
+	if v == nil {
+		if s.Nullable || s.Type == "" {
+			return nil
+		}
+		return invalid(field, "must not be null")
+	}
+	switch s.Type {
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return invalid(field, "must be a string")
+		}
+		if len(str) < s.MinLength {
+			return invalid(field, "must not be empty")
+		}
+		if len(s.Enum) > 0 && !contains(s.Enum, str) {
+			return invalid(field, "must be one of %s", strings.Join(s.Enum, ", "))
+		}
+	case "integer", "number":
+		n, ok := number(v)
+		if !ok {
+			return invalid(field, "must be %s", article(s.Type))
+		}
+		if s.Type == "integer" && n != math.Trunc(n) {
+			return invalid(field, "must be an integer")
+		}
+		if s.Minimum != nil && n < *s.Minimum {
+			return invalid(field, "must be at least %v", *s.Minimum)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return invalid(field, "must be a boolean")
+		}
+	case "array":
+		items, ok := v.([]interface{})
+		if !ok {
+			return invalid(field, "must be an array")
+		}
+		for i, item := range items {
+			if err := s.Items.Validate(fmt.Sprintf("%s[%d]", field, i), item); err != nil {
+				return err
+			}
+		}
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return invalid(field, "must be an object")
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return invalid(field+"."+name, "is required")
+			}
+		}
+		// Check in order so the first error is always the same one
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop := s.Properties[name]
+			if prop == nil {
+				prop = s.AdditionalProperties
+			}
+			if err := prop.Validate(field+"."+name, obj[name]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateParam checks a path, query or header parameter given as text
+func (s *Schema) ValidateParam(field, raw string) error {
+	if s == nil {
+		return nil
+	}
+	var v interface{} = raw
+	switch s.Type {
+	case "integer", "number":
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return invalid(field, "must be %s", article(s.Type))
+		}
+		v = n
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return invalid(field, "must be a boolean")
+		}
+		v = b
+	}
+	return s.Validate(field, v)
+}
+
+func article(t string) string {
+	if t == "integer" {
+		return "an integer"
+	}
+	return "a " + t
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,243 @@
+// Package quota holds the limits placed on tenants. A tenant is either a
+// namespace, which is limited in what it stores and how often it is
+// called, or an ACL user, which is only rate limited. Limits stored under
+// the name "*" apply to every tenant of that kind without its own entry.
+package quota
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/dhanushcrueiso/coding-test/internal/store"
+)
+
+// Kind is the type of a tenant
+type Kind string
+
+const (
+	Namespace Kind = "namespace"
+	User      Kind = "user"
+)
+
+// Default is the tenant name whose limits apply to tenants without their
+// own
+const Default = "*"
+
+var (
+	ErrUnknownKind = errors.New("tenant kind must be namespace or user")
+	ErrInvalid     = errors.New("limits must not be negative")
+	ErrNotFound    = errors.New("no limits set")
+)
+
+// Limits are the quotas for one tenant. Zero fields are unlimited. Storage
+// limits only apply to namespaces.
+type Limits struct {
+	store.Quota
+	RequestsPerSecond float64 `json:"requests_per_second,omitempty"`
+	// Burst is how many requests may be made at once after a quiet
+	// period. It defaults to one second's worth.
+	Burst int `json:"burst,omitempty"`
+}
+
+// Entry is one tenant's limits as listed by Registry.All
+type Entry struct {
+	Kind   Kind   `json:"kind"`
+	Name   string `json:"name"`
+	Limits Limits `json:"limits"`
+}
+
+type tenant struct {
+	kind Kind
+	name string
+}
+
+// Registry holds tenant limits and the request rate of every tenant, and
+// saves the limits to a file after every change when one is configured
+type Registry struct {
+	mu      sync.RWMutex
+	limits  map[tenant]Limits
+	buckets map[tenant]*bucket
+	file    string
+}
+
+func New() *Registry {
+	return &Registry{
+		limits:  make(map[tenant]Limits),
+		buckets: make(map[tenant]*bucket),
+	}
+}
+
+// Load reads limits from file and saves later changes back to it. A
+// missing file starts out empty.
+func Load(file string) (*Registry, error) {
+	r := New()
+	r.file = file
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", file, err)
+	}
+	for _, e := range entries {
+		if err := validate(e.Kind, e.Limits); err != nil {
+			return nil, fmt.Errorf("%s: %s %s: %w", file, e.Kind, e.Name, err)
+		}
+		r.limits[tenant{e.Kind, e.Name}] = e.Limits
+	}
+	return r, nil
+}
+
+// Get returns the limits for a tenant, falling back to the default for
+// its kind. It reports false if neither is set.
+func (r *Registry) Get(kind Kind, name string) (Limits, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.get(tenant{kind, name})
+}
+
+func (r *Registry) get(t tenant) (Limits, bool) {
+	if l, ok := r.limits[t]; ok {
+		return l, true
+	}
+	l, ok := r.limits[tenant{t.kind, Default}]
+	return l, ok
+}
+
+// StoreQuota returns the storage quota of a namespace, for store.WithQuotas
+func (r *Registry) StoreQuota(db string) store.Quota {
+	l, _ := r.Get(Namespace, db)
+	return l.Quota
+}
+
+// All returns every entry sorted by kind and name
+func (r *Registry) All() []Entry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]Entry, 0, len(r.limits))
+	for t, l := range r.limits {
+		out = append(out, Entry{Kind: t.kind, Name: t.name, Limits: l})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Kind != out[j].Kind {
+			return out[i].Kind < out[j].Kind
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// Set replaces the limits of a tenant. Its request rate starts over.
+func (r *Registry) Set(kind Kind, name string, l Limits) error {
+	if err := validate(kind, l); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := tenant{kind, name}
+	prev, had := r.limits[t]
+	r.limits[t] = l
+	if err := r.saveLocked(); err != nil {
+		if had {
+			r.limits[t] = prev
+		} else {
+			delete(r.limits, t)
+		}
+		return err
+	}
+	r.resetLocked(kind, name)
+	return nil
+}
+
+// Delete removes the limits of a tenant
+func (r *Registry) Delete(kind Kind, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := tenant{kind, name}
+	prev, ok := r.limits[t]
+	if !ok {
+		return fmt.Errorf("%w for %s %s", ErrNotFound, kind, name)
+	}
+	delete(r.limits, t)
+	if err := r.saveLocked(); err != nil {
+		r.limits[t] = prev
+		return err
+	}
+	r.resetLocked(kind, name)
+	return nil
+}
+
+// resetLocked drops rate state affected by a change to kind/name. A change
+// to the default affects every tenant of the kind.
+func (r *Registry) resetLocked(kind Kind, name string) {
+	for t := range r.buckets {
+		if t.kind == kind && (name == Default || t.name == name) {
+			delete(r.buckets, t)
+		}
+	}
+}
+
+func (r *Registry) saveLocked() error {
+	if r.file == "" {
+		return nil
+	}
+	entries := make([]Entry, 0, len(r.limits))
+	for t, l := range r.limits {
+		entries = append(entries, Entry{Kind: t.kind, Name: t.name, Limits: l})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Kind != entries[j].Kind {
+			return entries[i].Kind < entries[j].Kind
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(r.file), filepath.Base(r.file)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), r.file)
+}
+
+func validate(kind Kind, l Limits) error {
+	if kind != Namespace && kind != User {
+		return fmt.Errorf("%w: %q", ErrUnknownKind, kind)
+	}
+	if l.MaxKeys < 0 || l.MaxBytes < 0 || l.MaxValueSize < 0 || l.RequestsPerSecond < 0 || l.Burst < 0 {
+		return ErrInvalid
+	}
+	return nil
+}
+
+// ParseKind checks a tenant kind given in a URL
+func ParseKind(s string) (Kind, error) {
+	switch Kind(s) {
+	case Namespace, User:
+		return Kind(s), nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownKind, s)
+}
@@ -0,0 +1,78 @@
+package quota
+
+import (
+	"math"
+	"time"
+)
+
+// bucket is a token bucket refilled at the tenant's request rate
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimited is the error Allow returns when a tenant is over its limit
+type RateLimited struct {
+	Kind Kind
+	Name string
+	// Wait is how long until a request would be allowed
+	Wait time.Duration
+}
+
+func (e *RateLimited) Error() string {
+	return "rate limit exceeded for " + string(e.Kind) + " " + e.Name
+}
+
+// Allow takes one request from the rate limit of namespace db and, unless
+// user is empty, of that user. The request is only taken if both allow
+// it, so a request refused for the user leaves the namespace untouched.
+// Tenants without a rate limit are always allowed.
+func (r *Registry) Allow(db, user string, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tenants := []tenant{{Namespace, db}}
+	if user != "" {
+		tenants = append(tenants, tenant{User, user})
+	}
+	var take []*bucket
+	for _, t := range tenants {
+		b, l := r.bucketLocked(t, now)
+		if b == nil {
+			continue
+		}
+		if b.tokens < 1 {
+			wait := (1 - b.tokens) / l.RequestsPerSecond
+			return &RateLimited{Kind: t.kind, Name: t.name, Wait: time.Duration(wait * float64(time.Second))}
+		}
+		take = append(take, b)
+	}
+	for _, b := range take {
+		b.tokens--
+	}
+	return nil
+}
+
+// bucketLocked returns the bucket of t refilled up to now, or nil if t has
+// no rate limit
+func (r *Registry) bucketLocked(t tenant, now time.Time) (*bucket, Limits) {
+	l, ok := r.get(t)
+	if !ok || l.RequestsPerSecond <= 0 {
+		return nil, l
+	}
+	burst := float64(l.Burst)
+	if burst <= 0 {
+		burst = math.Max(1, math.Ceil(l.RequestsPerSecond))
+	}
+
+	b, ok := r.buckets[t]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		r.buckets[t] = b
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(burst, b.tokens+elapsed.Seconds()*l.RequestsPerSecond)
+		b.last = now
+	}
+	return b, l
+}
@@ -0,0 +1,1344 @@
+// Package raft implements the Raft consensus protocol used to replicate
+// store mutations across a small group of nodes. Entries are persisted to
+// disk before they are acknowledged, reads are made linearizable with the
+// read-index protocol and membership is changed one server at a time.
+package raft
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotLeader        = errors.New("raft: not the leader")
+	ErrNoLeader         = errors.New("raft: no leader elected")
+	ErrStopped          = errors.New("raft: node stopped")
+	ErrTimeout          = errors.New("raft: timed out waiting for commit")
+	ErrLeadershipLost   = errors.New("raft: leadership lost before entry was committed")
+	ErrConfigInProgress = errors.New("raft: a membership change is already in progress")
+	ErrUnknownServer    = errors.New("raft: server is not a member")
+)
+
+type State int
+
+const (
+	Follower State = iota
+	Candidate
+	Leader
+)
+
+func (s State) String() string {
+	switch s {
+	case Follower:
+		return "follower"
+	case Candidate:
+		return "candidate"
+	case Leader:
+		return "leader"
+	}
+	return "unknown"
+}
+
+type EntryType int
+
+const (
+	EntryCommand EntryType = iota
+	EntryNoop
+	EntryConfig
+)
+
+// Entry is a single record in the replicated log
+type Entry struct {
+	Index uint64    `json:"index"`
+	Term  uint64    `json:"term"`
+	Type  EntryType `json:"type"`
+	Data  []byte    `json:"data,omitempty"`
+}
+
+// Server identifies a member of the group
+type Server struct {
+	ID string `json:"id"`
+	// Addr is the host:port raft RPCs are sent to
+	Addr string `json:"addr"`
+	// API is the base URL of the member's client API, used for redirects
+	API string `json:"api,omitempty"`
+}
+
+// Configuration is the set of voting members
+type Configuration struct {
+	Servers []Server `json:"servers"`
+}
+
+func (c Configuration) find(id string) (Server, bool) {
+	for _, s := range c.Servers {
+		if s.ID == id {
+			return s, true
+		}
+	}
+	return Server{}, false
+}
+
+func (c Configuration) clone() Configuration {
+	servers := make([]Server, len(c.Servers))
+	copy(servers, c.Servers)
+	return Configuration{Servers: servers}
+}
+
+func (c Configuration) quorum() int {
+	return len(c.Servers)/2 + 1
+}
+
+// FSM is the replicated state machine. Apply must be deterministic: every
+// member applies the same entries in the same order and must end up in the
+// same state.
+type FSM interface {
+	Apply(data []byte) interface{}
+	Snapshot() ([]byte, error)
+	Restore(data []byte) error
+}
+
+// Config holds the settings of a single node
+type Config struct {
+	ID string
+	// RaftAddr is the address the node listens on for raft RPCs
+	RaftAddr string
+	// APIAddr is the client API base URL advertised to the other members
+	APIAddr string
+	// DataDir keeps the log, hard state and snapshots
+	DataDir string
+	// Peers is the initial membership, including this node. It is only used
+	// when DataDir holds no previous state. A node started without peers
+	// waits to be added to an existing group.
+	Peers []Server
+
+	HeartbeatInterval time.Duration
+	ElectionTimeout   time.Duration
+	// CommitTimeout bounds how long Propose and ReadBarrier wait
+	CommitTimeout time.Duration
+	// SnapshotThreshold is the number of applied entries after which the
+	// log is compacted into a snapshot
+	SnapshotThreshold uint64
+
+	// Logger receives the node's events. Defaults to slog.Default().
+	Logger *slog.Logger
+}
+
+func (c *Config) setDefaults() {
+	if c.Logger == nil {
+		c.Logger = slog.Default()
+	}
+	if c.HeartbeatInterval == 0 {
+		c.HeartbeatInterval = 50 * time.Millisecond
+	}
+	if c.ElectionTimeout == 0 {
+		c.ElectionTimeout = 500 * time.Millisecond
+	}
+	if c.CommitTimeout == 0 {
+		c.CommitTimeout = 5 * time.Second
+	}
+	if c.SnapshotThreshold == 0 {
+		c.SnapshotThreshold = 4096
+	}
+}
+
+type applyResult struct {
+	value interface{}
+	err   error
+}
+
+type waiter struct {
+	term uint64
+	ch   chan applyResult
+}
+
+// Node is one member of a raft group
+type Node struct {
+	cfg    Config
+	logger *slog.Logger
+	fsm    FSM
+	disk   *storage
+	trans  *transport
+
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	state       State
+	currentTerm uint64
+	votedFor    string
+	leaderID    string
+	leaderAPI   string
+	lastContact time.Time
+	timeout     time.Duration
+
+	// log[0] is a sentinel holding the index and term of the last entry
+	// covered by the snapshot
+	log            []Entry
+	snapshotConfig Configuration
+	config         Configuration
+	configIndex    uint64
+	// known remembers the address of every server seen in a configuration
+	// so the leader can keep replicating to a server it is removing
+	known       map[string]Server
+	commitIndex uint64
+	lastApplied uint64
+
+	// leader state
+	nextIndex  map[string]uint64
+	matchIndex map[string]uint64
+	lastAck    map[string]time.Time
+	ackSeq     map[string]uint64
+	hbSeq      uint64
+	noopIndex  uint64
+	replTrig   map[string]chan struct{}
+	leaderDone chan struct{}
+	waiters    map[uint64]*waiter
+
+	// applyMu serialises access to the FSM between the apply loop, snapshot
+	// creation and snapshot installation
+	applyMu sync.Mutex
+
+	listener net.Listener
+	server   *http.Server
+	stopCh   chan struct{}
+	stopped  bool
+	wg       sync.WaitGroup
+	rng      *rand.Rand
+}
+
+// NewNode restores the node's persisted state and prepares it to join the
+// group. Call Start to begin serving RPCs and participating in elections.
+func NewNode(cfg Config, fsm FSM) (*Node, error) {
+	cfg.setDefaults()
+	if cfg.ID == "" {
+		return nil, errors.New("raft: node id is required")
+	}
+
+	disk, err := openStorage(cfg.DataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &Node{
+		cfg:     cfg,
+		logger:  cfg.Logger.With("component", "raft", "node", cfg.ID),
+		fsm:     fsm,
+		disk:    disk,
+		trans:   newTransport(cfg.ElectionTimeout),
+		log:     []Entry{{}},
+		known:   make(map[string]Server),
+		waiters: make(map[uint64]*waiter),
+		stopCh:  make(chan struct{}),
+		rng:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	n.cond = sync.NewCond(&n.mu)
+
+	if err := n.restore(); err != nil {
+		disk.close()
+		return nil, err
+	}
+	return n, nil
+}
+
+func (n *Node) restore() error {
+	hs, err := n.disk.loadState()
+	if err != nil {
+		return fmt.Errorf("raft: load state: %w", err)
+	}
+	n.currentTerm, n.votedFor = hs.Term, hs.VotedFor
+
+	snap, err := n.disk.loadSnapshot()
+	if err != nil {
+		return fmt.Errorf("raft: load snapshot: %w", err)
+	}
+	if snap != nil {
+		if err := n.fsm.Restore(snap.Data); err != nil {
+			return fmt.Errorf("raft: restore snapshot: %w", err)
+		}
+		n.log = []Entry{{Index: snap.Index, Term: snap.Term}}
+		n.snapshotConfig = snap.Config
+		n.commitIndex = snap.Index
+		n.lastApplied = snap.Index
+	}
+
+	entries, err := n.disk.loadLog()
+	if err != nil {
+		return fmt.Errorf("raft: load log: %w", err)
+	}
+	for _, e := range entries {
+		if e.Index <= n.snapshotIndex() {
+			continue
+		}
+		if e.Index != n.lastIndex()+1 {
+			return fmt.Errorf("raft: log gap at index %d", e.Index)
+		}
+		n.log = append(n.log, e)
+	}
+
+	// A brand new node with a peer list bootstraps the initial membership as
+	// the first entry. Every initial member writes the identical entry so
+	// their logs agree from the start.
+	if snap == nil && len(entries) == 0 && hs.Term == 0 && len(n.cfg.Peers) > 0 {
+		data, err := json.Marshal(Configuration{Servers: n.cfg.Peers})
+		if err != nil {
+			return err
+		}
+		boot := Entry{Index: 1, Term: 0, Type: EntryConfig, Data: data}
+		if err := n.disk.appendLog([]Entry{boot}); err != nil {
+			return fmt.Errorf("raft: bootstrap: %w", err)
+		}
+		n.log = append(n.log, boot)
+		n.commitIndex = 1
+	}
+
+	n.recomputeConfigLocked()
+	return nil
+}
+
+// Start begins serving raft RPCs on the configured address and runs the
+// election timer and apply loop
+func (n *Node) Start() error {
+	ln, err := net.Listen("tcp", n.cfg.RaftAddr)
+	if err != nil {
+		return fmt.Errorf("raft: listen: %w", err)
+	}
+	n.listener = ln
+	n.server = &http.Server{Handler: n.Handler()}
+
+	n.mu.Lock()
+	n.lastContact = time.Now()
+	n.resetTimeoutLocked()
+	n.mu.Unlock()
+
+	n.wg.Add(3)
+	go func() {
+		defer n.wg.Done()
+		if err := n.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			n.logger.Error("rpc server failed", "err", err)
+		}
+	}()
+	go n.runTicker()
+	go n.runApply()
+	return nil
+}
+
+// Stop shuts the node down. Pending proposals fail with ErrStopped.
+func (n *Node) Stop() error {
+	n.mu.Lock()
+	if n.stopped {
+		n.mu.Unlock()
+		return nil
+	}
+	n.stopped = true
+	close(n.stopCh)
+	if n.leaderDone != nil {
+		close(n.leaderDone)
+		n.leaderDone = nil
+	}
+	for idx, w := range n.waiters {
+		w.ch <- applyResult{err: ErrStopped}
+		delete(n.waiters, idx)
+	}
+	n.cond.Broadcast()
+	n.mu.Unlock()
+
+	var err error
+	if n.server != nil {
+		err = n.server.Close()
+	}
+	n.wg.Wait()
+	if cerr := n.disk.close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Status is a point-in-time view of the node
+type Status struct {
+	ID            string   `json:"id"`
+	State         string   `json:"state"`
+	Term          uint64   `json:"term"`
+	LeaderID      string   `json:"leader_id"`
+	LeaderAPI     string   `json:"leader_api"`
+	CommitIndex   uint64   `json:"commit_index"`
+	LastApplied   uint64   `json:"last_applied"`
+	LastIndex     uint64   `json:"last_index"`
+	SnapshotIndex uint64   `json:"snapshot_index"`
+	Servers       []Server `json:"servers"`
+}
+
+func (n *Node) Status() Status {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return Status{
+		ID:            n.cfg.ID,
+		State:         n.state.String(),
+		Term:          n.currentTerm,
+		LeaderID:      n.leaderID,
+		LeaderAPI:     n.leaderAPI,
+		CommitIndex:   n.commitIndex,
+		LastApplied:   n.lastApplied,
+		LastIndex:     n.lastIndex(),
+		SnapshotIndex: n.snapshotIndex(),
+		Servers:       n.config.clone().Servers,
+	}
+}
+
+func (n *Node) IsLeader() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.state == Leader
+}
+
+// Leader returns the id and API address of the current leader, if known
+func (n *Node) Leader() (string, string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.leaderID, n.leaderAPI
+}
+
+// Propose appends data to the log and blocks until it has been committed
+// and applied, returning the value produced by the FSM
+func (n *Node) Propose(data []byte) (interface{}, error) {
+	n.mu.Lock()
+	if n.stopped {
+		n.mu.Unlock()
+		return nil, ErrStopped
+	}
+	if n.state != Leader {
+		n.mu.Unlock()
+		return nil, ErrNotLeader
+	}
+	e, err := n.appendLocked(EntryCommand, data)
+	if err != nil {
+		n.mu.Unlock()
+		return nil, err
+	}
+	w := &waiter{term: e.Term, ch: make(chan applyResult, 1)}
+	n.waiters[e.Index] = w
+	n.advanceCommitLocked()
+	n.triggerLocked()
+	n.mu.Unlock()
+
+	return n.wait(e.Index, w)
+}
+
+func (n *Node) wait(index uint64, w *waiter) (interface{}, error) {
+	timer := time.NewTimer(n.cfg.CommitTimeout)
+	defer timer.Stop()
+	select {
+	case r := <-w.ch:
+		return r.value, r.err
+	case <-timer.C:
+		n.mu.Lock()
+		if n.waiters[index] == w {
+			delete(n.waiters, index)
+		}
+		n.mu.Unlock()
+		return nil, ErrTimeout
+	}
+}
+
+// ReadBarrier blocks until this node has applied every entry that was
+// committed when the call was made, so that a read served afterwards from
+// the local state machine is linearizable. Followers ask the leader for its
+// commit index; the leader confirms it still holds a quorum first.
+func (n *Node) ReadBarrier() error {
+	ctx, cancel := context.WithTimeout(context.Background(), n.cfg.CommitTimeout)
+	defer cancel()
+
+	n.mu.Lock()
+	state := n.state
+	leader, known := n.known[n.leaderID]
+	n.mu.Unlock()
+
+	var index uint64
+	var err error
+	switch {
+	case state == Leader:
+		index, err = n.leaderReadIndex(ctx)
+	case !known:
+		return ErrNoLeader
+	default:
+		index, err = n.trans.readIndex(ctx, leader.Addr)
+	}
+	if err != nil {
+		return err
+	}
+
+	deadline, _ := ctx.Deadline()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for n.lastApplied < index {
+		if n.stopped {
+			return ErrStopped
+		}
+		if !n.waitLocked(deadline) {
+			return ErrTimeout
+		}
+	}
+	return nil
+}
+
+// leaderReadIndex returns the commit index once leadership has been
+// confirmed by a quorum heartbeat round
+func (n *Node) leaderReadIndex(ctx context.Context) (uint64, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(n.cfg.CommitTimeout)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.state != Leader {
+		return 0, ErrNotLeader
+	}
+	// The commit index is only known to be current once an entry from this
+	// term has been committed
+	for n.commitIndex < n.noopIndex {
+		if n.state != Leader {
+			return 0, ErrNotLeader
+		}
+		if !n.waitLocked(deadline) {
+			return 0, ErrTimeout
+		}
+	}
+	index := n.commitIndex
+
+	n.hbSeq++
+	target := n.hbSeq
+	n.triggerLocked()
+	for {
+		if n.state != Leader {
+			return 0, ErrNotLeader
+		}
+		acks := 0
+		for _, s := range n.config.Servers {
+			if s.ID == n.cfg.ID || n.ackSeq[s.ID] >= target {
+				acks++
+			}
+		}
+		if acks >= n.config.quorum() {
+			return index, nil
+		}
+		if !n.waitLocked(deadline) {
+			return 0, ErrTimeout
+		}
+	}
+}
+
+// AddServer adds a voting member. It must be called on the leader.
+func (n *Node) AddServer(s Server) error {
+	if s.ID == "" || s.Addr == "" {
+		return errors.New("raft: server id and addr are required")
+	}
+	return n.changeConfig(func(c Configuration) (Configuration, error) {
+		for i, existing := range c.Servers {
+			if existing.ID == s.ID {
+				c.Servers[i] = s
+				return c, nil
+			}
+		}
+		c.Servers = append(c.Servers, s)
+		return c, nil
+	})
+}
+
+// RemoveServer removes a member. A leader removing itself steps down once
+// the change has been committed.
+func (n *Node) RemoveServer(id string) error {
+	return n.changeConfig(func(c Configuration) (Configuration, error) {
+		for i, existing := range c.Servers {
+			if existing.ID == id {
+				c.Servers = append(c.Servers[:i], c.Servers[i+1:]...)
+				return c, nil
+			}
+		}
+		return c, ErrUnknownServer
+	})
+}
+
+func (n *Node) changeConfig(mutate func(Configuration) (Configuration, error)) error {
+	n.mu.Lock()
+	if n.state != Leader {
+		n.mu.Unlock()
+		return ErrNotLeader
+	}
+	if n.configIndex > n.commitIndex || n.commitIndex < n.noopIndex {
+		n.mu.Unlock()
+		return ErrConfigInProgress
+	}
+	next, err := mutate(n.config.clone())
+	if err != nil {
+		n.mu.Unlock()
+		return err
+	}
+	data, err := json.Marshal(next)
+	if err != nil {
+		n.mu.Unlock()
+		return err
+	}
+	e, err := n.appendLocked(EntryConfig, data)
+	if err != nil {
+		n.mu.Unlock()
+		return err
+	}
+	w := &waiter{term: e.Term, ch: make(chan applyResult, 1)}
+	n.waiters[e.Index] = w
+	n.advanceCommitLocked()
+	n.triggerLocked()
+	n.mu.Unlock()
+
+	_, err = n.wait(e.Index, w)
+	return err
+}
+
+func (n *Node) runTicker() {
+	defer n.wg.Done()
+	t := time.NewTicker(10 * time.Millisecond)
+	defer t.Stop()
+	for {
+		select {
+		case <-n.stopCh:
+			return
+		case <-t.C:
+			n.tick()
+		}
+	}
+}
+
+func (n *Node) tick() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.state == Leader {
+		// Step down when a quorum has not answered for a full election
+		// timeout so that clients are sent to a leader that can commit
+		acks := 0
+		for _, s := range n.config.Servers {
+			if s.ID == n.cfg.ID || time.Since(n.lastAck[s.ID]) < n.cfg.ElectionTimeout {
+				acks++
+			}
+		}
+		if acks < n.config.quorum() {
+			n.logger.Warn("lost contact with quorum, stepping down", "term", n.currentTerm)
+			n.becomeFollowerLocked(n.currentTerm)
+		}
+		return
+	}
+
+	if time.Since(n.lastContact) < n.timeout {
+		return
+	}
+	if _, voter := n.config.find(n.cfg.ID); !voter {
+		return
+	}
+	n.startElectionLocked()
+}
+
+func (n *Node) startElectionLocked() {
+	if n.stopped {
+		return
+	}
+	n.state = Candidate
+	n.currentTerm++
+	n.votedFor = n.cfg.ID
+	n.leaderID, n.leaderAPI = "", ""
+	n.lastContact = time.Now()
+	n.resetTimeoutLocked()
+	if err := n.persistStateLocked(); err != nil {
+		n.logger.Error("persist vote failed", "err", err)
+		return
+	}
+
+	term := n.currentTerm
+	req := &voteRequest{
+		Term:         term,
+		CandidateID:  n.cfg.ID,
+		LastLogIndex: n.lastIndex(),
+		LastLogTerm:  n.lastTerm(),
+	}
+	votes := 1
+	quorum := n.config.quorum()
+	n.logger.Info("starting election", "term", term)
+	if votes >= quorum {
+		n.becomeLeaderLocked()
+		return
+	}
+
+	for _, s := range n.config.Servers {
+		if s.ID == n.cfg.ID {
+			continue
+		}
+		// Stop waits for the vote requests so that a late vote cannot make
+		// a stopped node leader and write to its closed log
+		n.wg.Add(1)
+		go func(s Server) {
+			defer n.wg.Done()
+			resp, err := n.trans.requestVote(s.Addr, req)
+			if err != nil {
+				return
+			}
+			n.mu.Lock()
+			defer n.mu.Unlock()
+			if n.stopped {
+				return
+			}
+			if resp.Term > n.currentTerm {
+				n.becomeFollowerLocked(resp.Term)
+				return
+			}
+			if n.state != Candidate || n.currentTerm != term || !resp.Granted {
+				return
+			}
+			votes++
+			if votes >= quorum {
+				n.becomeLeaderLocked()
+			}
+		}(s)
+	}
+}
+
+func (n *Node) becomeLeaderLocked() {
+	n.logger.Info("became leader", "term", n.currentTerm)
+	n.state = Leader
+	n.leaderID, n.leaderAPI = n.cfg.ID, n.cfg.APIAddr
+	n.nextIndex = make(map[string]uint64)
+	n.matchIndex = make(map[string]uint64)
+	n.lastAck = make(map[string]time.Time)
+	n.ackSeq = make(map[string]uint64)
+	n.replTrig = make(map[string]chan struct{})
+	n.leaderDone = make(chan struct{})
+
+	e, err := n.appendLocked(EntryNoop, nil)
+	if err != nil {
+		n.logger.Error("append noop failed", "err", err)
+		n.becomeFollowerLocked(n.currentTerm)
+		return
+	}
+	n.noopIndex = e.Index
+	n.syncReplicatorsLocked()
+	n.advanceCommitLocked()
+	n.triggerLocked()
+}
+
+func (n *Node) becomeFollowerLocked(term uint64) {
+	if term > n.currentTerm {
+		n.currentTerm = term
+		n.votedFor = ""
+		n.leaderID, n.leaderAPI = "", ""
+		if err := n.persistStateLocked(); err != nil {
+			n.logger.Error("persist term failed", "err", err)
+		}
+	}
+	if n.state == Leader && n.leaderDone != nil {
+		close(n.leaderDone)
+		n.leaderDone = nil
+		n.replTrig = nil
+		n.leaderID, n.leaderAPI = "", ""
+	}
+	n.state = Follower
+	n.lastContact = time.Now()
+	n.resetTimeoutLocked()
+	n.cond.Broadcast()
+}
+
+// syncReplicatorsLocked starts a replication goroutine for every member
+// that does not have one yet
+func (n *Node) syncReplicatorsLocked() {
+	if n.state != Leader {
+		return
+	}
+	for _, s := range n.config.Servers {
+		if s.ID == n.cfg.ID {
+			continue
+		}
+		if _, ok := n.replTrig[s.ID]; ok {
+			continue
+		}
+		n.nextIndex[s.ID] = n.lastIndex() + 1
+		n.matchIndex[s.ID] = 0
+		n.lastAck[s.ID] = time.Now()
+		trig := make(chan struct{}, 1)
+		n.replTrig[s.ID] = trig
+		n.wg.Add(1)
+		go n.replicate(s.ID, trig, n.leaderDone)
+	}
+}
+
+func (n *Node) triggerLocked() {
+	for _, trig := range n.replTrig {
+		select {
+		case trig <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (n *Node) replicate(id string, trig chan struct{}, done chan struct{}) {
+	defer n.wg.Done()
+	t := time.NewTicker(n.cfg.HeartbeatInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-n.stopCh:
+			return
+		case <-done:
+			return
+		case <-t.C:
+		case <-trig:
+		}
+
+		n.mu.Lock()
+		current := n.replTrig[id] == trig
+		n.mu.Unlock()
+		if !current {
+			return
+		}
+		n.replicateOnce(id)
+	}
+}
+
+const maxEntriesPerAppend = 512
+
+func (n *Node) replicateOnce(id string) {
+	n.mu.Lock()
+	if n.state != Leader {
+		n.mu.Unlock()
+		return
+	}
+	peer, ok := n.known[id]
+	if !ok {
+		n.mu.Unlock()
+		return
+	}
+	term := n.currentTerm
+	seq := n.hbSeq
+	next := n.nextIndex[id]
+
+	if next <= n.snapshotIndex() {
+		n.mu.Unlock()
+		n.sendSnapshot(peer, term, seq)
+		return
+	}
+
+	prev := next - 1
+	req := &appendRequest{
+		Term:         term,
+		LeaderID:     n.cfg.ID,
+		LeaderAPI:    n.cfg.APIAddr,
+		PrevLogIndex: prev,
+		PrevLogTerm:  n.termAt(prev),
+		LeaderCommit: n.commitIndex,
+	}
+	if last := n.lastIndex(); next <= last {
+		end := last
+		if end-next+1 > maxEntriesPerAppend {
+			end = next + maxEntriesPerAppend - 1
+		}
+		req.Entries = append([]Entry(nil), n.slice(next, end)...)
+	}
+	n.mu.Unlock()
+
+	resp, err := n.trans.appendEntries(peer.Addr, req)
+	if err != nil {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if resp.Term > n.currentTerm {
+		n.becomeFollowerLocked(resp.Term)
+		return
+	}
+	if n.state != Leader || n.currentTerm != term {
+		return
+	}
+	n.lastAck[id] = time.Now()
+	if seq > n.ackSeq[id] {
+		n.ackSeq[id] = seq
+	}
+	if resp.Success {
+		match := prev + uint64(len(req.Entries))
+		if match > n.matchIndex[id] {
+			n.matchIndex[id] = match
+		}
+		n.nextIndex[id] = n.matchIndex[id] + 1
+		n.advanceCommitLocked()
+		if n.nextIndex[id] <= n.lastIndex() {
+			n.triggerPeerLocked(id)
+		}
+	} else {
+		next := resp.ConflictIndex
+		if next == 0 || next >= n.nextIndex[id] {
+			next = n.nextIndex[id] - 1
+		}
+		if next < 1 {
+			next = 1
+		}
+		n.nextIndex[id] = next
+		n.triggerPeerLocked(id)
+	}
+	n.cond.Broadcast()
+}
+
+func (n *Node) triggerPeerLocked(id string) {
+	if trig, ok := n.replTrig[id]; ok {
+		select {
+		case trig <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (n *Node) sendSnapshot(peer Server, term, seq uint64) {
+	n.applyMu.Lock()
+	snap, err := n.disk.loadSnapshot()
+	if err == nil && snap == nil {
+		// In-memory nodes have no snapshot on disk; take one now
+		snap, err = n.takeSnapshotLocked()
+	}
+	n.applyMu.Unlock()
+	if err != nil || snap == nil {
+		n.logger.Error("load snapshot failed", "peer", peer.ID, "err", err)
+		return
+	}
+
+	req := &snapshotRequest{Term: term, LeaderID: n.cfg.ID, LeaderAPI: n.cfg.APIAddr, Snapshot: snap}
+	resp, err := n.trans.installSnapshot(peer.Addr, req)
+	if err != nil {
+		n.logger.Warn("install snapshot failed", "peer", peer.ID, "err", err)
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if resp.Term > n.currentTerm {
+		n.becomeFollowerLocked(resp.Term)
+		return
+	}
+	if n.state != Leader || n.currentTerm != term {
+		return
+	}
+	n.lastAck[peer.ID] = time.Now()
+	if seq > n.ackSeq[peer.ID] {
+		n.ackSeq[peer.ID] = seq
+	}
+	if snap.Index > n.matchIndex[peer.ID] {
+		n.matchIndex[peer.ID] = snap.Index
+	}
+	n.nextIndex[peer.ID] = n.matchIndex[peer.ID] + 1
+	n.triggerPeerLocked(peer.ID)
+	n.cond.Broadcast()
+}
+
+// advanceCommitLocked moves the commit index to the highest entry of the
+// current term stored on a quorum
+func (n *Node) advanceCommitLocked() {
+	if n.state != Leader {
+		return
+	}
+	for idx := n.lastIndex(); idx > n.commitIndex; idx-- {
+		if n.termAt(idx) != n.currentTerm {
+			break
+		}
+		count := 0
+		for _, s := range n.config.Servers {
+			if s.ID == n.cfg.ID || n.matchIndex[s.ID] >= idx {
+				count++
+			}
+		}
+		if count >= n.config.quorum() {
+			n.commitIndex = idx
+			n.cond.Broadcast()
+			n.triggerLocked()
+			break
+		}
+	}
+}
+
+func (n *Node) handleAppendEntries(req *appendRequest) *appendResponse {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	resp := &appendResponse{Term: n.currentTerm}
+	if req.Term < n.currentTerm {
+		return resp
+	}
+	if req.Term > n.currentTerm || n.state != Follower {
+		n.becomeFollowerLocked(req.Term)
+	}
+	resp.Term = n.currentTerm
+	n.leaderID, n.leaderAPI = req.LeaderID, req.LeaderAPI
+	n.lastContact = time.Now()
+
+	prev, prevTerm, entries := req.PrevLogIndex, req.PrevLogTerm, req.Entries
+	if prev < n.snapshotIndex() {
+		// The start of the request is already covered by our snapshot
+		for len(entries) > 0 && entries[0].Index <= n.snapshotIndex() {
+			entries = entries[1:]
+		}
+		prev, prevTerm = n.snapshotIndex(), n.snapshotTerm()
+	}
+	if prev > n.lastIndex() {
+		resp.ConflictIndex = n.lastIndex() + 1
+		return resp
+	}
+	if n.termAt(prev) != prevTerm {
+		conflictTerm := n.termAt(prev)
+		idx := prev
+		for idx > n.snapshotIndex()+1 && n.termAt(idx-1) == conflictTerm {
+			idx--
+		}
+		resp.ConflictIndex = idx
+		return resp
+	}
+
+	truncated := false
+	var appended []Entry
+	for i, e := range entries {
+		if e.Index <= n.lastIndex() {
+			if n.termAt(e.Index) == e.Term {
+				continue
+			}
+			n.log = n.log[:e.Index-n.snapshotIndex()]
+			truncated = true
+		}
+		appended = entries[i:]
+		break
+	}
+	n.log = append(n.log, appended...)
+
+	var err error
+	if truncated {
+		err = n.disk.rewriteLog(n.log[1:])
+	} else {
+		err = n.disk.appendLog(appended)
+	}
+	if err != nil {
+		n.logger.Error("persist entries failed", "err", err)
+		return resp
+	}
+	if truncated || containsConfig(appended) {
+		n.recomputeConfigLocked()
+	}
+
+	if req.LeaderCommit > n.commitIndex {
+		last := prev + uint64(len(entries))
+		if req.LeaderCommit < last {
+			last = req.LeaderCommit
+		}
+		if last > n.commitIndex {
+			n.commitIndex = last
+			n.cond.Broadcast()
+		}
+	}
+	resp.Success = true
+	return resp
+}
+
+func (n *Node) handleRequestVote(req *voteRequest) *voteResponse {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	// Ignore candidates while a leader is known to be alive. This stops a
+	// removed or partitioned server from disrupting a healthy group.
+	if req.Term > n.currentTerm {
+		if n.state == Leader || (n.leaderID != "" && time.Since(n.lastContact) < n.cfg.ElectionTimeout) {
+			return &voteResponse{Term: n.currentTerm}
+		}
+		n.becomeFollowerLocked(req.Term)
+	}
+
+	resp := &voteResponse{Term: n.currentTerm}
+	if req.Term < n.currentTerm {
+		return resp
+	}
+	upToDate := req.LastLogTerm > n.lastTerm() ||
+		(req.LastLogTerm == n.lastTerm() && req.LastLogIndex >= n.lastIndex())
+	if (n.votedFor == "" || n.votedFor == req.CandidateID) && upToDate {
+		n.votedFor = req.CandidateID
+		if err := n.persistStateLocked(); err != nil {
+			n.logger.Error("persist vote failed", "err", err)
+			return resp
+		}
+		n.lastContact = time.Now()
+		resp.Granted = true
+	}
+	return resp
+}
+
+func (n *Node) handleInstallSnapshot(req *snapshotRequest) (*snapshotResponse, error) {
+	n.applyMu.Lock()
+	defer n.applyMu.Unlock()
+
+	n.mu.Lock()
+	resp := &snapshotResponse{Term: n.currentTerm}
+	if req.Term < n.currentTerm {
+		n.mu.Unlock()
+		return resp, nil
+	}
+	if req.Term > n.currentTerm || n.state != Follower {
+		n.becomeFollowerLocked(req.Term)
+	}
+	resp.Term = n.currentTerm
+	n.leaderID, n.leaderAPI = req.LeaderID, req.LeaderAPI
+	n.lastContact = time.Now()
+	snap := req.Snapshot
+	if snap == nil || snap.Index <= n.lastApplied {
+		n.mu.Unlock()
+		return resp, nil
+	}
+	n.mu.Unlock()
+
+	if err := n.fsm.Restore(snap.Data); err != nil {
+		return nil, fmt.Errorf("restore snapshot: %w", err)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if snap.Index <= n.lastIndex() && n.termAt(snap.Index) == snap.Term {
+		n.log = append([]Entry{{Index: snap.Index, Term: snap.Term}}, n.log[snap.Index-n.snapshotIndex()+1:]...)
+	} else {
+		n.log = []Entry{{Index: snap.Index, Term: snap.Term}}
+	}
+	n.snapshotConfig = snap.Config
+	n.recomputeConfigLocked()
+	if snap.Index > n.commitIndex {
+		n.commitIndex = snap.Index
+	}
+	n.lastApplied = snap.Index
+	n.cond.Broadcast()
+
+	if err := n.disk.saveSnapshot(snap); err != nil {
+		return nil, err
+	}
+	if err := n.disk.rewriteLog(n.log[1:]); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (n *Node) runApply() {
+	defer n.wg.Done()
+	for {
+		n.mu.Lock()
+		for n.lastApplied >= n.commitIndex && !n.stopped {
+			n.cond.Wait()
+		}
+		if n.stopped {
+			n.mu.Unlock()
+			return
+		}
+		n.mu.Unlock()
+
+		n.applyMu.Lock()
+		n.mu.Lock()
+		var entries []Entry
+		if n.lastApplied < n.commitIndex && n.lastApplied >= n.snapshotIndex() {
+			entries = append(entries, n.slice(n.lastApplied+1, n.commitIndex)...)
+		}
+		n.mu.Unlock()
+
+		for _, e := range entries {
+			var value interface{}
+			if e.Type == EntryCommand {
+				value = n.fsm.Apply(e.Data)
+			}
+
+			n.mu.Lock()
+			n.lastApplied = e.Index
+			if w, ok := n.waiters[e.Index]; ok {
+				delete(n.waiters, e.Index)
+				if w.term == e.Term {
+					w.ch <- applyResult{value: value}
+				} else {
+					w.ch <- applyResult{err: ErrLeadershipLost}
+				}
+			}
+			if e.Type == EntryConfig && e.Index == n.configIndex {
+				n.configCommittedLocked()
+			}
+			n.cond.Broadcast()
+			n.mu.Unlock()
+		}
+
+		if err := n.maybeSnapshotLocked(); err != nil {
+			n.logger.Error("snapshot failed", "err", err)
+		}
+		n.applyMu.Unlock()
+	}
+}
+
+// configCommittedLocked runs once the latest membership change is applied.
+// Replication to removed servers stops and a removed leader steps down.
+func (n *Node) configCommittedLocked() {
+	if n.state != Leader {
+		return
+	}
+	for id := range n.replTrig {
+		if _, ok := n.config.find(id); !ok {
+			delete(n.replTrig, id)
+		}
+	}
+	if _, ok := n.config.find(n.cfg.ID); !ok {
+		n.logger.Info("removed from configuration, stepping down")
+		n.becomeFollowerLocked(n.currentTerm)
+	}
+}
+
+// maybeSnapshotLocked compacts the log once enough entries have been
+// applied. The caller must hold applyMu.
+func (n *Node) maybeSnapshotLocked() error {
+	n.mu.Lock()
+	due := n.lastApplied-n.snapshotIndex() >= n.cfg.SnapshotThreshold
+	n.mu.Unlock()
+	if !due {
+		return nil
+	}
+	_, err := n.takeSnapshotLocked()
+	return err
+}
+
+// takeSnapshotLocked captures the FSM at lastApplied, persists it and
+// discards the log prefix it covers. The caller must hold applyMu.
+func (n *Node) takeSnapshotLocked() (*snapshot, error) {
+	data, err := n.fsm.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	index := n.lastApplied
+	snap := &snapshot{
+		Index:  index,
+		Term:   n.termAt(index),
+		Config: n.configAtLocked(index),
+		Data:   data,
+	}
+	if err := n.disk.saveSnapshot(snap); err != nil {
+		return nil, err
+	}
+	n.log = append([]Entry{{Index: snap.Index, Term: snap.Term}}, n.log[index-n.snapshotIndex()+1:]...)
+	n.snapshotConfig = snap.Config
+	if err := n.disk.rewriteLog(n.log[1:]); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+func (n *Node) appendLocked(t EntryType, data []byte) (Entry, error) {
+	e := Entry{Index: n.lastIndex() + 1, Term: n.currentTerm, Type: t, Data: data}
+	if err := n.disk.appendLog([]Entry{e}); err != nil {
+		return e, err
+	}
+	n.log = append(n.log, e)
+	if t == EntryConfig {
+		n.recomputeConfigLocked()
+		n.syncReplicatorsLocked()
+	}
+	return e, nil
+}
+
+// recomputeConfigLocked makes the newest configuration in the log, committed
+// or not, the active one
+func (n *Node) recomputeConfigLocked() {
+	for i := len(n.log) - 1; i > 0; i-- {
+		if n.log[i].Type != EntryConfig {
+			continue
+		}
+		var c Configuration
+		if err := json.Unmarshal(n.log[i].Data, &c); err != nil {
+			n.logger.Error("decode configuration failed", "index", n.log[i].Index, "err", err)
+			continue
+		}
+		n.setConfigLocked(c, n.log[i].Index)
+		return
+	}
+	n.setConfigLocked(n.snapshotConfig, n.snapshotIndex())
+}
+
+func (n *Node) setConfigLocked(c Configuration, index uint64) {
+	n.config = c
+	n.configIndex = index
+	for _, s := range c.Servers {
+		n.known[s.ID] = s
+	}
+}
+
+func (n *Node) configAtLocked(index uint64) Configuration {
+	for i := index; i > n.snapshotIndex(); i-- {
+		e := n.log[i-n.snapshotIndex()]
+		if e.Type != EntryConfig {
+			continue
+		}
+		var c Configuration
+		if err := json.Unmarshal(e.Data, &c); err == nil {
+			return c
+		}
+	}
+	return n.snapshotConfig
+}
+
+func (n *Node) persistStateLocked() error {
+	if n.stopped {
+		return ErrStopped
+	}
+	return n.disk.saveState(hardState{Term: n.currentTerm, VotedFor: n.votedFor})
+}
+
+func (n *Node) resetTimeoutLocked() {
+	n.timeout = n.cfg.ElectionTimeout + time.Duration(n.rng.Int63n(int64(n.cfg.ElectionTimeout)))
+}
+
+// waitLocked waits on the condition variable until it is signalled or the
+// deadline passes. It reports false once the deadline has passed.
+func (n *Node) waitLocked(deadline time.Time) bool {
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		return false
+	}
+	t := time.AfterFunc(remaining, func() {
+		n.mu.Lock()
+		n.cond.Broadcast()
+		n.mu.Unlock()
+	})
+	n.cond.Wait()
+	t.Stop()
+	return time.Now().Before(deadline)
+}
+
+func (n *Node) snapshotIndex() uint64 { return n.log[0].Index }
+func (n *Node) snapshotTerm() uint64  { return n.log[0].Term }
+func (n *Node) lastIndex() uint64     { return n.log[len(n.log)-1].Index }
+func (n *Node) lastTerm() uint64      { return n.log[len(n.log)-1].Term }
+
+func (n *Node) termAt(index uint64) uint64 {
+	if index < n.snapshotIndex() || index > n.lastIndex() {
+		return 0
+	}
+	return n.log[index-n.snapshotIndex()].Term
+}
+
+// slice returns the entries in [from, to]
+func (n *Node) slice(from, to uint64) []Entry {
+	off := n.snapshotIndex()
+	return n.log[from-off : to-off+1]
+}
+
+func containsConfig(entries []Entry) bool {
+	for _, e := range entries {
+		if e.Type == EntryConfig {
+			return true
+		}
+	}
+	return false
+}
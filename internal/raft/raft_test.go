@@ -0,0 +1,426 @@
+package raft
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// kv is a map FSM. Commands are "key=value".
+type kv struct {
+	mu       sync.Mutex
+	data     map[string]string
+	restores int
+}
+
+func newKV() *kv {
+	return &kv{data: make(map[string]string)}
+}
+
+func (f *kv) Apply(data []byte) interface{} {
+	k, v, _ := strings.Cut(string(data), "=")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.data[k] = v
+	return v
+}
+
+func (f *kv) Snapshot() ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return json.Marshal(f.data)
+}
+
+func (f *kv) Restore(data []byte) error {
+	m := make(map[string]string)
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.data = m
+	f.restores++
+	return nil
+}
+
+func (f *kv) get(k string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	v, ok := f.data[k]
+	return v, ok
+}
+
+func (f *kv) len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.data)
+}
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// cluster is a group of nodes on loopback ports, each with its own data
+// directory
+type cluster struct {
+	t     *testing.T
+	nodes map[string]*Node
+	fsms  map[string]*kv
+	cfgs  map[string]Config
+}
+
+func testConfig(t *testing.T, id, addr string, peers []Server) Config {
+	return Config{
+		ID:                id,
+		RaftAddr:          addr,
+		APIAddr:           "http://" + id,
+		DataDir:           t.TempDir(),
+		Peers:             peers,
+		HeartbeatInterval: 20 * time.Millisecond,
+		ElectionTimeout:   200 * time.Millisecond,
+		CommitTimeout:     2 * time.Second,
+		Logger:            slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+func newCluster(t *testing.T, size int, configure func(*Config)) *cluster {
+	t.Helper()
+	c := &cluster{t: t, nodes: make(map[string]*Node), fsms: make(map[string]*kv), cfgs: make(map[string]Config)}
+	var peers []Server
+	for i := 1; i <= size; i++ {
+		peers = append(peers, Server{ID: fmt.Sprintf("n%d", i), Addr: freeAddr(t)})
+	}
+	for _, p := range peers {
+		cfg := testConfig(t, p.ID, p.Addr, peers)
+		if configure != nil {
+			configure(&cfg)
+		}
+		c.start(cfg)
+	}
+	t.Cleanup(func() {
+		for _, n := range c.nodes {
+			n.Stop()
+		}
+	})
+	return c
+}
+
+// start creates and starts a node, restoring it from cfg.DataDir if it ran
+// before
+func (c *cluster) start(cfg Config) *Node {
+	c.t.Helper()
+	fsm := newKV()
+	n, err := NewNode(cfg, fsm)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err := n.Start(); err != nil {
+		c.t.Fatal(err)
+	}
+	c.nodes[cfg.ID], c.fsms[cfg.ID], c.cfgs[cfg.ID] = n, fsm, cfg
+	return n
+}
+
+func (c *cluster) stop(id string) {
+	c.t.Helper()
+	if err := c.nodes[id].Stop(); err != nil {
+		c.t.Fatal(err)
+	}
+	delete(c.nodes, id)
+}
+
+// leader waits until exactly one running node leads and every running
+// node agrees on it
+func (c *cluster) leader() *Node {
+	c.t.Helper()
+	var leader *Node
+	eventually(c.t, "a leader is elected", func() bool {
+		leader = nil
+		for _, n := range c.nodes {
+			if n.IsLeader() {
+				if leader != nil {
+					return false
+				}
+				leader = n
+			}
+		}
+		if leader == nil {
+			return false
+		}
+		for _, n := range c.nodes {
+			if id, _ := n.Leader(); id != leader.cfg.ID {
+				return false
+			}
+		}
+		return true
+	})
+	return leader
+}
+
+func (c *cluster) followers() []*Node {
+	var out []*Node
+	for _, n := range c.nodes {
+		if !n.IsLeader() {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting until %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func propose(t *testing.T, n *Node, cmd string) {
+	t.Helper()
+	if _, err := n.Propose([]byte(cmd)); err != nil {
+		t.Fatalf("propose %q: %v", cmd, err)
+	}
+}
+
+func TestElection(t *testing.T) {
+	c := newCluster(t, 3, nil)
+	first := c.leader()
+	term := first.Status().Term
+
+	c.stop(first.cfg.ID)
+	second := c.leader()
+	if second.cfg.ID == first.cfg.ID {
+		t.Fatal("stopped node is still the leader")
+	}
+	if got := second.Status().Term; got <= term {
+		t.Errorf("new leader's term = %d, want above %d", got, term)
+	}
+}
+
+// TestStopDuringElection stops a candidate while its vote requests are in
+// flight, and grants the votes only afterwards
+func TestStopDuringElection(t *testing.T) {
+	asked := make(chan struct{}, 1)
+	release := make(chan struct{})
+	var once sync.Once
+	granting := func() { once.Do(func() { close(release) }) }
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req voteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		select {
+		case asked <- struct{}{}:
+		default:
+		}
+		<-release
+		json.NewEncoder(w).Encode(voteResponse{Term: req.Term, Granted: true})
+	}))
+	defer peer.Close()
+	defer granting()
+
+	addr := strings.TrimPrefix(peer.URL, "http://")
+	self := Server{ID: "n1", Addr: freeAddr(t)}
+	n, err := NewNode(testConfig(t, self.ID, self.Addr, []Server{self, {ID: "n2", Addr: addr}, {ID: "n3", Addr: addr}}), newKV())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Start(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-asked:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no vote requested")
+	}
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- n.Stop() }()
+	select {
+	case err := <-stopped:
+		t.Fatalf("Stop returned (%v) while vote requests were in flight", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	granting()
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Stop did not return")
+	}
+	if n.IsLeader() {
+		t.Error("stopped node became leader on late votes")
+	}
+}
+
+func TestReplication(t *testing.T) {
+	c := newCluster(t, 3, nil)
+	leader := c.leader()
+
+	for i := 0; i < 20; i++ {
+		res, err := leader.Propose([]byte(fmt.Sprintf("k%d=v%d", i, i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf("v%d", i); res != want {
+			t.Fatalf("Propose returned %v, want %q", res, want)
+		}
+	}
+	for id, fsm := range c.fsms {
+		eventually(t, id+" applies every entry", func() bool { return fsm.len() == 20 })
+	}
+
+	for _, f := range c.followers() {
+		if _, err := f.Propose([]byte("x=y")); !errors.Is(err, ErrNotLeader) {
+			t.Errorf("Propose on follower %s: err = %v, want ErrNotLeader", f.cfg.ID, err)
+		}
+	}
+}
+
+func TestReadBarrier(t *testing.T) {
+	c := newCluster(t, 3, nil)
+	leader := c.leader()
+
+	// A read after the barrier sees every write committed before it, on any
+	// member
+	for i := 0; i < 20; i++ {
+		want := fmt.Sprint(i)
+		propose(t, leader, "k="+want)
+		for id, n := range c.nodes {
+			if err := n.ReadBarrier(); err != nil {
+				t.Fatalf("ReadBarrier on %s: %v", id, err)
+			}
+			if got, _ := c.fsms[id].get("k"); got != want {
+				t.Fatalf("%s read k = %q after the barrier, want %q", id, got, want)
+			}
+		}
+	}
+
+	// A leader cut off from the quorum must not serve reads
+	for _, f := range c.followers() {
+		c.stop(f.cfg.ID)
+	}
+	if err := leader.ReadBarrier(); err == nil {
+		t.Fatal("ReadBarrier succeeded on a leader without a quorum")
+	}
+}
+
+func TestSnapshotInstall(t *testing.T) {
+	c := newCluster(t, 3, func(cfg *Config) { cfg.SnapshotThreshold = 8 })
+	leader := c.leader()
+	propose(t, leader, "before=1")
+
+	lagging := c.followers()[0]
+	id := lagging.cfg.ID
+	eventually(t, id+" applies the first entry", func() bool {
+		_, ok := c.fsms[id].get("before")
+		return ok
+	})
+	stoppedAt := lagging.Status().LastIndex
+	c.stop(id)
+
+	for i := 0; i < 50; i++ {
+		propose(t, leader, fmt.Sprintf("k%d=%d", i, i))
+	}
+	eventually(t, "the leader compacts its log", func() bool {
+		return leader.Status().SnapshotIndex > stoppedAt
+	})
+
+	restarted := c.start(c.cfgs[id])
+	fsm := c.fsms[id]
+	eventually(t, id+" catches up", func() bool { return fsm.len() == 51 })
+	fsm.mu.Lock()
+	restores := fsm.restores
+	fsm.mu.Unlock()
+	if restores == 0 {
+		t.Error("lagging follower caught up without installing a snapshot")
+	}
+	if got := restarted.Status().SnapshotIndex; got <= stoppedAt {
+		t.Errorf("follower snapshot index = %d, want above %d", got, stoppedAt)
+	}
+
+	// It keeps following the log after the snapshot
+	propose(t, leader, "after=1")
+	eventually(t, id+" applies entries after the snapshot", func() bool {
+		_, ok := fsm.get("after")
+		return ok
+	})
+}
+
+func TestMembership(t *testing.T) {
+	c := newCluster(t, 3, nil)
+	leader := c.leader()
+	propose(t, leader, "a=1")
+
+	// A node started without peers waits to be added
+	cfg := testConfig(t, "n4", freeAddr(t), nil)
+	joined := c.start(cfg)
+	if err := leader.AddServer(Server{ID: "n4", Addr: cfg.RaftAddr}); err != nil {
+		t.Fatal(err)
+	}
+	propose(t, leader, "b=2")
+	eventually(t, "n4 replicates the log", func() bool {
+		_, a := c.fsms["n4"].get("a")
+		_, b := c.fsms["n4"].get("b")
+		return a && b
+	})
+	for id, n := range c.nodes {
+		eventually(t, id+" sees four members", func() bool { return len(n.Status().Servers) == 4 })
+	}
+	if id, _ := joined.Leader(); id != leader.cfg.ID {
+		t.Errorf("n4 follows %q, want %q", id, leader.cfg.ID)
+	}
+
+	if err := leader.RemoveServer("n4"); err != nil {
+		t.Fatal(err)
+	}
+	if err := leader.RemoveServer("n4"); !errors.Is(err, ErrUnknownServer) {
+		t.Errorf("removing n4 twice: err = %v, want ErrUnknownServer", err)
+	}
+	propose(t, leader, "c=3")
+	for id, n := range c.nodes {
+		if id == "n4" {
+			continue
+		}
+		eventually(t, id+" sees three members", func() bool { return len(n.Status().Servers) == 3 })
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := c.fsms["n4"].get("c"); ok {
+		t.Error("removed server still receives entries")
+	}
+	c.stop("n4")
+
+	// A leader that removes itself steps down and the rest elect a new one
+	old := leader.cfg.ID
+	if err := leader.RemoveServer(old); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, old+" steps down", func() bool { return !leader.IsLeader() })
+	c.stop(old)
+	next := c.leader()
+	propose(t, next, "d=4")
+	if got := len(next.Status().Servers); got != 2 {
+		t.Errorf("members after removing the leader = %d, want 2", got)
+	}
+}
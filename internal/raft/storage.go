@@ -0,0 +1,219 @@
+package raft
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	stateFile    = "state.json"
+	logFile      = "log.jsonl"
+	snapshotFile = "snapshot.json"
+)
+
+// snapshot is the on-disk and on-wire form of a compacted state machine
+type snapshot struct {
+	Index  uint64        `json:"index"`
+	Term   uint64        `json:"term"`
+	Config Configuration `json:"config"`
+	Data   []byte        `json:"data"`
+}
+
+type hardState struct {
+	Term     uint64 `json:"term"`
+	VotedFor string `json:"voted_for"`
+}
+
+// storage persists the raft hard state, log and latest snapshot under a
+// directory. Every write is fsynced before it returns so that a node which
+// acknowledged an entry still has it after a crash. An empty directory
+// keeps everything in memory, which is only suitable for experiments.
+type storage struct {
+	dir string
+	log *os.File
+}
+
+func openStorage(dir string) (*storage, error) {
+	s := &storage{dir: dir}
+	if dir == "" {
+		return s, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create raft dir: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, logFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open raft log: %w", err)
+	}
+	s.log = f
+	return s, nil
+}
+
+func (s *storage) close() error {
+	if s.log == nil {
+		return nil
+	}
+	return s.log.Close()
+}
+
+func (s *storage) loadState() (hardState, error) {
+	var st hardState
+	if s.dir == "" {
+		return st, nil
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, stateFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return st, err
+	}
+	err = json.Unmarshal(data, &st)
+	return st, err
+}
+
+func (s *storage) saveState(st hardState) error {
+	if s.dir == "" {
+		return nil
+	}
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return s.writeFile(stateFile, data)
+}
+
+// loadSnapshot returns nil when no snapshot has been taken yet
+func (s *storage) loadSnapshot() (*snapshot, error) {
+	if s.dir == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, snapshotFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("decode snapshot: %w", err)
+	}
+	return &snap, nil
+}
+
+func (s *storage) saveSnapshot(snap *snapshot) error {
+	if s.dir == "" {
+		return nil
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	return s.writeFile(snapshotFile, data)
+}
+
+// loadLog reads every entry from the log file. A torn final line left by a
+// crash in the middle of an append is ignored.
+func (s *storage) loadLog() ([]Entry, error) {
+	if s.dir == "" {
+		return nil, nil
+	}
+	f, err := os.Open(filepath.Join(s.dir, logFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			break
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+func (s *storage) appendLog(entries []Entry) error {
+	if s.dir == "" || len(entries) == 0 {
+		return nil
+	}
+	w := bufio.NewWriter(s.log)
+	enc := json.NewEncoder(w)
+	for i := range entries {
+		if err := enc.Encode(&entries[i]); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return s.log.Sync()
+}
+
+// rewriteLog atomically replaces the log file with the given entries. It is
+// used after truncating a conflicting suffix and after compaction.
+func (s *storage) rewriteLog(entries []Entry) error {
+	if s.dir == "" {
+		return nil
+	}
+	tmp := filepath.Join(s.dir, logFile+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for i := range entries {
+		if err := enc.Encode(&entries[i]); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	s.log.Close()
+	if err := os.Rename(tmp, filepath.Join(s.dir, logFile)); err != nil {
+		return err
+	}
+	s.log, err = os.OpenFile(filepath.Join(s.dir, logFile), os.O_APPEND|os.O_WRONLY, 0o644)
+	return err
+}
+
+func (s *storage) writeFile(name string, data []byte) error {
+	tmp := filepath.Join(s.dir, name+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.dir, name))
+}
@@ -0,0 +1,181 @@
+package raft
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+type appendRequest struct {
+	Term         uint64  `json:"term"`
+	LeaderID     string  `json:"leader_id"`
+	LeaderAPI    string  `json:"leader_api"`
+	PrevLogIndex uint64  `json:"prev_log_index"`
+	PrevLogTerm  uint64  `json:"prev_log_term"`
+	Entries      []Entry `json:"entries,omitempty"`
+	LeaderCommit uint64  `json:"leader_commit"`
+}
+
+type appendResponse struct {
+	Term    uint64 `json:"term"`
+	Success bool   `json:"success"`
+	// ConflictIndex tells the leader where to resume when Success is false
+	ConflictIndex uint64 `json:"conflict_index,omitempty"`
+}
+
+type voteRequest struct {
+	Term         uint64 `json:"term"`
+	CandidateID  string `json:"candidate_id"`
+	LastLogIndex uint64 `json:"last_log_index"`
+	LastLogTerm  uint64 `json:"last_log_term"`
+}
+
+type voteResponse struct {
+	Term    uint64 `json:"term"`
+	Granted bool   `json:"granted"`
+}
+
+type snapshotRequest struct {
+	Term      uint64    `json:"term"`
+	LeaderID  string    `json:"leader_id"`
+	LeaderAPI string    `json:"leader_api"`
+	Snapshot  *snapshot `json:"snapshot"`
+}
+
+type snapshotResponse struct {
+	Term uint64 `json:"term"`
+}
+
+type readIndexResponse struct {
+	Index uint64 `json:"index"`
+}
+
+// transport carries raft RPCs as JSON over plain HTTP
+type transport struct {
+	rpc      *http.Client
+	snapshot *http.Client
+}
+
+func newTransport(timeout time.Duration) *transport {
+	return &transport{
+		rpc:      &http.Client{Timeout: timeout},
+		snapshot: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (t *transport) appendEntries(addr string, req *appendRequest) (*appendResponse, error) {
+	var resp appendResponse
+	err := t.call(t.rpc, addr, "/raft/append", req, &resp)
+	return &resp, err
+}
+
+func (t *transport) requestVote(addr string, req *voteRequest) (*voteResponse, error) {
+	var resp voteResponse
+	err := t.call(t.rpc, addr, "/raft/vote", req, &resp)
+	return &resp, err
+}
+
+func (t *transport) installSnapshot(addr string, req *snapshotRequest) (*snapshotResponse, error) {
+	var resp snapshotResponse
+	err := t.call(t.snapshot, addr, "/raft/snapshot", req, &resp)
+	return &resp, err
+}
+
+func (t *transport) readIndex(ctx context.Context, addr string) (uint64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+addr+"/raft/readindex", nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := t.rpc.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return 0, fmt.Errorf("read index from %s: %s", addr, bytes.TrimSpace(body))
+	}
+	var out readIndexResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return 0, err
+	}
+	return out.Index, nil
+}
+
+func (t *transport) call(client *http.Client, addr, path string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post("http://"+addr+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s%s: status %d: %s", addr, path, resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Handler serves the raft RPC endpoints used by other members
+func (n *Node) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/raft/append", func(w http.ResponseWriter, r *http.Request) {
+		var req appendRequest
+		if !decodeRPC(w, r, &req) {
+			return
+		}
+		writeRPC(w, n.handleAppendEntries(&req))
+	})
+	mux.HandleFunc("/raft/vote", func(w http.ResponseWriter, r *http.Request) {
+		var req voteRequest
+		if !decodeRPC(w, r, &req) {
+			return
+		}
+		writeRPC(w, n.handleRequestVote(&req))
+	})
+	mux.HandleFunc("/raft/snapshot", func(w http.ResponseWriter, r *http.Request) {
+		var req snapshotRequest
+		if !decodeRPC(w, r, &req) {
+			return
+		}
+		resp, err := n.handleInstallSnapshot(&req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeRPC(w, resp)
+	})
+	mux.HandleFunc("/raft/readindex", func(w http.ResponseWriter, r *http.Request) {
+		index, err := n.leaderReadIndex(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		writeRPC(w, &readIndexResponse{Index: index})
+	})
+	return mux
+}
+
+func decodeRPC(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func writeRPC(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
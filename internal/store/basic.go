@@ -2,8 +2,11 @@ package store
 
 import (
 	"fmt"
+	"log/slog"
 	"sync"
 	"time"
+
+	"github.com/dhanushcrueiso/coding-test/internal/logging"
 )
 
 type DataType int
@@ -11,6 +14,10 @@ type DataType int
 const (
 	StringType DataType = iota
 	ListType
+	StreamType
+	QueueType
+	LockType
+	JSONType
 )
 
 // Item represents a stored item with expiration
@@ -18,25 +25,72 @@ type Item struct {
 	Type      DataType
 	Value     interface{}
 	ExpiresAt time.Time
+	// Version changes whenever the item is written, see put
+	Version uint64
+	// Flags are opaque client flags stored with strings for memcached
+	// clients
+	Flags uint32
 }
 
 type DataObj struct {
 	Mu     sync.RWMutex
-	Data   *DataMap
 	Timer  *time.Ticker
 	StopCh chan bool
+
+	// dbs holds one keyspace per namespace, see namespace.go
+	dbs map[string]*DataMap
+
+	closeOnce sync.Once
+	done      chan struct{}
+
+	replicator   Replicator
+	log          *slog.Logger
+	lockObserver func(mode string, wait time.Duration)
+	quotas       func(db string) Quota
+
+	// addSignal is closed when something is added that a blocked reader
+	// may be waiting for, see wait.go
+	addSignal chan struct{}
+	// fence is the last lock fencing token handed out, see lock.go
+	fence uint64
+	// broker delivers pub/sub messages, see pubsub.go
+	broker broker
+	// version is the last item version handed out, see memory.go
+	version uint64
+	// indexes holds the secondary indexes of each namespace by name, see
+	// index.go
+	indexes map[string]map[string]*searchIndex
+	// fullText holds the full-text indexes of each namespace by name, see
+	// fulltext.go
+	fullText map[string]map[string]*fullTextIndex
+
+	// memory accounting, see memory.go
+	used           int64
+	maxMemory      int64
+	evictionPolicy string
+	evicted        int64
+	expired        int64
+
+	lastCleanup         time.Time
+	lastCleanupDuration time.Duration
 }
 
 // IsExpired checks if an item is expired
 func (i *Item) IsExpired() bool {
+	return i.expiredAt(time.Now())
+}
+
+func (i *Item) expiredAt(now time.Time) bool {
 	if i.ExpiresAt.IsZero() {
 		return false
 	}
-	return time.Now().After(i.ExpiresAt)
+	return now.After(i.ExpiresAt)
 }
 
 type DataMap struct {
 	Data map[string]*Item
+	// used is the estimated size of Data, see memory.go
+	used int64
 }
 
 // NewDataMap creates a new data map instance
@@ -46,23 +100,60 @@ func NewDataMap() *DataMap {
 	}
 }
 
-func NewRedisMemoryStore() *DataObj {
+// DefaultCleanupInterval is how often expired keys are removed unless
+// changed with SetCleanupInterval
+const DefaultCleanupInterval = time.Second * 5
+
+// Option configures a DataObj created by NewRedisMemoryStore
+type Option func(*DataObj)
+
+// WithLogger sets the logger the store reports cleanup and persistence
+// events to. The default discards them.
+func WithLogger(l *slog.Logger) Option {
+	return func(s *DataObj) {
+		s.log = l.With("component", "store")
+	}
+}
+
+func NewRedisMemoryStore(opts ...Option) *DataObj {
 	s := &DataObj{
-		Data:   NewDataMap(),
+		dbs:    map[string]*DataMap{DefaultDB: NewDataMap()},
 		StopCh: make(chan bool),
+		done:   make(chan struct{}),
+		log:    logging.Discard(),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
 
-	s.Timer = time.NewTicker(time.Second * 5)
+	s.Timer = time.NewTicker(DefaultCleanupInterval)
 	go s.runCleanUp()
 
 	return s
 }
 
+// SetCleanupInterval changes how often expired keys are removed
+func (s *DataObj) SetCleanupInterval(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	s.Timer.Reset(d)
+}
+
+// Close stops the cleanup goroutine and waits for it to exit. It is safe to
+// call more than once.
+func (s *DataObj) Close() {
+	s.closeOnce.Do(func() {
+		close(s.StopCh)
+	})
+	<-s.done
+}
+
 func (s *DataObj) runCleanUp() {
+	defer close(s.done)
 	for {
 		select {
 		case <-s.Timer.C:
-			fmt.Println("cleaning expired items")
 			s.cleanExpired()
 		case <-s.StopCh:
 			s.Timer.Stop()
@@ -71,176 +162,327 @@ func (s *DataObj) runCleanUp() {
 	}
 }
 
+// cleanExpired removes the keys that have expired. The removal is a write
+// like any other: with a replicator attached the leader proposes it with
+// its clock and every replica drops the same keys in log order, while
+// followers, whose proposals fail, leave it to the leader. Deleting on each
+// node's own clock would let replicas disagree on which keys a command
+// finds.
 func (s *DataObj) cleanExpired() {
-	s.Mu.Lock()
-	defer s.Mu.Unlock()
-
-	now := time.Now()
-	fmt.Printf("Starting cleanup at %v, checking %d keys\n", now, len(s.Data.Data))
-
-	// Create a separate list of keys to delete to avoid map modification during iteration
-	keysToDelete := []string{}
-
-	for k, v := range s.Data.Data {
-		if !v.ExpiresAt.IsZero() && now.After(v.ExpiresAt) {
-			// Make a copy of the key string to prevent mutation
-			keyToDelete := string([]byte(k))
-			fmt.Printf("Key expired: '%s' (expires: %v, now: %v)\n", keyToDelete, v.ExpiresAt, now)
-			keysToDelete = append(keysToDelete, keyToDelete)
+	start := time.Now()
+	s.rlock()
+	due := s.anyExpired(start)
+	s.Mu.RUnlock()
+
+	removed := 0
+	if due {
+		res := s.exec(Command{Op: OpExpire})
+		if res.Err != nil {
+			s.log.Debug("expired keys not removed", "err", res.Err)
 		}
+		removed = res.N
 	}
 
-	// Now perform the actual deletion
-	for _, k := range keysToDelete {
-		fmt.Printf("Deleting key: '%s'\n", k)
-		delete(s.Data.Data, k)
+	s.lock()
+	defer s.Mu.Unlock()
+	s.lastCleanup = start
+	s.lastCleanupDuration = time.Since(start)
+	if removed == 0 {
+		return
+	}
+	remaining := 0
+	for _, m := range s.dbs {
+		remaining += len(m.Data)
+	}
+	s.log.Debug("expired keys removed",
+		"removed", removed,
+		"remaining", remaining,
+		"duration", s.lastCleanupDuration)
+}
 
-		// Verify deletion
-		if _, stillExists := s.Data.Data[k]; stillExists {
-			fmt.Printf("ERROR: Key '%s' still exists after deletion!\n", k)
-		} else {
-			fmt.Printf("Successfully deleted key: '%s'\n", k)
+// anyExpired reports whether a key has expired as of now. The caller must
+// hold s.Mu.
+func (s *DataObj) anyExpired(now time.Time) bool {
+	for _, m := range s.dbs {
+		for _, v := range m.Data {
+			if v.expiredAt(now) {
+				return true
+			}
 		}
 	}
+	return false
+}
 
-	fmt.Printf("Cleanup complete: %d keys deleted, %d keys remaining\n",
-		len(keysToDelete), len(s.Data.Data))
+func (s *DataObj) applyExpire(cmd Command) Result {
+	removed := 0
+	for db, m := range s.dbs {
+		for k, v := range m.Data {
+			if v.expiredAt(cmd.Now) {
+				s.log.Debug("key expired", "db", db, logging.KeyAttr, k, "expires_at", v.ExpiresAt)
+				s.del(db, k)
+				s.expired++
+				removed++
+			}
+		}
+	}
+	return Result{N: removed, OK: removed > 0}
 }
 
-func (s *DataObj) Set(key string, item string, ttl *time.Duration) error {
-	s.Mu.Lock()
-	defer s.Mu.Unlock()
-	var expiresAt time.Time
-	if ttl != nil && *ttl > 0 {
-		expiresAt = time.Now().Add(*ttl)
+func (d *DB) Set(key string, item string, ttl *time.Duration) error {
+	cmd := Command{Op: OpSet, DB: d.name, Key: key, Value: item}
+	if ttl != nil {
+		cmd.TTL = *ttl
 	}
+	return d.s.exec(cmd).Err
+}
 
-	fmt.Println(expiresAt)
+func (s *DataObj) applySet(cmd Command) Result {
+	// Commands from Set carry no args
+	var o SetOptions
+	if len(cmd.Args) > 0 {
+		if err := decodeArgs(cmd, &o); err != nil {
+			return Result{Err: err}
+		}
+	}
+	old, exists := s.live(cmd.DB, cmd.Key, cmd.Now)
+	if o.IfVersion != 0 {
+		switch {
+		case !exists:
+			return Result{Err: ErrNoSuchKey}
+		case old.Version != o.IfVersion:
+			return Result{Err: ErrVersionMismatch}
+		}
+	}
+	var res SetResult
+	if o.Get && exists {
+		if old.Type != StringType {
+			return Result{Err: ErrWrongType}
+		}
+		res.Old, res.Existed = old.Value.(string), true
+	}
+	if (o.NX && exists) || (o.XX && !exists) {
+		return Result{Data: res}
+	}
 
-	s.Data.Data[key] = &Item{
+	item := &Item{
 		Type:      StringType,
-		Value:     item,
-		ExpiresAt: expiresAt,
+		Value:     cmd.Value,
+		ExpiresAt: expiry(cmd.Now, cmd.TTL),
+		Flags:     o.Flags,
+	}
+	switch {
+	case o.KeepTTL && exists:
+		item.ExpiresAt = old.ExpiresAt
+	case !o.ExpireAt.IsZero():
+		item.ExpiresAt = o.ExpireAt
+	}
+	if err := s.admit(cmd, s.growth(cmd.DB, cmd.Key, item), len(cmd.Value)); err != nil {
+		return Result{Err: err}
 	}
-	fmt.Println(s.Data.Data[key])
-	return nil
+	if err := s.reserve(cmd); err != nil {
+		return Result{Err: err}
+	}
+	s.put(cmd.DB, cmd.Key, item)
+	res.Set, res.Version = true, item.Version
+	return Result{Data: res, OK: true}
 }
 
-func (s *DataObj) Get(key string) (interface{}, DataType, bool) {
-	s.Mu.Lock()
-	defer s.Mu.Unlock()
+func (d *DB) Get(key string) (interface{}, DataType, bool) {
+	value, dataType, _, found := d.GetVersioned(key)
+	return value, dataType, found
+}
+
+// GetVersioned is Get also returning the version of the key, which changes
+// whenever its value does
+func (d *DB) GetVersioned(key string) (interface{}, DataType, uint64, bool) {
+	d.s.lock()
+	defer d.s.Mu.Unlock()
 
-	item, found := s.Data.Data[key]
+	// Keys past their expiration count as missing before the cleanup loop
+	// removes them
+	item, found := d.s.live(d.name, key, time.Now())
 	if !found {
-		return nil, 0, false
+		return nil, 0, 0, false
 	}
-
-	// if item.IsExpired() {
-	// 	delete(s.Data.Data, key)
-	// 	return nil, 0, false
-	// }
-	return item.Value, item.Type, true
+	if st, ok := item.Value.(*Stream); ok {
+		// The stream keeps changing after the lock is released
+		return append([]StreamEntry{}, st.Entries...), item.Type, item.Version, true
+	}
+	if q, ok := item.Value.(*Queue); ok {
+		return q.list(), item.Type, item.Version, true
+	}
+	return item.Value, item.Type, item.Version, true
 }
 
-func (s *DataObj) Remove(key string) bool {
-	s.Mu.Lock()
-	defer s.Mu.Unlock()
+// Type returns the data type of key. It reports false if there is no such
+// key.
+func (d *DB) Type(key string) (DataType, bool) {
+	d.s.rlock()
+	defer d.s.Mu.RUnlock()
+	item, found := d.s.live(d.name, key, time.Now())
+	if !found {
+		return 0, false
+	}
+	return item.Type, true
+}
 
-	_, exists := s.Data.Data[key]
-	if exists {
-		delete(s.Data.Data, key)
-		return true
+// Version returns the version of key, which changes whenever its value
+// does. It reports false if there is no such key.
+func (d *DB) Version(key string) (uint64, bool) {
+	d.s.rlock()
+	defer d.s.Mu.RUnlock()
+	item, found := d.s.live(d.name, key, time.Now())
+	if !found {
+		return 0, false
 	}
-	return false
+	return item.Version, true
 }
 
-func (s *DataObj) Update(key string, value string) bool {
-	s.Mu.Lock()
-	defer s.Mu.Unlock()
+// Remove deletes key and reports whether it existed
+func (d *DB) Remove(key string) (bool, error) {
+	res := d.s.exec(Command{Op: OpRemove, DB: d.name, Key: key})
+	return res.OK, res.Err
+}
 
-	item, exists := s.Data.Data[key]
-	if !exists || item.IsExpired() {
-		return false
+// RemoveVersion removes key only if it is at version. It reports false if
+// there is no such key and returns ErrVersionMismatch if it has changed.
+func (d *DB) RemoveVersion(key string, version uint64) (bool, error) {
+	res := d.s.exec(withArgs(Command{Op: OpRemove, DB: d.name, Key: key}, removeArgs{IfVersion: version}))
+	return res.OK, res.Err
+}
+
+type removeArgs struct {
+	IfVersion uint64 `json:"if_version,omitempty"`
+}
+
+func (s *DataObj) applyRemove(cmd Command) Result {
+	// Commands from Remove carry no args
+	var o removeArgs
+	if len(cmd.Args) > 0 {
+		if err := decodeArgs(cmd, &o); err != nil {
+			return Result{Err: err}
+		}
+	}
+	if o.IfVersion != 0 {
+		item, exists := s.live(cmd.DB, cmd.Key, cmd.Now)
+		if !exists {
+			return Result{}
+		}
+		if item.Version != o.IfVersion {
+			return Result{Err: ErrVersionMismatch}
+		}
 	}
+	_, exists := s.keys(cmd.DB)[cmd.Key]
+	s.del(cmd.DB, cmd.Key)
+	return Result{OK: exists}
+}
 
-	if item.Type != StringType {
-		return false
+// Update replaces the value of an existing string key. It reports false
+// if there is no such key.
+func (d *DB) Update(key string, value string) (bool, error) {
+	_, ok, err := d.UpdateVersion(key, value, 0)
+	return ok, err
+}
+
+// UpdateVersion is Update that only replaces the value if the key is at
+// version, unless that is 0, and returns the new version. It returns
+// ErrVersionMismatch if the key has changed.
+func (d *DB) UpdateVersion(key, value string, version uint64) (uint64, bool, error) {
+	cmd := Command{Op: OpUpdate, DB: d.name, Key: key, Value: value}
+	if version != 0 {
+		cmd = withArgs(cmd, updateArgs{IfVersion: version})
 	}
+	res := d.s.exec(cmd)
+	v, _ := res.Data.(uint64)
+	return v, res.OK, res.Err
+}
 
-	item.Value = value
-	return true
+type updateArgs struct {
+	IfVersion uint64 `json:"if_version,omitempty"`
 }
 
-func (s *DataObj) GetTTL(key string) (time.Duration, bool) {
+func (s *DataObj) applyUpdate(cmd Command) Result {
+	// Commands from Update carry no args
+	var o updateArgs
+	if len(cmd.Args) > 0 {
+		if err := decodeArgs(cmd, &o); err != nil {
+			return Result{Err: err}
+		}
+	}
+	item, exists := s.live(cmd.DB, cmd.Key, cmd.Now)
+	if !exists {
+		return Result{}
+	}
 
-	s.Mu.Lock()
-	defer s.Mu.Unlock()
-	fmt.Println("Current keys in map:")
-	for k := range s.Data.Data {
-		fmt.Printf("  '%s' (bytes: %x)\n", k, []byte(k))
+	if item.Type != StringType {
+		return Result{}
+	}
+	if o.IfVersion != 0 && item.Version != o.IfVersion {
+		return Result{Err: ErrVersionMismatch}
+	}
+	updated := &Item{Type: StringType, Value: cmd.Value, ExpiresAt: item.ExpiresAt, Flags: item.Flags}
+	if err := s.admit(cmd, s.growth(cmd.DB, cmd.Key, updated), len(cmd.Value)); err != nil {
+		return Result{Err: err}
+	}
+	if err := s.reserve(cmd); err != nil {
+		return Result{Err: err}
 	}
-	// Create a defensive copy of the key
-	keyCopy := defensiveCopy(key)
 
-	fmt.Printf("GetTTL called with key: '%s' (bytes: %x)\n", keyCopy, []byte(keyCopy))
+	s.put(cmd.DB, cmd.Key, updated)
+	return Result{Data: updated.Version, OK: true}
+}
 
-	// Debug: print all keys
-	fmt.Println("Current keys in map:")
-	for k := range s.Data.Data {
-		fmt.Printf("  '%s' (bytes: %x)\n", k, []byte(k))
-	}
+func (d *DB) GetTTL(key string) (time.Duration, bool) {
+	d.s.lock()
+	defer d.s.Mu.Unlock()
 
-	item, exists := s.Data.Data[keyCopy]
+	item, exists := d.s.live(d.name, key, time.Now())
 	if !exists {
-		fmt.Printf("Key not found for TTL: '%s'\n", keyCopy)
 		return 0, false
 	}
 
-	// if item.IsExpired() {
-	// 	fmt.Printf("Key expired: '%s'\n", keyCopy)
-	// 	delete(s.Data.Data, keyCopy)
-	// 	return 0, false
-	// }
-
 	if item.ExpiresAt.IsZero() {
-		fmt.Printf("Key has no expiration: '%s'\n", keyCopy)
 		return -1, true // -1 indicates no expiration
 	}
-
-	remaining := time.Until(item.ExpiresAt)
-	// if remaining < 0 {
-	// 	fmt.Printf("Key has negative remaining time: '%s'\n", keyCopy)
-	// 	delete(s.Data.Data, keyCopy)
-	// 	return 0, false
-	// }
-
-	fmt.Printf("Successfully retrieved TTL for key '%s': %v\n", keyCopy, remaining)
-	return remaining, true
+	return time.Until(item.ExpiresAt), true
 }
 
-func (s *DataObj) SetTTL(key string, ttl time.Duration) bool {
-	s.Mu.Lock()
-	defer s.Mu.Unlock()
+// SetTTL makes key expire after ttl and reports whether it exists
+func (d *DB) SetTTL(key string, ttl time.Duration) (bool, error) {
+	res := d.s.exec(Command{Op: OpSetTTL, DB: d.name, Key: key, TTL: ttl})
+	return res.OK, res.Err
+}
 
-	item, exists := s.Data.Data[key]
-	if !exists || item.IsExpired() {
-		return false
+func (s *DataObj) applySetTTL(cmd Command) Result {
+	// Commands from SetTTL carry no args
+	var o ExpireOptions
+	if len(cmd.Args) > 0 {
+		if err := decodeArgs(cmd, &o); err != nil {
+			return Result{Err: err}
+		}
 	}
-
-	if ttl <= 0 {
-		item.ExpiresAt = time.Time{} // No expiration
-	} else {
-		item.ExpiresAt = time.Now().Add(ttl)
+	item, exists := s.live(cmd.DB, cmd.Key, cmd.Now)
+	if !exists {
+		return Result{}
 	}
 
-	return true
+	// A non-positive ttl removes the expiration
+	next := expiry(cmd.Now, cmd.TTL)
+	if !o.At.IsZero() {
+		next = o.At
+	}
+	if !o.allows(item.ExpiresAt, next) {
+		return Result{}
+	}
+	item.ExpiresAt = next
+	return Result{OK: true}
 }
 
-func (s *DataObj) GetList(key string) ([]string, error) {
-	s.Mu.Lock()
-	defer s.Mu.Unlock()
+func (d *DB) GetList(key string) ([]string, error) {
+	d.s.lock()
+	defer d.s.Mu.Unlock()
 
-	item, exists := s.Data.Data[key]
+	item, exists := d.s.keys(d.name)[key]
 	if !exists || item.IsExpired() {
 		return nil, fmt.Errorf("item not found or expired for key")
 	}
@@ -261,77 +503,92 @@ func (s *DataObj) GetList(key string) ([]string, error) {
 	return result, nil
 }
 
-func (s *DataObj) CreateList(key string, ttl time.Duration) bool {
-	s.Mu.Lock()
-	defer s.Mu.Unlock()
-
-	if _, exists := s.Data.Data[key]; exists {
-		return false
-	}
+// CreateList creates an empty list. It reports false if the key exists.
+func (d *DB) CreateList(key string, ttl time.Duration) (bool, error) {
+	res := d.s.exec(Command{Op: OpCreateList, DB: d.name, Key: key, TTL: ttl})
+	return res.OK, res.Err
+}
 
-	var expiresAt time.Time
-	if ttl > 0 {
-		expiresAt = time.Now().Add(ttl)
+func (s *DataObj) applyCreateList(cmd Command) Result {
+	if _, exists := s.live(cmd.DB, cmd.Key, cmd.Now); exists {
+		return Result{}
 	}
-
-	s.Data.Data[key] = &Item{
+	item := &Item{
 		Type:      ListType,
 		Value:     []string{},
-		ExpiresAt: expiresAt,
+		ExpiresAt: expiry(cmd.Now, cmd.TTL),
+	}
+	if err := s.admit(cmd, s.growth(cmd.DB, cmd.Key, item), 0); err != nil {
+		return Result{Err: err}
 	}
+	if err := s.reserve(cmd); err != nil {
+		return Result{Err: err}
+	}
+
+	s.put(cmd.DB, cmd.Key, item)
 
-	return true
+	return Result{OK: true}
 }
 
-// Push adds a value to the end of a list
-func (s *DataObj) Push(key string, value string) bool {
-	s.Mu.Lock()
-	defer s.Mu.Unlock()
+// Push adds a value to the end of a list. It reports false if there is no
+// list under key.
+func (d *DB) Push(key string, value string) (bool, error) {
+	res := d.s.exec(Command{Op: OpPush, DB: d.name, Key: key, Value: value})
+	return res.OK, res.Err
+}
 
-	item, exists := s.Data.Data[key]
-	if !exists || item.IsExpired() {
-		return false
+func (s *DataObj) applyPush(cmd Command) Result {
+	item, exists := s.live(cmd.DB, cmd.Key, cmd.Now)
+	if !exists {
+		return Result{}
 	}
 
 	if item.Type != ListType {
-		return false
+		return Result{}
 	}
 
 	list, ok := item.Value.([]string)
 	if !ok {
-		return false
+		return Result{}
+	}
+	grow := int64(len(cmd.Value)) + stringOverhead
+	if err := s.admit(cmd, grow, len(cmd.Value)); err != nil {
+		return Result{Err: err}
+	}
+	if err := s.reserve(cmd); err != nil {
+		return Result{Err: err}
 	}
 
-	item.Value = append(list, value)
-	return true
+	item.Value = append(list, cmd.Value)
+	s.grow(cmd.DB, cmd.Key, grow)
+	return Result{OK: true}
 }
 
 // Pop removes and returns the last value from a list
-func (s *DataObj) Pop(key string) (string, bool) {
-	s.Mu.Lock()
-	defer s.Mu.Unlock()
+func (d *DB) Pop(key string) (string, bool, error) {
+	res := d.s.exec(Command{Op: OpPop, DB: d.name, Key: key})
+	return res.Value, res.OK, res.Err
+}
 
-	item, exists := s.Data.Data[key]
-	if !exists || item.IsExpired() {
-		return "", false
+func (s *DataObj) applyPop(cmd Command) Result {
+	item, exists := s.live(cmd.DB, cmd.Key, cmd.Now)
+	if !exists {
+		return Result{}
 	}
 
 	if item.Type != ListType {
-		return "", false
+		return Result{}
 	}
 
 	list, ok := item.Value.([]string)
 	if !ok || len(list) == 0 {
-		return "", false
+		return Result{}
 	}
 
 	lastIndex := len(list) - 1
 	value := list[lastIndex]
 	item.Value = list[:lastIndex]
+	s.grow(cmd.DB, cmd.Key, -(int64(len(value)) + stringOverhead))
 
-	return value, true
-}
-
-func defensiveCopy(key string) string {
-	return string([]byte(key))
+	return Result{Value: value, OK: true}
 }
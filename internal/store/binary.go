@@ -0,0 +1,93 @@
+package store
+
+import (
+	"encoding/json"
+	"unicode/utf8"
+)
+
+// Keys and values may hold any bytes, but JSON strings must be valid UTF-8
+// and encoding/json replaces anything else. Where the store writes JSON,
+// in replicated commands and in snapshots, such strings are written as
+// base64 instead.
+
+// commandFields has the fields of Command without its methods
+type commandFields Command
+
+type commandJSON struct {
+	commandFields
+	KeyBin   []byte `json:"key_bin,omitempty"`
+	ValueBin []byte `json:"value_bin,omitempty"`
+}
+
+func (c Command) MarshalJSON() ([]byte, error) {
+	out := commandJSON{commandFields: commandFields(c)}
+	if !utf8.ValidString(c.Key) {
+		out.KeyBin, out.Key = []byte(c.Key), ""
+	}
+	if !utf8.ValidString(c.Value) {
+		out.ValueBin, out.Value = []byte(c.Value), ""
+	}
+	return json.Marshal(out)
+}
+
+func (c *Command) UnmarshalJSON(data []byte) error {
+	var in commandJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	*c = Command(in.commandFields)
+	if in.KeyBin != nil {
+		c.Key = string(in.KeyBin)
+	}
+	if in.ValueBin != nil {
+		c.Value = string(in.ValueBin)
+	}
+	return nil
+}
+
+// encodeValue encodes the value of a snapshot item. It reports true if it
+// used base64 for a string or list holding invalid UTF-8.
+func encodeValue(v interface{}) (json.RawMessage, bool, error) {
+	switch v := v.(type) {
+	case string:
+		if !utf8.ValidString(v) {
+			data, err := json.Marshal([]byte(v))
+			return data, true, err
+		}
+	case []string:
+		for _, e := range v {
+			if utf8.ValidString(e) {
+				continue
+			}
+			bin := make([][]byte, len(v))
+			for i, e := range v {
+				bin[i] = []byte(e)
+			}
+			data, err := json.Marshal(bin)
+			return data, true, err
+		}
+	}
+	data, err := json.Marshal(v)
+	return data, false, err
+}
+
+// decodeBinary decodes a value encodeValue wrote as base64
+func decodeBinary(t DataType, raw json.RawMessage) (interface{}, error) {
+	switch t {
+	case StringType:
+		var v []byte
+		err := json.Unmarshal(raw, &v)
+		return string(v), err
+	case ListType:
+		var bin [][]byte
+		if err := json.Unmarshal(raw, &bin); err != nil {
+			return nil, err
+		}
+		v := make([]string, len(bin))
+		for i, e := range bin {
+			v[i] = string(e)
+		}
+		return v, nil
+	}
+	return decodeValue(t, raw)
+}
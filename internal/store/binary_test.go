@@ -0,0 +1,99 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var binaryKeys = []string{"plain", "a/b?c#d% e", "nul\x00byte", "\xff\xfe", "ünïcödé"}
+
+var binaryValues = []string{"plain", "", "\xff\x00\xfe", "ünïcödé"}
+
+func TestCommandJSON(t *testing.T) {
+	for _, key := range binaryKeys {
+		for _, value := range binaryValues {
+			cmd := Command{Op: OpSet, DB: "ns", Key: key, Value: value, TTL: time.Second, Now: time.Unix(1700000000, 0).UTC()}
+			data, err := json.Marshal(cmd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !json.Valid(data) || bytes.Contains(data, []byte("\\ufffd")) {
+				t.Fatalf("%q=%q encodes as %s", key, value, data)
+			}
+			var got Command
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, cmd) {
+				t.Fatalf("round trip of %q=%q: got %+v, want %+v", key, value, got, cmd)
+			}
+		}
+	}
+
+	// A replica applying the encoded command stores the same bytes
+	s := NewRedisMemoryStore()
+	defer s.Close()
+	data, err := json.Marshal(Command{Op: OpSet, Key: "\xff", Value: "\x00\xfe", Now: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := s.Apply(data).(Result); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if v, _, ok := s.DB(DefaultDB).Get("\xff"); !ok || v != "\x00\xfe" {
+		t.Fatalf("applied value = %q, %v", v, ok)
+	}
+}
+
+func TestSnapshotBinary(t *testing.T) {
+	s := NewRedisMemoryStore()
+	defer s.Close()
+	for _, db := range []string{DefaultDB, "ns"} {
+		d := s.DB(db)
+		for _, key := range binaryKeys {
+			for i, value := range binaryValues {
+				if err := d.Set(key, value, nil); err != nil {
+					t.Fatal(err)
+				}
+				if i == 0 {
+					if _, err := d.CreateList(key+":list", 0); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if _, err := d.Push(key+":list", value); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+
+	data, err := s.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("\\ufffd")) {
+		t.Fatal("snapshot replaced invalid UTF-8")
+	}
+	restored := NewRedisMemoryStore()
+	defer restored.Close()
+	if err := restored.Restore(data); err != nil {
+		t.Fatal(err)
+	}
+
+	last := binaryValues[len(binaryValues)-1]
+	for _, db := range []string{DefaultDB, "ns"} {
+		d := restored.DB(db)
+		for _, key := range binaryKeys {
+			if v, _, ok := d.Get(key); !ok || v != last {
+				t.Errorf("%s/%q = %q, %v after restore, want %q", db, key, v, ok, last)
+			}
+			v, _, ok := d.Get(key + ":list")
+			if !ok || !reflect.DeepEqual(v, binaryValues) {
+				t.Errorf("%s/%q = %q, %v after restore, want %q", db, key+":list", v, ok, binaryValues)
+			}
+		}
+	}
+}
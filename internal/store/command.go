@@ -0,0 +1,287 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Op names a mutation that can be applied to the store
+type Op string
+
+const (
+	OpSet        Op = "set"
+	OpUpdate     Op = "update"
+	OpRemove     Op = "remove"
+	OpSetTTL     Op = "set_ttl"
+	OpCreateList Op = "create_list"
+	OpPush       Op = "push"
+	OpPop        Op = "pop"
+	OpFlushDB    Op = "flush_db"
+	OpSwapDB     Op = "swap_db"
+	OpGetEx      Op = "getex"
+	OpGetDel     Op = "getdel"
+	OpPersist    Op = "persist"
+	OpAppend     Op = "append"
+	OpIncr       Op = "incr"
+	OpExpire     Op = "expire"
+
+	OpXAdd              Op = "xadd"
+	OpXDel              Op = "xdel"
+	OpXTrim             Op = "xtrim"
+	OpXGroupCreate      Op = "xgroup_create"
+	OpXGroupDestroy     Op = "xgroup_destroy"
+	OpXGroupDelConsumer Op = "xgroup_delconsumer"
+	OpXReadGroup        Op = "xreadgroup"
+	OpXAck              Op = "xack"
+	OpXClaim            Op = "xclaim"
+	OpXAutoClaim        Op = "xautoclaim"
+
+	OpEnqueue        Op = "enqueue"
+	OpReceive        Op = "receive"
+	OpAck            Op = "ack"
+	OpNack           Op = "nack"
+	OpExtendLease    Op = "extend_lease"
+	OpConfigureQueue Op = "configure_queue"
+
+	OpAcquire Op = "acquire"
+	OpRelease Op = "release"
+	OpExtend  Op = "extend"
+
+	OpJSONSet       Op = "json_set"
+	OpJSONDel       Op = "json_del"
+	OpJSONNumIncrBy Op = "json_numincrby"
+	OpJSONArrAppend Op = "json_arrappend"
+	OpJSONArrPop    Op = "json_arrpop"
+
+	OpCreateIndex    Op = "create_index"
+	OpDropIndex      Op = "drop_index"
+	OpCreateFullText Op = "create_fulltext"
+	OpDropFullText   Op = "drop_fulltext"
+)
+
+// Command is a self-contained description of a mutation. Everything the
+// mutation depends on, including the wall clock, is carried in the command
+// so that applying it on any replica produces the same result.
+type Command struct {
+	Op Op `json:"op"`
+	// DB is the namespace the command applies to; empty means DefaultDB
+	DB    string        `json:"db,omitempty"`
+	Key   string        `json:"key"`
+	Value string        `json:"value,omitempty"`
+	TTL   time.Duration `json:"ttl,omitempty"`
+	// Args holds the arguments of commands that need more than Value and
+	// TTL, encoded as JSON so the command stays serialisable
+	Args json.RawMessage `json:"args,omitempty"`
+	Now  time.Time       `json:"now"`
+	// Quota is the namespace's quota when the command was issued, so every
+	// replica enforces the quota of the node that issued it
+	Quota *Quota `json:"quota,omitempty"`
+}
+
+// withArgs returns cmd carrying args
+func withArgs(cmd Command, args interface{}) Command {
+	data, err := json.Marshal(args)
+	if err != nil {
+		// Args are plain structs the store defines
+		panic(fmt.Sprintf("store: encode %s args: %v", cmd.Op, err))
+	}
+	cmd.Args = data
+	return cmd
+}
+
+// decodeArgs decodes the arguments withArgs attached to cmd
+func decodeArgs(cmd Command, v interface{}) error {
+	if err := json.Unmarshal(cmd.Args, v); err != nil {
+		return fmt.Errorf("decode %s args: %w", cmd.Op, err)
+	}
+	return nil
+}
+
+// Result is the outcome of applying a Command
+type Result struct {
+	Value string
+	// N counts the items a command affected, where that is meaningful
+	N int
+	// Data is the structured result of commands such as stream reads
+	Data interface{}
+	OK   bool
+	Err  error
+}
+
+// Replicator orders mutations across a group of nodes. When one is attached
+// every mutation is proposed through it and applied once committed; Propose
+// returns the Result produced by Apply on this node.
+type Replicator interface {
+	Propose(data []byte) (interface{}, error)
+}
+
+// SetReplicator routes all further mutations through r
+func (s *DataObj) SetReplicator(r Replicator) {
+	s.lock()
+	defer s.Mu.Unlock()
+	s.replicator = r
+}
+
+// exec applies cmd locally, or proposes it when replication is enabled
+func (s *DataObj) exec(cmd Command) Result {
+	cmd.Now = time.Now()
+	if s.quotas != nil {
+		db := cmd.DB
+		if db == "" {
+			db = DefaultDB
+		}
+		if q := s.quotas(db); q != (Quota{}) {
+			cmd.Quota = &q
+		}
+	}
+
+	s.rlock()
+	r := s.replicator
+	s.Mu.RUnlock()
+
+	if r == nil {
+		s.lock()
+		defer s.Mu.Unlock()
+		return s.apply(cmd)
+	}
+
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return Result{Err: err}
+	}
+	out, err := r.Propose(data)
+	if err != nil {
+		return Result{Err: err}
+	}
+	res, ok := out.(Result)
+	if !ok {
+		return Result{Err: fmt.Errorf("unexpected apply result %T", out)}
+	}
+	return res
+}
+
+// Apply decodes and applies a committed command. It is called by the
+// replicator on every member in log order.
+func (s *DataObj) Apply(data []byte) interface{} {
+	var cmd Command
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		return Result{Err: fmt.Errorf("decode command: %w", err)}
+	}
+	s.lock()
+	defer s.Mu.Unlock()
+	return s.apply(cmd)
+}
+
+// apply executes cmd against the map. The caller must hold s.Mu.
+func (s *DataObj) apply(cmd Command) Result {
+	if cmd.DB == "" {
+		cmd.DB = DefaultDB
+	}
+	switch cmd.Op {
+	case OpSet:
+		return s.applySet(cmd)
+	case OpUpdate:
+		return s.applyUpdate(cmd)
+	case OpRemove:
+		return s.applyRemove(cmd)
+	case OpSetTTL:
+		return s.applySetTTL(cmd)
+	case OpCreateList:
+		return s.applyCreateList(cmd)
+	case OpPush:
+		return s.applyPush(cmd)
+	case OpPop:
+		return s.applyPop(cmd)
+	case OpFlushDB:
+		return s.applyFlushDB(cmd)
+	case OpSwapDB:
+		return s.applySwapDB(cmd)
+	case OpGetEx:
+		return s.applyGetEx(cmd)
+	case OpGetDel:
+		return s.applyGetDel(cmd)
+	case OpPersist:
+		return s.applyPersist(cmd)
+	case OpAppend:
+		return s.applyAppend(cmd)
+	case OpIncr:
+		return s.applyIncr(cmd)
+	case OpExpire:
+		return s.applyExpire(cmd)
+	case OpXAdd:
+		return s.applyXAdd(cmd)
+	case OpXDel:
+		return s.applyXDel(cmd)
+	case OpXTrim:
+		return s.applyXTrim(cmd)
+	case OpXGroupCreate:
+		return s.applyXGroupCreate(cmd)
+	case OpXGroupDestroy:
+		return s.applyXGroupDestroy(cmd)
+	case OpXGroupDelConsumer:
+		return s.applyXGroupDelConsumer(cmd)
+	case OpXReadGroup:
+		return s.applyXReadGroup(cmd)
+	case OpXAck:
+		return s.applyXAck(cmd)
+	case OpXClaim:
+		return s.applyXClaim(cmd)
+	case OpXAutoClaim:
+		return s.applyXAutoClaim(cmd)
+	case OpEnqueue:
+		return s.applyEnqueue(cmd)
+	case OpReceive:
+		return s.applyReceive(cmd)
+	case OpAck:
+		return s.applyAck(cmd)
+	case OpNack:
+		return s.applyNack(cmd)
+	case OpExtendLease:
+		return s.applyExtendLease(cmd)
+	case OpConfigureQueue:
+		return s.applyConfigureQueue(cmd)
+	case OpAcquire:
+		return s.applyAcquire(cmd)
+	case OpRelease:
+		return s.applyRelease(cmd)
+	case OpExtend:
+		return s.applyExtend(cmd)
+	case OpJSONSet:
+		return s.applyJSONSet(cmd)
+	case OpJSONDel:
+		return s.applyJSONDel(cmd)
+	case OpJSONNumIncrBy:
+		return s.applyJSONNumIncrBy(cmd)
+	case OpJSONArrAppend:
+		return s.applyJSONArrAppend(cmd)
+	case OpJSONArrPop:
+		return s.applyJSONArrPop(cmd)
+	case OpCreateIndex:
+		return s.applyCreateIndex(cmd)
+	case OpDropIndex:
+		return s.applyDropIndex(cmd)
+	case OpCreateFullText:
+		return s.applyCreateFullText(cmd)
+	case OpDropFullText:
+		return s.applyDropFullText(cmd)
+	}
+	return Result{Err: fmt.Errorf("unknown op %q", cmd.Op)}
+}
+
+// live returns the item stored under key in db unless it has expired as
+// of now
+func (s *DataObj) live(db, key string, now time.Time) (*Item, bool) {
+	item, exists := s.keys(db)[key]
+	if !exists || item.expiredAt(now) {
+		return nil, false
+	}
+	return item, true
+}
+
+func expiry(now time.Time, ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return now.Add(ttl)
+}
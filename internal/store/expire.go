@@ -0,0 +1,79 @@
+package store
+
+import "time"
+
+// ExpireOptions make Expire conditional on the key's current expiration,
+// like the NX, XX, GT and LT flags of Redis EXPIRE. A key without an
+// expiration counts as expiring never, so GT fails and LT succeeds on it.
+type ExpireOptions struct {
+	NX bool `json:"nx,omitempty"`
+	XX bool `json:"xx,omitempty"`
+	GT bool `json:"gt,omitempty"`
+	LT bool `json:"lt,omitempty"`
+	// At expires the key at a point in time instead of after a TTL
+	At time.Time `json:"at,omitempty"`
+}
+
+func (o ExpireOptions) validate() error {
+	if (o.NX && (o.XX || o.GT || o.LT)) || (o.GT && o.LT) {
+		return ErrConflictingOptions
+	}
+	return nil
+}
+
+// allows reports whether the options let the expiration change from
+// current to next, where a zero time is no expiration
+func (o ExpireOptions) allows(current, next time.Time) bool {
+	switch {
+	case o.NX && !current.IsZero(), o.XX && current.IsZero():
+		return false
+	case o.GT:
+		return !current.IsZero() && !next.IsZero() && next.After(current)
+	case o.LT:
+		return !next.IsZero() && (current.IsZero() || next.Before(current))
+	}
+	return true
+}
+
+// Expire sets the expiration of key to ttl from now, or to opts.At, if the
+// conditions in opts hold. A non-positive ttl without At removes the
+// expiration. It reports false if there is no such key or a condition
+// failed.
+func (d *DB) Expire(key string, ttl time.Duration, opts ExpireOptions) (bool, error) {
+	if err := opts.validate(); err != nil {
+		return false, err
+	}
+	if !opts.At.IsZero() && ttl > 0 {
+		return false, ErrConflictingOptions
+	}
+	res := d.s.exec(withArgs(Command{Op: OpSetTTL, DB: d.name, Key: key, TTL: ttl}, opts))
+	return res.OK, res.Err
+}
+
+// Persist removes the expiration of key. It reports false if there is no
+// such key or it had no expiration.
+func (d *DB) Persist(key string) (bool, error) {
+	res := d.s.exec(Command{Op: OpPersist, DB: d.name, Key: key})
+	return res.OK, res.Err
+}
+
+func (s *DataObj) applyPersist(cmd Command) Result {
+	item, exists := s.live(cmd.DB, cmd.Key, cmd.Now)
+	if !exists || item.ExpiresAt.IsZero() {
+		return Result{}
+	}
+	item.ExpiresAt = time.Time{}
+	return Result{OK: true}
+}
+
+// ExpireTime returns when key expires, or the zero time if it does not.
+// It reports false if there is no such key.
+func (d *DB) ExpireTime(key string) (time.Time, bool) {
+	d.s.rlock()
+	defer d.s.Mu.RUnlock()
+	item, exists := d.s.live(d.name, key, time.Now())
+	if !exists {
+		return time.Time{}, false
+	}
+	return item.ExpiresAt, true
+}
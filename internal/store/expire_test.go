@@ -0,0 +1,118 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errFollower = errors.New("not the leader")
+
+// replicaLog is a Replicator that applies every command to each member in
+// the same order, standing in for a committed raft log
+type replicaLog struct {
+	members []*DataObj
+}
+
+func (l *replicaLog) Propose(data []byte) (interface{}, error) {
+	var out interface{}
+	for i, m := range l.members {
+		res := m.Apply(data)
+		if i == 0 {
+			out = res
+		}
+	}
+	return out, nil
+}
+
+// follower is the Replicator of a member that cannot propose
+type follower struct{}
+
+func (follower) Propose([]byte) (interface{}, error) { return nil, errFollower }
+
+// replicaState is what must match across replicas
+func replicaState(t *testing.T, s *DataObj) ([]byte, int64, int64) {
+	t.Helper()
+	data, err := s.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.rlock()
+	defer s.Mu.RUnlock()
+	return data, s.used, s.expired
+}
+
+// TestExpiryIsReplicated runs the cleanup of two replicas at different
+// times and checks that a command applied in between, stamped before the
+// key expired, finds the key on both, and that both end up alike.
+func TestExpiryIsReplicated(t *testing.T) {
+	leader, other := NewRedisMemoryStore(), NewRedisMemoryStore()
+	defer leader.Close()
+	defer other.Close()
+	log := &replicaLog{members: []*DataObj{leader, other}}
+	leader.SetReplicator(log)
+	other.SetReplicator(follower{})
+
+	ttl := 20 * time.Millisecond
+	if err := leader.DB(DefaultDB).Set("k", "v", &ttl); err != nil {
+		t.Fatal(err)
+	}
+	if err := leader.DB(DefaultDB).Set("kept", "v", nil); err != nil {
+		t.Fatal(err)
+	}
+	expiresAt := leader.keys(DefaultDB)["k"].ExpiresAt
+	time.Sleep(2 * ttl)
+
+	// The follower's cleanup runs first and must leave the key to the log
+	other.cleanExpired()
+	if _, ok := other.keys(DefaultDB)["k"]; !ok {
+		t.Fatal("follower dropped an expired key on its own clock")
+	}
+
+	// A write issued just before the key expired reaches both replicas late
+	data, err := json.Marshal(withArgs(Command{Op: OpSet, Key: "k", Value: "nx", Now: expiresAt.Add(-time.Millisecond)}, SetOptions{NX: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := leader.Apply(data).(Result), other.Apply(data).(Result)
+	if a.OK || b.OK {
+		t.Fatalf("SET NX of a key live at the command's time: leader %+v, follower %+v", a, b)
+	}
+
+	leader.cleanExpired()
+	for name, s := range map[string]*DataObj{"leader": leader, "follower": other} {
+		if _, ok := s.keys(DefaultDB)["k"]; ok {
+			t.Errorf("%s kept the expired key after the leader's cleanup", name)
+		}
+		if _, ok := s.keys(DefaultDB)["kept"]; !ok {
+			t.Errorf("%s dropped a key without expiration", name)
+		}
+	}
+	snapA, usedA, expiredA := replicaState(t, leader)
+	snapB, usedB, expiredB := replicaState(t, other)
+	if !bytes.Equal(snapA, snapB) {
+		t.Errorf("replicas differ:\n%s\n%s", snapA, snapB)
+	}
+	if usedA != usedB || expiredA != expiredB || expiredA != 1 {
+		t.Errorf("used %d/%d, expired %d/%d, want equal and 1 expired", usedA, usedB, expiredA, expiredB)
+	}
+}
+
+func TestCleanupWithoutReplicator(t *testing.T) {
+	s := NewRedisMemoryStore()
+	defer s.Close()
+	ttl := time.Millisecond
+	if err := s.DB(DefaultDB).Set("k", "v", &ttl); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	s.cleanExpired()
+	if _, ok := s.keys(DefaultDB)["k"]; ok {
+		t.Fatal("expired key not removed")
+	}
+	if used := s.UsedMemory(); used != 0 {
+		t.Errorf("used memory = %d after removing every key, want 0", used)
+	}
+}
@@ -0,0 +1,744 @@
+package store
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Full-text indexes make the words of values findable. A full-text index
+// covers the string and JSON keys of one namespace that start with one of
+// its prefixes. The text of a string is its value, and that of a JSON
+// document the strings its paths select, every string in it by default.
+// Text is split into words of letters and digits, lower cased and stemmed,
+// so "Running" finds "runs", and an inverted index maps each stem to the
+// keys holding it and where.
+//
+// Like secondary indexes, full-text indexes follow put and del, and only
+// their definitions are replicated and saved in snapshots.
+
+// BM25 parameters: k1 is how quickly more occurrences of a word stop
+// adding to a score, b how much long texts are penalised
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+const (
+	// maxPrefixTerms is the most stems a prefix query expands to
+	maxPrefixTerms = 256
+	// fragmentWords is the most words of a highlighted fragment, and
+	// fragmentLead how many of them come before the first match
+	fragmentWords = 30
+	fragmentLead  = 5
+)
+
+// FullTextDef defines a full-text index
+type FullTextDef struct {
+	Name string `json:"name"`
+	// Prefixes are the key prefixes the index covers; none covers every key
+	Prefixes []string `json:"prefixes,omitempty"`
+	// Paths are the JSON paths of the text in JSON documents
+	Paths []string `json:"paths,omitempty"`
+}
+
+// FullTextInfo describes a full-text index
+type FullTextInfo struct {
+	FullTextDef
+	// Docs is the number of keys the index holds and Terms the number of
+	// distinct stems in them
+	Docs  int `json:"docs"`
+	Terms int `json:"terms"`
+}
+
+func (def FullTextDef) validate() error {
+	if def.Name == "" || len(def.Name) > 64 {
+		return ErrInvalidIndex
+	}
+	for _, p := range def.Paths {
+		if _, err := parsePath(p); err != nil {
+			return fmt.Errorf("%w: path %s: %v", ErrInvalidIndex, p, err)
+		}
+	}
+	return nil
+}
+
+// fullTextIndex is a full-text index and the postings of the keys it
+// covers
+type fullTextIndex struct {
+	def   FullTextDef
+	paths []jsonPath
+	docs  map[string]*textDoc
+	// postings maps a stem to the keys holding it and its positions in
+	// each, in ascending order
+	postings map[string]map[string][]int
+	// words are the lower cased words of the keys, before stemming, and
+	// dict their stems. Prefix queries are matched against words, sorted,
+	// since a stem is often not a prefix of the words it stands for.
+	words []string
+	dict  map[string]*dictWord
+	// length is the number of words in every key, for the average
+	length int
+}
+
+// textDoc is what an index holds about a key: its length, and its
+// distinct stems and words
+type textDoc struct {
+	length int
+	terms  []string
+	words  []string
+}
+
+// dictWord is the stem of a word and the number of keys holding it
+type dictWord struct {
+	term string
+	docs int
+}
+
+// textToken is a word of a text: the word lower cased, its stem and where
+// it is
+type textToken struct {
+	word, term string
+	start, end int
+}
+
+func newFullTextIndex(def FullTextDef) *fullTextIndex {
+	ix := &fullTextIndex{
+		def:      def,
+		docs:     map[string]*textDoc{},
+		postings: map[string]map[string][]int{},
+		dict:     map[string]*dictWord{},
+	}
+	paths := def.Paths
+	if len(paths) == 0 {
+		// The root if it is a string, and every string below it
+		paths = []string{"$", "$..*"}
+	}
+	for _, p := range paths {
+		// Definitions are validated before they get here
+		jp, _ := parsePath(p)
+		ix.paths = append(ix.paths, jp)
+	}
+	return ix
+}
+
+// covers reports whether key starts with one of the index's prefixes
+func (ix *fullTextIndex) covers(key string) bool {
+	if len(ix.def.Prefixes) == 0 {
+		return true
+	}
+	for _, p := range ix.def.Prefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// texts returns the text of item: a string value, or the strings the
+// index's paths select in a JSON document
+func (ix *fullTextIndex) texts(item *Item) []string {
+	switch v := item.Value.(type) {
+	case string:
+		if item.Type == StringType {
+			return []string{v}
+		}
+	case *JSONDoc:
+		var out []string
+		for _, p := range ix.paths {
+			for _, l := range p.eval(v.Root) {
+				if s, ok := l.value.(string); ok {
+					out = append(out, s)
+				}
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// analyze splits text into words and stems them
+func analyze(text string) []textToken {
+	var out []textToken
+	start := -1
+	for i, r := range text {
+		word := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case word && start < 0:
+			start = i
+		case !word && start >= 0:
+			out = append(out, newTextToken(text, start, i))
+			start = -1
+		}
+	}
+	if start >= 0 {
+		out = append(out, newTextToken(text, start, len(text)))
+	}
+	return out
+}
+
+func newTextToken(text string, start, end int) textToken {
+	word := strings.ToLower(text[start:end])
+	return textToken{word: word, term: stem(word), start: start, end: end}
+}
+
+// update indexes the text of item under key, or drops key if it has none
+func (ix *fullTextIndex) update(key string, item *Item) {
+	ix.remove(key)
+	doc := &textDoc{}
+	words := map[string]bool{}
+	pos := 0
+	for _, text := range ix.texts(item) {
+		for _, t := range analyze(text) {
+			keys, ok := ix.postings[t.term]
+			if !ok {
+				keys = map[string][]int{}
+				ix.postings[t.term] = keys
+			}
+			if len(keys[key]) == 0 {
+				doc.terms = append(doc.terms, t.term)
+			}
+			if !words[t.word] {
+				words[t.word] = true
+				doc.words = append(doc.words, t.word)
+				ix.addWord(t.word, t.term)
+			}
+			keys[key] = append(keys[key], pos)
+			pos++
+			doc.length++
+		}
+		// Leave a gap so phrases do not run from one string into the next
+		pos++
+	}
+	if doc.length == 0 {
+		return
+	}
+	ix.docs[key] = doc
+	ix.length += doc.length
+}
+
+// remove drops key from the index
+func (ix *fullTextIndex) remove(key string) {
+	doc, ok := ix.docs[key]
+	if !ok {
+		return
+	}
+	for _, term := range doc.terms {
+		keys := ix.postings[term]
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(ix.postings, term)
+		}
+	}
+	for _, word := range doc.words {
+		ix.removeWord(word)
+	}
+	ix.length -= doc.length
+	delete(ix.docs, key)
+}
+
+// addWord counts one more key holding word, whose stem is term
+func (ix *fullTextIndex) addWord(word, term string) {
+	if w, ok := ix.dict[word]; ok {
+		w.docs++
+		return
+	}
+	ix.dict[word] = &dictWord{term: term, docs: 1}
+	at := sort.SearchStrings(ix.words, word)
+	ix.words = append(ix.words, "")
+	copy(ix.words[at+1:], ix.words[at:])
+	ix.words[at] = word
+}
+
+// removeWord counts one key fewer holding word
+func (ix *fullTextIndex) removeWord(word string) {
+	w, ok := ix.dict[word]
+	if !ok {
+		return
+	}
+	if w.docs--; w.docs > 0 {
+		return
+	}
+	delete(ix.dict, word)
+	at := sort.SearchStrings(ix.words, word)
+	if at < len(ix.words) && ix.words[at] == word {
+		ix.words = append(ix.words[:at], ix.words[at+1:]...)
+	}
+}
+
+// withPrefix returns the stems of the words that start with prefix
+func (ix *fullTextIndex) withPrefix(prefix string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for i := sort.SearchStrings(ix.words, prefix); i < len(ix.words) && len(out) < maxPrefixTerms; i++ {
+		if !strings.HasPrefix(ix.words[i], prefix) {
+			break
+		}
+		if term := ix.dict[ix.words[i]].term; !seen[term] {
+			seen[term] = true
+			out = append(out, term)
+		}
+	}
+	return out
+}
+
+// A search query is a list of words that must all be in a key's text:
+//
+//	word          the word, or another with the same stem
+//	"two words"   the words next to each other, in order
+//	wor*          a word starting with wor, or another with its stem
+//
+// - in front of a term excludes the keys that match it, and | separates
+// alternatives, so "laptop -refurbished | notebook*" is valid.
+
+// searchClause is a term of a search query. It matches keys holding the
+// stems in terms next to each other, or a word starting with prefix.
+type searchClause struct {
+	terms  []string
+	prefix string
+	not    bool
+}
+
+// parseSearch parses a query into alternatives, each a list of clauses
+func parseSearch(query string) ([][]searchClause, error) {
+	var out [][]searchClause
+	var alt []searchClause
+	end := func(pos int) error {
+		if len(alt) == 0 {
+			return fmt.Errorf("%w at %d: expected a term", ErrInvalidQuery, pos)
+		}
+		out = append(out, alt)
+		alt = nil
+		return nil
+	}
+	for pos := 0; pos < len(query); {
+		switch query[pos] {
+		case ' ':
+			pos++
+			continue
+		case '|':
+			if err := end(pos); err != nil {
+				return nil, err
+			}
+			pos++
+			continue
+		}
+		var c searchClause
+		start := pos
+		if query[pos] == '-' {
+			c.not = true
+			pos++
+		}
+		var text string
+		if pos < len(query) && query[pos] == '"' {
+			n := strings.IndexByte(query[pos+1:], '"')
+			if n < 0 {
+				return nil, fmt.Errorf("%w at %d: unterminated phrase", ErrInvalidQuery, pos)
+			}
+			text = query[pos+1 : pos+1+n]
+			pos += n + 2
+		} else {
+			n := strings.IndexAny(query[pos:], ` |"`)
+			if n < 0 {
+				n = len(query) - pos
+			}
+			text = query[pos : pos+n]
+			pos += n
+			if prefix := strings.TrimSuffix(text, "*"); prefix != text {
+				tokens := analyze(prefix)
+				if len(tokens) != 1 || tokens[0].start != 0 || tokens[0].end != len(prefix) {
+					return nil, fmt.Errorf("%w at %d: a prefix must be one word", ErrInvalidQuery, start)
+				}
+				c.prefix = tokens[0].word
+				alt = append(alt, c)
+				continue
+			}
+		}
+		for _, t := range analyze(text) {
+			c.terms = append(c.terms, t.term)
+		}
+		if len(c.terms) == 0 {
+			return nil, fmt.Errorf("%w at %d: expected a word", ErrInvalidQuery, start)
+		}
+		alt = append(alt, c)
+	}
+	if err := end(len(query)); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// match returns the keys a clause matches, ignoring its negation
+func (ix *fullTextIndex) match(c searchClause) keySet {
+	out := keySet{}
+	if c.prefix != "" {
+		for _, term := range ix.withPrefix(c.prefix) {
+			for key := range ix.postings[term] {
+				out[key] = struct{}{}
+			}
+		}
+		return out
+	}
+	for key := range ix.postings[c.terms[0]] {
+		if ix.phraseAt(key, c.terms) {
+			out[key] = struct{}{}
+		}
+	}
+	return out
+}
+
+// phraseAt reports whether the text of key holds terms next to each
+// other, in order
+func (ix *fullTextIndex) phraseAt(key string, terms []string) bool {
+	first := ix.postings[terms[0]][key]
+	if len(terms) == 1 {
+		return len(first) > 0
+	}
+next:
+	for _, p := range first {
+		for i, term := range terms[1:] {
+			positions := ix.postings[term][key]
+			at := sort.SearchInts(positions, p+i+1)
+			if at == len(positions) || positions[at] != p+i+1 {
+				continue next
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// eval returns the keys matching any of the alternatives of a query
+func (ix *fullTextIndex) eval(alts [][]searchClause) keySet {
+	out := keySet{}
+	for _, alt := range alts {
+		var keys keySet
+		for _, c := range alt {
+			if c.not {
+				continue
+			}
+			matched := ix.match(c)
+			if keys == nil {
+				keys = matched
+				continue
+			}
+			for key := range keys {
+				if _, ok := matched[key]; !ok {
+					delete(keys, key)
+				}
+			}
+		}
+		if keys == nil {
+			// Only exclusions: start from every key
+			keys = make(keySet, len(ix.docs))
+			for key := range ix.docs {
+				keys[key] = struct{}{}
+			}
+		}
+		for _, c := range alt {
+			if c.not {
+				for key := range ix.match(c) {
+					delete(keys, key)
+				}
+			}
+		}
+		for key := range keys {
+			out[key] = struct{}{}
+		}
+	}
+	return out
+}
+
+// scoreTerms returns the stems a query looks for, which rank and highlight
+// the keys it finds
+func (ix *fullTextIndex) scoreTerms(alts [][]searchClause) map[string]bool {
+	out := map[string]bool{}
+	for _, alt := range alts {
+		for _, c := range alt {
+			if c.not {
+				continue
+			}
+			if c.prefix != "" {
+				for _, term := range ix.withPrefix(c.prefix) {
+					out[term] = true
+				}
+			}
+			for _, term := range c.terms {
+				out[term] = true
+			}
+		}
+	}
+	return out
+}
+
+// score ranks key for terms with BM25: rare words count for more than
+// common ones, and a word for more in a short text than in a long one
+func (ix *fullTextIndex) score(key string, terms map[string]bool) float64 {
+	n := float64(len(ix.docs))
+	avg := float64(ix.length) / n
+	norm := bm25K1 * (1 - bm25B + bm25B*float64(ix.docs[key].length)/avg)
+	var score float64
+	for term := range terms {
+		keys := ix.postings[term]
+		tf := float64(len(keys[key]))
+		if tf == 0 {
+			continue
+		}
+		df := float64(len(keys))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		score += idf * tf * (bm25K1 + 1) / (tf + norm)
+	}
+	return score
+}
+
+// highlight returns a fragment of the text of item around the words of
+// terms, with each of them between pre and post
+func (ix *fullTextIndex) highlight(item *Item, terms map[string]bool, pre, post string) string {
+	// Use the string with the most matching words
+	var text string
+	var tokens []textToken
+	best := -1
+	for _, s := range ix.texts(item) {
+		t := analyze(s)
+		n := 0
+		for _, tok := range t {
+			if terms[tok.term] {
+				n++
+			}
+		}
+		if n > best {
+			text, tokens, best = s, t, n
+		}
+	}
+	if len(tokens) == 0 {
+		return ""
+	}
+	from := 0
+	for i, tok := range tokens {
+		if terms[tok.term] {
+			from = i - fragmentLead
+			break
+		}
+	}
+	if from < 0 {
+		from = 0
+	}
+	to := from + fragmentWords
+	if to > len(tokens) {
+		to = len(tokens)
+	}
+
+	var b strings.Builder
+	start, end := 0, len(text)
+	if from > 0 {
+		start = tokens[from].start
+		b.WriteString("…")
+	}
+	if to < len(tokens) {
+		end = tokens[to-1].end
+	}
+	last := start
+	for _, tok := range tokens[from:to] {
+		if terms[tok.term] {
+			b.WriteString(text[last:tok.start])
+			b.WriteString(pre)
+			b.WriteString(text[tok.start:tok.end])
+			b.WriteString(post)
+			last = tok.end
+		}
+	}
+	b.WriteString(text[last:end])
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// indexText updates the full-text indexes covering key in db after a put.
+// The caller must hold s.Mu.
+func (s *DataObj) indexText(db, key string, item *Item) {
+	for _, ix := range s.fullText[db] {
+		if ix.covers(key) {
+			ix.update(key, item)
+		}
+	}
+}
+
+// unindexText removes key in db from the full-text indexes. The caller
+// must hold s.Mu.
+func (s *DataObj) unindexText(db, key string) {
+	for _, ix := range s.fullText[db] {
+		ix.remove(key)
+	}
+}
+
+// buildFullText creates a full-text index over the keys already in db.
+// The caller must hold s.Mu.
+func (s *DataObj) buildFullText(db string, def FullTextDef) *fullTextIndex {
+	ix := newFullTextIndex(def)
+	for key, item := range s.keys(db) {
+		if ix.covers(key) {
+			ix.update(key, item)
+		}
+	}
+	return ix
+}
+
+// addFullText stores a full-text index of db. The caller must hold s.Mu.
+func (s *DataObj) addFullText(db string, def FullTextDef) {
+	if s.fullText == nil {
+		s.fullText = map[string]map[string]*fullTextIndex{}
+	}
+	if s.fullText[db] == nil {
+		s.fullText[db] = map[string]*fullTextIndex{}
+	}
+	s.fullText[db][def.Name] = s.buildFullText(db, def)
+}
+
+// CreateFullText defines a full-text index and indexes the keys it covers
+func (d *DB) CreateFullText(def FullTextDef) error {
+	if err := def.validate(); err != nil {
+		return err
+	}
+	return d.s.exec(withArgs(Command{Op: OpCreateFullText, DB: d.name, Key: def.Name}, def)).Err
+}
+
+func (s *DataObj) applyCreateFullText(cmd Command) Result {
+	var def FullTextDef
+	if err := decodeArgs(cmd, &def); err != nil {
+		return Result{Err: err}
+	}
+	if err := def.validate(); err != nil {
+		return Result{Err: err}
+	}
+	if _, exists := s.fullText[cmd.DB][def.Name]; exists {
+		return Result{Err: ErrIndexExists}
+	}
+	s.addFullText(cmd.DB, def)
+	return Result{OK: true}
+}
+
+// DropFullText deletes a full-text index, keeping the keys it covered
+func (d *DB) DropFullText(name string) error {
+	return d.s.exec(Command{Op: OpDropFullText, DB: d.name, Key: name}).Err
+}
+
+func (s *DataObj) applyDropFullText(cmd Command) Result {
+	if _, exists := s.fullText[cmd.DB][cmd.Key]; !exists {
+		return Result{Err: ErrNoSuchIndex}
+	}
+	delete(s.fullText[cmd.DB], cmd.Key)
+	if len(s.fullText[cmd.DB]) == 0 {
+		delete(s.fullText, cmd.DB)
+	}
+	return Result{OK: true}
+}
+
+func (ix *fullTextIndex) info() FullTextInfo {
+	return FullTextInfo{FullTextDef: ix.def, Docs: len(ix.docs), Terms: len(ix.postings)}
+}
+
+// FullTextIndexes describes the full-text indexes of the namespace, sorted
+// by name
+func (d *DB) FullTextIndexes() []FullTextInfo {
+	d.s.rlock()
+	defer d.s.Mu.RUnlock()
+	out := []FullTextInfo{}
+	for _, ix := range d.s.fullText[d.name] {
+		out = append(out, ix.info())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// FullTextIndex describes one full-text index of the namespace
+func (d *DB) FullTextIndex(name string) (FullTextInfo, error) {
+	d.s.rlock()
+	defer d.s.Mu.RUnlock()
+	ix, ok := d.s.fullText[d.name][name]
+	if !ok {
+		return FullTextInfo{}, ErrNoSuchIndex
+	}
+	return ix.info(), nil
+}
+
+// SearchOptions are the paging and highlighting of a search
+type SearchOptions struct {
+	Offset int `json:"offset,omitempty"`
+	// Limit is the most keys to return
+	Limit int `json:"limit"`
+	// Highlight returns a fragment of each key's text with the words found
+	// between PreTag and PostTag, <b> and </b> by default
+	Highlight bool   `json:"highlight,omitempty"`
+	PreTag    string `json:"pre_tag,omitempty"`
+	PostTag   string `json:"post_tag,omitempty"`
+	// Allow leaves out keys it returns false for, e.g. those a user may
+	// not read
+	Allow func(key string) bool `json:"-"`
+}
+
+// SearchResult is what a search returns. Total counts every matching key
+// before paging.
+type SearchResult struct {
+	Total int
+	Hits  []SearchHit
+}
+
+// SearchHit is a matching key, its score and the highlighted fragment of
+// its text
+type SearchHit struct {
+	Key       string  `json:"key"`
+	Score     float64 `json:"score"`
+	Highlight string  `json:"highlight,omitempty"`
+}
+
+// Search finds the keys of a full-text index matching a query, best first
+func (d *DB) Search(index, query string, opts SearchOptions) (SearchResult, error) {
+	if opts.Offset < 0 || opts.Limit < 0 {
+		return SearchResult{}, fmt.Errorf("%w: offset and limit must not be negative", ErrInvalidQuery)
+	}
+	alts, err := parseSearch(query)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	d.s.rlock()
+	defer d.s.Mu.RUnlock()
+	ix, ok := d.s.fullText[d.name][index]
+	if !ok {
+		return SearchResult{}, ErrNoSuchIndex
+	}
+
+	terms := ix.scoreTerms(alts)
+	now := time.Now()
+	hits := []SearchHit{}
+	for key := range ix.eval(alts) {
+		// Leave out keys that expired but have not been removed yet
+		if _, live := d.s.live(d.name, key, now); live && (opts.Allow == nil || opts.Allow(key)) {
+			hits = append(hits, SearchHit{Key: key, Score: ix.score(key, terms)})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Key < hits[j].Key
+	})
+	res := SearchResult{Total: len(hits), Hits: page(hits, QueryOptions{Offset: opts.Offset, Limit: opts.Limit})}
+	if res.Hits == nil {
+		res.Hits = []SearchHit{}
+	}
+	if opts.Highlight {
+		pre, post := opts.PreTag, opts.PostTag
+		if pre == "" && post == "" {
+			pre, post = "<b>", "</b>"
+		}
+		for i := range res.Hits {
+			item, _ := d.s.live(d.name, res.Hits[i].Key, now)
+			res.Hits[i].Highlight = ix.highlight(item, terms, pre, post)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,219 @@
+package store
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestStem(t *testing.T) {
+	tests := map[string]string{
+		"caresses":       "caress",
+		"ponies":         "poni",
+		"cats":           "cat",
+		"agreed":         "agre",
+		"plastered":      "plaster",
+		"motoring":       "motor",
+		"sing":           "sing",
+		"hopping":        "hop",
+		"falling":        "fall",
+		"filing":         "file",
+		"happy":          "happi",
+		"sky":            "sky",
+		"relational":     "relat",
+		"digitizer":      "digit",
+		"generalization": "gener",
+		"hopeful":        "hope",
+		"goodness":       "good",
+		"adjustment":     "adjust",
+		"controll":       "control",
+		"connected":      "connect",
+		"connecting":     "connect",
+		"connection":     "connect",
+		"running":        "run",
+		"runs":           "run",
+		"computer":       "comput",
+		// Too short, or not lower case ASCII letters
+		"is":     "is",
+		"naïves": "naïves",
+		"mp3s":   "mp3s",
+	}
+	for word, want := range tests {
+		if got := stem(word); got != want {
+			t.Errorf("stem(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
+
+// textIndex returns a namespace with a full-text index over strings
+// holding texts, named a, b, c... in order
+func textIndex(t *testing.T, texts ...string) *DB {
+	t.Helper()
+	s := NewRedisMemoryStore()
+	t.Cleanup(s.Close)
+	d := s.DB(DefaultDB)
+	if err := d.CreateFullText(FullTextDef{Name: "docs"}); err != nil {
+		t.Fatal(err)
+	}
+	for i, text := range texts {
+		if err := d.Set(string(rune('a'+i)), text, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return d
+}
+
+func searchKeys(t *testing.T, d *DB, query string) []string {
+	t.Helper()
+	res, err := d.Search("docs", query, SearchOptions{Limit: 100})
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	keys := []string{}
+	for _, hit := range res.Hits {
+		keys = append(keys, hit.Key)
+	}
+	if res.Total != len(keys) {
+		t.Errorf("%s: total %d, %d hits", query, res.Total, len(keys))
+	}
+	return keys
+}
+
+// TestSearchPrefix checks that prefixes are matched against the words of
+// the text as written, not against their stems, which often differ
+func TestSearchPrefix(t *testing.T) {
+	d := textIndex(t, "the computer is running fast", "she runs every day", "happy days")
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"running*", []string{"a", "b"}},
+		{"runn*", []string{"a", "b"}},
+		{"RUN*", []string{"a", "b"}},
+		{"computer*", []string{"a"}},
+		{"comput*", []string{"a"}},
+		{"comp* fas*", []string{"a"}},
+		{"happy*", []string{"c"}},
+		{"da*", []string{"b", "c"}},
+		{"runx*", []string{}},
+		{"computers*", []string{}},
+		{"-run* da*", []string{"c"}},
+	}
+	for _, tt := range tests {
+		if got := searchKeys(t, d, tt.query); !sameKeys(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	// Words stay in the dictionary while any key holds them
+	if err := d.Set("d", "running late", nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b"} {
+		if _, err := d.Remove(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := searchKeys(t, d, "runn*"), []string{"d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("runn* after removing a and b: got %v, want %v", got, want)
+	}
+	if got := searchKeys(t, d, "comput*"); len(got) != 0 {
+		t.Errorf("comput* after removing a: got %v", got)
+	}
+	if err := d.Set("d", "walking", nil); err != nil {
+		t.Fatal(err)
+	}
+	d.s.rlock()
+	words := d.s.fullText[DefaultDB]["docs"].words
+	d.s.Mu.RUnlock()
+	if want := []string{"days", "happy", "walking"}; !reflect.DeepEqual(words, want) {
+		t.Errorf("dictionary %v, want %v", words, want)
+	}
+}
+
+func TestSearchPhrase(t *testing.T) {
+	d := textIndex(t,
+		"Noise cancelling headphones",
+		"cancelling the noise",
+		"the noise, cancelled",
+	)
+	// Phrases do not run from one string of a document into the next
+	if _, err := d.JSONSet("d", "$", `{"a":"white noise","b":"cancelling"}`, JSONSetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{`"noise cancelling"`, []string{"a", "c"}},
+		{`"noise cancelled headphones"`, []string{"a"}},
+		{`"cancelling noise"`, []string{}},
+		{`"cancelling the noise"`, []string{"b"}},
+		{"noise cancelling", []string{"a", "b", "c", "d"}},
+		{`"white noise" -"noise cancelling"`, []string{"d"}},
+		{`"headphones" | "the noise"`, []string{"a", "b", "c"}},
+	}
+	for _, tt := range tests {
+		if got := searchKeys(t, d, tt.query); !sameKeys(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+// sameKeys compares keys ignoring their order
+func sameKeys(got, want []string) bool {
+	seen := map[string]bool{}
+	for _, key := range want {
+		seen[key] = true
+	}
+	for _, key := range got {
+		if !seen[key] {
+			return false
+		}
+	}
+	return len(got) == len(want)
+}
+
+func TestSearchRanking(t *testing.T) {
+	tests := []struct {
+		name  string
+		texts []string
+		query string
+		want  []string
+	}{
+		{"shorter text first", []string{"apple banana cherry date elder", "apple fig"}, "apple", []string{"b", "a"}},
+		{"more occurrences first", []string{"apple pear plum", "apple apple pear"}, "apple", []string{"b", "a"}},
+		{"rarer word first", []string{"common one", "common two", "rare three", "common four"}, "common | rare", []string{"c", "a", "b", "d"}},
+		{"more words found first", []string{"red car", "red blue car", "blue boat"}, "red | blue", []string{"b", "a", "c"}},
+		{"ties by key", []string{"same text", "same text"}, "same", []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		d := textIndex(t, tt.texts...)
+		res, err := d.Search("docs", tt.query, SearchOptions{Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for i, hit := range res.Hits {
+			keys = append(keys, hit.Key)
+			if hit.Score <= 0 || (i > 0 && hit.Score > res.Hits[i-1].Score) {
+				t.Errorf("%s: scores out of order: %+v", tt.name, res.Hits)
+			}
+		}
+		if !reflect.DeepEqual(keys, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, keys, tt.want)
+		}
+	}
+}
+
+func TestSearchInvalid(t *testing.T) {
+	d := textIndex(t, "text")
+	for _, query := range []string{"", " ", "|", "a |", `"unterminated`, `""`, "--", "a-b*", "*"} {
+		if _, err := d.Search("docs", query, SearchOptions{Limit: 10}); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("%q: err = %v, want ErrInvalidQuery", query, err)
+		}
+	}
+	if _, err := d.Search("nope", "text", SearchOptions{}); !errors.Is(err, ErrNoSuchIndex) {
+		t.Errorf("unknown index: err = %v", err)
+	}
+}
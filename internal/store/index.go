@@ -0,0 +1,419 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrIndexExists  = errors.New("index already exists")
+	ErrNoSuchIndex  = errors.New("no such index")
+	ErrInvalidIndex = errors.New("invalid index definition")
+)
+
+// Secondary indexes make JSON documents findable by their contents. An
+// index covers the JSON keys of one namespace that start with one of its
+// prefixes, and indexes the values a JSON path selects in each as a field:
+//
+//	tag      exact values, strings or the text of numbers and booleans
+//	numeric  numbers, for range queries
+//	text     the words of strings, matched case-insensitively
+//
+// Only JSON documents are indexed: there is no hash type, and strings,
+// lists, streams, queues and locks under the prefixes are left out.
+//
+// Indexes are kept current by put and del, which every write, deletion,
+// eviction and expiry goes through, and rebuilt when a namespace's keys
+// are replaced wholesale. They are derived state: only their definitions
+// are replicated and saved in snapshots.
+
+// IndexFieldType is how a field is indexed
+type IndexFieldType string
+
+const (
+	TagField     IndexFieldType = "tag"
+	NumericField IndexFieldType = "numeric"
+	TextField    IndexFieldType = "text"
+)
+
+// IndexField is a field of an index
+type IndexField struct {
+	Name string `json:"name"`
+	// Path is the JSON path of the field's values, $.<name> by default
+	Path string         `json:"path,omitempty"`
+	Type IndexFieldType `json:"type"`
+}
+
+// IndexDef defines an index over the JSON documents under its prefixes
+type IndexDef struct {
+	Name string `json:"name"`
+	// Prefixes are the key prefixes the index covers; none covers every key
+	Prefixes []string     `json:"prefixes,omitempty"`
+	Fields   []IndexField `json:"fields"`
+}
+
+// IndexInfo describes an index
+type IndexInfo struct {
+	IndexDef
+	// Docs is the number of keys the index holds
+	Docs int `json:"docs"`
+}
+
+func (f IndexField) path() string {
+	if f.Path == "" {
+		return "$." + f.Name
+	}
+	return f.Path
+}
+
+func (def IndexDef) validate() error {
+	if def.Name == "" || len(def.Name) > 64 || len(def.Fields) == 0 {
+		return ErrInvalidIndex
+	}
+	seen := map[string]bool{}
+	for _, f := range def.Fields {
+		if f.Name == "" || seen[f.Name] {
+			return fmt.Errorf("%w: field names must be unique and not empty", ErrInvalidIndex)
+		}
+		seen[f.Name] = true
+		switch f.Type {
+		case TagField, NumericField, TextField:
+		default:
+			return fmt.Errorf("%w: field %s has unknown type %q", ErrInvalidIndex, f.Name, f.Type)
+		}
+		if _, err := parsePath(f.path()); err != nil {
+			return fmt.Errorf("%w: field %s: %v", ErrInvalidIndex, f.Name, err)
+		}
+	}
+	return nil
+}
+
+type keySet map[string]struct{}
+
+// searchIndex is an index and the postings of the keys it covers
+type searchIndex struct {
+	def   IndexDef
+	paths []jsonPath
+	docs  map[string]*indexedDoc
+	// Postings by field position: tags and words map a value to the keys
+	// holding it, numbers are sorted by value
+	tags    []map[string]keySet
+	words   []map[string]keySet
+	numbers [][]numberEntry
+}
+
+// indexedDoc is what an index extracted from a key, by field position
+type indexedDoc struct {
+	tags    [][]string
+	words   [][]string
+	numbers [][]float64
+	// first is the first value of each field, used to sort and group: a
+	// string, a float64 or nil
+	first []interface{}
+}
+
+type numberEntry struct {
+	value float64
+	key   string
+}
+
+func newSearchIndex(def IndexDef) *searchIndex {
+	ix := &searchIndex{
+		def:     def,
+		docs:    map[string]*indexedDoc{},
+		tags:    make([]map[string]keySet, len(def.Fields)),
+		words:   make([]map[string]keySet, len(def.Fields)),
+		numbers: make([][]numberEntry, len(def.Fields)),
+	}
+	for i, f := range def.Fields {
+		// Definitions are validated before they get here
+		p, _ := parsePath(f.path())
+		ix.paths = append(ix.paths, p)
+		ix.tags[i], ix.words[i] = map[string]keySet{}, map[string]keySet{}
+	}
+	return ix
+}
+
+// field returns the position of the named field
+func (ix *searchIndex) field(name string) (int, bool) {
+	for i, f := range ix.def.Fields {
+		if f.Name == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// covers reports whether key starts with one of the index's prefixes
+func (ix *searchIndex) covers(key string) bool {
+	if len(ix.def.Prefixes) == 0 {
+		return true
+	}
+	for _, p := range ix.def.Prefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// update indexes item under key, or drops key if item is not a document
+func (ix *searchIndex) update(key string, item *Item) {
+	ix.remove(key)
+	doc, ok := item.Value.(*JSONDoc)
+	if !ok {
+		return
+	}
+	n := len(ix.def.Fields)
+	d := &indexedDoc{
+		tags:    make([][]string, n),
+		words:   make([][]string, n),
+		numbers: make([][]float64, n),
+		first:   make([]interface{}, n),
+	}
+	for i, f := range ix.def.Fields {
+		for _, l := range ix.paths[i].eval(doc.Root) {
+			switch f.Type {
+			case TagField:
+				for _, tag := range tagValues(l.value) {
+					d.tags[i] = append(d.tags[i], tag)
+					addPosting(ix.tags[i], tag, key)
+				}
+			case NumericField:
+				if n, ok := l.value.(json.Number); ok {
+					if v, err := n.Float64(); err == nil {
+						d.numbers[i] = append(d.numbers[i], v)
+						ix.insertNumber(i, v, key)
+					}
+				}
+			case TextField:
+				if s, ok := l.value.(string); ok {
+					for _, w := range tokenize(s) {
+						d.words[i] = append(d.words[i], w)
+						addPosting(ix.words[i], w, key)
+					}
+					if d.first[i] == nil {
+						d.first[i] = s
+					}
+				}
+			}
+		}
+		switch {
+		case len(d.tags[i]) > 0:
+			d.first[i] = d.tags[i][0]
+		case len(d.numbers[i]) > 0:
+			d.first[i] = d.numbers[i][0]
+		}
+	}
+	ix.docs[key] = d
+}
+
+// remove drops key from the index
+func (ix *searchIndex) remove(key string) {
+	d, ok := ix.docs[key]
+	if !ok {
+		return
+	}
+	for i := range ix.def.Fields {
+		for _, tag := range d.tags[i] {
+			removePosting(ix.tags[i], tag, key)
+		}
+		for _, w := range d.words[i] {
+			removePosting(ix.words[i], w, key)
+		}
+		for _, v := range d.numbers[i] {
+			ix.deleteNumber(i, v, key)
+		}
+	}
+	delete(ix.docs, key)
+}
+
+func addPosting(postings map[string]keySet, value, key string) {
+	keys, ok := postings[value]
+	if !ok {
+		keys = keySet{}
+		postings[value] = keys
+	}
+	keys[key] = struct{}{}
+}
+
+func removePosting(postings map[string]keySet, value, key string) {
+	if keys, ok := postings[value]; ok {
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(postings, value)
+		}
+	}
+}
+
+// searchNumber returns where value and key are or belong in the sorted
+// entries of field i
+func (ix *searchIndex) searchNumber(i int, value float64, key string) int {
+	entries := ix.numbers[i]
+	return sort.Search(len(entries), func(j int) bool {
+		e := entries[j]
+		return e.value > value || (e.value == value && e.key >= key)
+	})
+}
+
+func (ix *searchIndex) insertNumber(i int, value float64, key string) {
+	at := ix.searchNumber(i, value, key)
+	entries := ix.numbers[i]
+	if at < len(entries) && entries[at] == (numberEntry{value, key}) {
+		// The same value twice in one document
+		return
+	}
+	entries = append(entries, numberEntry{})
+	copy(entries[at+1:], entries[at:])
+	entries[at] = numberEntry{value, key}
+	ix.numbers[i] = entries
+}
+
+func (ix *searchIndex) deleteNumber(i int, value float64, key string) {
+	at := ix.searchNumber(i, value, key)
+	entries := ix.numbers[i]
+	if at < len(entries) && entries[at] == (numberEntry{value, key}) {
+		ix.numbers[i] = append(entries[:at], entries[at+1:]...)
+	}
+}
+
+// tagValues returns the tags of a value: strings as they are, the text of
+// numbers and booleans, and those of the elements of an array
+func tagValues(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case json.Number:
+		return []string{v.String()}
+	case bool:
+		return []string{fmt.Sprint(v)}
+	case []interface{}:
+		var out []string
+		for _, e := range v {
+			if _, nested := e.([]interface{}); !nested {
+				out = append(out, tagValues(e)...)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// tokenize splits text into lower case words of letters and digits
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// indexPut updates the indexes covering key in db after a put. The caller
+// must hold s.Mu.
+func (s *DataObj) indexPut(db, key string, item *Item) {
+	for _, ix := range s.indexes[db] {
+		if ix.covers(key) {
+			ix.update(key, item)
+		}
+	}
+}
+
+// indexDel removes key in db from the indexes. The caller must hold s.Mu.
+func (s *DataObj) indexDel(db, key string) {
+	for _, ix := range s.indexes[db] {
+		ix.remove(key)
+	}
+}
+
+// reindex rebuilds the secondary and full-text indexes of db from its
+// keys. The caller must hold s.Mu.
+func (s *DataObj) reindex(db string) {
+	for name, ix := range s.indexes[db] {
+		s.indexes[db][name] = s.buildIndex(db, ix.def)
+	}
+	for name, ix := range s.fullText[db] {
+		s.fullText[db][name] = s.buildFullText(db, ix.def)
+	}
+}
+
+// buildIndex creates an index over the keys already in db. The caller
+// must hold s.Mu.
+func (s *DataObj) buildIndex(db string, def IndexDef) *searchIndex {
+	ix := newSearchIndex(def)
+	for key, item := range s.keys(db) {
+		if ix.covers(key) {
+			ix.update(key, item)
+		}
+	}
+	return ix
+}
+
+// CreateIndex defines an index and indexes the keys it covers
+func (d *DB) CreateIndex(def IndexDef) error {
+	if err := def.validate(); err != nil {
+		return err
+	}
+	return d.s.exec(withArgs(Command{Op: OpCreateIndex, DB: d.name, Key: def.Name}, def)).Err
+}
+
+func (s *DataObj) applyCreateIndex(cmd Command) Result {
+	var def IndexDef
+	if err := decodeArgs(cmd, &def); err != nil {
+		return Result{Err: err}
+	}
+	if err := def.validate(); err != nil {
+		return Result{Err: err}
+	}
+	if _, exists := s.indexes[cmd.DB][def.Name]; exists {
+		return Result{Err: ErrIndexExists}
+	}
+	if s.indexes == nil {
+		s.indexes = map[string]map[string]*searchIndex{}
+	}
+	if s.indexes[cmd.DB] == nil {
+		s.indexes[cmd.DB] = map[string]*searchIndex{}
+	}
+	s.indexes[cmd.DB][def.Name] = s.buildIndex(cmd.DB, def)
+	return Result{OK: true}
+}
+
+// DropIndex deletes an index, keeping the keys it covered
+func (d *DB) DropIndex(name string) error {
+	return d.s.exec(Command{Op: OpDropIndex, DB: d.name, Key: name}).Err
+}
+
+func (s *DataObj) applyDropIndex(cmd Command) Result {
+	if _, exists := s.indexes[cmd.DB][cmd.Key]; !exists {
+		return Result{Err: ErrNoSuchIndex}
+	}
+	delete(s.indexes[cmd.DB], cmd.Key)
+	if len(s.indexes[cmd.DB]) == 0 {
+		delete(s.indexes, cmd.DB)
+	}
+	return Result{OK: true}
+}
+
+// Indexes describes the indexes of the namespace, sorted by name
+func (d *DB) Indexes() []IndexInfo {
+	d.s.rlock()
+	defer d.s.Mu.RUnlock()
+	out := []IndexInfo{}
+	for _, ix := range d.s.indexes[d.name] {
+		out = append(out, IndexInfo{IndexDef: ix.def, Docs: len(ix.docs)})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Index describes one index of the namespace
+func (d *DB) Index(name string) (IndexInfo, error) {
+	d.s.rlock()
+	defer d.s.Mu.RUnlock()
+	ix, ok := d.s.indexes[d.name][name]
+	if !ok {
+		return IndexInfo{}, ErrNoSuchIndex
+	}
+	return IndexInfo{IndexDef: ix.def, Docs: len(ix.docs)}, nil
+}
@@ -0,0 +1,619 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrInvalidJSON = errors.New("invalid JSON value")
+	ErrNumberRange = errors.New("result is out of range for a JSON number")
+)
+
+// JSONDoc is a parsed JSON document. Objects are map[string]interface{},
+// arrays []interface{} and numbers json.Number, which keeps integers
+// exact. Documents are never changed in place: commands change a copy and
+// store it, so values read from a document stay valid without the lock.
+type JSONDoc struct {
+	Root interface{}
+	// size is the estimated size of Root, see memory.go
+	size int64
+}
+
+func newJSONDoc(root interface{}) *JSONDoc {
+	return &JSONDoc{Root: root, size: jsonSize(root)}
+}
+
+func (d *JSONDoc) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.Root)
+}
+
+// ParseJSON parses a JSON value as the store holds it
+func ParseJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, ErrInvalidJSON
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, ErrInvalidJSON
+	}
+	return v, nil
+}
+
+// ValidJSONPath checks the syntax of a JSON path, see jsonpath.go
+func ValidJSONPath(path string) error {
+	_, err := parsePath(path)
+	return err
+}
+
+func jsonSize(v interface{}) int64 {
+	switch v := v.(type) {
+	case string:
+		return int64(len(v)) + stringOverhead
+	case json.Number:
+		return int64(len(v)) + stringOverhead
+	case map[string]interface{}:
+		n := int64(stringOverhead)
+		for name, e := range v {
+			n += int64(len(name)) + jsonSize(e)
+		}
+		return n
+	case []interface{}:
+		n := int64(stringOverhead)
+		for _, e := range v {
+			n += jsonSize(e)
+		}
+		return n
+	}
+	return stringOverhead
+}
+
+// copyJSON returns a deep copy of v
+func copyJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for name, e := range v {
+			m[name] = copyJSON(e)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, e := range v {
+			a[i] = copyJSON(e)
+		}
+		return a
+	}
+	return v
+}
+
+// lookup returns the value at steps, the members and indexes leading to it
+func (d *JSONDoc) lookup(steps []interface{}) (interface{}, bool) {
+	v := d.Root
+	for _, step := range steps {
+		switch c := v.(type) {
+		case map[string]interface{}:
+			name, ok := step.(string)
+			if !ok {
+				return nil, false
+			}
+			if v, ok = c[name]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, ok := step.(int)
+			if !ok || i >= len(c) {
+				return nil, false
+			}
+			v = c[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// set replaces the value at steps, or adds it if its parent is an object.
+// It reports false if there is no such place, which happens when an
+// earlier change to the same document removed it.
+func (d *JSONDoc) set(steps []interface{}, v interface{}) bool {
+	if len(steps) == 0 {
+		d.Root = v
+		return true
+	}
+	parent, ok := d.lookup(steps[:len(steps)-1])
+	if !ok {
+		return false
+	}
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		name, ok := steps[len(steps)-1].(string)
+		if ok {
+			p[name] = v
+		}
+		return ok
+	case []interface{}:
+		i, ok := steps[len(steps)-1].(int)
+		if !ok || i >= len(p) {
+			return false
+		}
+		p[i] = v
+		return true
+	}
+	return false
+}
+
+// remove deletes the value at steps, which must not be the root
+func (d *JSONDoc) remove(steps []interface{}) bool {
+	parent, ok := d.lookup(steps[:len(steps)-1])
+	if !ok {
+		return false
+	}
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		name, _ := steps[len(steps)-1].(string)
+		if _, ok := p[name]; !ok {
+			return false
+		}
+		delete(p, name)
+		return true
+	case []interface{}:
+		i, ok := steps[len(steps)-1].(int)
+		if !ok || i >= len(p) {
+			return false
+		}
+		return d.set(steps[:len(steps)-1], append(p[:i:i], p[i+1:]...))
+	}
+	return false
+}
+
+// JSONTypeName returns the type of a value in a document: object, array,
+// string, integer, number, boolean or null
+func JSONTypeName(v interface{}) string {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return "null"
+}
+
+type jsonArgs struct {
+	Path string `json:"path"`
+	NX   bool   `json:"nx,omitempty"`
+	XX   bool   `json:"xx,omitempty"`
+	// By is the increment of NUMINCRBY
+	By json.Number `json:"by,omitempty"`
+	// Values are the JSON texts ARRAPPEND appends
+	Values []string `json:"values,omitempty"`
+	// Index is the element ARRPOP removes
+	Index int `json:"index,omitempty"`
+}
+
+// jsonDoc returns the document stored under key in db, or nil if there is
+// none. The caller must hold s.Mu.
+func (s *DataObj) jsonDoc(db, key string, now time.Time) (*Item, *JSONDoc, error) {
+	item, exists := s.live(db, key, now)
+	if !exists {
+		return nil, nil, nil
+	}
+	if item.Type != JSONType {
+		return nil, nil, ErrWrongType
+	}
+	return item, item.Value.(*JSONDoc), nil
+}
+
+// readJSON returns what path selects in the document under key and the
+// key's version
+func (d *DB) readJSON(key, path string) ([]jsonLocation, uint64, error) {
+	p, err := parsePath(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	d.s.rlock()
+	defer d.s.Mu.RUnlock()
+	item, doc, err := d.s.jsonDoc(d.name, key, time.Now())
+	if err != nil {
+		return nil, 0, err
+	}
+	if doc == nil {
+		return nil, 0, ErrNoSuchKey
+	}
+	return p.eval(doc.Root), item.Version, nil
+}
+
+// execJSON runs a JSON command after checking its path
+func (d *DB) execJSON(op Op, key, value string, args jsonArgs) Result {
+	if _, err := parsePath(args.Path); err != nil {
+		return Result{Err: err}
+	}
+	return d.s.exec(withArgs(Command{Op: op, DB: d.name, Key: key, Value: value}, args))
+}
+
+// changeJSON applies change to a copy of the document under cmd.Key and
+// stores the copy if change reports it changed
+func (s *DataObj) changeJSON(cmd Command, change func(doc *JSONDoc, path jsonPath, a jsonArgs) (bool, interface{}, error)) Result {
+	var a jsonArgs
+	if err := decodeArgs(cmd, &a); err != nil {
+		return Result{Err: err}
+	}
+	path, err := parsePath(a.Path)
+	if err != nil {
+		return Result{Err: err}
+	}
+	item, doc, err := s.jsonDoc(cmd.DB, cmd.Key, cmd.Now)
+	if err != nil {
+		return Result{Err: err}
+	}
+	if doc == nil {
+		return Result{Err: ErrNoSuchKey}
+	}
+	next := &JSONDoc{Root: copyJSON(doc.Root)}
+	changed, data, err := change(next, path, a)
+	if err != nil || !changed {
+		return Result{Data: data, Err: err}
+	}
+	return s.putJSON(cmd, next, item.ExpiresAt, data)
+}
+
+// putJSON stores doc under cmd.Key and returns a result carrying data
+func (s *DataObj) putJSON(cmd Command, doc *JSONDoc, expiresAt time.Time, data interface{}) Result {
+	doc.size = jsonSize(doc.Root)
+	item := &Item{Type: JSONType, Value: doc, ExpiresAt: expiresAt}
+	if err := s.admit(cmd, s.growth(cmd.DB, cmd.Key, item), int(doc.size)); err != nil {
+		return Result{Err: err}
+	}
+	if err := s.reserve(cmd); err != nil {
+		return Result{Err: err}
+	}
+	s.put(cmd.DB, cmd.Key, item)
+	return Result{Data: data, OK: true}
+}
+
+// JSONSetOptions are the conditions of JSONSet
+type JSONSetOptions struct {
+	// NX only sets the path if it does not exist, XX only if it does
+	NX bool
+	XX bool
+}
+
+// JSONSet sets the values path selects in the document under key to the
+// JSON text value, or adds a member if the last step of path names one
+// that does not exist. A key that does not exist or holds no document is
+// only created by setting the root path $. It reports false if nothing
+// was set.
+func (d *DB) JSONSet(key, path, value string, opts JSONSetOptions) (bool, error) {
+	if opts.NX && opts.XX {
+		return false, ErrConflictingOptions
+	}
+	if _, err := ParseJSON([]byte(value)); err != nil {
+		return false, err
+	}
+	res := d.execJSON(OpJSONSet, key, value, jsonArgs{Path: path, NX: opts.NX, XX: opts.XX})
+	return res.OK, res.Err
+}
+
+func (s *DataObj) applyJSONSet(cmd Command) Result {
+	var a jsonArgs
+	if err := decodeArgs(cmd, &a); err != nil {
+		return Result{Err: err}
+	}
+	path, err := parsePath(a.Path)
+	if err != nil {
+		return Result{Err: err}
+	}
+	value, err := ParseJSON([]byte(cmd.Value))
+	if err != nil {
+		return Result{Err: err}
+	}
+	item, doc, err := s.jsonDoc(cmd.DB, cmd.Key, cmd.Now)
+	if err != nil {
+		return Result{Err: err}
+	}
+	if doc == nil {
+		if !path.isRoot() {
+			return Result{Err: ErrNoSuchKey}
+		}
+		if a.XX {
+			return Result{}
+		}
+		return s.putJSON(cmd, &JSONDoc{Root: value}, time.Time{}, nil)
+	}
+	if path.isRoot() {
+		if a.NX {
+			return Result{}
+		}
+		return s.putJSON(cmd, &JSONDoc{Root: value}, item.ExpiresAt, nil)
+	}
+
+	next := &JSONDoc{Root: copyJSON(doc.Root)}
+	set := false
+	if locs := path.eval(next.Root); len(locs) > 0 {
+		if a.NX {
+			return Result{}
+		}
+		for _, l := range locs {
+			set = next.set(l.steps, copyJSON(value)) || set
+		}
+	} else {
+		// Add a member to the objects the rest of the path selects
+		last := path[len(path)-1]
+		if a.XX || last.descendant || len(last.selectors) != 1 || last.selectors[0].kind != selectName {
+			return Result{}
+		}
+		for _, l := range path[:len(path)-1].eval(next.Root) {
+			if _, ok := l.value.(map[string]interface{}); ok {
+				set = next.set(l.child(last.selectors[0].name, nil).steps, copyJSON(value)) || set
+			}
+		}
+	}
+	if !set {
+		return Result{}
+	}
+	return s.putJSON(cmd, next, item.ExpiresAt, nil)
+}
+
+// JSONGet returns the values path selects in the document under key, and
+// the key's version. For the root path that is the document alone.
+func (d *DB) JSONGet(key, path string) ([]interface{}, uint64, error) {
+	locs, version, err := d.readJSON(key, path)
+	if err != nil {
+		return nil, 0, err
+	}
+	values := make([]interface{}, len(locs))
+	for i, l := range locs {
+		values[i] = l.value
+	}
+	return values, version, nil
+}
+
+// JSONDel deletes the values path selects in the document under key, or
+// the key itself for the root path, and returns how many it deleted
+func (d *DB) JSONDel(key, path string) (int, error) {
+	res := d.execJSON(OpJSONDel, key, "", jsonArgs{Path: path})
+	return res.N, res.Err
+}
+
+func (s *DataObj) applyJSONDel(cmd Command) Result {
+	var a jsonArgs
+	if err := decodeArgs(cmd, &a); err != nil {
+		return Result{Err: err}
+	}
+	path, err := parsePath(a.Path)
+	if err != nil {
+		return Result{Err: err}
+	}
+	_, doc, err := s.jsonDoc(cmd.DB, cmd.Key, cmd.Now)
+	if err != nil || doc == nil {
+		return Result{Err: err}
+	}
+	if path.isRoot() {
+		s.del(cmd.DB, cmd.Key)
+		return Result{N: 1, OK: true}
+	}
+	res := s.changeJSON(cmd, func(doc *JSONDoc, path jsonPath, _ jsonArgs) (bool, interface{}, error) {
+		locs := path.eval(doc.Root)
+		n := 0
+		// Later values first, so removing one does not move the others
+		for i := len(locs) - 1; i >= 0; i-- {
+			if doc.remove(locs[i].steps) {
+				n++
+			}
+		}
+		return n > 0, n, nil
+	})
+	if n, ok := res.Data.(int); ok {
+		res.N = n
+	}
+	return res
+}
+
+// JSONNumIncrBy adds by to the numbers path selects in the document under
+// key and returns their new values, with nil for values that are not
+// numbers. Integers stay integers while the result fits in an int64.
+func (d *DB) JSONNumIncrBy(key, path string, by json.Number) ([]interface{}, error) {
+	if _, err := by.Float64(); err != nil {
+		return nil, ErrInvalidJSON
+	}
+	res := d.execJSON(OpJSONNumIncrBy, key, "", jsonArgs{Path: path, By: by})
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	return res.Data.([]interface{}), nil
+}
+
+func (s *DataObj) applyJSONNumIncrBy(cmd Command) Result {
+	return s.changeJSON(cmd, func(doc *JSONDoc, path jsonPath, a jsonArgs) (bool, interface{}, error) {
+		locs := path.eval(doc.Root)
+		out := make([]interface{}, len(locs))
+		changed := false
+		for i, l := range locs {
+			n, ok := l.value.(json.Number)
+			if !ok {
+				continue
+			}
+			sum, err := addNumbers(n, a.By)
+			if err != nil {
+				return false, nil, err
+			}
+			if doc.set(l.steps, sum) {
+				out[i], changed = sum, true
+			}
+		}
+		return changed, out, nil
+	})
+}
+
+// addNumbers adds two JSON numbers, exactly if both are integers and the
+// sum fits in an int64
+func addNumbers(a, b json.Number) (json.Number, error) {
+	x, errX := a.Int64()
+	y, errY := b.Int64()
+	if errX == nil && errY == nil {
+		if sum := x + y; (sum > x) == (y > 0) {
+			return json.Number(strconv.FormatInt(sum, 10)), nil
+		}
+	}
+	f, _ := a.Float64()
+	g, _ := b.Float64()
+	sum := f + g
+	if math.IsInf(sum, 0) || math.IsNaN(sum) {
+		return "", ErrNumberRange
+	}
+	return json.Number(strconv.FormatFloat(sum, 'g', -1, 64)), nil
+}
+
+// JSONArrAppend appends the JSON texts values to the arrays path selects
+// in the document under key and returns their new lengths, with nil for
+// values that are not arrays
+func (d *DB) JSONArrAppend(key, path string, values ...string) ([]*int, error) {
+	for _, v := range values {
+		if _, err := ParseJSON([]byte(v)); err != nil {
+			return nil, err
+		}
+	}
+	res := d.execJSON(OpJSONArrAppend, key, "", jsonArgs{Path: path, Values: values})
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	return res.Data.([]*int), nil
+}
+
+func (s *DataObj) applyJSONArrAppend(cmd Command) Result {
+	return s.changeJSON(cmd, func(doc *JSONDoc, path jsonPath, a jsonArgs) (bool, interface{}, error) {
+		values := make([]interface{}, len(a.Values))
+		for i, text := range a.Values {
+			v, err := ParseJSON([]byte(text))
+			if err != nil {
+				return false, nil, err
+			}
+			values[i] = v
+		}
+		locs := path.eval(doc.Root)
+		out := make([]*int, len(locs))
+		changed := false
+		for i, l := range locs {
+			arr, ok := l.value.([]interface{})
+			if !ok {
+				continue
+			}
+			for _, v := range values {
+				arr = append(arr, copyJSON(v))
+			}
+			if doc.set(l.steps, arr) {
+				n := len(arr)
+				out[i], changed = &n, true
+			}
+		}
+		return changed, out, nil
+	})
+}
+
+// JSONArrPop removes and returns the element at index of the arrays path
+// selects in the document under key. A negative index counts from the
+// end, and one out of range pops the first or last element. The result
+// has nil for values that are not arrays or are empty.
+func (d *DB) JSONArrPop(key, path string, index int) ([]interface{}, error) {
+	res := d.execJSON(OpJSONArrPop, key, "", jsonArgs{Path: path, Index: index})
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	return res.Data.([]interface{}), nil
+}
+
+func (s *DataObj) applyJSONArrPop(cmd Command) Result {
+	return s.changeJSON(cmd, func(doc *JSONDoc, path jsonPath, a jsonArgs) (bool, interface{}, error) {
+		locs := path.eval(doc.Root)
+		out := make([]interface{}, len(locs))
+		changed := false
+		for i, l := range locs {
+			arr, ok := l.value.([]interface{})
+			if !ok || len(arr) == 0 {
+				continue
+			}
+			at := a.Index
+			if at < 0 {
+				at += len(arr)
+			}
+			at = min(max(at, 0), len(arr)-1)
+			popped := arr[at]
+			if doc.set(l.steps, append(arr[:at:at], arr[at+1:]...)) {
+				out[i], changed = popped, true
+			}
+		}
+		return changed, out, nil
+	})
+}
+
+// JSONStrLen returns the lengths in bytes of the strings path selects in
+// the document under key, with nil for values that are not strings
+func (d *DB) JSONStrLen(key, path string) ([]*int, error) {
+	locs, _, err := d.readJSON(key, path)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*int, len(locs))
+	for i, l := range locs {
+		if s, ok := l.value.(string); ok {
+			n := len(s)
+			out[i] = &n
+		}
+	}
+	return out, nil
+}
+
+// JSONObjKeys returns the member names, in order, of the objects path
+// selects in the document under key, with nil for values that are not
+// objects
+func (d *DB) JSONObjKeys(key, path string) ([][]string, error) {
+	locs, _, err := d.readJSON(key, path)
+	if err != nil {
+		return nil, err
+	}
+	out := make([][]string, len(locs))
+	for i, l := range locs {
+		m, ok := l.value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		names := make([]string, 0, len(m))
+		for name := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		out[i] = names
+	}
+	return out, nil
+}
+
+// JSONTypes returns the types of the values path selects in the document
+// under key, see JSONTypeName
+func (d *DB) JSONTypes(key, path string) ([]string, error) {
+	locs, _, err := d.readJSON(key, path)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, len(locs))
+	for i, l := range locs {
+		out[i] = JSONTypeName(l.value)
+	}
+	return out, nil
+}
@@ -0,0 +1,242 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// asJSON returns v as JSON text, for comparing values that hold
+// json.Number
+func asJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func jsonDB(t *testing.T, key, doc string) *DB {
+	t.Helper()
+	s := NewRedisMemoryStore()
+	t.Cleanup(s.Close)
+	d := s.DB(DefaultDB)
+	if _, err := d.JSONSet(key, "$", doc, JSONSetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestJSONPaths(t *testing.T) {
+	d := jsonDB(t, "doc", `{"a":{"b":[1,2,3],"c":"x"},"d":[{"n":1},{"n":2,"m":{"n":3}}],"e":null,"big":9007199254740993}`)
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"$.a.c", `["x"]`},
+		{"a.c", `["x"]`},
+		{".a.c", `["x"]`},
+		{"$['a']['c']", `["x"]`},
+		{"$.a.b[0]", `[1]`},
+		{"$.a.b[-1]", `[3]`},
+		{"$.a.b[1:]", `[2,3]`},
+		{"$.a.b[:2]", `[1,2]`},
+		{"$.a.b[0,2]", `[1,3]`},
+		{"$.a.b[*]", `[1,2,3]`},
+		{"$.d[*].n", `[1,2]`},
+		{"$..n", `[1,2,3]`},
+		{"$.e", `[null]`},
+		// Integers stay exact beyond the precision of a float64
+		{"$.big", `[9007199254740993]`},
+		{"$.missing", `[]`},
+		{"$.a.b[9]", `[]`},
+		{"$.a.c.x", `[]`},
+	}
+	for _, tt := range tests {
+		values, _, err := d.JSONGet("doc", tt.path)
+		if err != nil {
+			t.Errorf("%s: %v", tt.path, err)
+			continue
+		}
+		if got := asJSON(t, values); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.path, got, tt.want)
+		}
+	}
+	for _, path := range []string{"$.", "$[", "$.a[", "$.a[x]", "$.a[?(@.n)]", "$['a'"} {
+		if _, _, err := d.JSONGet("doc", path); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("%q: err = %v, want ErrInvalidPath", path, err)
+		}
+	}
+	if _, _, err := d.JSONGet("missing", "$"); !errors.Is(err, ErrNoSuchKey) {
+		t.Errorf("JSONGet of a missing key: err = %v, want ErrNoSuchKey", err)
+	}
+}
+
+func TestJSONSetAndDel(t *testing.T) {
+	d := jsonDB(t, "doc", `{"a":1,"list":[{"x":1},{"x":2}]}`)
+	get := func(path string) string {
+		t.Helper()
+		values, _, err := d.JSONGet("doc", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return asJSON(t, values)
+	}
+	_, before, _ := d.JSONGet("doc", "$")
+
+	tests := []struct {
+		path, value string
+		opts        JSONSetOptions
+		set         bool
+	}{
+		{"$.a", `2`, JSONSetOptions{}, true},
+		{"$.a", `3`, JSONSetOptions{NX: true}, false},
+		{"$.b", `"new"`, JSONSetOptions{XX: true}, false},
+		{"$.b", `"new"`, JSONSetOptions{NX: true}, true},
+		{"$.list[*].x", `0`, JSONSetOptions{}, true},
+		{"$.list[*].y", `true`, JSONSetOptions{}, true},
+		// Only a member of an existing object can be added
+		{"$.none.c", `1`, JSONSetOptions{}, false},
+		{"$.list[5]", `1`, JSONSetOptions{}, false},
+	}
+	for _, tt := range tests {
+		set, err := d.JSONSet("doc", tt.path, tt.value, tt.opts)
+		if err != nil || set != tt.set {
+			t.Errorf("JSONSet %s %s %+v = %v, %v, want %v", tt.path, tt.value, tt.opts, set, err, tt.set)
+		}
+	}
+	if got, want := get("$"), `[{"a":2,"b":"new","list":[{"x":0,"y":true},{"x":0,"y":true}]}]`; got != want {
+		t.Errorf("document %s, want %s", got, want)
+	}
+	if _, after, _ := d.JSONGet("doc", "$"); after == before {
+		t.Errorf("version %d unchanged by writes", after)
+	}
+
+	if _, err := d.JSONSet("doc", "$.a", `{bad`, JSONSetOptions{}); !errors.Is(err, ErrInvalidJSON) {
+		t.Errorf("JSONSet of invalid JSON: err = %v, want ErrInvalidJSON", err)
+	}
+	if _, err := d.JSONSet("doc", "$.a", `1`, JSONSetOptions{NX: true, XX: true}); !errors.Is(err, ErrConflictingOptions) {
+		t.Errorf("JSONSet with NX and XX: err = %v, want ErrConflictingOptions", err)
+	}
+	if _, err := d.JSONSet("other", "$.a", `1`, JSONSetOptions{}); !errors.Is(err, ErrNoSuchKey) {
+		t.Errorf("JSONSet below the root of a missing key: err = %v, want ErrNoSuchKey", err)
+	}
+	if err := d.Set("str", "v", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := d.JSONGet("str", "$"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("JSONGet of a string: err = %v, want ErrWrongType", err)
+	}
+
+	// Changing part of a document keeps its expiration
+	if ok, err := d.SetTTL("doc", time.Hour); !ok || err != nil {
+		t.Fatalf("SetTTL = %v, %v", ok, err)
+	}
+	if _, err := d.JSONSet("doc", "$.a", `5`, JSONSetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if ttl, ok := d.GetTTL("doc"); !ok || ttl <= 0 || ttl > time.Hour {
+		t.Errorf("TTL after JSONSet = %v, %v", ttl, ok)
+	}
+
+	if n, err := d.JSONDel("doc", "$.list[*].y"); err != nil || n != 2 {
+		t.Errorf("JSONDel of two members = %d, %v", n, err)
+	}
+	if n, err := d.JSONDel("doc", "$.list[0,1]"); err != nil || n != 2 {
+		t.Errorf("JSONDel of two elements = %d, %v", n, err)
+	}
+	if n, _ := d.JSONDel("doc", "$.missing"); n != 0 {
+		t.Errorf("JSONDel of a missing path = %d", n)
+	}
+	if got, want := get("$"), `[{"a":5,"b":"new","list":[]}]`; got != want {
+		t.Errorf("document after JSONDel %s, want %s", got, want)
+	}
+	if n, err := d.JSONDel("doc", "$"); err != nil || n != 1 {
+		t.Errorf("JSONDel of the root = %d, %v", n, err)
+	}
+	if _, _, found := d.Get("doc"); found {
+		t.Error("key kept after deleting the root")
+	}
+}
+
+func TestJSONOperations(t *testing.T) {
+	d := jsonDB(t, "doc", `{"n":1,"f":1.5,"s":"héllo","max":9223372036854775807,"arr":[1,2,3],"empty":[],"obj":{"b":1,"a":2}}`)
+
+	incr := func(path, by string) string {
+		t.Helper()
+		out, err := d.JSONNumIncrBy("doc", path, json.Number(by))
+		if err != nil {
+			t.Fatalf("JSONNumIncrBy %s %s: %v", path, by, err)
+		}
+		return asJSON(t, out)
+	}
+	if got := incr("$.n", "2"); got != `[3]` {
+		t.Errorf("integer increment: %s", got)
+	}
+	if got := incr("$.f", "-0.5"); got != `[1]` {
+		t.Errorf("float increment: %s", got)
+	}
+	if got := incr("$.max", "1"); got != `[9.223372036854776e+18]` {
+		t.Errorf("increment past int64, which becomes a float: %s", got)
+	}
+	if got := incr("$[\"n\",\"s\"]", "1"); got != `[4,null]` {
+		t.Errorf("increment of a number and a string: %s", got)
+	}
+	if _, err := d.JSONNumIncrBy("doc", "$.max", "1e308"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.JSONNumIncrBy("doc", "$.max", "1e308"); !errors.Is(err, ErrNumberRange) {
+		t.Errorf("increment to infinity: err = %v, want ErrNumberRange", err)
+	}
+	if _, err := d.JSONNumIncrBy("doc", "$.n", "x"); !errors.Is(err, ErrInvalidJSON) {
+		t.Errorf("increment by a non-number: err = %v, want ErrInvalidJSON", err)
+	}
+
+	lengths, err := d.JSONArrAppend("doc", "$[\"arr\",\"s\"]", `4`, `{"x":1}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := asJSON(t, lengths); got != `[5,null]` {
+		t.Errorf("JSONArrAppend lengths %s", got)
+	}
+	pop := func(path string, index int) string {
+		t.Helper()
+		out, err := d.JSONArrPop("doc", path, index)
+		if err != nil {
+			t.Fatalf("JSONArrPop %s %d: %v", path, index, err)
+		}
+		return asJSON(t, out)
+	}
+	if got := pop("$.arr", -1); got != `[{"x":1}]` {
+		t.Errorf("pop of the last element: %s", got)
+	}
+	if got := pop("$.arr", 0); got != `[1]` {
+		t.Errorf("pop of the first element: %s", got)
+	}
+	if got := pop("$.arr", 100); got != `[4]` {
+		t.Errorf("pop past the end: %s", got)
+	}
+	if got := pop("$.empty", 0); got != `[null]` {
+		t.Errorf("pop of an empty array: %s", got)
+	}
+	if values, _, _ := d.JSONGet("doc", "$.arr"); asJSON(t, values) != `[[2,3]]` {
+		t.Errorf("array after pops: %s", asJSON(t, values))
+	}
+
+	if got, _ := d.JSONStrLen("doc", "$[\"s\",\"n\"]"); asJSON(t, got) != `[6,null]` {
+		t.Errorf("JSONStrLen = %s", asJSON(t, got))
+	}
+	if got, _ := d.JSONObjKeys("doc", "$[\"obj\",\"arr\"]"); !reflect.DeepEqual(got, [][]string{{"a", "b"}, nil}) {
+		t.Errorf("JSONObjKeys = %v", got)
+	}
+	types, err := d.JSONTypes("doc", "$[\"obj\",\"arr\",\"s\",\"n\",\"f\"]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"object", "array", "string", "integer", "integer"}; !reflect.DeepEqual(types, want) {
+		t.Errorf("JSONTypes = %v, want %v", types, want)
+	}
+}
@@ -0,0 +1,311 @@
+package store
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidPath = errors.New("invalid JSON path")
+
+// A JSON path selects values in a document, as in JSONPath:
+//
+//	$              the root
+//	.name ['name'] a member of an object
+//	[0] [-1]       an element of an array, counting from the end if negative
+//	[1:3]          a slice of an array
+//	.* [*]         every member or element
+//	..name ..*     the same at any depth
+//	[0,2] ['a','b'] any of several
+//
+// Paths without the leading $, such as .a.b or a.b, are accepted too.
+// Filter expressions are not supported.
+
+type selectorKind int
+
+const (
+	selectName selectorKind = iota
+	selectIndex
+	selectSlice
+	selectAll
+)
+
+type selector struct {
+	kind  selectorKind
+	name  string
+	index int
+	// start and end of a slice, nil where omitted
+	start, end *int
+}
+
+type pathSegment struct {
+	// descendant applies the selectors at any depth, for ..
+	descendant bool
+	selectors  []selector
+}
+
+// jsonPath is a parsed path
+type jsonPath []pathSegment
+
+// jsonLocation is a value a path selected and where it is: the object
+// members and array indexes leading to it from the root
+type jsonLocation struct {
+	steps []interface{}
+	value interface{}
+}
+
+func parsePath(s string) (jsonPath, error) {
+	switch {
+	case s == "" || s == "." || s == "$":
+		return nil, nil
+	case strings.HasPrefix(s, "$"):
+		s = s[1:]
+	case !strings.HasPrefix(s, ".") && !strings.HasPrefix(s, "["):
+		s = "." + s
+	}
+
+	var path jsonPath
+	for s != "" {
+		var seg pathSegment
+		switch {
+		case strings.HasPrefix(s, ".."):
+			seg.descendant = true
+			s = s[2:]
+			if strings.HasPrefix(s, "[") {
+				break
+			}
+			fallthrough
+		case strings.HasPrefix(s, "."):
+			if !seg.descendant {
+				s = s[1:]
+			}
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			name := s[:end]
+			if name == "" {
+				return nil, ErrInvalidPath
+			}
+			s = s[end:]
+			if name == "*" {
+				seg.selectors = []selector{{kind: selectAll}}
+			} else {
+				seg.selectors = []selector{{kind: selectName, name: name}}
+			}
+			path = append(path, seg)
+			continue
+		case !strings.HasPrefix(s, "["):
+			return nil, ErrInvalidPath
+		}
+
+		sels, rest, err := parseBracket(s[1:])
+		if err != nil {
+			return nil, err
+		}
+		seg.selectors, s = sels, rest
+		path = append(path, seg)
+	}
+	return path, nil
+}
+
+// parseBracket parses the selectors of a [...] segment, s starting after
+// the [, and returns the rest of the path after the ]
+func parseBracket(s string) ([]selector, string, error) {
+	var sels []selector
+	for {
+		s = strings.TrimLeft(s, " ")
+		if s == "" {
+			return nil, "", ErrInvalidPath
+		}
+		var sel selector
+		switch q := s[0]; {
+		case q == '\'' || q == '"':
+			end := strings.IndexByte(s[1:], q)
+			if end < 0 {
+				return nil, "", ErrInvalidPath
+			}
+			sel = selector{kind: selectName, name: s[1 : end+1]}
+			s = s[end+2:]
+		case q == '*':
+			sel = selector{kind: selectAll}
+			s = s[1:]
+		default:
+			end := strings.IndexAny(s, ",]")
+			if end < 0 {
+				return nil, "", ErrInvalidPath
+			}
+			var err error
+			sel, err = parseIndex(strings.TrimSpace(s[:end]))
+			if err != nil {
+				return nil, "", err
+			}
+			s = s[end:]
+		}
+		sels = append(sels, sel)
+
+		s = strings.TrimLeft(s, " ")
+		switch {
+		case strings.HasPrefix(s, ","):
+			s = s[1:]
+		case strings.HasPrefix(s, "]"):
+			return sels, s[1:], nil
+		default:
+			return nil, "", ErrInvalidPath
+		}
+	}
+}
+
+// parseIndex parses an array index or slice
+func parseIndex(s string) (selector, error) {
+	bound := func(s string) (*int, error) {
+		if s == "" {
+			return nil, nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, ErrInvalidPath
+		}
+		return &n, nil
+	}
+	if from, to, ok := strings.Cut(s, ":"); ok {
+		start, err := bound(strings.TrimSpace(from))
+		if err != nil {
+			return selector{}, err
+		}
+		end, err := bound(strings.TrimSpace(to))
+		if err != nil {
+			return selector{}, err
+		}
+		return selector{kind: selectSlice, start: start, end: end}, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return selector{}, ErrInvalidPath
+	}
+	return selector{kind: selectIndex, index: n}, nil
+}
+
+// isRoot reports whether the path selects the whole document
+func (p jsonPath) isRoot() bool {
+	return len(p) == 0
+}
+
+// eval returns the values the path selects in root, in document order
+func (p jsonPath) eval(root interface{}) []jsonLocation {
+	locs := []jsonLocation{{value: root}}
+	for _, seg := range p {
+		if seg.descendant {
+			var all []jsonLocation
+			for _, l := range locs {
+				all = descendants(all, l)
+			}
+			locs = all
+		}
+		var next []jsonLocation
+		for _, l := range locs {
+			for _, sel := range seg.selectors {
+				next = sel.apply(next, l)
+			}
+		}
+		locs = next
+	}
+	return locs
+}
+
+// descendants appends l and everything below it to out, in document order
+func descendants(out []jsonLocation, l jsonLocation) []jsonLocation {
+	out = append(out, l)
+	for _, c := range children(l) {
+		out = descendants(out, c)
+	}
+	return out
+}
+
+// children returns the members of an object, ordered by name, or the
+// elements of an array
+func children(l jsonLocation) []jsonLocation {
+	switch v := l.value.(type) {
+	case map[string]interface{}:
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		out := make([]jsonLocation, len(names))
+		for i, name := range names {
+			out[i] = l.child(name, v[name])
+		}
+		return out
+	case []interface{}:
+		out := make([]jsonLocation, len(v))
+		for i, e := range v {
+			out[i] = l.child(i, e)
+		}
+		return out
+	}
+	return nil
+}
+
+func (l jsonLocation) child(step, value interface{}) jsonLocation {
+	steps := make([]interface{}, len(l.steps), len(l.steps)+1)
+	copy(steps, l.steps)
+	return jsonLocation{steps: append(steps, step), value: value}
+}
+
+// apply appends what the selector selects below l to out
+func (sel selector) apply(out []jsonLocation, l jsonLocation) []jsonLocation {
+	switch sel.kind {
+	case selectAll:
+		return append(out, children(l)...)
+	case selectName:
+		if m, ok := l.value.(map[string]interface{}); ok {
+			if v, ok := m[sel.name]; ok {
+				out = append(out, l.child(sel.name, v))
+			}
+		}
+		return out
+	}
+
+	a, ok := l.value.([]interface{})
+	if !ok {
+		return out
+	}
+	if sel.kind == selectIndex {
+		i := sel.index
+		if i < 0 {
+			i += len(a)
+		}
+		if i >= 0 && i < len(a) {
+			out = append(out, l.child(i, a[i]))
+		}
+		return out
+	}
+	start, end := 0, len(a)
+	if sel.start != nil {
+		start = clampIndex(*sel.start, len(a))
+	}
+	if sel.end != nil {
+		end = clampIndex(*sel.end, len(a))
+	}
+	for i := start; i < end; i++ {
+		out = append(out, l.child(i, a[i]))
+	}
+	return out
+}
+
+// clampIndex resolves a slice bound, counting from the end if negative,
+// to an index in [0, n]
+func clampIndex(i, n int) int {
+	if i < 0 {
+		i += n
+	}
+	if i < 0 {
+		return 0
+	}
+	if i > n {
+		return n
+	}
+	return i
+}
@@ -0,0 +1,203 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrLockHeld    = errors.New("lock is held by another owner")
+	ErrLockNotHeld = errors.New("lock is not held by this owner")
+	ErrInvalidTTL  = errors.New("ttl must be positive")
+)
+
+// Lock is a lease on a key. The lease is the key's TTL, so an owner that
+// stops renewing loses the lock when the key expires.
+type Lock struct {
+	Owner string `json:"owner"`
+	// Token increases with every acquisition. Resources guarded by the
+	// lock should reject writes carrying a smaller token than one already
+	// seen, which stops a paused former owner from doing damage.
+	Token      uint64    `json:"token"`
+	AcquiredAt time.Time `json:"acquired_at"`
+}
+
+// LockGrant describes a held lock
+type LockGrant struct {
+	Token     uint64    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type lockArgs struct {
+	Owner string `json:"owner"`
+}
+
+// nextToken returns a fencing token larger than any handed out before.
+// Tokens follow the command clock, so they keep growing across restarts
+// and after a lock key is deleted, and they stay unique because the last
+// one is remembered. The caller must hold s.Mu.
+func (s *DataObj) nextToken(now time.Time) uint64 {
+	t := uint64(now.UnixNano())
+	if t <= s.fence {
+		t = s.fence + 1
+	}
+	s.fence = t
+	return t
+}
+
+// heldLock returns the lock held under key in db, or nil if it is free. The
+// caller must hold s.Mu.
+func (s *DataObj) heldLock(db, key string, now time.Time) (*Item, *Lock, error) {
+	item, exists := s.live(db, key, now)
+	if !exists {
+		return nil, nil, nil
+	}
+	if item.Type != LockType {
+		return nil, nil, ErrWrongType
+	}
+	return item, item.Value.(*Lock), nil
+}
+
+// Acquire takes the lock under key for owner for ttl. If another owner
+// holds it, it waits up to block for the lock to be released or to expire
+// and then fails with ErrLockHeld. Acquiring a lock the owner already
+// holds renews it and keeps its token.
+func (d *DB) Acquire(ctx context.Context, key, owner string, ttl, block time.Duration) (LockGrant, error) {
+	if ttl <= 0 {
+		return LockGrant{}, ErrInvalidTTL
+	}
+	cmd := withArgs(Command{Op: OpAcquire, DB: d.name, Key: key, TTL: ttl}, lockArgs{Owner: owner})
+	grants, err := blockFor(ctx, block, func() ([]LockGrant, <-chan struct{}, time.Duration, error) {
+		d.s.lock()
+		released := d.s.added()
+		item, l, err := d.s.heldLock(d.name, key, time.Now())
+		d.s.Mu.Unlock()
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if l != nil && l.Owner != owner {
+			var retry time.Duration
+			if !item.ExpiresAt.IsZero() {
+				retry = time.Until(item.ExpiresAt)
+			}
+			return nil, released, retry, nil
+		}
+
+		res := d.s.exec(cmd)
+		if errors.Is(res.Err, ErrLockHeld) {
+			// Taken by someone else since the check
+			return nil, released, time.Millisecond, nil
+		}
+		if res.Err != nil {
+			return nil, nil, 0, res.Err
+		}
+		return []LockGrant{res.Data.(LockGrant)}, nil, 0, nil
+	})
+	if err != nil {
+		return LockGrant{}, err
+	}
+	if len(grants) == 0 {
+		return LockGrant{}, ErrLockHeld
+	}
+	return grants[0], nil
+}
+
+func (s *DataObj) applyAcquire(cmd Command) Result {
+	var a lockArgs
+	if err := decodeArgs(cmd, &a); err != nil {
+		return Result{Err: err}
+	}
+	item, l, err := s.heldLock(cmd.DB, cmd.Key, cmd.Now)
+	if err != nil {
+		return Result{Err: err}
+	}
+	if l != nil {
+		if l.Owner != a.Owner {
+			return Result{Err: ErrLockHeld}
+		}
+		item.ExpiresAt = expiry(cmd.Now, cmd.TTL)
+		return Result{Data: LockGrant{Token: l.Token, ExpiresAt: item.ExpiresAt}, OK: true}
+	}
+
+	item = &Item{
+		Type:      LockType,
+		Value:     &Lock{Owner: a.Owner, AcquiredAt: cmd.Now},
+		ExpiresAt: expiry(cmd.Now, cmd.TTL),
+	}
+	if err := s.admit(cmd, s.growth(cmd.DB, cmd.Key, item), len(a.Owner)); err != nil {
+		return Result{Err: err}
+	}
+	if err := s.reserve(cmd); err != nil {
+		return Result{Err: err}
+	}
+	item.Value.(*Lock).Token = s.nextToken(cmd.Now)
+	s.put(cmd.DB, cmd.Key, item)
+	return Result{Data: LockGrant{Token: item.Value.(*Lock).Token, ExpiresAt: item.ExpiresAt}, OK: true}
+}
+
+// Release frees the lock under key if owner holds it
+func (d *DB) Release(key, owner string) error {
+	return d.s.exec(withArgs(Command{Op: OpRelease, DB: d.name, Key: key}, lockArgs{Owner: owner})).Err
+}
+
+func (s *DataObj) applyRelease(cmd Command) Result {
+	var a lockArgs
+	if err := decodeArgs(cmd, &a); err != nil {
+		return Result{Err: err}
+	}
+	_, l, err := s.heldLock(cmd.DB, cmd.Key, cmd.Now)
+	if err != nil {
+		return Result{Err: err}
+	}
+	if l == nil || l.Owner != a.Owner {
+		return Result{Err: ErrLockNotHeld}
+	}
+	s.del(cmd.DB, cmd.Key)
+	s.notifyAdded()
+	return Result{OK: true}
+}
+
+// Extend renews the lease of a lock owner holds to ttl from now
+func (d *DB) Extend(key, owner string, ttl time.Duration) (LockGrant, error) {
+	if ttl <= 0 {
+		return LockGrant{}, ErrInvalidTTL
+	}
+	res := d.s.exec(withArgs(Command{Op: OpExtend, DB: d.name, Key: key, TTL: ttl}, lockArgs{Owner: owner}))
+	if res.Err != nil {
+		return LockGrant{}, res.Err
+	}
+	return res.Data.(LockGrant), nil
+}
+
+func (s *DataObj) applyExtend(cmd Command) Result {
+	var a lockArgs
+	if err := decodeArgs(cmd, &a); err != nil {
+		return Result{Err: err}
+	}
+	item, l, err := s.heldLock(cmd.DB, cmd.Key, cmd.Now)
+	if err != nil {
+		return Result{Err: err}
+	}
+	if l == nil || l.Owner != a.Owner {
+		return Result{Err: ErrLockNotHeld}
+	}
+	item.ExpiresAt = expiry(cmd.Now, cmd.TTL)
+	return Result{Data: LockGrant{Token: l.Token, ExpiresAt: item.ExpiresAt}, OK: true}
+}
+
+// LockInfo returns the token and expiry of the lock under key, or
+// ErrNoSuchKey if it is free. The owner is left out because it is what
+// proves ownership.
+func (d *DB) LockInfo(key string) (LockGrant, error) {
+	d.s.rlock()
+	defer d.s.Mu.RUnlock()
+	item, l, err := d.s.heldLock(d.name, key, time.Now())
+	if err != nil {
+		return LockGrant{}, err
+	}
+	if l == nil {
+		return LockGrant{}, ErrNoSuchKey
+	}
+	return LockGrant{Token: l.Token, ExpiresAt: item.ExpiresAt}, nil
+}
@@ -0,0 +1,189 @@
+package store
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+var ErrOutOfMemory = errors.New("memory limit reached")
+
+const (
+	// PolicyNoEviction rejects writes once the limit is reached
+	PolicyNoEviction = "noeviction"
+	// PolicyVolatileTTL evicts the keys closest to expiring first
+	PolicyVolatileTTL = "volatile-ttl"
+)
+
+// Rough per-entry bookkeeping cost of the map, item and string headers
+const (
+	itemOverhead   = 64
+	stringOverhead = 16
+)
+
+// SetMemoryLimit caps the estimated size of stored data. A limit of zero
+// disables the check. In replicated mode every member must use the same
+// limit and policy for writes to be applied identically.
+func (s *DataObj) SetMemoryLimit(max int64, policy string) {
+	s.lock()
+	defer s.Mu.Unlock()
+	s.maxMemory = max
+	s.evictionPolicy = policy
+}
+
+// UsedMemory returns the estimated size of stored data in bytes
+func (s *DataObj) UsedMemory() int64 {
+	s.rlock()
+	defer s.Mu.RUnlock()
+	return s.used
+}
+
+func entrySize(key string, item *Item) int64 {
+	n := int64(len(key)) + itemOverhead
+	switch v := item.Value.(type) {
+	case string:
+		n += int64(len(v))
+	case []string:
+		for _, e := range v {
+			n += int64(len(e)) + stringOverhead
+		}
+	case *Stream:
+		for _, e := range v.Entries {
+			n += streamEntrySize(e)
+		}
+	case *Queue:
+		for _, m := range v.Messages {
+			n += queueMessageSize(m)
+		}
+	case *Lock:
+		n += int64(len(v.Owner))
+	case *JSONDoc:
+		n += v.size
+	}
+	return n
+}
+
+// put stores item under key in db and keeps the memory estimates current.
+// It gives the item the next version; versions come from one counter
+// advanced in apply order, so every replica assigns the same ones.
+func (s *DataObj) put(db, key string, item *Item) {
+	s.version++
+	item.Version = s.version
+	s.keyspace(db)
+	m := s.dbs[db]
+	if old, ok := m.Data[key]; ok {
+		n := entrySize(key, old)
+		s.used -= n
+		m.used -= n
+	}
+	m.Data[key] = item
+	n := entrySize(key, item)
+	s.used += n
+	m.used += n
+	s.indexPut(db, key, item)
+	s.indexText(db, key, item)
+}
+
+// del removes key from db and keeps the memory estimates current
+func (s *DataObj) del(db, key string) {
+	m, ok := s.dbs[db]
+	if !ok {
+		return
+	}
+	if old, ok := m.Data[key]; ok {
+		n := entrySize(key, old)
+		s.used -= n
+		m.used -= n
+		delete(m.Data, key)
+		s.indexDel(db, key)
+		s.unindexText(db, key)
+	}
+}
+
+// growth is how much storing item under key would grow db
+func (s *DataObj) growth(db, key string, item *Item) int64 {
+	n := entrySize(key, item)
+	if old, ok := s.keys(db)[key]; ok {
+		n -= entrySize(key, old)
+	}
+	return n
+}
+
+// grow accounts for the item under key in db changing in place, by n
+// bytes, and gives it the next version
+func (s *DataObj) grow(db, key string, n int64) {
+	s.used += n
+	if m, ok := s.dbs[db]; ok {
+		m.used += n
+		if item, ok := m.Data[key]; ok {
+			s.version++
+			item.Version = s.version
+		}
+	}
+}
+
+// reserve is called before cmd writes in a way that can grow the store.
+// Once the limit is exceeded it first drops keys that have expired as of
+// cmd.Now, which makes the outcome independent of when the cleanup loop
+// last ran, and then applies the eviction policy. The key cmd writes is
+// never dropped, as the caller may already hold its item. The caller must
+// hold s.Mu.
+func (s *DataObj) reserve(cmd Command) error {
+	if s.maxMemory <= 0 || s.used < s.maxMemory {
+		return nil
+	}
+	own := func(db, key string) bool {
+		return db == cmd.DB && key == cmd.Key
+	}
+
+	for db, m := range s.dbs {
+		for k, v := range m.Data {
+			if !own(db, k) && v.expiredAt(cmd.Now) {
+				s.del(db, k)
+				s.expired++
+			}
+		}
+	}
+	if s.used < s.maxMemory {
+		return nil
+	}
+
+	if s.evictionPolicy == PolicyVolatileTTL {
+		type entry struct {
+			db, key   string
+			expiresAt time.Time
+		}
+		var candidates []entry
+		for db, m := range s.dbs {
+			for k, v := range m.Data {
+				if !v.ExpiresAt.IsZero() && !own(db, k) {
+					candidates = append(candidates, entry{db, k, v.ExpiresAt})
+				}
+			}
+		}
+		// Order by expiry, then namespace and key, so every replica picks
+		// the same victims
+		sort.Slice(candidates, func(i, j int) bool {
+			a, b := candidates[i], candidates[j]
+			if !a.expiresAt.Equal(b.expiresAt) {
+				return a.expiresAt.Before(b.expiresAt)
+			}
+			if a.db != b.db {
+				return a.db < b.db
+			}
+			return a.key < b.key
+		})
+		for _, c := range candidates {
+			if s.used < s.maxMemory {
+				break
+			}
+			s.del(c.db, c.key)
+			s.evicted++
+		}
+	}
+
+	if s.used >= s.maxMemory {
+		return ErrOutOfMemory
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package store
+
+import (
+	"errors"
+	"sort"
+)
+
+// DefaultDB is the namespace used when none is selected
+const DefaultDB = "0"
+
+var ErrInvalidDB = errors.New("namespace names are 1-64 letters, digits, '_', '-' or '.'")
+
+// ValidDBName reports whether name can be used as a namespace
+func ValidDBName(name string) bool {
+	if len(name) == 0 || len(name) > 64 {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '_' || r == '-' || r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// DB is a view of one namespace. Keys in different namespaces never
+// collide; memory limits, expiry and replication are shared by all of
+// them. Views are cheap and can be created per request.
+type DB struct {
+	s    *DataObj
+	name string
+}
+
+// DB returns the namespace called name. Namespaces exist implicitly and
+// start out empty.
+func (s *DataObj) DB(name string) *DB {
+	return &DB{s: s, name: name}
+}
+
+func (d *DB) Name() string {
+	return d.name
+}
+
+// Size returns the number of live keys in the namespace
+func (d *DB) Size() int {
+	d.s.rlock()
+	defer d.s.Mu.RUnlock()
+	return d.s.size(d.name)
+}
+
+// Flush removes every key in the namespace and returns how many there were
+func (d *DB) Flush() (int, error) {
+	res := d.s.exec(Command{Op: OpFlushDB, DB: d.name})
+	if res.Err != nil {
+		return 0, res.Err
+	}
+	return res.N, nil
+}
+
+func (s *DataObj) applyFlushDB(cmd Command) Result {
+	m := s.keys(cmd.DB)
+	n := 0
+	for k, v := range m {
+		if !v.expiredAt(cmd.Now) {
+			n++
+		}
+		s.del(cmd.DB, k)
+	}
+	delete(s.dbs, cmd.DB)
+	return Result{N: n, OK: true}
+}
+
+// SwapDB exchanges the contents of two namespaces atomically, so clients
+// of either see the other's keys from then on
+func (s *DataObj) SwapDB(a, b string) error {
+	return s.exec(Command{Op: OpSwapDB, DB: a, Key: b}).Err
+}
+
+func (s *DataObj) applySwapDB(cmd Command) Result {
+	a, b := s.dbs[cmd.DB], s.dbs[cmd.Key]
+	delete(s.dbs, cmd.DB)
+	delete(s.dbs, cmd.Key)
+	if b != nil {
+		s.dbs[cmd.DB] = b
+	}
+	if a != nil {
+		s.dbs[cmd.Key] = a
+	}
+	// Indexes stay with their namespace and now cover the other's keys
+	s.reindex(cmd.DB)
+	s.reindex(cmd.Key)
+	return Result{OK: true}
+}
+
+// Namespaces returns the number of live keys in each namespace that holds
+// any, sorted by name
+func (s *DataObj) Namespaces() []NamespaceSize {
+	s.rlock()
+	defer s.Mu.RUnlock()
+	var out []NamespaceSize
+	for name := range s.dbs {
+		if n := s.size(name); n > 0 {
+			out = append(out, NamespaceSize{Name: name, Keys: n, Bytes: s.dbs[name].used})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// NamespaceSize is one entry returned by Namespaces
+type NamespaceSize struct {
+	Name  string `json:"name"`
+	Keys  int    `json:"keys"`
+	Bytes int64  `json:"bytes"`
+}
+
+func (s *DataObj) size(db string) int {
+	n := 0
+	for _, v := range s.keys(db) {
+		if !v.IsExpired() {
+			n++
+		}
+	}
+	return n
+}
+
+// keys returns the items in db. It is nil for a namespace that has never
+// been written to, which reads like an empty map.
+func (s *DataObj) keys(db string) map[string]*Item {
+	if m, ok := s.dbs[db]; ok {
+		return m.Data
+	}
+	return nil
+}
+
+// keyspace is like keys but creates the namespace
+func (s *DataObj) keyspace(db string) map[string]*Item {
+	m, ok := s.dbs[db]
+	if !ok {
+		m = NewDataMap()
+		s.dbs[db] = m
+	}
+	return m.Data
+}
@@ -0,0 +1,156 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Persister keeps a snapshot of the store in a file. The file is loaded at
+// start up and rewritten on an interval and when the server stops.
+type Persister struct {
+	store *DataObj
+	path  string
+
+	mu       sync.Mutex
+	interval time.Duration
+	lastSave time.Time
+	lastErr  error
+	reset    chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewPersister creates a persister for path. An interval of zero only saves
+// when Save or Stop is called.
+func NewPersister(s *DataObj, path string, interval time.Duration) *Persister {
+	return &Persister{
+		store:    s,
+		path:     path,
+		interval: interval,
+		reset:    make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Load restores the store from the file. A missing file is not an error.
+func (p *Persister) Load() error {
+	data, err := os.ReadFile(p.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return p.store.Restore(data)
+}
+
+// Save writes a snapshot to a temporary file and renames it into place so a
+// crash never leaves a partially written file behind
+func (p *Persister) Save() error {
+	data, err := p.store.Snapshot()
+	if err == nil {
+		err = writeFileAtomic(p.path, data)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastErr = err
+	if err == nil {
+		p.lastSave = time.Now()
+	}
+	return err
+}
+
+// Start saves in the background on the configured interval
+func (p *Persister) Start() {
+	go p.run()
+}
+
+func (p *Persister) run() {
+	defer close(p.done)
+	for {
+		p.mu.Lock()
+		interval := p.interval
+		p.mu.Unlock()
+
+		var tick <-chan time.Time
+		var timer *time.Timer
+		if interval > 0 {
+			timer = time.NewTimer(interval)
+			tick = timer.C
+		}
+
+		stopped := false
+		select {
+		case <-p.stop:
+			stopped = true
+		case <-p.reset:
+		case <-tick:
+			if err := p.Save(); err != nil {
+				p.store.log.Error("save snapshot failed", "path", p.path, "err", err)
+			}
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if stopped {
+			return
+		}
+	}
+}
+
+// SetInterval changes how often the file is saved
+func (p *Persister) SetInterval(d time.Duration) {
+	p.mu.Lock()
+	p.interval = d
+	p.mu.Unlock()
+	select {
+	case p.reset <- struct{}{}:
+	default:
+	}
+}
+
+// Stop ends background saving and writes a final snapshot
+func (p *Persister) Stop() error {
+	close(p.stop)
+	<-p.done
+	return p.Save()
+}
+
+// Path returns the snapshot file
+func (p *Persister) Path() string {
+	return p.path
+}
+
+// Status reports when the file was last saved and whether that succeeded
+func (p *Persister) Status() (time.Time, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lastSave, p.lastErr
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// settle waits for goroutines on their way out and reports whether the
+// count dropped to at most want
+func settle(want int) (int, bool) {
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		n := runtime.NumGoroutine()
+		if n <= want || time.Now().After(deadline) {
+			return n, n <= want
+		}
+	}
+}
+
+func TestCloseAndStopLeaveNoGoroutines(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "snapshot.json")
+	before := runtime.NumGoroutine()
+
+	s := NewRedisMemoryStore()
+	s.SetCleanupInterval(5 * time.Millisecond)
+	p := NewPersister(s, file, 5*time.Millisecond)
+	p.Start()
+	ttl := time.Hour
+	for _, k := range []string{"a", "b", "c"} {
+		if err := s.DB(DefaultDB).Set(k, "v", &ttl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.SetInterval(time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+
+	s.Close()
+	s.Close() // closing twice is harmless
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if n, ok := settle(before); !ok {
+		buf := make([]byte, 1<<20)
+		t.Fatalf("%d goroutines left after Close and Stop, started with %d:\n%s", n, before, buf[:runtime.Stack(buf, true)])
+	}
+
+	// Stop saved every write
+	restored := NewRedisMemoryStore()
+	defer restored.Close()
+	if err := NewPersister(restored, file, 0).Load(); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"a", "b", "c"} {
+		if _, _, ok := restored.DB(DefaultDB).Get(k); !ok {
+			t.Errorf("%s missing from the snapshot saved by Stop", k)
+		}
+	}
+}
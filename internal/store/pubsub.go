@@ -0,0 +1,115 @@
+package store
+
+import (
+	"path"
+	"sync"
+)
+
+// subscriptionBuffer is how many messages a subscriber may fall behind
+// before further messages are dropped for it
+const subscriptionBuffer = 256
+
+// Message is a message published to a channel
+type Message struct {
+	Channel string
+	// Pattern is the pattern the subscription matched, empty for a
+	// subscription to the channel itself
+	Pattern string
+	Payload string
+}
+
+// broker fans published messages out to subscribers. Channels are shared
+// by all namespaces, nothing is stored and, with replication, messages only
+// reach subscribers of the node they were published on.
+type broker struct {
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+// Subscription receives the messages published to its channels and
+// patterns until it is closed
+type Subscription struct {
+	C <-chan Message
+
+	ch       chan Message
+	channels map[string]bool
+	patterns []string
+	b        *broker
+	once     sync.Once
+}
+
+// Subscribe starts delivering messages published to the channels, or to a
+// channel matching one of the patterns. Patterns use the syntax of
+// path.Match. Close the subscription when done with it.
+func (s *DataObj) Subscribe(channels, patterns []string) (*Subscription, error) {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, err
+		}
+	}
+	ch := make(chan Message, subscriptionBuffer)
+	sub := &Subscription{
+		C:        ch,
+		ch:       ch,
+		channels: make(map[string]bool, len(channels)),
+		patterns: patterns,
+		b:        &s.broker,
+	}
+	for _, c := range channels {
+		sub.channels[c] = true
+	}
+
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	if s.broker.subs == nil {
+		s.broker.subs = make(map[*Subscription]struct{})
+	}
+	s.broker.subs[sub] = struct{}{}
+	return sub, nil
+}
+
+// Close stops delivery and closes C. It is safe to call more than once.
+func (sub *Subscription) Close() {
+	sub.once.Do(func() {
+		sub.b.mu.Lock()
+		delete(sub.b.subs, sub)
+		sub.b.mu.Unlock()
+		close(sub.ch)
+	})
+}
+
+// Publish delivers payload to the subscribers of channel and returns how
+// many received it. It never blocks; a subscriber that cannot keep up
+// misses messages.
+func (s *DataObj) Publish(channel, payload string) int {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	n := 0
+	for sub := range s.broker.subs {
+		msg, ok := sub.match(channel)
+		if !ok {
+			continue
+		}
+		msg.Payload = payload
+		select {
+		case sub.ch <- msg:
+			n++
+		default:
+		}
+	}
+	return n
+}
+
+// match reports whether the subscription wants messages on channel. A
+// subscription to the channel itself wins over its patterns.
+func (sub *Subscription) match(channel string) (Message, bool) {
+	if sub.channels[channel] {
+		return Message{Channel: channel}, true
+	}
+	for _, p := range sub.patterns {
+		if ok, _ := path.Match(p, channel); ok {
+			return Message{Channel: channel, Pattern: p}, true
+		}
+	}
+	return Message{}, false
+}
@@ -0,0 +1,629 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidQuery = errors.New("invalid query")
+
+// A query selects the keys of an index:
+//
+//	@field:{a | b}      tag field holding a or b
+//	@field:[10 20]      numeric field between 10 and 20; ( excludes a
+//	                    bound, as in [(10 +inf]
+//	@field:word         text field containing the word
+//	@field:"two words"  text field containing both words
+//	word, "two words"   any text field containing the words
+//	*                   every key
+//
+// Terms separated by spaces must all match, | matches either side, - in
+// front of a term negates it and parentheses group, so
+// "@status:{open} -(@owner:{bob} | @age:[0 (18])" is valid.
+
+type queryNode interface {
+	eval(ix *searchIndex) keySet
+}
+
+type (
+	allNode struct{}
+	andNode []queryNode
+	orNode  []queryNode
+	notNode struct{ node queryNode }
+	tagNode struct {
+		field  int
+		values []string
+	}
+	rangeNode struct {
+		field            int
+		min, max         float64
+		minOpen, maxOpen bool
+	}
+	// wordsNode matches keys holding every word in the field, or in any
+	// text field if field is -1
+	wordsNode struct {
+		field int
+		words []string
+	}
+)
+
+func (allNode) eval(ix *searchIndex) keySet {
+	out := make(keySet, len(ix.docs))
+	for key := range ix.docs {
+		out[key] = struct{}{}
+	}
+	return out
+}
+
+func (n andNode) eval(ix *searchIndex) keySet {
+	out := n[0].eval(ix)
+	for _, node := range n[1:] {
+		out = intersect(out, node.eval(ix))
+	}
+	return out
+}
+
+func (n orNode) eval(ix *searchIndex) keySet {
+	out := keySet{}
+	for _, node := range n {
+		for key := range node.eval(ix) {
+			out[key] = struct{}{}
+		}
+	}
+	return out
+}
+
+func (n notNode) eval(ix *searchIndex) keySet {
+	exclude := n.node.eval(ix)
+	out := keySet{}
+	for key := range ix.docs {
+		if _, ok := exclude[key]; !ok {
+			out[key] = struct{}{}
+		}
+	}
+	return out
+}
+
+func (n tagNode) eval(ix *searchIndex) keySet {
+	out := keySet{}
+	for _, v := range n.values {
+		for key := range ix.tags[n.field][v] {
+			out[key] = struct{}{}
+		}
+	}
+	return out
+}
+
+func (n rangeNode) eval(ix *searchIndex) keySet {
+	entries := ix.numbers[n.field]
+	start := sort.Search(len(entries), func(i int) bool {
+		v := entries[i].value
+		return v > n.min || (v == n.min && !n.minOpen)
+	})
+	out := keySet{}
+	for _, e := range entries[start:] {
+		if e.value > n.max || (e.value == n.max && n.maxOpen) {
+			break
+		}
+		out[e.key] = struct{}{}
+	}
+	return out
+}
+
+func (n wordsNode) eval(ix *searchIndex) keySet {
+	var out keySet
+	for _, w := range n.words {
+		found := keySet{}
+		for i, f := range ix.def.Fields {
+			if (n.field == -1 && f.Type == TextField) || n.field == i {
+				for key := range ix.words[i][w] {
+					found[key] = struct{}{}
+				}
+			}
+		}
+		if out == nil {
+			out = found
+		} else {
+			out = intersect(out, found)
+		}
+	}
+	return out
+}
+
+func intersect(a, b keySet) keySet {
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+	out := keySet{}
+	for key := range a {
+		if _, ok := b[key]; ok {
+			out[key] = struct{}{}
+		}
+	}
+	return out
+}
+
+// queryParser parses a query for an index
+type queryParser struct {
+	ix  *searchIndex
+	s   string
+	pos int
+}
+
+func parseQuery(ix *searchIndex, s string) (queryNode, error) {
+	p := &queryParser{ix: ix, s: s}
+	node, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.s) {
+		return nil, p.errorf("unexpected %q", p.s[p.pos])
+	}
+	return node, nil
+}
+
+func (p *queryParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w at %d: %s", ErrInvalidQuery, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *queryParser) skipSpace() {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// peek returns the next byte after spaces, or 0 at the end
+func (p *queryParser) peek() byte {
+	p.skipSpace()
+	if p.pos == len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *queryParser) expect(c byte) error {
+	if p.peek() != c {
+		return p.errorf("expected %q", c)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *queryParser) or() (queryNode, error) {
+	var nodes orNode
+	for {
+		node, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+		if p.peek() != '|' {
+			break
+		}
+		p.pos++
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *queryParser) and() (queryNode, error) {
+	var nodes andNode
+	for {
+		if c := p.peek(); c == 0 || c == '|' || c == ')' {
+			break
+		}
+		node, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	switch len(nodes) {
+	case 0:
+		return nil, p.errorf("expected a term")
+	case 1:
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *queryParser) unary() (queryNode, error) {
+	switch p.peek() {
+	case '-':
+		p.pos++
+		node, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{node}, nil
+	case '(':
+		p.pos++
+		node, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return node, p.expect(')')
+	case '*':
+		p.pos++
+		return allNode{}, nil
+	case '@':
+		p.pos++
+		return p.field()
+	}
+	return p.words(-1)
+}
+
+// field parses the name and value of a @field: term
+func (p *queryParser) field() (queryNode, error) {
+	end := strings.IndexByte(p.s[p.pos:], ':')
+	if end < 0 {
+		return nil, p.errorf("expected : after field name")
+	}
+	name := p.s[p.pos : p.pos+end]
+	i, ok := p.ix.field(name)
+	if !ok {
+		return nil, p.errorf("unknown field %q", name)
+	}
+	p.pos += end + 1
+	switch p.ix.def.Fields[i].Type {
+	case TagField:
+		values, err := p.tags()
+		return tagNode{field: i, values: values}, err
+	case NumericField:
+		return p.numericRange(i)
+	}
+	return p.words(i)
+}
+
+// tags parses {a | b}. \ escapes the next character.
+func (p *queryParser) tags() ([]string, error) {
+	if err := p.expect('{'); err != nil {
+		return nil, err
+	}
+	var values []string
+	var b strings.Builder
+	for ; p.pos < len(p.s); p.pos++ {
+		switch c := p.s[p.pos]; c {
+		case '\\':
+			if p.pos++; p.pos < len(p.s) {
+				b.WriteByte(p.s[p.pos])
+			}
+		case '|', '}':
+			values = append(values, strings.TrimSpace(b.String()))
+			b.Reset()
+			if c == '}' {
+				p.pos++
+				return values, nil
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return nil, p.errorf("expected }")
+}
+
+// numericRange parses [min max]
+func (p *queryParser) numericRange(field int) (queryNode, error) {
+	if err := p.expect('['); err != nil {
+		return nil, err
+	}
+	end := strings.IndexByte(p.s[p.pos:], ']')
+	if end < 0 {
+		return nil, p.errorf("expected ]")
+	}
+	bounds := strings.Fields(p.s[p.pos : p.pos+end])
+	if len(bounds) != 2 {
+		return nil, p.errorf("a range needs a minimum and a maximum")
+	}
+	n := rangeNode{field: field}
+	var err error
+	if n.min, n.minOpen, err = parseBound(bounds[0]); err != nil {
+		return nil, p.errorf("%v", err)
+	}
+	if n.max, n.maxOpen, err = parseBound(bounds[1]); err != nil {
+		return nil, p.errorf("%v", err)
+	}
+	p.pos += end + 1
+	return n, nil
+}
+
+func parseBound(s string) (float64, bool, error) {
+	open := strings.HasPrefix(s, "(")
+	s = strings.TrimPrefix(s, "(")
+	switch s {
+	case "-inf":
+		return math.Inf(-1), open, nil
+	case "inf", "+inf":
+		return math.Inf(1), open, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid number %q", s)
+	}
+	return v, open, nil
+}
+
+// words parses a word or a quoted string of words
+func (p *queryParser) words(field int) (queryNode, error) {
+	var text string
+	if p.peek() == '"' {
+		end := strings.IndexByte(p.s[p.pos+1:], '"')
+		if end < 0 {
+			return nil, p.errorf("expected \"")
+		}
+		text = p.s[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+	} else {
+		end := strings.IndexAny(p.s[p.pos:], " |()")
+		if end < 0 {
+			end = len(p.s) - p.pos
+		}
+		text = p.s[p.pos : p.pos+end]
+		p.pos += end
+	}
+	words := tokenize(text)
+	if len(words) == 0 {
+		return nil, p.errorf("expected a word")
+	}
+	return wordsNode{field: field, words: words}, nil
+}
+
+// QueryOptions are the ordering, paging and grouping of a query
+type QueryOptions struct {
+	// SortBy is a field to order keys by, or a group field or reducer to
+	// order groups by. Keys are in key order otherwise, and groups in the
+	// order of their values.
+	SortBy string `json:"sort_by,omitempty"`
+	Desc   bool   `json:"desc,omitempty"`
+	Offset int    `json:"offset,omitempty"`
+	// Limit is the most keys or groups to return
+	Limit int `json:"limit"`
+	// GroupBy and Reduce turn the matching keys into groups, with one row
+	// per distinct combination of the GroupBy fields' values
+	GroupBy []string  `json:"group_by,omitempty"`
+	Reduce  []Reducer `json:"reduce,omitempty"`
+	// Allow leaves out keys it returns false for, e.g. those a user may
+	// not read, from results and groups alike
+	Allow func(key string) bool `json:"-"`
+}
+
+// Reducer computes a value for each group: count, count_distinct, sum,
+// avg, min or max of a field
+type Reducer struct {
+	Op    string `json:"op"`
+	Field string `json:"field,omitempty"`
+	// As names the value in the group, op_field by default
+	As string `json:"as,omitempty"`
+}
+
+func (r Reducer) name() string {
+	switch {
+	case r.As != "":
+		return r.As
+	case r.Field == "":
+		return r.Op
+	}
+	return r.Op + "_" + r.Field
+}
+
+// QueryResult is what a query returns. Total counts every matching key, or
+// every group, before paging.
+type QueryResult struct {
+	Total  int
+	Docs   []QueryDoc
+	Groups []map[string]interface{}
+}
+
+// QueryDoc is a matching key and its document
+type QueryDoc struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+// Query runs a query on an index
+func (d *DB) Query(index, query string, opts QueryOptions) (QueryResult, error) {
+	if opts.Offset < 0 || opts.Limit < 0 {
+		return QueryResult{}, fmt.Errorf("%w: offset and limit must not be negative", ErrInvalidQuery)
+	}
+	d.s.rlock()
+	defer d.s.Mu.RUnlock()
+	ix, ok := d.s.indexes[d.name][index]
+	if !ok {
+		return QueryResult{}, ErrNoSuchIndex
+	}
+	node, err := parseQuery(ix, query)
+	if err != nil {
+		return QueryResult{}, err
+	}
+
+	// Leave out keys that expired but have not been removed yet
+	now := time.Now()
+	var keys []string
+	for key := range node.eval(ix) {
+		if _, live := d.s.live(d.name, key, now); live && (opts.Allow == nil || opts.Allow(key)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	if len(opts.GroupBy) > 0 || len(opts.Reduce) > 0 {
+		return aggregate(ix, keys, opts)
+	}
+	if opts.SortBy != "" {
+		f, ok := ix.field(opts.SortBy)
+		if !ok {
+			return QueryResult{}, fmt.Errorf("%w: unknown field %q", ErrInvalidQuery, opts.SortBy)
+		}
+		sort.SliceStable(keys, func(i, j int) bool {
+			return less(ix.docs[keys[i]].first[f], ix.docs[keys[j]].first[f], opts.Desc)
+		})
+	}
+	res := QueryResult{Total: len(keys), Docs: []QueryDoc{}}
+	for _, key := range page(keys, opts) {
+		item, _ := d.s.live(d.name, key, now)
+		res.Docs = append(res.Docs, QueryDoc{Key: key, Value: item.Value.(*JSONDoc).Root})
+	}
+	return res, nil
+}
+
+// page returns the part of s that opts.Offset and opts.Limit select
+func page[T any](s []T, opts QueryOptions) []T {
+	if opts.Offset >= len(s) {
+		return nil
+	}
+	s = s[opts.Offset:]
+	if opts.Limit < len(s) {
+		s = s[:opts.Limit]
+	}
+	return s
+}
+
+// less orders sort values: numbers before strings, missing values last
+// whichever the direction
+func less(a, b interface{}, desc bool) bool {
+	if a == nil || b == nil {
+		return a != nil && b == nil
+	}
+	x, xNum := a.(float64)
+	y, yNum := b.(float64)
+	switch {
+	case xNum && yNum:
+		if x == y {
+			return false
+		}
+		return (x < y) != desc
+	case xNum != yNum:
+		return xNum
+	}
+	s, t := fmt.Sprint(a), fmt.Sprint(b)
+	if s == t {
+		return false
+	}
+	return (s < t) != desc
+}
+
+// aggregate groups keys, which are sorted, as opts asks
+func aggregate(ix *searchIndex, keys []string, opts QueryOptions) (QueryResult, error) {
+	groupBy := make([]int, len(opts.GroupBy))
+	for i, name := range opts.GroupBy {
+		f, ok := ix.field(name)
+		if !ok {
+			return QueryResult{}, fmt.Errorf("%w: unknown field %q", ErrInvalidQuery, name)
+		}
+		groupBy[i] = f
+	}
+	reduceBy := make([]int, len(opts.Reduce))
+	for i, r := range opts.Reduce {
+		switch r.Op {
+		case "count":
+			continue
+		case "count_distinct", "sum", "avg", "min", "max":
+		default:
+			return QueryResult{}, fmt.Errorf("%w: unknown reducer %q", ErrInvalidQuery, r.Op)
+		}
+		f, ok := ix.field(r.Field)
+		if !ok {
+			return QueryResult{}, fmt.Errorf("%w: unknown field %q", ErrInvalidQuery, r.Field)
+		}
+		if r.Op != "count_distinct" && ix.def.Fields[f].Type != NumericField {
+			return QueryResult{}, fmt.Errorf("%w: %s needs a numeric field", ErrInvalidQuery, r.Op)
+		}
+		reduceBy[i] = f
+	}
+
+	type group struct {
+		values  []interface{}
+		keys    []string
+		ordinal string
+	}
+	groups := map[string]*group{}
+	for _, key := range keys {
+		doc := ix.docs[key]
+		values := make([]interface{}, len(groupBy))
+		for i, f := range groupBy {
+			values[i] = doc.first[f]
+		}
+		id, _ := json.Marshal(values)
+		g, ok := groups[string(id)]
+		if !ok {
+			g = &group{values: values, ordinal: string(id)}
+			groups[string(id)] = g
+		}
+		g.keys = append(g.keys, key)
+	}
+
+	var ordered []*group
+	for _, g := range groups {
+		ordered = append(ordered, g)
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].ordinal < ordered[j].ordinal })
+
+	rows := make([]map[string]interface{}, len(ordered))
+	for i, g := range ordered {
+		row := map[string]interface{}{}
+		for j, name := range opts.GroupBy {
+			row[name] = g.values[j]
+		}
+		for j, r := range opts.Reduce {
+			row[r.name()] = reduce(ix, r.Op, reduceBy[j], g.keys)
+		}
+		rows[i] = row
+	}
+	if opts.SortBy != "" {
+		sort.SliceStable(rows, func(i, j int) bool {
+			return less(rows[i][opts.SortBy], rows[j][opts.SortBy], opts.Desc)
+		})
+	}
+	return QueryResult{Total: len(rows), Groups: append([]map[string]interface{}{}, page(rows, opts)...)}, nil
+}
+
+// reduce computes a reducer over the keys of a group. Numeric reducers
+// use every value of the field; a group without any gets nil.
+func reduce(ix *searchIndex, op string, field int, keys []string) interface{} {
+	switch op {
+	case "count":
+		return len(keys)
+	case "count_distinct":
+		seen := map[interface{}]bool{}
+		for _, key := range keys {
+			if v := ix.docs[key].first[field]; v != nil {
+				seen[v] = true
+			}
+		}
+		return len(seen)
+	}
+	var sum, min, max float64
+	n := 0
+	for _, key := range keys {
+		for _, v := range ix.docs[key].numbers[field] {
+			if n == 0 || v < min {
+				min = v
+			}
+			if n == 0 || v > max {
+				max = v
+			}
+			sum += v
+			n++
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+	switch op {
+	case "sum":
+		return sum
+	case "avg":
+		return sum / float64(n)
+	case "min":
+		return min
+	}
+	return max
+}
@@ -0,0 +1,253 @@
+package store
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// usersIndex returns a namespace with an index over user: keys and a few
+// documents, some without every field, beside keys the index leaves out
+func usersIndex(t *testing.T) *DB {
+	t.Helper()
+	s := NewRedisMemoryStore()
+	t.Cleanup(s.Close)
+	d := s.DB(DefaultDB)
+	docs := map[string]string{
+		"user:1":  `{"status":"open","age":30,"bio":"Loves Go and hiking","tags":["admin","ops"]}`,
+		"user:2":  `{"status":"closed","age":17,"bio":"hiking guide"}`,
+		"user:3":  `{"status":"open","age":18,"tags":["ops"]}`,
+		"user:4":  `{"status":"open","age":"unknown"}`,
+		"other:1": `{"status":"open","age":30}`,
+	}
+	for key, doc := range docs {
+		if _, err := d.JSONSet(key, "$", doc, JSONSetOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.Set("user:5", `{"status":"open"}`, nil); err != nil {
+		t.Fatal(err)
+	}
+	err := d.CreateIndex(IndexDef{Name: "users", Prefixes: []string{"user:"}, Fields: []IndexField{
+		{Name: "status", Type: TagField},
+		{Name: "age", Type: NumericField},
+		{Name: "bio", Type: TextField},
+		{Name: "tags", Type: TagField},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func queryKeys(t *testing.T, d *DB, query string, opts QueryOptions) []string {
+	t.Helper()
+	if opts.Limit == 0 {
+		opts.Limit = 100
+	}
+	res, err := d.Query("users", query, opts)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	keys := []string{}
+	for _, doc := range res.Docs {
+		keys = append(keys, doc.Key)
+	}
+	return keys
+}
+
+func TestQueryOperators(t *testing.T) {
+	d := usersIndex(t)
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// The string user:5 and other:1, outside the prefixes, are left out
+		{"*", []string{"user:1", "user:2", "user:3", "user:4"}},
+		{"@status:{open}", []string{"user:1", "user:3", "user:4"}},
+		{"@status:{open | closed}", []string{"user:1", "user:2", "user:3", "user:4"}},
+		{"@status:{Open}", []string{}},
+		{"@tags:{ops}", []string{"user:1", "user:3"}},
+		{"@age:[18 30]", []string{"user:1", "user:3"}},
+		{"@age:[(18 30]", []string{"user:1"}},
+		{"@age:[18 (30]", []string{"user:3"}},
+		{"@age:[-inf (18]", []string{"user:2"}},
+		{"@age:[18 +inf]", []string{"user:1", "user:3"}},
+		{"@age:[31 inf]", []string{}},
+		{"@bio:HIKING", []string{"user:1", "user:2"}},
+		{`@bio:"go hiking"`, []string{"user:1"}},
+		{"hiking guide", []string{"user:2"}},
+		{"@status:{open} -@tags:{admin}", []string{"user:3", "user:4"}},
+		{"@status:{closed} | @age:[30 30]", []string{"user:1", "user:2"}},
+		{"@status:{open} (@tags:{admin} | -@bio:hiking)", []string{"user:1", "user:3", "user:4"}},
+		{"--@tags:{admin}", []string{"user:1"}},
+	}
+	for _, tt := range tests {
+		if got := queryKeys(t, d, tt.query, QueryOptions{}); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+// TestQueryMissingPaths checks that a document without a field, or with a
+// value of the wrong type there, matches no term on the field but does
+// match its negation
+func TestQueryMissingPaths(t *testing.T) {
+	d := usersIndex(t)
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"@age:[-inf +inf]", []string{"user:1", "user:2", "user:3"}},
+		{"-@age:[-inf +inf]", []string{"user:4"}},
+		{"-@bio:hiking", []string{"user:3", "user:4"}},
+		{"@tags:{ops} | -@tags:{ops}", []string{"user:1", "user:2", "user:3", "user:4"}},
+		{"@status:{unknown}", []string{}},
+	}
+	for _, tt := range tests {
+		if got := queryKeys(t, d, tt.query, QueryOptions{}); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	// Removing the field takes the key out of its postings
+	if _, err := d.JSONDel("user:1", "$.tags"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := queryKeys(t, d, "@tags:{ops}", QueryOptions{}), []string{"user:3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after deleting user:1's tags: got %v, want %v", got, want)
+	}
+}
+
+func TestQueryInvalid(t *testing.T) {
+	d := usersIndex(t)
+	for _, query := range []string{
+		"",
+		"|",
+		"@status:{open} |",
+		"(@status:{open}",
+		"@status:{open",
+		"@status:open",
+		"@nope:{x}",
+		"@age:{30}",
+		"@age:[1]",
+		"@age:[1 2 3]",
+		"@age:[a 2]",
+		"@age:[1 2",
+		`@bio:"hiking`,
+		"@bio:--",
+		"@status",
+		"@status:{open})",
+	} {
+		if _, err := d.Query("users", query, QueryOptions{Limit: 10}); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("%q: err = %v, want ErrInvalidQuery", query, err)
+		}
+	}
+	if _, err := d.Query("users", "*", QueryOptions{SortBy: "nope", Limit: 10}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("sort by an unknown field: err = %v", err)
+	}
+	if _, err := d.Query("users", "*", QueryOptions{Offset: -1}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("negative offset: err = %v", err)
+	}
+	if _, err := d.Query("users", "*", QueryOptions{Reduce: []Reducer{{Op: "sum", Field: "status"}}}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("sum of a tag field: err = %v", err)
+	}
+	if _, err := d.Query("nope", "*", QueryOptions{}); !errors.Is(err, ErrNoSuchIndex) {
+		t.Errorf("unknown index: err = %v", err)
+	}
+}
+
+func TestQuerySortAndPage(t *testing.T) {
+	d := usersIndex(t)
+	// Keys without the field come last whichever the direction
+	if got, want := queryKeys(t, d, "*", QueryOptions{SortBy: "age"}), []string{"user:2", "user:3", "user:1", "user:4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("by age: got %v, want %v", got, want)
+	}
+	if got, want := queryKeys(t, d, "*", QueryOptions{SortBy: "age", Desc: true}), []string{"user:1", "user:3", "user:2", "user:4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("by age descending: got %v, want %v", got, want)
+	}
+
+	res, err := d.Query("users", "*", QueryOptions{SortBy: "age", Offset: 1, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 4 || len(res.Docs) != 2 || res.Docs[0].Key != "user:3" || res.Docs[1].Key != "user:1" {
+		t.Errorf("page: %+v", res)
+	}
+	if res, _ := d.Query("users", "*", QueryOptions{Offset: 10, Limit: 2}); res.Total != 4 || len(res.Docs) != 0 {
+		t.Errorf("page past the end: %+v", res)
+	}
+}
+
+func TestQueryAggregate(t *testing.T) {
+	d := usersIndex(t)
+	res, err := d.Query("users", "*", QueryOptions{
+		GroupBy: []string{"status"},
+		Reduce:  []Reducer{{Op: "count"}, {Op: "avg", Field: "age"}, {Op: "max", Field: "age", As: "oldest"}},
+		Limit:   10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]interface{}{
+		{"status": "closed", "count": 1, "avg_age": 17.0, "oldest": 17.0},
+		{"status": "open", "count": 3, "avg_age": 24.0, "oldest": 30.0},
+	}
+	if res.Total != 2 || !reflect.DeepEqual(res.Groups, want) {
+		t.Errorf("groups: got %v, want %v", res.Groups, want)
+	}
+
+	res, err = d.Query("users", "*", QueryOptions{
+		GroupBy: []string{"status"},
+		Reduce:  []Reducer{{Op: "count"}},
+		SortBy:  "count",
+		Desc:    true,
+		Limit:   1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 2 || len(res.Groups) != 1 || res.Groups[0]["status"] != "open" {
+		t.Errorf("largest group: %+v", res)
+	}
+}
+
+// TestQueryAllow checks that keys Allow rejects are left out of results,
+// totals and groups
+func TestQueryAllow(t *testing.T) {
+	d := usersIndex(t)
+	allow := func(key string) bool { return key != "user:1" }
+
+	res, err := d.Query("users", "@status:{open}", QueryOptions{Allow: allow, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, doc := range res.Docs {
+		keys = append(keys, doc.Key)
+	}
+	if want := []string{"user:3", "user:4"}; res.Total != 2 || !reflect.DeepEqual(keys, want) {
+		t.Errorf("got %d %v, want %v", res.Total, keys, want)
+	}
+
+	res, err = d.Query("users", "*", QueryOptions{
+		Allow:   allow,
+		GroupBy: []string{"status"},
+		Reduce:  []Reducer{{Op: "count"}, {Op: "max", Field: "age"}},
+		Limit:   10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]interface{}{
+		{"status": "closed", "count": 1, "max_age": 17.0},
+		{"status": "open", "count": 2, "max_age": 18.0},
+	}
+	if !reflect.DeepEqual(res.Groups, want) {
+		t.Errorf("groups: got %v, want %v", res.Groups, want)
+	}
+
+	if res, _ := d.Query("users", "*", QueryOptions{Allow: func(string) bool { return false }, Limit: 10}); res.Total != 0 || len(res.Docs) != 0 {
+		t.Errorf("nothing allowed: %+v", res)
+	}
+}
@@ -0,0 +1,436 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrNoMessage    = errors.New("no such message")
+	ErrStaleReceipt = errors.New("receipt does not match the message's current lease")
+)
+
+// DefaultVisibilityTimeout is how long a received message stays invisible
+// unless the queue or the receive call sets another
+const DefaultVisibilityTimeout = 30 * time.Second
+
+// Queue is a work queue with leases. A received message is hidden until its
+// lease ends; it is then delivered again unless it was acknowledged. After
+// MaxAttempts deliveries a message moves to the DeadLetter queue instead.
+type Queue struct {
+	Messages map[string]*QueueMessage `json:"messages"`
+	NextID   uint64                   `json:"next_id"`
+	QueueConfig
+}
+
+// QueueConfig are a queue's settings. Zero values use the defaults.
+type QueueConfig struct {
+	Visibility time.Duration `json:"visibility,omitempty"`
+	// MaxAttempts is how often a message is delivered before it is dead
+	// lettered; zero delivers it forever
+	MaxAttempts int `json:"max_attempts,omitempty"`
+	// DeadLetter is the key of the queue dead messages move to, in the
+	// same namespace. Empty drops them.
+	DeadLetter string `json:"dead_letter,omitempty"`
+}
+
+// QueueMessage is one message. Receipt identifies the current lease and is
+// needed to ack, nack or extend it.
+type QueueMessage struct {
+	ID         string    `json:"id"`
+	Body       string    `json:"body"`
+	Attempts   int       `json:"attempts"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+	VisibleAt  time.Time `json:"visible_at"`
+	Receipt    string    `json:"receipt,omitempty"`
+	seq        uint64
+}
+
+func queueMessageSize(m *QueueMessage) int64 {
+	return int64(len(m.ID)+len(m.Body)+len(m.Receipt)) + itemOverhead
+}
+
+func (q *Queue) visibility() time.Duration {
+	if q.Visibility > 0 {
+		return q.Visibility
+	}
+	return DefaultVisibilityTimeout
+}
+
+// seqOf orders messages that become visible at the same time by ID
+func seqOf(m *QueueMessage) uint64 {
+	if m.seq == 0 {
+		m.seq, _ = strconv.ParseUint(m.ID, 10, 64)
+	}
+	return m.seq
+}
+
+// visible returns the messages visible at now in delivery order, and how
+// long until the next hidden one becomes visible, or zero if there is none
+func (q *Queue) visible(now time.Time) ([]*QueueMessage, time.Duration) {
+	var out []*QueueMessage
+	var next time.Duration
+	for _, m := range q.Messages {
+		if !m.VisibleAt.After(now) {
+			out = append(out, m)
+		} else if d := m.VisibleAt.Sub(now); next == 0 || d < next {
+			next = d
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if !a.VisibleAt.Equal(b.VisibleAt) {
+			return a.VisibleAt.Before(b.VisibleAt)
+		}
+		return seqOf(a) < seqOf(b)
+	})
+	return out, next
+}
+
+// list copies the messages in ID order
+func (q *Queue) list() []QueueMessage {
+	out := make([]QueueMessage, 0, len(q.Messages))
+	for _, m := range q.Messages {
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return seqOf(&out[i]) < seqOf(&out[j]) })
+	return out
+}
+
+// queue returns the queue under key in db, or nil if there is none. The
+// caller must hold s.Mu.
+func (s *DataObj) queue(db, key string, now time.Time) (*Queue, error) {
+	item, exists := s.live(db, key, now)
+	if !exists {
+		return nil, nil
+	}
+	if item.Type != QueueType {
+		return nil, ErrWrongType
+	}
+	return item.Value.(*Queue), nil
+}
+
+// createQueue stores an empty queue under key. The caller must hold s.Mu.
+func (s *DataObj) createQueue(cmd Command, key string) (*Queue, error) {
+	if err := s.reserve(cmd); err != nil {
+		return nil, err
+	}
+	q := &Queue{Messages: make(map[string]*QueueMessage)}
+	s.put(cmd.DB, key, &Item{Type: QueueType, Value: q})
+	return q, nil
+}
+
+type queueArgs struct {
+	Body    string        `json:"body,omitempty"`
+	Delay   time.Duration `json:"delay,omitempty"`
+	Count   int           `json:"count,omitempty"`
+	Lease   time.Duration `json:"lease,omitempty"`
+	ID      string        `json:"id,omitempty"`
+	Receipt string        `json:"receipt,omitempty"`
+	Config  *QueueConfig  `json:"config,omitempty"`
+}
+
+// Enqueue adds a message to the queue under key, creating the queue, and
+// returns its ID. The message is delivered no earlier than delay from now.
+func (d *DB) Enqueue(key, body string, delay time.Duration) (string, error) {
+	res := d.s.exec(withArgs(Command{Op: OpEnqueue, DB: d.name, Key: key}, queueArgs{Body: body, Delay: delay}))
+	return res.Value, res.Err
+}
+
+func (s *DataObj) applyEnqueue(cmd Command) Result {
+	var a queueArgs
+	if err := decodeArgs(cmd, &a); err != nil {
+		return Result{Err: err}
+	}
+	q, err := s.queue(cmd.DB, cmd.Key, cmd.Now)
+	if err != nil {
+		return Result{Err: err}
+	}
+
+	m := &QueueMessage{Body: a.Body, EnqueuedAt: cmd.Now, VisibleAt: cmd.Now.Add(a.Delay)}
+	next := uint64(1)
+	if q != nil {
+		next = q.NextID + 1
+	}
+	m.ID = strconv.FormatUint(next, 10)
+
+	grow := queueMessageSize(m)
+	if q == nil {
+		grow += int64(len(cmd.Key)) + itemOverhead
+	}
+	if err := s.admit(cmd, grow, len(a.Body)); err != nil {
+		return Result{Err: err}
+	}
+	if q == nil {
+		if q, err = s.createQueue(cmd, cmd.Key); err != nil {
+			return Result{Err: err}
+		}
+	} else if err := s.reserve(cmd); err != nil {
+		return Result{Err: err}
+	}
+	q.NextID = next
+	q.Messages[m.ID] = m
+	s.grow(cmd.DB, cmd.Key, queueMessageSize(m))
+	s.notifyAdded()
+	return Result{Value: m.ID, OK: true}
+}
+
+// Receive leases up to count visible messages from the queue under key for
+// lease, or the queue's visibility timeout if lease is zero. If there are
+// none it waits up to block for one.
+func (d *DB) Receive(ctx context.Context, key string, count int, lease, block time.Duration) ([]QueueMessage, error) {
+	if count <= 0 {
+		count = 1
+	}
+	a := queueArgs{Count: count, Lease: lease}
+	return blockFor(ctx, block, func() ([]QueueMessage, <-chan struct{}, time.Duration, error) {
+		// Check before proposing so idle workers do not write to the
+		// replicated log
+		d.s.lock()
+		added := d.s.added()
+		q, err := d.s.queue(d.name, key, time.Now())
+		var ready []*QueueMessage
+		var next time.Duration
+		if q != nil {
+			ready, next = q.visible(time.Now())
+		}
+		d.s.Mu.Unlock()
+		if err != nil || len(ready) == 0 {
+			return nil, added, next, err
+		}
+
+		res := d.s.exec(withArgs(Command{Op: OpReceive, DB: d.name, Key: key}, a))
+		if res.Err != nil {
+			return nil, added, 0, res.Err
+		}
+		return res.Data.([]QueueMessage), added, next, nil
+	})
+}
+
+func (s *DataObj) applyReceive(cmd Command) Result {
+	var a queueArgs
+	if err := decodeArgs(cmd, &a); err != nil {
+		return Result{Err: err}
+	}
+	q, err := s.queue(cmd.DB, cmd.Key, cmd.Now)
+	if err != nil || q == nil {
+		return Result{Data: []QueueMessage{}, Err: err}
+	}
+	lease := a.Lease
+	if lease <= 0 {
+		lease = q.visibility()
+	}
+
+	ready, _ := q.visible(cmd.Now)
+	out := []QueueMessage{}
+	for _, m := range ready {
+		if len(out) == a.Count {
+			break
+		}
+		if q.MaxAttempts > 0 && m.Attempts >= q.MaxAttempts {
+			s.deadLetter(cmd, q, m)
+			continue
+		}
+		size := queueMessageSize(m)
+		m.Attempts++
+		m.VisibleAt = cmd.Now.Add(lease)
+		m.Receipt = m.ID + "." + strconv.Itoa(m.Attempts)
+		s.grow(cmd.DB, cmd.Key, queueMessageSize(m)-size)
+		out = append(out, *m)
+	}
+	return Result{Data: out, N: len(out), OK: true}
+}
+
+// deadLetter moves m from q to q's dead letter queue, or drops it. The
+// caller must hold s.Mu.
+func (s *DataObj) deadLetter(cmd Command, q *Queue, m *QueueMessage) {
+	delete(q.Messages, m.ID)
+	s.grow(cmd.DB, cmd.Key, -queueMessageSize(m))
+	if q.DeadLetter == "" || q.DeadLetter == cmd.Key {
+		return
+	}
+
+	dlq, err := s.queue(cmd.DB, q.DeadLetter, cmd.Now)
+	if err != nil {
+		s.log.Warn("dead letter key holds another type, message dropped",
+			"db", cmd.DB, "queue", cmd.Key, "dead_letter", q.DeadLetter, "id", m.ID)
+		return
+	}
+	if dlq == nil {
+		// Moving a message does not grow the store, so skip the memory
+		// checks that could fail here
+		dlq = &Queue{Messages: make(map[string]*QueueMessage)}
+		s.put(cmd.DB, q.DeadLetter, &Item{Type: QueueType, Value: dlq})
+	}
+	dlq.NextID++
+	dead := &QueueMessage{
+		ID:         strconv.FormatUint(dlq.NextID, 10),
+		Body:       m.Body,
+		EnqueuedAt: cmd.Now,
+		VisibleAt:  cmd.Now,
+	}
+	dlq.Messages[dead.ID] = dead
+	s.grow(cmd.DB, q.DeadLetter, queueMessageSize(dead))
+	s.notifyAdded()
+}
+
+// lease returns the message with id if receipt names its current lease.
+// The caller must hold s.Mu.
+func (s *DataObj) lease(cmd Command, a queueArgs) (*Queue, *QueueMessage, error) {
+	q, err := s.queue(cmd.DB, cmd.Key, cmd.Now)
+	if err != nil {
+		return nil, nil, err
+	}
+	if q == nil {
+		return nil, nil, ErrNoSuchKey
+	}
+	m, ok := q.Messages[a.ID]
+	if !ok {
+		return nil, nil, ErrNoMessage
+	}
+	if m.Receipt == "" || m.Receipt != a.Receipt || !m.VisibleAt.After(cmd.Now) {
+		return nil, nil, ErrStaleReceipt
+	}
+	return q, m, nil
+}
+
+// Ack removes a received message from the queue. It fails with
+// ErrStaleReceipt if the lease ended and the message may have been given to
+// another worker.
+func (d *DB) Ack(key, id, receipt string) error {
+	return d.s.exec(withArgs(Command{Op: OpAck, DB: d.name, Key: key}, queueArgs{ID: id, Receipt: receipt})).Err
+}
+
+func (s *DataObj) applyAck(cmd Command) Result {
+	var a queueArgs
+	if err := decodeArgs(cmd, &a); err != nil {
+		return Result{Err: err}
+	}
+	q, m, err := s.lease(cmd, a)
+	if err != nil {
+		return Result{Err: err}
+	}
+	delete(q.Messages, m.ID)
+	s.grow(cmd.DB, cmd.Key, -queueMessageSize(m))
+	return Result{OK: true}
+}
+
+// Nack ends the lease of a received message early so it is delivered again
+// after delay, or dead lettered if it has used up its attempts
+func (d *DB) Nack(key, id, receipt string, delay time.Duration) error {
+	a := queueArgs{ID: id, Receipt: receipt, Delay: delay}
+	return d.s.exec(withArgs(Command{Op: OpNack, DB: d.name, Key: key}, a)).Err
+}
+
+func (s *DataObj) applyNack(cmd Command) Result {
+	var a queueArgs
+	if err := decodeArgs(cmd, &a); err != nil {
+		return Result{Err: err}
+	}
+	q, m, err := s.lease(cmd, a)
+	if err != nil {
+		return Result{Err: err}
+	}
+	if q.MaxAttempts > 0 && m.Attempts >= q.MaxAttempts {
+		s.deadLetter(cmd, q, m)
+		return Result{OK: true}
+	}
+	size := queueMessageSize(m)
+	m.Receipt = ""
+	m.VisibleAt = cmd.Now.Add(a.Delay)
+	s.grow(cmd.DB, cmd.Key, queueMessageSize(m)-size)
+	s.notifyAdded()
+	return Result{OK: true}
+}
+
+// ExtendLease keeps a received message hidden for lease from now, for work
+// that takes longer than the visibility timeout
+func (d *DB) ExtendLease(key, id, receipt string, lease time.Duration) error {
+	a := queueArgs{ID: id, Receipt: receipt, Lease: lease}
+	return d.s.exec(withArgs(Command{Op: OpExtendLease, DB: d.name, Key: key}, a)).Err
+}
+
+func (s *DataObj) applyExtendLease(cmd Command) Result {
+	var a queueArgs
+	if err := decodeArgs(cmd, &a); err != nil {
+		return Result{Err: err}
+	}
+	q, m, err := s.lease(cmd, a)
+	if err != nil {
+		return Result{Err: err}
+	}
+	lease := a.Lease
+	if lease <= 0 {
+		lease = q.visibility()
+	}
+	m.VisibleAt = cmd.Now.Add(lease)
+	return Result{OK: true}
+}
+
+// ConfigureQueue changes the settings of the queue under key, creating it
+func (d *DB) ConfigureQueue(key string, cfg QueueConfig) error {
+	return d.s.exec(withArgs(Command{Op: OpConfigureQueue, DB: d.name, Key: key}, queueArgs{Config: &cfg})).Err
+}
+
+func (s *DataObj) applyConfigureQueue(cmd Command) Result {
+	var a queueArgs
+	if err := decodeArgs(cmd, &a); err != nil {
+		return Result{Err: err}
+	}
+	q, err := s.queue(cmd.DB, cmd.Key, cmd.Now)
+	if err != nil {
+		return Result{Err: err}
+	}
+	if q == nil {
+		if err := s.admit(cmd, int64(len(cmd.Key))+itemOverhead, 0); err != nil {
+			return Result{Err: err}
+		}
+		if q, err = s.createQueue(cmd, cmd.Key); err != nil {
+			return Result{Err: err}
+		}
+	}
+	if a.Config != nil {
+		q.QueueConfig = *a.Config
+	}
+	return Result{OK: true}
+}
+
+// QueueInfo describes a queue. Ready messages can be received now,
+// in-flight ones are leased and delayed ones were never delivered and are
+// not visible yet.
+type QueueInfo struct {
+	QueueConfig
+	Ready    int `json:"ready"`
+	InFlight int `json:"in_flight"`
+	Delayed  int `json:"delayed"`
+}
+
+// QueueInfo describes the queue under key
+func (d *DB) QueueInfo(key string) (QueueInfo, error) {
+	d.s.rlock()
+	defer d.s.Mu.RUnlock()
+	now := time.Now()
+	q, err := d.s.queue(d.name, key, now)
+	if err != nil {
+		return QueueInfo{}, err
+	}
+	if q == nil {
+		return QueueInfo{}, ErrNoSuchKey
+	}
+	info := QueueInfo{QueueConfig: q.QueueConfig}
+	info.Visibility = q.visibility()
+	for _, m := range q.Messages {
+		switch {
+		case !m.VisibleAt.After(now):
+			info.Ready++
+		case m.Receipt != "":
+			info.InFlight++
+		default:
+			info.Delayed++
+		}
+	}
+	return info, nil
+}
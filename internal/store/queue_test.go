@@ -0,0 +1,255 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// receive takes up to count messages from the queue without waiting
+func receive(t *testing.T, d *DB, key string, count int, lease time.Duration) []QueueMessage {
+	t.Helper()
+	msgs, err := d.Receive(context.Background(), key, count, lease, 0)
+	if err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	return msgs
+}
+
+// bodies returns the bodies of msgs
+func bodies(msgs []QueueMessage) []string {
+	out := []string{}
+	for _, m := range msgs {
+		out = append(out, m.Body)
+	}
+	return out
+}
+
+func TestQueueDelivery(t *testing.T) {
+	s := NewRedisMemoryStore()
+	defer s.Close()
+	d := s.DB(DefaultDB)
+
+	if got := receive(t, d, "q", 1, 0); len(got) != 0 {
+		t.Errorf("Receive from a missing queue: %v", bodies(got))
+	}
+	for _, body := range []string{"a", "b", "c"} {
+		if _, err := d.Enqueue("q", body, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := d.Enqueue("q", "later", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	// Messages come out in the order they went in, each to one receiver
+	first := receive(t, d, "q", 2, time.Hour)
+	if got := bodies(first); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Fatalf("first Receive: %v", got)
+	}
+	if first[0].Attempts != 1 || first[0].Receipt == "" {
+		t.Errorf("received message %+v", first[0])
+	}
+	second := receive(t, d, "q", 5, 50*time.Millisecond)
+	if got := bodies(second); len(got) != 1 || got[0] != "c" {
+		t.Fatalf("second Receive: %v", got)
+	}
+	if got := receive(t, d, "q", 5, 0); len(got) != 0 {
+		t.Errorf("Receive with everything leased or delayed: %v", bodies(got))
+	}
+	info, err := d.QueueInfo("q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Ready != 0 || info.InFlight != 3 || info.Delayed != 1 || info.Visibility != DefaultVisibilityTimeout {
+		t.Errorf("QueueInfo = %+v", info)
+	}
+
+	if err := d.Ack("q", first[0].ID, first[0].Receipt); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Ack("q", first[0].ID, first[0].Receipt); !errors.Is(err, ErrNoMessage) {
+		t.Errorf("second Ack: err = %v, want ErrNoMessage", err)
+	}
+	if err := d.Ack("q", first[1].ID, "wrong"); !errors.Is(err, ErrStaleReceipt) {
+		t.Errorf("Ack with a wrong receipt: err = %v, want ErrStaleReceipt", err)
+	}
+	if err := d.Ack("missing", "1", "1.1"); !errors.Is(err, ErrNoSuchKey) {
+		t.Errorf("Ack on a missing queue: err = %v, want ErrNoSuchKey", err)
+	}
+
+	// A message whose lease ends is delivered again with a new receipt,
+	// and the old one no longer acks it
+	time.Sleep(80 * time.Millisecond)
+	again := receive(t, d, "q", 5, time.Hour)
+	if len(again) != 1 || again[0].ID != second[0].ID || again[0].Attempts != 2 || again[0].Receipt == second[0].Receipt {
+		t.Fatalf("redelivery: %+v", again)
+	}
+	if err := d.Ack("q", second[0].ID, second[0].Receipt); !errors.Is(err, ErrStaleReceipt) {
+		t.Errorf("Ack with the first lease's receipt: err = %v, want ErrStaleReceipt", err)
+	}
+
+	// Nack makes a message visible again after its delay
+	if err := d.Nack("q", first[1].ID, first[1].Receipt, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := receive(t, d, "q", 5, time.Hour); len(got) != 1 || got[0].Body != "b" || got[0].Attempts != 2 {
+		t.Errorf("Receive after Nack: %+v", got)
+	}
+	if err := d.Nack("q", again[0].ID, again[0].Receipt, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if got := receive(t, d, "q", 5, time.Hour); len(got) != 0 {
+		t.Errorf("Receive before the Nack delay: %v", bodies(got))
+	}
+	time.Sleep(80 * time.Millisecond)
+	if got := receive(t, d, "q", 5, time.Hour); len(got) != 1 || got[0].Body != "c" {
+		t.Errorf("Receive after the Nack delay: %v", bodies(got))
+	}
+
+	if err := d.Set("str", "v", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Enqueue("str", "x", 0); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Enqueue to a string: err = %v, want ErrWrongType", err)
+	}
+}
+
+func TestQueueExtendLease(t *testing.T) {
+	s := NewRedisMemoryStore()
+	defer s.Close()
+	d := s.DB(DefaultDB)
+	if _, err := d.Enqueue("q", "a", 0); err != nil {
+		t.Fatal(err)
+	}
+	m := receive(t, d, "q", 1, 50*time.Millisecond)[0]
+	for i := 0; i < 3; i++ {
+		time.Sleep(30 * time.Millisecond)
+		if err := d.ExtendLease("q", m.ID, m.Receipt, 50*time.Millisecond); err != nil {
+			t.Fatalf("ExtendLease %d: %v", i, err)
+		}
+		if got := receive(t, d, "q", 1, 0); len(got) != 0 {
+			t.Fatalf("message redelivered while its lease was extended")
+		}
+	}
+	time.Sleep(80 * time.Millisecond)
+	if err := d.ExtendLease("q", m.ID, m.Receipt, time.Minute); !errors.Is(err, ErrStaleReceipt) {
+		t.Errorf("ExtendLease after the lease ended: err = %v, want ErrStaleReceipt", err)
+	}
+	if err := d.Ack("q", m.ID, m.Receipt); !errors.Is(err, ErrStaleReceipt) {
+		t.Errorf("Ack after the lease ended: err = %v, want ErrStaleReceipt", err)
+	}
+}
+
+func TestQueueDeadLetter(t *testing.T) {
+	s := NewRedisMemoryStore()
+	defer s.Close()
+	d := s.DB(DefaultDB)
+	if err := d.ConfigureQueue("q", QueueConfig{MaxAttempts: 2, DeadLetter: "dlq", Visibility: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Enqueue("q", "a", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// a fails by timing out twice and is dead lettered on the next receive
+	for i := 0; i < 2; i++ {
+		if got := receive(t, d, "q", 1, 20*time.Millisecond); len(got) != 1 || got[0].Body != "a" {
+			t.Fatalf("delivery %d: %v", i+1, bodies(got))
+		}
+		time.Sleep(40 * time.Millisecond)
+	}
+	// b is nacked on its last attempt, which dead letters it at once
+	if _, err := d.Enqueue("q", "b", 0); err != nil {
+		t.Fatal(err)
+	}
+	got := receive(t, d, "q", 2, 0)
+	if len(got) != 1 || got[0].Body != "b" {
+		t.Fatalf("Receive after a's attempts: %v", bodies(got))
+	}
+	if err := d.Nack("q", got[0].ID, got[0].Receipt, 0); err != nil {
+		t.Fatal(err)
+	}
+	got = receive(t, d, "q", 2, 0)
+	if err := d.Nack("q", got[0].ID, got[0].Receipt, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := d.QueueInfo("q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Ready+info.InFlight+info.Delayed != 0 {
+		t.Errorf("queue after dead lettering: %+v", info)
+	}
+	dead := receive(t, d, "dlq", 5, 0)
+	if got := bodies(dead); len(got) != 2 || got[0] != "a" || got[1] != "b" || dead[0].Attempts != 1 {
+		t.Errorf("dead letter queue: %+v", dead)
+	}
+
+	// Without a dead letter queue, or with one of another type, dead
+	// messages are dropped
+	if err := d.Set("str", "v", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConfigureQueue("q", QueueConfig{MaxAttempts: 1, DeadLetter: "str"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Enqueue("q", "c", 0); err != nil {
+		t.Fatal(err)
+	}
+	m := receive(t, d, "q", 1, 0)[0]
+	if err := d.Nack("q", m.ID, m.Receipt, 0); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := d.QueueInfo("q"); info.Ready != 0 {
+		t.Errorf("message kept after a failed dead lettering: %+v", info)
+	}
+	if v, _, _ := d.Get("str"); v != "v" {
+		t.Errorf("dead letter key of another type changed to %v", v)
+	}
+}
+
+func TestQueueReceiveBlocks(t *testing.T) {
+	s := NewRedisMemoryStore()
+	defer s.Close()
+	d := s.DB(DefaultDB)
+
+	received := make(chan []QueueMessage, 1)
+	go func() {
+		msgs, err := d.Receive(context.Background(), "q", 1, 0, 5*time.Second)
+		if err != nil {
+			t.Error(err)
+		}
+		received <- msgs
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if _, err := d.Enqueue("q", "a", 0); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-received:
+		if len(got) != 1 || got[0].Body != "a" {
+			t.Errorf("blocked Receive got %v", bodies(got))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("blocked Receive did not return after Enqueue")
+	}
+
+	// A delayed message wakes a blocked receiver when it becomes visible
+	if _, err := d.Enqueue("q", "delayed", 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	got, err := d.Receive(context.Background(), "q", 1, 0, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Body != "delayed" {
+		t.Errorf("Receive of a delayed message: %v", bodies(got))
+	}
+	if waited := time.Since(start); waited < 80*time.Millisecond || waited > 2*time.Second {
+		t.Errorf("delayed message received after %v, want about 100ms", waited)
+	}
+}
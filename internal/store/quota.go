@@ -0,0 +1,84 @@
+package store
+
+import "errors"
+
+var (
+	ErrKeyQuota      = errors.New("namespace key quota exceeded")
+	ErrByteQuota     = errors.New("namespace memory quota exceeded")
+	ErrValueTooLarge = errors.New("value exceeds the namespace's maximum value size")
+)
+
+// Quota limits what one namespace may hold. Zero fields are unlimited.
+type Quota struct {
+	MaxKeys      int   `json:"max_keys,omitempty"`
+	MaxBytes     int64 `json:"max_bytes,omitempty"`
+	MaxValueSize int   `json:"max_value_size,omitempty"`
+}
+
+// WithQuotas makes the store enforce the quota fn returns for each
+// namespace on every write. The quota is looked up when a command is
+// issued and carried in it, so in replicated mode every member enforces
+// the quotas of the node that accepted the write.
+func WithQuotas(fn func(db string) Quota) Option {
+	return func(s *DataObj) {
+		s.quotas = fn
+	}
+}
+
+// Usage is how much of its quota a namespace uses
+type Usage struct {
+	Keys  int   `json:"keys"`
+	Bytes int64 `json:"bytes"`
+}
+
+// Usage returns the live keys and estimated bytes held by the namespace
+func (d *DB) Usage() Usage {
+	d.s.rlock()
+	defer d.s.Mu.RUnlock()
+	u := Usage{Keys: d.s.size(d.name)}
+	if m, ok := d.s.dbs[d.name]; ok {
+		u.Bytes = m.used
+	}
+	return u
+}
+
+// admit checks that cmd, which stores valueSize bytes of user data and
+// grows the namespace by grow bytes, fits the quota it carries. Keys of the
+// namespace that have expired as of cmd.Now are dropped before a write is
+// refused. The caller must hold s.Mu.
+func (s *DataObj) admit(cmd Command, grow int64, valueSize int) error {
+	if cmd.Quota == nil {
+		return nil
+	}
+	q := *cmd.Quota
+	if q.MaxValueSize > 0 && valueSize > q.MaxValueSize {
+		return ErrValueTooLarge
+	}
+
+	check := func() error {
+		var used int64
+		var n int
+		if m, ok := s.dbs[cmd.DB]; ok {
+			used, n = m.used, len(m.Data)
+		}
+		_, exists := s.keys(cmd.DB)[cmd.Key]
+		if q.MaxKeys > 0 && !exists && n >= q.MaxKeys {
+			return ErrKeyQuota
+		}
+		if q.MaxBytes > 0 && grow > 0 && used+grow > q.MaxBytes {
+			return ErrByteQuota
+		}
+		return nil
+	}
+	if err := check(); err == nil {
+		return nil
+	}
+
+	for k, v := range s.keys(cmd.DB) {
+		if k != cmd.Key && v.expiredAt(cmd.Now) {
+			s.del(cmd.DB, k)
+			s.expired++
+		}
+	}
+	return check()
+}
@@ -0,0 +1,238 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+type snapshotItem struct {
+	// DB is omitted for the default namespace, so snapshots written before
+	// namespaces existed load into it
+	DB        string          `json:"db,omitempty"`
+	Key       string          `json:"key"`
+	Type      DataType        `json:"type"`
+	Value     json.RawMessage `json:"value"`
+	ExpiresAt time.Time       `json:"expires_at"`
+	// KeyBin replaces Key, and Binary marks a base64 Value, for keys and
+	// values that are not valid UTF-8, see binary.go
+	KeyBin  []byte `json:"key_bin,omitempty"`
+	Binary  bool   `json:"binary,omitempty"`
+	Version uint64 `json:"version,omitempty"`
+	Flags   uint32 `json:"flags,omitempty"`
+}
+
+// snapshot is the contents of the store. Snapshots written before indexes
+// existed are a bare array of items.
+type snapshot struct {
+	// Version is the store's version counter, which may be ahead of every
+	// item's version once the newest keys are deleted
+	Version uint64 `json:"version,omitempty"`
+	// Fence is the last lock fencing token handed out, which may be ahead
+	// of every lock still stored once the newest ones are released
+	Fence    uint64             `json:"fence,omitempty"`
+	Items    []snapshotItem     `json:"items"`
+	Indexes  []snapshotIndex    `json:"indexes,omitempty"`
+	FullText []snapshotFullText `json:"full_text,omitempty"`
+}
+
+// snapshotIndex is the definition of an index, see index.go
+type snapshotIndex struct {
+	DB string `json:"db,omitempty"`
+	IndexDef
+}
+
+// snapshotFullText is the definition of a full-text index, see fulltext.go
+type snapshotFullText struct {
+	DB string `json:"db,omitempty"`
+	FullTextDef
+}
+
+// Snapshot serialises every item in the store and the definitions of the
+// secondary and full-text indexes
+func (s *DataObj) Snapshot() ([]byte, error) {
+	s.lock()
+	defer s.Mu.Unlock()
+
+	var items []snapshotItem
+	for db, m := range s.dbs {
+		if db == DefaultDB {
+			db = ""
+		}
+		for k, v := range m.Data {
+			value, binary, err := encodeValue(v.Value)
+			if err != nil {
+				return nil, fmt.Errorf("encode %q: %w", k, err)
+			}
+			it := snapshotItem{
+				DB:        db,
+				Key:       k,
+				Type:      v.Type,
+				Value:     value,
+				ExpiresAt: v.ExpiresAt,
+				Binary:    binary,
+				Version:   v.Version,
+				Flags:     v.Flags,
+			}
+			if !utf8.ValidString(k) {
+				it.Key, it.KeyBin = "", []byte(k)
+			}
+			items = append(items, it)
+		}
+	}
+	if items == nil {
+		items = []snapshotItem{}
+	}
+	var indexes []snapshotIndex
+	for db, byName := range s.indexes {
+		if db == DefaultDB {
+			db = ""
+		}
+		for _, ix := range byName {
+			indexes = append(indexes, snapshotIndex{DB: db, IndexDef: ix.def})
+		}
+	}
+	var fullText []snapshotFullText
+	for db, byName := range s.fullText {
+		if db == DefaultDB {
+			db = ""
+		}
+		for _, ix := range byName {
+			fullText = append(fullText, snapshotFullText{DB: db, FullTextDef: ix.def})
+		}
+	}
+	return json.Marshal(snapshot{Version: s.version, Fence: s.fence, Items: items, Indexes: indexes, FullText: fullText})
+}
+
+// Restore replaces the contents of the store with a snapshot
+func (s *DataObj) Restore(data []byte) error {
+	var snap snapshot
+	var err error
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(data, &snap.Items)
+	} else {
+		err = json.Unmarshal(data, &snap)
+	}
+	if err != nil {
+		return fmt.Errorf("decode snapshot: %w", err)
+	}
+	items := snap.Items
+
+	restored := map[string]*DataMap{DefaultDB: NewDataMap()}
+	var used int64
+	fence := snap.Fence
+	version := snap.Version
+	for _, it := range items {
+		if it.Version > version {
+			version = it.Version
+		}
+	}
+	for _, it := range items {
+		if it.KeyBin != nil {
+			it.Key = string(it.KeyBin)
+		}
+		decode := decodeValue
+		if it.Binary {
+			decode = decodeBinary
+		}
+		value, err := decode(it.Type, it.Value)
+		if err != nil {
+			return fmt.Errorf("decode %q: %w", it.Key, err)
+		}
+		db := it.DB
+		if db == "" {
+			db = DefaultDB
+		}
+		m, ok := restored[db]
+		if !ok {
+			m = NewDataMap()
+			restored[db] = m
+		}
+		item := &Item{
+			Type:      it.Type,
+			Value:     value,
+			ExpiresAt: it.ExpiresAt,
+			Version:   it.Version,
+			Flags:     it.Flags,
+		}
+		// Snapshots written before items had versions give each one a
+		// fresh version, in snapshot order so replicas agree
+		if item.Version == 0 {
+			version++
+			item.Version = version
+		}
+		m.Data[it.Key] = item
+		if l, ok := value.(*Lock); ok && l.Token > fence {
+			fence = l.Token
+		}
+		m.used += entrySize(it.Key, item)
+		used += entrySize(it.Key, item)
+	}
+
+	s.lock()
+	defer s.Mu.Unlock()
+	s.dbs = restored
+	s.used = used
+	// Never hand out a token below one handed out before the snapshot,
+	// even if the clock is behind the node that wrote it. Snapshots written
+	// before the counter was kept fall back to the tokens of stored locks.
+	s.fence = fence
+	s.version = version
+	s.indexes = nil
+	for _, def := range snap.Indexes {
+		db := def.DB
+		if db == "" {
+			db = DefaultDB
+		}
+		if s.indexes == nil {
+			s.indexes = map[string]map[string]*searchIndex{}
+		}
+		if s.indexes[db] == nil {
+			s.indexes[db] = map[string]*searchIndex{}
+		}
+		s.indexes[db][def.Name] = s.buildIndex(db, def.IndexDef)
+	}
+	s.fullText = nil
+	for _, def := range snap.FullText {
+		db := def.DB
+		if db == "" {
+			db = DefaultDB
+		}
+		s.addFullText(db, def.FullTextDef)
+	}
+	return nil
+}
+
+func decodeValue(t DataType, raw json.RawMessage) (interface{}, error) {
+	switch t {
+	case StringType:
+		var v string
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	case ListType:
+		v := []string{}
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	case StreamType:
+		v := &Stream{}
+		err := json.Unmarshal(raw, v)
+		return v, err
+	case QueueType:
+		v := &Queue{Messages: map[string]*QueueMessage{}}
+		err := json.Unmarshal(raw, v)
+		return v, err
+	case LockType:
+		v := &Lock{}
+		err := json.Unmarshal(raw, v)
+		return v, err
+	case JSONType:
+		root, err := ParseJSON(raw)
+		if err != nil {
+			return nil, err
+		}
+		return newJSONDoc(root), nil
+	}
+	return nil, fmt.Errorf("unknown data type %d", t)
+}
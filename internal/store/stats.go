@@ -0,0 +1,112 @@
+package store
+
+import "time"
+
+// Stats is a point-in-time summary of the store's contents
+type Stats struct {
+	// Keys counts live keys per data type
+	Keys map[DataType]int
+	// Expires counts live keys that have a TTL and AvgTTL is their mean
+	// remaining time to live
+	Expires int
+	AvgTTL  time.Duration
+
+	UsedMemory int64
+	MaxMemory  int64
+
+	// Expired and Evicted count keys removed since the store was created
+	Expired int64
+	Evicted int64
+
+	// LastCleanup is when the cleanup loop last ran and how long it took
+	LastCleanup         time.Time
+	LastCleanupDuration time.Duration
+}
+
+// String returns the name used for a data type in metrics and the API
+func (t DataType) String() string {
+	switch t {
+	case StringType:
+		return "string"
+	case ListType:
+		return "list"
+	case StreamType:
+		return "stream"
+	case QueueType:
+		return "queue"
+	case LockType:
+		return "lock"
+	case JSONType:
+		return "json"
+	}
+	return "unknown"
+}
+
+// DataTypes lists every data type the store can hold
+var DataTypes = []DataType{StringType, ListType, StreamType, QueueType, LockType, JSONType}
+
+// Stats counts the keys in the store. Keys that have expired but not yet
+// been removed are left out.
+func (s *DataObj) Stats() Stats {
+	s.rlock()
+	defer s.Mu.RUnlock()
+
+	now := time.Now()
+	st := Stats{
+		Keys:       make(map[DataType]int, len(DataTypes)),
+		UsedMemory: s.used,
+		MaxMemory:  s.maxMemory,
+		Expired:    s.expired,
+		Evicted:    s.evicted,
+
+		LastCleanup:         s.lastCleanup,
+		LastCleanupDuration: s.lastCleanupDuration,
+	}
+	var ttl time.Duration
+	for _, m := range s.dbs {
+		for _, item := range m.Data {
+			if item.expiredAt(now) {
+				continue
+			}
+			st.Keys[item.Type]++
+			if !item.ExpiresAt.IsZero() {
+				st.Expires++
+				ttl += item.ExpiresAt.Sub(now)
+			}
+		}
+	}
+	if st.Expires > 0 {
+		st.AvgTTL = ttl / time.Duration(st.Expires)
+	}
+	return st
+}
+
+// WithLockObserver reports how long each acquisition of the store lock
+// waited. mode is "read" or "write".
+func WithLockObserver(fn func(mode string, wait time.Duration)) Option {
+	return func(s *DataObj) {
+		s.lockObserver = fn
+	}
+}
+
+// lock takes the write lock, timing the wait when an observer is set
+func (s *DataObj) lock() {
+	if s.lockObserver == nil {
+		s.Mu.Lock()
+		return
+	}
+	start := time.Now()
+	s.Mu.Lock()
+	s.lockObserver("write", time.Since(start))
+}
+
+// rlock takes the read lock, timing the wait when an observer is set
+func (s *DataObj) rlock() {
+	if s.lockObserver == nil {
+		s.Mu.RLock()
+		return
+	}
+	start := time.Now()
+	s.Mu.RLock()
+	s.lockObserver("read", time.Since(start))
+}
@@ -0,0 +1,515 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrWrongType        = errors.New("operation against a key holding the wrong kind of value")
+	ErrNoSuchKey        = errors.New("no such key")
+	ErrInvalidStreamID  = errors.New("invalid stream ID")
+	ErrStreamIDTooSmall = errors.New("stream ID must be greater than the stream's last ID")
+	ErrNoFields         = errors.New("a stream entry needs at least one field")
+)
+
+// StreamID identifies a stream entry: the milliseconds timestamp it was
+// added at and a sequence number within that millisecond
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+var maxStreamID = StreamID{math.MaxUint64, math.MaxUint64}
+
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+func (id StreamID) IsZero() bool {
+	return id == StreamID{}
+}
+
+func (id StreamID) Less(o StreamID) bool {
+	return id.Ms < o.Ms || id.Ms == o.Ms && id.Seq < o.Seq
+}
+
+func (id StreamID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+func (id *StreamID) UnmarshalText(b []byte) error {
+	parsed, err := ParseStreamID(string(b))
+	if err != nil {
+		return err
+	}
+	*id = parsed
+	return nil
+}
+
+// next is the smallest ID after id
+func (id StreamID) next() StreamID {
+	if id.Seq == math.MaxUint64 {
+		return StreamID{id.Ms + 1, 0}
+	}
+	return StreamID{id.Ms, id.Seq + 1}
+}
+
+// prev is the largest ID before id
+func (id StreamID) prev() StreamID {
+	if id.Seq == 0 {
+		return StreamID{id.Ms - 1, math.MaxUint64}
+	}
+	return StreamID{id.Ms, id.Seq - 1}
+}
+
+// ParseStreamID parses "ms-seq", or "ms" meaning sequence 0
+func ParseStreamID(s string) (StreamID, error) {
+	return parseStreamID(s, 0)
+}
+
+func parseStreamID(s string, defaultSeq uint64) (StreamID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return StreamID{}, fmt.Errorf("%w: %q", ErrInvalidStreamID, s)
+	}
+	if !hasSeq {
+		return StreamID{ms, defaultSeq}, nil
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return StreamID{}, fmt.Errorf("%w: %q", ErrInvalidStreamID, s)
+	}
+	return StreamID{ms, seq}, nil
+}
+
+// parseRange parses the start or end of an XRANGE: "-" and "+" are the
+// smallest and largest IDs, a "(" prefix excludes the ID itself and an ID
+// without a sequence covers the whole millisecond
+func parseRange(s string, start bool) (StreamID, error) {
+	switch s {
+	case "-":
+		return StreamID{}, nil
+	case "+":
+		return maxStreamID, nil
+	}
+	exclusive := strings.HasPrefix(s, "(")
+	s = strings.TrimPrefix(s, "(")
+	defaultSeq := uint64(0)
+	if !start {
+		defaultSeq = math.MaxUint64
+	}
+	id, err := parseStreamID(s, defaultSeq)
+	if err != nil || !exclusive {
+		return id, err
+	}
+	if start {
+		if id == maxStreamID {
+			return id, fmt.Errorf("%w: %q", ErrInvalidStreamID, s)
+		}
+		return id.next(), nil
+	}
+	if id.IsZero() {
+		return id, fmt.Errorf("%w: %q", ErrInvalidStreamID, s)
+	}
+	return id.prev(), nil
+}
+
+// StreamEntry is one entry of a stream. Fields is nil for an entry that
+// was deleted while still pending in a consumer group.
+type StreamEntry struct {
+	ID     StreamID          `json:"id"`
+	Fields map[string]string `json:"fields"`
+}
+
+// Stream is an append-only log of entries ordered by ID, with consumer
+// groups that track which entries were delivered to whom
+type Stream struct {
+	Entries      []StreamEntry           `json:"entries"`
+	LastID       StreamID                `json:"last_id"`
+	EntriesAdded uint64                  `json:"entries_added"`
+	Groups       map[string]*streamGroup `json:"groups,omitempty"`
+}
+
+func streamEntrySize(e StreamEntry) int64 {
+	n := int64(2 * stringOverhead)
+	for k, v := range e.Fields {
+		n += int64(len(k)+len(v)) + 2*stringOverhead
+	}
+	return n
+}
+
+// search returns the index of the first entry with an ID of at least id
+func (st *Stream) search(id StreamID) int {
+	return sort.Search(len(st.Entries), func(i int) bool {
+		return !st.Entries[i].ID.Less(id)
+	})
+}
+
+// lookup returns the entry with id
+func (st *Stream) lookup(id StreamID) (StreamEntry, bool) {
+	i := st.search(id)
+	if i < len(st.Entries) && st.Entries[i].ID == id {
+		return st.Entries[i], true
+	}
+	return StreamEntry{}, false
+}
+
+// rangeOf returns up to count entries between start and end inclusive,
+// newest first when rev is set. A count of zero returns all of them.
+func (st *Stream) rangeOf(start, end StreamID, count int, rev bool) []StreamEntry {
+	lo, hi := st.search(start), st.search(end.next())
+	if end == maxStreamID {
+		hi = len(st.Entries)
+	}
+	if lo >= hi {
+		return []StreamEntry{}
+	}
+	n := hi - lo
+	if count > 0 && count < n {
+		n = count
+	}
+	out := make([]StreamEntry, 0, n)
+	for i := 0; i < n; i++ {
+		if rev {
+			out = append(out, st.Entries[hi-1-i])
+		} else {
+			out = append(out, st.Entries[lo+i])
+		}
+	}
+	return out
+}
+
+// trim drops entries beyond maxLen or below minID and returns how many
+// bytes were freed and how many entries were removed
+func (st *Stream) trim(maxLen int, minID StreamID) (int64, int) {
+	drop := 0
+	if maxLen > 0 && len(st.Entries) > maxLen {
+		drop = len(st.Entries) - maxLen
+	}
+	if !minID.IsZero() {
+		if i := st.search(minID); i > drop {
+			drop = i
+		}
+	}
+	var freed int64
+	for _, e := range st.Entries[:drop] {
+		freed += streamEntrySize(e)
+	}
+	st.Entries = append([]StreamEntry(nil), st.Entries[drop:]...)
+	return freed, drop
+}
+
+// stream returns the stream under key in db, or nil if there is none. The
+// caller must hold s.Mu.
+func (s *DataObj) stream(db, key string, now time.Time) (*Stream, error) {
+	item, exists := s.live(db, key, now)
+	if !exists {
+		return nil, nil
+	}
+	if item.Type != StreamType {
+		return nil, ErrWrongType
+	}
+	return item.Value.(*Stream), nil
+}
+
+// XAddArgs are the options of XAdd
+type XAddArgs struct {
+	// ID is "*" or empty to generate one, "ms-*" to generate the sequence
+	// only, or an explicit ID greater than the stream's last
+	ID     string            `json:"id,omitempty"`
+	Fields map[string]string `json:"fields"`
+	// NoMkStream fails with ErrNoSuchKey instead of creating the stream
+	NoMkStream bool `json:"nomkstream,omitempty"`
+	// MaxLen and MinID trim the stream after the entry is added
+	MaxLen int    `json:"maxlen,omitempty"`
+	MinID  string `json:"minid,omitempty"`
+}
+
+// XAdd appends an entry to the stream under key, creating it unless
+// a.NoMkStream is set, and returns the entry's ID
+func (d *DB) XAdd(key string, a XAddArgs) (StreamID, error) {
+	if len(a.Fields) == 0 {
+		return StreamID{}, ErrNoFields
+	}
+	if a.MinID != "" {
+		if _, err := ParseStreamID(a.MinID); err != nil {
+			return StreamID{}, err
+		}
+	}
+	res := d.s.exec(withArgs(Command{Op: OpXAdd, DB: d.name, Key: key}, a))
+	if res.Err != nil {
+		return StreamID{}, res.Err
+	}
+	return res.Data.(StreamID), nil
+}
+
+func (s *DataObj) applyXAdd(cmd Command) Result {
+	var a XAddArgs
+	if err := decodeArgs(cmd, &a); err != nil {
+		return Result{Err: err}
+	}
+	st, err := s.stream(cmd.DB, cmd.Key, cmd.Now)
+	if err != nil {
+		return Result{Err: err}
+	}
+	if st == nil && a.NoMkStream {
+		return Result{Err: ErrNoSuchKey}
+	}
+	last := StreamID{}
+	if st != nil {
+		last = st.LastID
+	}
+
+	id, err := nextStreamID(a.ID, last, cmd.Now)
+	if err != nil {
+		return Result{Err: err}
+	}
+	entry := StreamEntry{ID: id, Fields: a.Fields}
+	size := streamEntrySize(entry)
+	valueSize := 0
+	for k, v := range a.Fields {
+		valueSize += len(k) + len(v)
+	}
+
+	grow := size
+	if st == nil {
+		grow += int64(len(cmd.Key)) + itemOverhead
+	}
+	if err := s.admit(cmd, grow, valueSize); err != nil {
+		return Result{Err: err}
+	}
+	if err := s.reserve(cmd); err != nil {
+		return Result{Err: err}
+	}
+
+	if st == nil {
+		st = &Stream{Entries: []StreamEntry{}}
+		s.put(cmd.DB, cmd.Key, &Item{Type: StreamType, Value: st})
+	}
+	st.Entries = append(st.Entries, entry)
+	st.LastID = id
+	st.EntriesAdded++
+	s.grow(cmd.DB, cmd.Key, size)
+
+	var minID StreamID
+	if a.MinID != "" {
+		minID, _ = ParseStreamID(a.MinID)
+	}
+	freed, _ := st.trim(a.MaxLen, minID)
+	s.grow(cmd.DB, cmd.Key, -freed)
+
+	s.notifyAdded()
+	return Result{Data: id, OK: true}
+}
+
+func nextStreamID(requested string, last StreamID, now time.Time) (StreamID, error) {
+	ms := uint64(now.UnixMilli())
+	switch {
+	case requested == "" || requested == "*":
+		if ms <= last.Ms {
+			if last.Seq == math.MaxUint64 {
+				return StreamID{last.Ms + 1, 0}, nil
+			}
+			return StreamID{last.Ms, last.Seq + 1}, nil
+		}
+		return StreamID{ms, 0}, nil
+	case strings.HasSuffix(requested, "-*"):
+		ms, err := strconv.ParseUint(strings.TrimSuffix(requested, "-*"), 10, 64)
+		if err != nil {
+			return StreamID{}, fmt.Errorf("%w: %q", ErrInvalidStreamID, requested)
+		}
+		switch {
+		case ms > last.Ms:
+			return StreamID{ms, 0}, nil
+		case ms == last.Ms && last.Seq < math.MaxUint64:
+			return StreamID{ms, last.Seq + 1}, nil
+		}
+		return StreamID{}, ErrStreamIDTooSmall
+	}
+	id, err := ParseStreamID(requested)
+	if err != nil {
+		return StreamID{}, err
+	}
+	if id.IsZero() || !last.Less(id) {
+		return StreamID{}, ErrStreamIDTooSmall
+	}
+	return id, nil
+}
+
+// XRange returns up to count entries with IDs between start and end,
+// oldest first, or newest first when rev is set. See parseRange for the
+// bound syntax; for rev, start is still the lower bound.
+func (d *DB) XRange(key, start, end string, count int, rev bool) ([]StreamEntry, error) {
+	lo, err := parseRange(start, true)
+	if err != nil {
+		return nil, err
+	}
+	hi, err := parseRange(end, false)
+	if err != nil {
+		return nil, err
+	}
+
+	d.s.rlock()
+	defer d.s.Mu.RUnlock()
+	st, err := d.s.stream(d.name, key, time.Now())
+	if err != nil || st == nil {
+		return []StreamEntry{}, err
+	}
+	return st.rangeOf(lo, hi, count, rev), nil
+}
+
+// XLen returns the number of entries in the stream under key
+func (d *DB) XLen(key string) (int, error) {
+	d.s.rlock()
+	defer d.s.Mu.RUnlock()
+	st, err := d.s.stream(d.name, key, time.Now())
+	if err != nil || st == nil {
+		return 0, err
+	}
+	return len(st.Entries), nil
+}
+
+// XRead returns up to count entries added after the ID after, which may be
+// "$" for the last entry at the time of the call. If there are none it
+// waits up to block for one to be added. A block of zero returns at once.
+func (d *DB) XRead(ctx context.Context, key, after string, count int, block time.Duration) ([]StreamEntry, error) {
+	var from StreamID
+	if after == "$" {
+		d.s.rlock()
+		st, err := d.s.stream(d.name, key, time.Now())
+		if st != nil {
+			from = st.LastID
+		}
+		d.s.Mu.RUnlock()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		id, err := ParseStreamID(after)
+		if err != nil {
+			return nil, err
+		}
+		from = id
+	}
+
+	return blockFor(ctx, block, func() ([]StreamEntry, <-chan struct{}, time.Duration, error) {
+		d.s.lock()
+		defer d.s.Mu.Unlock()
+		added := d.s.added()
+		st, err := d.s.stream(d.name, key, time.Now())
+		if err != nil || st == nil {
+			return nil, added, 0, err
+		}
+		if from == maxStreamID {
+			return nil, added, 0, nil
+		}
+		return st.rangeOf(from.next(), maxStreamID, count, false), added, 0, nil
+	})
+}
+
+// XDel removes entries from the stream under key and returns how many
+// existed
+func (d *DB) XDel(key string, ids ...StreamID) (int, error) {
+	res := d.s.exec(withArgs(Command{Op: OpXDel, DB: d.name, Key: key}, ids))
+	return res.N, res.Err
+}
+
+func (s *DataObj) applyXDel(cmd Command) Result {
+	var ids []StreamID
+	if err := decodeArgs(cmd, &ids); err != nil {
+		return Result{Err: err}
+	}
+	st, err := s.stream(cmd.DB, cmd.Key, cmd.Now)
+	if err != nil || st == nil {
+		return Result{Err: err}
+	}
+	n := 0
+	for _, id := range ids {
+		i := st.search(id)
+		if i < len(st.Entries) && st.Entries[i].ID == id {
+			s.grow(cmd.DB, cmd.Key, -streamEntrySize(st.Entries[i]))
+			st.Entries = append(st.Entries[:i], st.Entries[i+1:]...)
+			n++
+		}
+	}
+	return Result{N: n, OK: true}
+}
+
+// XTrim drops the oldest entries of the stream under key beyond maxLen and
+// those with IDs below minID, and returns how many were dropped
+func (d *DB) XTrim(key string, maxLen int, minID string) (int, error) {
+	if minID != "" {
+		if _, err := ParseStreamID(minID); err != nil {
+			return 0, err
+		}
+	}
+	res := d.s.exec(withArgs(Command{Op: OpXTrim, DB: d.name, Key: key}, trimArgs{maxLen, minID}))
+	return res.N, res.Err
+}
+
+type trimArgs struct {
+	MaxLen int    `json:"maxlen,omitempty"`
+	MinID  string `json:"minid,omitempty"`
+}
+
+func (s *DataObj) applyXTrim(cmd Command) Result {
+	var a trimArgs
+	if err := decodeArgs(cmd, &a); err != nil {
+		return Result{Err: err}
+	}
+	st, err := s.stream(cmd.DB, cmd.Key, cmd.Now)
+	if err != nil || st == nil {
+		return Result{Err: err}
+	}
+	var minID StreamID
+	if a.MinID != "" {
+		minID, _ = ParseStreamID(a.MinID)
+	}
+	freed, n := st.trim(a.MaxLen, minID)
+	if n > 0 {
+		s.grow(cmd.DB, cmd.Key, -freed)
+	}
+	return Result{N: n, OK: true}
+}
+
+// StreamInfo is returned by XInfoStream
+type StreamInfo struct {
+	Length       int          `json:"length"`
+	LastID       StreamID     `json:"last_generated_id"`
+	EntriesAdded uint64       `json:"entries_added"`
+	Groups       int          `json:"groups"`
+	FirstEntry   *StreamEntry `json:"first_entry"`
+	LastEntry    *StreamEntry `json:"last_entry"`
+}
+
+// XInfoStream describes the stream under key
+func (d *DB) XInfoStream(key string) (StreamInfo, error) {
+	d.s.rlock()
+	defer d.s.Mu.RUnlock()
+	st, err := d.s.stream(d.name, key, time.Now())
+	if err != nil {
+		return StreamInfo{}, err
+	}
+	if st == nil {
+		return StreamInfo{}, ErrNoSuchKey
+	}
+	info := StreamInfo{
+		Length:       len(st.Entries),
+		LastID:       st.LastID,
+		EntriesAdded: st.EntriesAdded,
+		Groups:       len(st.Groups),
+	}
+	if n := len(st.Entries); n > 0 {
+		first, last := st.Entries[0], st.Entries[n-1]
+		info.FirstEntry, info.LastEntry = &first, &last
+	}
+	return info, nil
+}
@@ -0,0 +1,334 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// entryIDs returns the IDs of entries
+func entryIDs(entries []StreamEntry) []string {
+	out := []string{}
+	for _, e := range entries {
+		out = append(out, e.ID.String())
+	}
+	return out
+}
+
+func xadd(t *testing.T, d *DB, key, id string) StreamID {
+	t.Helper()
+	got, err := d.XAdd(key, XAddArgs{ID: id, Fields: map[string]string{"n": id}})
+	if err != nil {
+		t.Fatalf("XAdd %s: %v", id, err)
+	}
+	return got
+}
+
+func TestStreamAddAndRange(t *testing.T) {
+	s := NewRedisMemoryStore()
+	defer s.Close()
+	d := s.DB(DefaultDB)
+
+	if _, err := d.XAdd("s", XAddArgs{Fields: map[string]string{"a": "1"}, NoMkStream: true}); !errors.Is(err, ErrNoSuchKey) {
+		t.Errorf("XAdd with NoMkStream: err = %v, want ErrNoSuchKey", err)
+	}
+	if _, err := d.XAdd("s", XAddArgs{}); !errors.Is(err, ErrNoFields) {
+		t.Errorf("XAdd without fields: err = %v, want ErrNoFields", err)
+	}
+	for id, want := range map[string]error{"0-0": ErrStreamIDTooSmall, "x": ErrInvalidStreamID, "1-x": ErrInvalidStreamID} {
+		if _, err := d.XAdd("s", XAddArgs{ID: id, Fields: map[string]string{"a": "1"}}); !errors.Is(err, want) {
+			t.Errorf("XAdd %s: err = %v, want %v", id, err, want)
+		}
+	}
+
+	xadd(t, d, "s", "1-1")
+	if got := xadd(t, d, "s", "1-*"); got != (StreamID{1, 2}) {
+		t.Errorf("1-* gave %v, want 1-2", got)
+	}
+	xadd(t, d, "s", "5")
+	for _, id := range []string{"5-0", "4-9", "1-*"} {
+		if _, err := d.XAdd("s", XAddArgs{ID: id, Fields: map[string]string{"a": "1"}}); !errors.Is(err, ErrStreamIDTooSmall) {
+			t.Errorf("XAdd %s after 5-0: err = %v, want ErrStreamIDTooSmall", id, err)
+		}
+	}
+	xadd(t, d, "s", "7-3")
+	if got := xadd(t, d, "s", "*"); !(StreamID{7, 3}).Less(got) {
+		t.Errorf("generated ID %v not after 7-3", got)
+	}
+
+	tests := []struct {
+		start, end string
+		count      int
+		rev        bool
+		want       []string
+	}{
+		{"-", "7-3", 0, false, []string{"1-1", "1-2", "5-0", "7-3"}},
+		{"1", "1", 0, false, []string{"1-1", "1-2"}},
+		{"(1-1", "(7-3", 0, false, []string{"1-2", "5-0"}},
+		{"2", "6", 0, false, []string{"5-0"}},
+		{"-", "7-3", 2, false, []string{"1-1", "1-2"}},
+		{"-", "7-3", 2, true, []string{"7-3", "5-0"}},
+		{"6", "4", 0, false, []string{}},
+	}
+	for _, tt := range tests {
+		got, err := d.XRange("s", tt.start, tt.end, tt.count, tt.rev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(entryIDs(got), tt.want) {
+			t.Errorf("XRange %s %s count %d rev %v: got %v, want %v", tt.start, tt.end, tt.count, tt.rev, entryIDs(got), tt.want)
+		}
+	}
+	for _, bound := range []string{"x", "(-", "1-"} {
+		if _, err := d.XRange("s", bound, "+", 0, false); !errors.Is(err, ErrInvalidStreamID) {
+			t.Errorf("XRange from %q: err = %v, want ErrInvalidStreamID", bound, err)
+		}
+	}
+	if got, _ := d.XRange("missing", "-", "+", 0, false); len(got) != 0 {
+		t.Errorf("XRange of a missing stream: %v", got)
+	}
+
+	if n, err := d.XDel("s", StreamID{1, 2}, StreamID{9, 9}); err != nil || n != 1 {
+		t.Errorf("XDel = %d, %v, want 1", n, err)
+	}
+	if n, err := d.XTrim("s", 2, ""); err != nil || n != 2 {
+		t.Errorf("XTrim to 2 = %d, %v, want 2", n, err)
+	}
+	if n, _ := d.XLen("s"); n != 2 {
+		t.Errorf("XLen = %d, want 2", n)
+	}
+	info, err := d.XInfoStream("s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Deleting and trimming keep the last ID and the count of entries added
+	if info.Length != 2 || info.EntriesAdded != 5 || info.FirstEntry.ID != (StreamID{7, 3}) || info.LastEntry.ID != info.LastID {
+		t.Errorf("XInfoStream = %+v", info)
+	}
+	if _, err := d.XAdd("s", XAddArgs{ID: "7-3", Fields: map[string]string{"a": "1"}}); !errors.Is(err, ErrStreamIDTooSmall) {
+		t.Errorf("XAdd of a trimmed ID: err = %v", err)
+	}
+
+	if err := d.Set("str", "v", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.XAdd("str", XAddArgs{Fields: map[string]string{"a": "1"}}); !errors.Is(err, ErrWrongType) {
+		t.Errorf("XAdd to a string: err = %v, want ErrWrongType", err)
+	}
+}
+
+func TestStreamRead(t *testing.T) {
+	s := NewRedisMemoryStore()
+	defer s.Close()
+	d := s.DB(DefaultDB)
+	xadd(t, d, "s", "1")
+	xadd(t, d, "s", "2")
+
+	got, err := d.XRead(context.Background(), "s", "1", 0, 0)
+	if err != nil || !reflect.DeepEqual(entryIDs(got), []string{"2-0"}) {
+		t.Errorf("XRead after 1: %v, %v", entryIDs(got), err)
+	}
+	if got, err := d.XRead(context.Background(), "s", "$", 0, 0); err != nil || len(got) != 0 {
+		t.Errorf("XRead after $ without blocking: %v, %v", entryIDs(got), err)
+	}
+
+	// A blocked read returns the first entry added after it started
+	read := make(chan []StreamEntry, 1)
+	go func() {
+		got, err := d.XRead(context.Background(), "s", "$", 0, 5*time.Second)
+		if err != nil {
+			t.Error(err)
+		}
+		read <- got
+	}()
+	time.Sleep(50 * time.Millisecond)
+	xadd(t, d, "s", "3")
+	select {
+	case got := <-read:
+		if !reflect.DeepEqual(entryIDs(got), []string{"3-0"}) {
+			t.Errorf("blocked XRead got %v, want [3-0]", entryIDs(got))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("blocked XRead did not return after XAdd")
+	}
+
+	start := time.Now()
+	if got, err := d.XRead(context.Background(), "s", "$", 0, 100*time.Millisecond); err != nil || len(got) != 0 {
+		t.Errorf("XRead timing out: %v, %v", entryIDs(got), err)
+	}
+	if time.Since(start) < 100*time.Millisecond {
+		t.Errorf("XRead returned after %v, before its block of 100ms", time.Since(start))
+	}
+}
+
+func TestStreamGroups(t *testing.T) {
+	s := NewRedisMemoryStore()
+	defer s.Close()
+	d := s.DB(DefaultDB)
+	ctx := context.Background()
+
+	if err := d.XGroupCreate("s", "g", "$", false); !errors.Is(err, ErrNoSuchKey) {
+		t.Errorf("XGroupCreate on a missing stream: err = %v", err)
+	}
+	if err := d.XGroupCreate("s", "g", "0", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.XGroupCreate("s", "g", "0", false); !errors.Is(err, ErrGroupExists) {
+		t.Errorf("XGroupCreate twice: err = %v, want ErrGroupExists", err)
+	}
+	if _, err := d.XReadGroup(ctx, "s", XReadGroupArgs{Group: "nope", Consumer: "a"}, 0); !errors.Is(err, ErrNoGroup) {
+		t.Errorf("XReadGroup of a missing group: err = %v, want ErrNoGroup", err)
+	}
+	for _, id := range []string{"1", "2", "3", "4"} {
+		xadd(t, d, "s", id)
+	}
+
+	// Each entry goes to one consumer of the group
+	read := func(consumer, id string, count int) []string {
+		t.Helper()
+		got, err := d.XReadGroup(ctx, "s", XReadGroupArgs{Group: "g", Consumer: consumer, ID: id, Count: count}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return entryIDs(got)
+	}
+	if got := read("a", ">", 2); !reflect.DeepEqual(got, []string{"1-0", "2-0"}) {
+		t.Errorf("a read %v", got)
+	}
+	if got := read("b", ">", 1); !reflect.DeepEqual(got, []string{"3-0"}) {
+		t.Errorf("b read %v", got)
+	}
+	// A group created later starts where it was told to, and does not
+	// share deliveries with the first
+	if err := d.XGroupCreate("s", "other", "3", false); err != nil {
+		t.Fatal(err)
+	}
+	if got := read("a", "0", 0); !reflect.DeepEqual(got, []string{"1-0", "2-0"}) {
+		t.Errorf("a's pending entries: %v", got)
+	}
+	got, err := d.XReadGroup(ctx, "s", XReadGroupArgs{Group: "other", Consumer: "c"}, 0)
+	if err != nil || !reflect.DeepEqual(entryIDs(got), []string{"4-0"}) {
+		t.Errorf("other group read %v, %v", entryIDs(got), err)
+	}
+
+	sum, err := d.XPending("s", "g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Count != 3 || *sum.Min != (StreamID{1, 0}) || *sum.Max != (StreamID{3, 0}) || !reflect.DeepEqual(sum.Consumers, map[string]int{"a": 2, "b": 1}) {
+		t.Errorf("XPending = %+v", sum)
+	}
+	if n, err := d.XAck("s", "g", StreamID{1, 0}, StreamID{1, 0}, StreamID{4, 0}); err != nil || n != 1 {
+		t.Errorf("XAck = %d, %v, want 1", n, err)
+	}
+	if got := read("a", "0", 0); !reflect.DeepEqual(got, []string{"2-0"}) {
+		t.Errorf("a's pending entries after XAck: %v", got)
+	}
+
+	groups, err := d.XInfoGroups("s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 || groups[0].Name != "g" || groups[0].Pending != 2 || groups[0].Lag != 1 || groups[0].Consumers != 2 {
+		t.Errorf("XInfoGroups = %+v", groups)
+	}
+
+	// Claiming moves an idle entry to another consumer and counts the
+	// delivery; an entry delivered too recently stays put
+	if got, _ := d.XClaim("s", "g", "c", time.Hour, StreamID{2, 0}); len(got) != 0 {
+		t.Errorf("XClaim of a recent entry: %v", entryIDs(got))
+	}
+	time.Sleep(20 * time.Millisecond)
+	claimed, err := d.XClaim("s", "g", "c", 10*time.Millisecond, StreamID{2, 0})
+	if err != nil || !reflect.DeepEqual(entryIDs(claimed), []string{"2-0"}) {
+		t.Errorf("XClaim = %v, %v", entryIDs(claimed), err)
+	}
+	pending, err := d.XPendingRange("s", "g", XPendingArgs{Start: "-", End: "+"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 2 || pending[0].Consumer != "c" || pending[0].Deliveries != 2 || pending[1].Consumer != "b" {
+		t.Errorf("XPendingRange = %+v", pending)
+	}
+
+	// Entries deleted while pending are dropped when claimed, and reread
+	// without fields until then
+	if _, err := d.XDel("s", StreamID{3, 0}); err != nil {
+		t.Fatal(err)
+	}
+	history, err := d.XReadGroup(ctx, "s", XReadGroupArgs{Group: "g", Consumer: "b", ID: "0"}, 0)
+	if err != nil || len(history) != 1 || history[0].Fields != nil {
+		t.Errorf("b's pending entries after XDel: %+v, %v", history, err)
+	}
+	res, err := d.XAutoClaim("s", "g", "a", 0, StreamID{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(entryIDs(res.Entries), []string{"2-0"}) || !reflect.DeepEqual(res.Deleted, []StreamID{{3, 0}}) || !res.Next.IsZero() {
+		t.Errorf("XAutoClaim = %+v", res)
+	}
+	if sum, _ := d.XPending("s", "g"); sum.Count != 1 || sum.Consumers["a"] != 1 {
+		t.Errorf("XPending after XAutoClaim = %+v", sum)
+	}
+
+	// NoAck reads leave nothing pending
+	if _, err := d.XReadGroup(ctx, "s", XReadGroupArgs{Group: "g", Consumer: "a", NoAck: true}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if sum, _ := d.XPending("s", "g"); sum.Count != 1 {
+		t.Errorf("XPending after a NoAck read = %+v", sum)
+	}
+
+	if n, err := d.XGroupDelConsumer("s", "g", "a"); err != nil || n != 1 {
+		t.Errorf("XGroupDelConsumer = %d, %v, want 1 pending dropped", n, err)
+	}
+	if ok, err := d.XGroupDestroy("s", "other"); err != nil || !ok {
+		t.Errorf("XGroupDestroy = %v, %v", ok, err)
+	}
+	if groups, _ := d.XInfoGroups("s"); len(groups) != 1 {
+		t.Errorf("groups after XGroupDestroy: %+v", groups)
+	}
+}
+
+func TestStreamReadGroupBlocks(t *testing.T) {
+	s := NewRedisMemoryStore()
+	defer s.Close()
+	d := s.DB(DefaultDB)
+	if err := d.XGroupCreate("s", "g", "$", true); err != nil {
+		t.Fatal(err)
+	}
+	read := make(chan []StreamEntry, 1)
+	go func() {
+		got, err := d.XReadGroup(context.Background(), "s", XReadGroupArgs{Group: "g", Consumer: "a"}, 5*time.Second)
+		if err != nil {
+			t.Error(err)
+		}
+		read <- got
+	}()
+	time.Sleep(50 * time.Millisecond)
+	xadd(t, d, "s", "1")
+	select {
+	case got := <-read:
+		if !reflect.DeepEqual(entryIDs(got), []string{"1-0"}) {
+			t.Errorf("blocked XReadGroup got %v", entryIDs(got))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("blocked XReadGroup did not return after XAdd")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := d.XReadGroup(ctx, "s", XReadGroupArgs{Group: "g", Consumer: "a"}, time.Minute)
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("XReadGroup kept blocking after its context was cancelled")
+	}
+}
@@ -0,0 +1,596 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+var (
+	ErrNoGroup     = errors.New("no such consumer group")
+	ErrGroupExists = errors.New("consumer group already exists")
+)
+
+// streamGroup is a consumer group: the last entry handed out to the group
+// and the entries delivered to its consumers but not yet acknowledged
+type streamGroup struct {
+	LastDelivered StreamID                   `json:"last_delivered"`
+	Pending       map[StreamID]*pendingEntry `json:"pending"`
+	Consumers     map[string]*streamConsumer `json:"consumers"`
+}
+
+type pendingEntry struct {
+	Consumer    string    `json:"consumer"`
+	DeliveredAt time.Time `json:"delivered_at"`
+	Deliveries  int       `json:"deliveries"`
+}
+
+type streamConsumer struct {
+	// SeenAt is the last time the consumer read or claimed, ActiveAt the
+	// last time it was given entries
+	SeenAt   time.Time `json:"seen_at"`
+	ActiveAt time.Time `json:"active_at"`
+}
+
+// pendingIDs returns the group's pending IDs in order
+func (g *streamGroup) pendingIDs() []StreamID {
+	ids := make([]StreamID, 0, len(g.Pending))
+	for id := range g.Pending {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Less(ids[j]) })
+	return ids
+}
+
+// consumer returns the named consumer, creating it
+func (g *streamGroup) consumer(name string, now time.Time) *streamConsumer {
+	c, ok := g.Consumers[name]
+	if !ok {
+		c = &streamConsumer{SeenAt: now}
+		g.Consumers[name] = c
+	}
+	return c
+}
+
+// group returns the stream under key and its group. The caller must hold
+// s.Mu.
+func (s *DataObj) group(db, key, name string, now time.Time) (*Stream, *streamGroup, error) {
+	st, err := s.stream(db, key, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	if st == nil {
+		return nil, nil, ErrNoSuchKey
+	}
+	g, ok := st.Groups[name]
+	if !ok {
+		return nil, nil, ErrNoGroup
+	}
+	return st, g, nil
+}
+
+type groupArgs struct {
+	Group    string `json:"group"`
+	Consumer string `json:"consumer,omitempty"`
+	// ID is where a new group starts, "$" for the current end
+	ID       string `json:"id,omitempty"`
+	MkStream bool   `json:"mkstream,omitempty"`
+}
+
+// XGroupCreate creates a consumer group that will be handed the entries
+// after id, which may be "$" for the stream's last entry. With mkStream a
+// missing stream is created empty.
+func (d *DB) XGroupCreate(key, group, id string, mkStream bool) error {
+	if id != "$" {
+		if _, err := ParseStreamID(id); err != nil {
+			return err
+		}
+	}
+	a := groupArgs{Group: group, ID: id, MkStream: mkStream}
+	return d.s.exec(withArgs(Command{Op: OpXGroupCreate, DB: d.name, Key: key}, a)).Err
+}
+
+func (s *DataObj) applyXGroupCreate(cmd Command) Result {
+	var a groupArgs
+	if err := decodeArgs(cmd, &a); err != nil {
+		return Result{Err: err}
+	}
+	st, err := s.stream(cmd.DB, cmd.Key, cmd.Now)
+	if err != nil {
+		return Result{Err: err}
+	}
+	if st == nil {
+		if !a.MkStream {
+			return Result{Err: ErrNoSuchKey}
+		}
+		if err := s.admit(cmd, int64(len(cmd.Key))+itemOverhead, 0); err != nil {
+			return Result{Err: err}
+		}
+		if err := s.reserve(cmd); err != nil {
+			return Result{Err: err}
+		}
+		st = &Stream{Entries: []StreamEntry{}}
+		s.put(cmd.DB, cmd.Key, &Item{Type: StreamType, Value: st})
+	}
+	if _, ok := st.Groups[a.Group]; ok {
+		return Result{Err: ErrGroupExists}
+	}
+
+	last := st.LastID
+	if a.ID != "$" {
+		last, _ = ParseStreamID(a.ID)
+	}
+	if st.Groups == nil {
+		st.Groups = make(map[string]*streamGroup)
+	}
+	st.Groups[a.Group] = &streamGroup{
+		LastDelivered: last,
+		Pending:       make(map[StreamID]*pendingEntry),
+		Consumers:     make(map[string]*streamConsumer),
+	}
+	return Result{OK: true}
+}
+
+// XGroupDestroy removes a consumer group and its pending entries. It
+// reports false if there was no such group.
+func (d *DB) XGroupDestroy(key, group string) (bool, error) {
+	res := d.s.exec(withArgs(Command{Op: OpXGroupDestroy, DB: d.name, Key: key}, groupArgs{Group: group}))
+	return res.OK, res.Err
+}
+
+func (s *DataObj) applyXGroupDestroy(cmd Command) Result {
+	var a groupArgs
+	if err := decodeArgs(cmd, &a); err != nil {
+		return Result{Err: err}
+	}
+	st, err := s.stream(cmd.DB, cmd.Key, cmd.Now)
+	if err != nil || st == nil {
+		return Result{Err: err}
+	}
+	if _, ok := st.Groups[a.Group]; !ok {
+		return Result{}
+	}
+	delete(st.Groups, a.Group)
+	return Result{OK: true}
+}
+
+// XGroupDelConsumer removes a consumer from a group along with its pending
+// entries, and returns how many entries it had pending
+func (d *DB) XGroupDelConsumer(key, group, consumer string) (int, error) {
+	a := groupArgs{Group: group, Consumer: consumer}
+	res := d.s.exec(withArgs(Command{Op: OpXGroupDelConsumer, DB: d.name, Key: key}, a))
+	return res.N, res.Err
+}
+
+func (s *DataObj) applyXGroupDelConsumer(cmd Command) Result {
+	var a groupArgs
+	if err := decodeArgs(cmd, &a); err != nil {
+		return Result{Err: err}
+	}
+	_, g, err := s.group(cmd.DB, cmd.Key, a.Group, cmd.Now)
+	if err != nil {
+		return Result{Err: err}
+	}
+	n := 0
+	for id, p := range g.Pending {
+		if p.Consumer == a.Consumer {
+			delete(g.Pending, id)
+			n++
+		}
+	}
+	delete(g.Consumers, a.Consumer)
+	return Result{N: n, OK: true}
+}
+
+// XReadGroupArgs are the options of XReadGroup
+type XReadGroupArgs struct {
+	Group    string `json:"group"`
+	Consumer string `json:"consumer"`
+	// ID ">" reads entries never delivered to the group; any other ID
+	// rereads the consumer's pending entries after it
+	ID    string `json:"id"`
+	Count int    `json:"count,omitempty"`
+	// NoAck does not add delivered entries to the pending list
+	NoAck bool `json:"noack,omitempty"`
+}
+
+// XReadGroup hands entries of the stream under key to a consumer of a
+// group. When reading new entries and there are none, it waits up to block
+// for one to be added.
+func (d *DB) XReadGroup(ctx context.Context, key string, a XReadGroupArgs, block time.Duration) ([]StreamEntry, error) {
+	if a.ID == "" {
+		a.ID = ">"
+	}
+	if a.ID != ">" {
+		if _, err := ParseStreamID(a.ID); err != nil {
+			return nil, err
+		}
+		block = 0
+	}
+	return blockFor(ctx, block, func() ([]StreamEntry, <-chan struct{}, time.Duration, error) {
+		// Only propose a read when there is something to hand out, so an
+		// idle consumer does not write to the replicated log
+		d.s.lock()
+		added := d.s.added()
+		_, g, err := d.s.group(d.name, key, a.Group, time.Now())
+		waiting := err == nil && a.ID == ">" && block > 0 && !d.s.hasNew(d.name, key, g)
+		d.s.Mu.Unlock()
+		if err != nil || waiting {
+			return nil, added, 0, err
+		}
+
+		res := d.s.exec(withArgs(Command{Op: OpXReadGroup, DB: d.name, Key: key}, a))
+		if res.Err != nil {
+			return nil, added, 0, res.Err
+		}
+		return res.Data.([]StreamEntry), added, 0, nil
+	})
+}
+
+// hasNew reports whether the stream under key has entries the group was
+// not handed yet. The caller must hold s.Mu.
+func (s *DataObj) hasNew(db, key string, g *streamGroup) bool {
+	st, _ := s.stream(db, key, time.Now())
+	return st != nil && len(st.Entries) > 0 && g.LastDelivered.Less(st.Entries[len(st.Entries)-1].ID)
+}
+
+func (s *DataObj) applyXReadGroup(cmd Command) Result {
+	var a XReadGroupArgs
+	if err := decodeArgs(cmd, &a); err != nil {
+		return Result{Err: err}
+	}
+	st, g, err := s.group(cmd.DB, cmd.Key, a.Group, cmd.Now)
+	if err != nil {
+		return Result{Err: err}
+	}
+	c := g.consumer(a.Consumer, cmd.Now)
+	c.SeenAt = cmd.Now
+
+	if a.ID != ">" {
+		// History of the consumer's own pending entries. Entries deleted
+		// since they were delivered come back without fields.
+		after, _ := ParseStreamID(a.ID)
+		out := []StreamEntry{}
+		for _, id := range g.pendingIDs() {
+			if id.Less(after) || id == after || g.Pending[id].Consumer != a.Consumer {
+				continue
+			}
+			if a.Count > 0 && len(out) == a.Count {
+				break
+			}
+			e, ok := st.lookup(id)
+			if !ok {
+				e = StreamEntry{ID: id}
+			}
+			out = append(out, e)
+		}
+		return Result{Data: out, OK: true}
+	}
+
+	var out []StreamEntry
+	if g.LastDelivered != maxStreamID {
+		out = st.rangeOf(g.LastDelivered.next(), maxStreamID, a.Count, false)
+	}
+	for _, e := range out {
+		g.LastDelivered = e.ID
+		if !a.NoAck {
+			g.Pending[e.ID] = &pendingEntry{Consumer: a.Consumer, DeliveredAt: cmd.Now, Deliveries: 1}
+		}
+	}
+	if len(out) > 0 {
+		c.ActiveAt = cmd.Now
+	}
+	if out == nil {
+		out = []StreamEntry{}
+	}
+	return Result{Data: out, N: len(out), OK: true}
+}
+
+// XAck removes entries from a group's pending list and returns how many
+// were pending
+func (d *DB) XAck(key, group string, ids ...StreamID) (int, error) {
+	res := d.s.exec(withArgs(Command{Op: OpXAck, DB: d.name, Key: key}, claimArgs{Group: group, IDs: ids}))
+	return res.N, res.Err
+}
+
+func (s *DataObj) applyXAck(cmd Command) Result {
+	var a claimArgs
+	if err := decodeArgs(cmd, &a); err != nil {
+		return Result{Err: err}
+	}
+	st, err := s.stream(cmd.DB, cmd.Key, cmd.Now)
+	if err != nil || st == nil {
+		return Result{Err: err}
+	}
+	g, ok := st.Groups[a.Group]
+	if !ok {
+		return Result{}
+	}
+	n := 0
+	for _, id := range a.IDs {
+		if _, ok := g.Pending[id]; ok {
+			delete(g.Pending, id)
+			n++
+		}
+	}
+	return Result{N: n, OK: true}
+}
+
+// PendingSummary is returned by XPending
+type PendingSummary struct {
+	Count int `json:"count"`
+	// Min and Max are the smallest and largest pending IDs
+	Min       *StreamID      `json:"min"`
+	Max       *StreamID      `json:"max"`
+	Consumers map[string]int `json:"consumers"`
+}
+
+// XPending summarises a group's pending entries
+func (d *DB) XPending(key, group string) (PendingSummary, error) {
+	d.s.rlock()
+	defer d.s.Mu.RUnlock()
+	_, g, err := d.s.group(d.name, key, group, time.Now())
+	if err != nil {
+		return PendingSummary{}, err
+	}
+	sum := PendingSummary{Count: len(g.Pending), Consumers: map[string]int{}}
+	ids := g.pendingIDs()
+	if len(ids) > 0 {
+		sum.Min, sum.Max = &ids[0], &ids[len(ids)-1]
+	}
+	for _, p := range g.Pending {
+		sum.Consumers[p.Consumer]++
+	}
+	return sum, nil
+}
+
+// PendingEntry is one entry of a pending list as returned by
+// XPendingRange
+type PendingEntry struct {
+	ID         StreamID      `json:"id"`
+	Consumer   string        `json:"consumer"`
+	Idle       time.Duration `json:"-"`
+	Deliveries int           `json:"deliveries"`
+}
+
+// XPendingArgs select the entries XPendingRange returns
+type XPendingArgs struct {
+	// Start and End bound the IDs as for XRange
+	Start, End string
+	Count      int
+	// Consumer, if set, only returns that consumer's entries
+	Consumer string
+	// MinIdle only returns entries delivered at least that long ago
+	MinIdle time.Duration
+}
+
+// XPendingRange lists a group's pending entries in ID order
+func (d *DB) XPendingRange(key, group string, a XPendingArgs) ([]PendingEntry, error) {
+	lo, err := parseRange(a.Start, true)
+	if err != nil {
+		return nil, err
+	}
+	hi, err := parseRange(a.End, false)
+	if err != nil {
+		return nil, err
+	}
+
+	d.s.rlock()
+	defer d.s.Mu.RUnlock()
+	now := time.Now()
+	_, g, err := d.s.group(d.name, key, group, now)
+	if err != nil {
+		return nil, err
+	}
+	out := []PendingEntry{}
+	for _, id := range g.pendingIDs() {
+		if id.Less(lo) || hi.Less(id) {
+			continue
+		}
+		p := g.Pending[id]
+		idle := now.Sub(p.DeliveredAt)
+		if (a.Consumer != "" && p.Consumer != a.Consumer) || idle < a.MinIdle {
+			continue
+		}
+		if a.Count > 0 && len(out) == a.Count {
+			break
+		}
+		out = append(out, PendingEntry{ID: id, Consumer: p.Consumer, Idle: idle, Deliveries: p.Deliveries})
+	}
+	return out, nil
+}
+
+type claimArgs struct {
+	Group    string        `json:"group"`
+	Consumer string        `json:"consumer,omitempty"`
+	MinIdle  time.Duration `json:"min_idle,omitempty"`
+	IDs      []StreamID    `json:"ids,omitempty"`
+	Start    StreamID      `json:"start,omitempty"`
+	Count    int           `json:"count,omitempty"`
+}
+
+// XClaim transfers pending entries that have been idle for at least
+// minIdle to consumer and returns them. Entries that were deleted from the
+// stream are dropped from the pending list instead.
+func (d *DB) XClaim(key, group, consumer string, minIdle time.Duration, ids ...StreamID) ([]StreamEntry, error) {
+	a := claimArgs{Group: group, Consumer: consumer, MinIdle: minIdle, IDs: ids}
+	res := d.s.exec(withArgs(Command{Op: OpXClaim, DB: d.name, Key: key}, a))
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	return res.Data.([]StreamEntry), nil
+}
+
+func (s *DataObj) applyXClaim(cmd Command) Result {
+	var a claimArgs
+	if err := decodeArgs(cmd, &a); err != nil {
+		return Result{Err: err}
+	}
+	st, g, err := s.group(cmd.DB, cmd.Key, a.Group, cmd.Now)
+	if err != nil {
+		return Result{Err: err}
+	}
+	g.consumer(a.Consumer, cmd.Now).SeenAt = cmd.Now
+
+	out := []StreamEntry{}
+	for _, id := range a.IDs {
+		if e, ok := s.claim(st, g, id, a, cmd.Now); ok {
+			out = append(out, e)
+		}
+	}
+	return Result{Data: out, N: len(out), OK: true}
+}
+
+// claim moves one pending entry to a.Consumer if it has been idle long
+// enough. It reports false if the entry was not claimed.
+func (s *DataObj) claim(st *Stream, g *streamGroup, id StreamID, a claimArgs, now time.Time) (StreamEntry, bool) {
+	p, ok := g.Pending[id]
+	if !ok || now.Sub(p.DeliveredAt) < a.MinIdle {
+		return StreamEntry{}, false
+	}
+	e, ok := st.lookup(id)
+	if !ok {
+		delete(g.Pending, id)
+		return StreamEntry{}, false
+	}
+	p.Consumer = a.Consumer
+	p.DeliveredAt = now
+	p.Deliveries++
+	g.consumer(a.Consumer, now).ActiveAt = now
+	return e, true
+}
+
+// AutoClaimResult is returned by XAutoClaim. Next is where the following
+// call should start, or zero once the whole pending list was scanned.
+type AutoClaimResult struct {
+	Next    StreamID      `json:"next"`
+	Entries []StreamEntry `json:"entries"`
+	Deleted []StreamID    `json:"deleted"`
+}
+
+// XAutoClaim scans a group's pending list from start and claims up to
+// count entries idle for at least minIdle, like XClaim. Pending entries
+// that were deleted from the stream are dropped and reported.
+func (d *DB) XAutoClaim(key, group, consumer string, minIdle time.Duration, start StreamID, count int) (AutoClaimResult, error) {
+	if count <= 0 {
+		count = 100
+	}
+	a := claimArgs{Group: group, Consumer: consumer, MinIdle: minIdle, Start: start, Count: count}
+	res := d.s.exec(withArgs(Command{Op: OpXAutoClaim, DB: d.name, Key: key}, a))
+	if res.Err != nil {
+		return AutoClaimResult{}, res.Err
+	}
+	return res.Data.(AutoClaimResult), nil
+}
+
+func (s *DataObj) applyXAutoClaim(cmd Command) Result {
+	var a claimArgs
+	if err := decodeArgs(cmd, &a); err != nil {
+		return Result{Err: err}
+	}
+	st, g, err := s.group(cmd.DB, cmd.Key, a.Group, cmd.Now)
+	if err != nil {
+		return Result{Err: err}
+	}
+	g.consumer(a.Consumer, cmd.Now).SeenAt = cmd.Now
+
+	out := AutoClaimResult{Entries: []StreamEntry{}, Deleted: []StreamID{}}
+	ids := g.pendingIDs()
+	// Like Redis, look at no more than ten times count entries per call
+	scanned := 0
+	for _, id := range ids {
+		if id.Less(a.Start) {
+			continue
+		}
+		if len(out.Entries) == a.Count || scanned == a.Count*10 {
+			out.Next = id
+			break
+		}
+		scanned++
+		if _, ok := st.lookup(id); !ok {
+			delete(g.Pending, id)
+			out.Deleted = append(out.Deleted, id)
+			continue
+		}
+		if e, ok := s.claim(st, g, id, a, cmd.Now); ok {
+			out.Entries = append(out.Entries, e)
+		}
+	}
+	return Result{Data: out, N: len(out.Entries), OK: true}
+}
+
+// GroupInfo describes a consumer group, see XInfoGroups
+type GroupInfo struct {
+	Name            string   `json:"name"`
+	Consumers       int      `json:"consumers"`
+	Pending         int      `json:"pending"`
+	LastDeliveredID StreamID `json:"last_delivered_id"`
+	// Lag is the number of entries not yet handed to the group
+	Lag int `json:"lag"`
+}
+
+// XInfoGroups describes the consumer groups of the stream under key,
+// sorted by name
+func (d *DB) XInfoGroups(key string) ([]GroupInfo, error) {
+	d.s.rlock()
+	defer d.s.Mu.RUnlock()
+	st, err := d.s.stream(d.name, key, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if st == nil {
+		return nil, ErrNoSuchKey
+	}
+	out := []GroupInfo{}
+	for name, g := range st.Groups {
+		lag := 0
+		if g.LastDelivered != maxStreamID {
+			lag = len(st.Entries) - st.search(g.LastDelivered.next())
+		}
+		out = append(out, GroupInfo{
+			Name:            name,
+			Consumers:       len(g.Consumers),
+			Pending:         len(g.Pending),
+			LastDeliveredID: g.LastDelivered,
+			Lag:             lag,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// ConsumerInfo describes a consumer of a group, see XInfoConsumers
+type ConsumerInfo struct {
+	Name    string `json:"name"`
+	Pending int    `json:"pending"`
+	// Idle is the time since the consumer last read or claimed, Inactive
+	// the time since it was last given entries
+	Idle     time.Duration `json:"-"`
+	Inactive time.Duration `json:"-"`
+}
+
+// XInfoConsumers describes the consumers of a group, sorted by name
+func (d *DB) XInfoConsumers(key, group string) ([]ConsumerInfo, error) {
+	d.s.rlock()
+	defer d.s.Mu.RUnlock()
+	now := time.Now()
+	_, g, err := d.s.group(d.name, key, group, now)
+	if err != nil {
+		return nil, err
+	}
+	pending := make(map[string]int)
+	for _, p := range g.Pending {
+		pending[p.Consumer]++
+	}
+	out := []ConsumerInfo{}
+	for name, c := range g.Consumers {
+		info := ConsumerInfo{Name: name, Pending: pending[name], Idle: now.Sub(c.SeenAt), Inactive: -1}
+		if !c.ActiveAt.IsZero() {
+			info.Inactive = now.Sub(c.ActiveAt)
+		}
+		out = append(out, info)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
@@ -0,0 +1,329 @@
+package store
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrConflictingOptions = errors.New("conflicting options")
+	ErrVersionMismatch    = errors.New("version mismatch")
+	ErrNotCounter         = errors.New("value is not an unsigned 64-bit integer")
+)
+
+// SetOptions are the conditions and expiration of SetWith. The zero value
+// behaves like Set without a TTL.
+type SetOptions struct {
+	// NX only sets the key if it does not exist, XX only if it does
+	NX bool `json:"nx,omitempty"`
+	XX bool `json:"xx,omitempty"`
+	// Get returns the old value, which must be a string
+	Get bool `json:"get,omitempty"`
+	// KeepTTL keeps the expiration of an existing key
+	KeepTTL bool `json:"keep_ttl,omitempty"`
+	// TTL expires the key after a duration, ExpireAt at a point in time
+	TTL      time.Duration `json:"-"`
+	ExpireAt time.Time     `json:"expire_at,omitempty"`
+	// IfVersion only replaces the key if it is at this version. It fails
+	// with ErrNoSuchKey or ErrVersionMismatch otherwise.
+	IfVersion uint64 `json:"if_version,omitempty"`
+	// Flags are stored with the value for memcached clients
+	Flags uint32 `json:"flags,omitempty"`
+}
+
+func (o SetOptions) validate() error {
+	expires := o.TTL > 0 || !o.ExpireAt.IsZero()
+	if (o.NX && o.XX) || (o.KeepTTL && expires) || (o.TTL > 0 && !o.ExpireAt.IsZero()) || (o.NX && o.IfVersion != 0) {
+		return ErrConflictingOptions
+	}
+	return nil
+}
+
+// SetResult is the outcome of SetWith. Old and Existed describe the
+// previous value when SetOptions.Get was given, Version is that of the
+// stored value.
+type SetResult struct {
+	Set     bool
+	Old     string
+	Existed bool
+	Version uint64
+}
+
+// SetWith stores a string value under the conditions in opts
+func (d *DB) SetWith(key, value string, opts SetOptions) (SetResult, error) {
+	if err := opts.validate(); err != nil {
+		return SetResult{}, err
+	}
+	res := d.s.exec(withArgs(Command{Op: OpSet, DB: d.name, Key: key, Value: value, TTL: opts.TTL}, opts))
+	if res.Err != nil {
+		return SetResult{}, res.Err
+	}
+	out, _ := res.Data.(SetResult)
+	return out, nil
+}
+
+// GetExOptions change the expiration of a key read with GetEx. The zero
+// value leaves it alone.
+type GetExOptions struct {
+	TTL      time.Duration `json:"-"`
+	ExpireAt time.Time     `json:"expire_at,omitempty"`
+	// Persist removes the expiration
+	Persist bool `json:"persist,omitempty"`
+}
+
+func (o GetExOptions) set() int {
+	n := 0
+	for _, b := range []bool{o.TTL > 0, !o.ExpireAt.IsZero(), o.Persist} {
+		if b {
+			n++
+		}
+	}
+	return n
+}
+
+// GetEx returns the string under key and changes its expiration. It
+// reports false if there is no such key.
+func (d *DB) GetEx(key string, opts GetExOptions) (string, bool, error) {
+	v, ok, err := d.GetStringEx(key, opts)
+	return v.Value, ok, err
+}
+
+// StringValue is a string with what is stored alongside it
+type StringValue struct {
+	Value     string
+	ExpiresAt time.Time
+	Version   uint64
+	Flags     uint32
+}
+
+func stringValue(item *Item) StringValue {
+	return StringValue{
+		Value:     item.Value.(string),
+		ExpiresAt: item.ExpiresAt,
+		Version:   item.Version,
+		Flags:     item.Flags,
+	}
+}
+
+// GetString returns the string under key with its expiration, version and
+// flags. It reports false if there is no such key.
+func (d *DB) GetString(key string) (StringValue, bool, error) {
+	d.s.rlock()
+	defer d.s.Mu.RUnlock()
+	item, exists := d.s.live(d.name, key, time.Now())
+	if !exists {
+		return StringValue{}, false, nil
+	}
+	if item.Type != StringType {
+		return StringValue{}, false, ErrWrongType
+	}
+	return stringValue(item), true, nil
+}
+
+// GetStringEx is GetEx returning what GetString does. Changing the
+// expiration leaves the version alone.
+func (d *DB) GetStringEx(key string, opts GetExOptions) (StringValue, bool, error) {
+	switch opts.set() {
+	case 0:
+		return d.GetString(key)
+	case 1:
+	default:
+		return StringValue{}, false, ErrConflictingOptions
+	}
+	res := d.s.exec(withArgs(Command{Op: OpGetEx, DB: d.name, Key: key, TTL: opts.TTL}, opts))
+	v, _ := res.Data.(StringValue)
+	return v, res.OK, res.Err
+}
+
+func (s *DataObj) applyGetEx(cmd Command) Result {
+	var o GetExOptions
+	if err := decodeArgs(cmd, &o); err != nil {
+		return Result{Err: err}
+	}
+	item, exists := s.live(cmd.DB, cmd.Key, cmd.Now)
+	if !exists {
+		return Result{}
+	}
+	if item.Type != StringType {
+		return Result{Err: ErrWrongType}
+	}
+	switch {
+	case o.Persist:
+		item.ExpiresAt = time.Time{}
+	case !o.ExpireAt.IsZero():
+		item.ExpiresAt = o.ExpireAt
+	default:
+		item.ExpiresAt = expiry(cmd.Now, cmd.TTL)
+	}
+	return Result{Value: item.Value.(string), Data: stringValue(item), OK: true}
+}
+
+// GetDel removes the string under key and returns it. It reports false if
+// there is no such key.
+func (d *DB) GetDel(key string) (string, bool, error) {
+	return d.GetDelVersion(key, 0)
+}
+
+// GetDelVersion is GetDel that only removes the key if it is at version,
+// unless that is 0. It returns ErrVersionMismatch if the key has changed.
+func (d *DB) GetDelVersion(key string, version uint64) (string, bool, error) {
+	cmd := Command{Op: OpGetDel, DB: d.name, Key: key}
+	if version != 0 {
+		cmd = withArgs(cmd, removeArgs{IfVersion: version})
+	}
+	res := d.s.exec(cmd)
+	return res.Value, res.OK, res.Err
+}
+
+func (s *DataObj) applyGetDel(cmd Command) Result {
+	// Commands from GetDel carry no args
+	var o removeArgs
+	if len(cmd.Args) > 0 {
+		if err := decodeArgs(cmd, &o); err != nil {
+			return Result{Err: err}
+		}
+	}
+	item, exists := s.live(cmd.DB, cmd.Key, cmd.Now)
+	if !exists {
+		return Result{}
+	}
+	if item.Type != StringType {
+		return Result{Err: ErrWrongType}
+	}
+	if o.IfVersion != 0 && item.Version != o.IfVersion {
+		return Result{Err: ErrVersionMismatch}
+	}
+	s.del(cmd.DB, cmd.Key)
+	return Result{Value: item.Value.(string), OK: true}
+}
+
+// AppendOptions control Append
+type AppendOptions struct {
+	// Prepend adds the value in front of the existing one
+	Prepend bool `json:"prepend,omitempty"`
+	// IfVersion only changes the key if it is at this version
+	IfVersion uint64 `json:"if_version,omitempty"`
+}
+
+// Append adds value to the end of the string under key, keeping its
+// expiration and flags, and returns the new version. Unlike Redis APPEND
+// it does not create a missing key and reports false instead.
+func (d *DB) Append(key, value string, opts AppendOptions) (uint64, bool, error) {
+	res := d.s.exec(withArgs(Command{Op: OpAppend, DB: d.name, Key: key, Value: value}, opts))
+	version, _ := res.Data.(uint64)
+	return version, res.OK, res.Err
+}
+
+func (s *DataObj) applyAppend(cmd Command) Result {
+	var o AppendOptions
+	if err := decodeArgs(cmd, &o); err != nil {
+		return Result{Err: err}
+	}
+	item, exists := s.live(cmd.DB, cmd.Key, cmd.Now)
+	if !exists {
+		return Result{}
+	}
+	if item.Type != StringType {
+		return Result{Err: ErrWrongType}
+	}
+	if o.IfVersion != 0 && item.Version != o.IfVersion {
+		return Result{Err: ErrVersionMismatch}
+	}
+	value := item.Value.(string) + cmd.Value
+	if o.Prepend {
+		value = cmd.Value + item.Value.(string)
+	}
+	updated := &Item{Type: StringType, Value: value, ExpiresAt: item.ExpiresAt, Flags: item.Flags}
+	if err := s.admit(cmd, s.growth(cmd.DB, cmd.Key, updated), len(value)); err != nil {
+		return Result{Err: err}
+	}
+	if err := s.reserve(cmd); err != nil {
+		return Result{Err: err}
+	}
+	s.put(cmd.DB, cmd.Key, updated)
+	return Result{Data: updated.Version, OK: true}
+}
+
+// IncrOptions control Incr
+type IncrOptions struct {
+	Delta uint64 `json:"delta"`
+	// Decr subtracts Delta, stopping at zero
+	Decr bool `json:"decr,omitempty"`
+	// IfVersion only changes the key if it is at this version
+	IfVersion uint64 `json:"if_version,omitempty"`
+	// Create stores Initial under a missing key, expiring it after TTL if
+	// that is set
+	Create  bool          `json:"create,omitempty"`
+	Initial uint64        `json:"initial,omitempty"`
+	TTL     time.Duration `json:"-"`
+}
+
+// IncrResult is the outcome of Incr
+type IncrResult struct {
+	Value     uint64
+	Version   uint64
+	ExpiresAt time.Time
+}
+
+// Incr adds to the decimal counter stored as a string under key, with the
+// unsigned semantics of memcached: increments wrap around at 2^64 and
+// decrements stop at zero. It reports false if there is no such key and
+// returns ErrNotCounter if the value is not a number.
+func (d *DB) Incr(key string, opts IncrOptions) (IncrResult, bool, error) {
+	res := d.s.exec(withArgs(Command{Op: OpIncr, DB: d.name, Key: key, TTL: opts.TTL}, opts))
+	out, _ := res.Data.(IncrResult)
+	return out, res.OK, res.Err
+}
+
+func (s *DataObj) applyIncr(cmd Command) Result {
+	var o IncrOptions
+	if err := decodeArgs(cmd, &o); err != nil {
+		return Result{Err: err}
+	}
+	item, exists := s.live(cmd.DB, cmd.Key, cmd.Now)
+	var updated *Item
+	switch {
+	case !exists && !o.Create:
+		return Result{}
+	case !exists:
+		updated = &Item{
+			Type:      StringType,
+			Value:     strconv.FormatUint(o.Initial, 10),
+			ExpiresAt: expiry(cmd.Now, cmd.TTL),
+		}
+	case item.Type != StringType:
+		return Result{Err: ErrWrongType}
+	case o.IfVersion != 0 && item.Version != o.IfVersion:
+		return Result{Err: ErrVersionMismatch}
+	default:
+		n, err := strconv.ParseUint(item.Value.(string), 10, 64)
+		if err != nil {
+			return Result{Err: ErrNotCounter}
+		}
+		switch {
+		case !o.Decr:
+			n += o.Delta
+		case n < o.Delta:
+			n = 0
+		default:
+			n -= o.Delta
+		}
+		updated = &Item{
+			Type:      StringType,
+			Value:     strconv.FormatUint(n, 10),
+			ExpiresAt: item.ExpiresAt,
+			Flags:     item.Flags,
+		}
+	}
+	value := updated.Value.(string)
+	if err := s.admit(cmd, s.growth(cmd.DB, cmd.Key, updated), len(value)); err != nil {
+		return Result{Err: err}
+	}
+	if err := s.reserve(cmd); err != nil {
+		return Result{Err: err}
+	}
+	s.put(cmd.DB, cmd.Key, updated)
+	n, _ := strconv.ParseUint(value, 10, 64)
+	return Result{Value: value, Data: IncrResult{Value: n, Version: updated.Version, ExpiresAt: updated.ExpiresAt}, OK: true}
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// added returns a channel that is closed the next time an entry is added
+// to a stream, a message to a queue or a lock is released. The caller must hold s.Mu for
+// writing.
+func (s *DataObj) added() <-chan struct{} {
+	if s.addSignal == nil {
+		s.addSignal = make(chan struct{})
+	}
+	return s.addSignal
+}
+
+// notifyAdded wakes blocked readers. The caller must hold s.Mu for
+// writing.
+func (s *DataObj) notifyAdded() {
+	if s.addSignal != nil {
+		close(s.addSignal)
+		s.addSignal = nil
+	}
+}
+
+// blockFor calls read until it returns items, fails, block passes or ctx
+// is done. Between calls it waits for the channel read returned to be
+// closed or, if read also returned a positive retry, for that long. A block
+// of zero calls read once.
+func blockFor[T any](ctx context.Context, block time.Duration, read func() ([]T, <-chan struct{}, time.Duration, error)) ([]T, error) {
+	var timeout <-chan time.Time
+	if block > 0 {
+		t := time.NewTimer(block)
+		defer t.Stop()
+		timeout = t.C
+	}
+	for {
+		items, wake, retry, err := read()
+		if err != nil || len(items) > 0 || block <= 0 {
+			if items == nil && err == nil {
+				items = []T{}
+			}
+			return items, err
+		}
+		var again *time.Timer
+		var retryC <-chan time.Time
+		if retry > 0 {
+			again = time.NewTimer(retry)
+			retryC = again.C
+		}
+		select {
+		case <-wake:
+		case <-retryC:
+		case <-timeout:
+			return []T{}, nil
+		case <-ctx.Done():
+			return []T{}, nil
+		}
+		if again != nil {
+			again.Stop()
+		}
+	}
+}
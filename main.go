@@ -1,18 +1,428 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dhanushcrueiso/coding-test/internal/acl"
+	"github.com/dhanushcrueiso/coding-test/internal/certs"
+	"github.com/dhanushcrueiso/coding-test/internal/config"
+	"github.com/dhanushcrueiso/coding-test/internal/logging"
+	"github.com/dhanushcrueiso/coding-test/internal/metrics"
+	"github.com/dhanushcrueiso/coding-test/internal/quota"
+	"github.com/dhanushcrueiso/coding-test/internal/raft"
+	"github.com/dhanushcrueiso/coding-test/internal/store"
+	"github.com/dhanushcrueiso/coding-test/src/handlers"
 	"github.com/dhanushcrueiso/coding-test/src/router"
 
 	"github.com/gofiber/fiber/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// version is reported by the INFO endpoint. Release builds set it with
+// -ldflags "-X main.version=..."
+var version = "dev"
+
+// Exit statuses reported to the process supervisor
+const (
+	exitOK = iota
+	// exitStartup means the server could not start or stopped serving
+	// because of an error
+	exitStartup
+	// exitUnclean means shutdown was requested but requests could not be
+	// drained in time or the final persistence flush failed
+	exitUnclean
 )
 
 func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	status := run(ctx, os.Args[1:])
+	stop()
+	os.Exit(status)
+}
+
+// run serves until ctx is done or a listener fails, then shuts down and
+// returns the exit status
+func run(ctx context.Context, args []string) int {
+	settings, err := config.Load(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitStartup
+	}
+	cfg := settings.Config()
+
+	logs := logging.NewOutput()
+	defer logs.Close()
+	if err := logs.SetFile(cfg.LogFile); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitStartup
+	}
+	level, _ := logging.ParseLevel(cfg.LogLevel)
+	logger := logging.New(logs, logging.Options{
+		Level:            level,
+		JSON:             cfg.LogFormat == "json",
+		Redact:           cfg.LogRedact,
+		SampleInitial:    cfg.LogSampleInitial,
+		SampleThereafter: cfg.LogSampleThereafter,
+	})
+	slog.SetDefault(logger.Logger)
+	log := logger.Logger
 
 	app := fiber.New(fiber.Config{
-		AppName: "Acronis-DataStore",
+		AppName:               "Acronis-DataStore",
+		DisableStartupMessage: true,
+		// Params and bodies end up as store keys and ACL user names, so they
+		// must not alias buffers fasthttp reuses for the next request
+		Immutable: true,
+		// Idle keep-alive connections would otherwise hold up draining
+		IdleTimeout: 10 * time.Second,
 	})
 
-	//server := handlers.NewServer()
-	router.MountRoutes(app)
-	app.Listen(":3000")
+	quotas := quota.New()
+	if cfg.QuotaFile != "" {
+		quotas, err = quota.Load(cfg.QuotaFile)
+		if err != nil {
+			log.Error("load quotas failed", "path", cfg.QuotaFile, "err", err)
+			return exitStartup
+		}
+	}
+
+	registry := metrics.NewRegistry()
+	dataStore := store.NewRedisMemoryStore(
+		store.WithLogger(log),
+		store.WithLockObserver(lockWaitMetric(registry)),
+		store.WithQuotas(quotas.StoreQuota),
+	)
+	defer dataStore.Close()
+	dataStore.SetCleanupInterval(cfg.ExpiryInterval)
+	dataStore.SetMemoryLimit(cfg.MaxMemory, cfg.EvictionPolicy)
+
+	var persister *store.Persister
+	if cfg.PersistenceFile != "" {
+		persister = store.NewPersister(dataStore, cfg.PersistenceFile, cfg.PersistenceInterval)
+		if err := persister.Load(); err != nil {
+			log.Error("load snapshot failed", "path", cfg.PersistenceFile, "err", err)
+			return exitStartup
+		}
+		persister.Start()
+	}
+
+	settings.OnChange(func(cfg config.Config) {
+		dataStore.SetCleanupInterval(cfg.ExpiryInterval)
+		dataStore.SetMemoryLimit(cfg.MaxMemory, cfg.EvictionPolicy)
+		if persister != nil {
+			persister.SetInterval(cfg.PersistenceInterval)
+		}
+		if err := logs.SetFile(cfg.LogFile); err != nil {
+			log.Error("reopen log file failed", "path", cfg.LogFile, "err", err)
+		}
+		if level, err := logging.ParseLevel(cfg.LogLevel); err == nil {
+			logger.SetLevel(level)
+		}
+		logger.SetRedact(cfg.LogRedact)
+	})
+
+	var node *raft.Node
+	if cfg.RaftID != "" {
+		node, err = startRaft(cfg, dataStore, log)
+		if err != nil {
+			log.Error("start raft failed", "err", err)
+			return exitStartup
+		}
+	}
+
+	registerMetrics(registry, dataStore, persister, node)
+
+	users := acl.New()
+	if cfg.ACLFile != "" {
+		users, err = acl.Load(cfg.ACLFile)
+		if err != nil {
+			log.Error("load acl failed", "path", cfg.ACLFile, "err", err)
+			return exitStartup
+		}
+	}
+
+	controller := handlers.NewServer(dataStore,
+		handlers.WithCluster(node),
+		handlers.WithConfig(settings),
+		handlers.WithLogger(log),
+		handlers.WithMetrics(registry),
+		handlers.WithPersister(persister),
+		handlers.WithVersion(version),
+		handlers.WithACL(users),
+		handlers.WithQuotas(quotas),
+	)
+	router.MountRoutes(app, controller)
+	controller.SetSlowLog(cfg.SlowLogThreshold, cfg.SlowLogMaxLen)
+	settings.OnChange(func(cfg config.Config) {
+		controller.SetSlowLog(cfg.SlowLogThreshold, cfg.SlowLogMaxLen)
+	})
+
+	var tlsConfig *tls.Config
+	if cfg.TLSCert != "" || cfg.TLSKey != "" {
+		reloader, err := startTLS(cfg, log)
+		if err != nil {
+			log.Error("load certificates failed", "err", err)
+			return exitStartup
+		}
+		defer reloader.Stop()
+		tlsConfig = reloader.TLSConfig()
+	}
+
+	ln, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		log.Error("listen failed", "addr", cfg.Listen, "err", err)
+		return exitStartup
+	}
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+
+	// gRPC is served on its own port, with the same certificates
+	var grpcServer *grpc.Server
+	var grpcLn net.Listener
+	if cfg.GRPCListen != "" {
+		grpcLn, err = net.Listen("tcp", cfg.GRPCListen)
+		if err != nil {
+			ln.Close()
+			log.Error("listen failed", "addr", cfg.GRPCListen, "err", err)
+			return exitStartup
+		}
+		var opts []grpc.ServerOption
+		if tlsConfig != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		}
+		grpcServer = controller.NewGRPCServer(opts...)
+	}
+
+	// memcached clients get a listener of their own too
+	var mcServer *handlers.MemcacheServer
+	var mcLn net.Listener
+	if cfg.MemcacheListen != "" {
+		if !store.ValidDBName(cfg.MemcacheDB) {
+			ln.Close()
+			if grpcLn != nil {
+				grpcLn.Close()
+			}
+			log.Error("invalid memcache namespace", "db", cfg.MemcacheDB)
+			return exitStartup
+		}
+		mcLn, err = net.Listen("tcp", cfg.MemcacheListen)
+		if err != nil {
+			ln.Close()
+			if grpcLn != nil {
+				grpcLn.Close()
+			}
+			log.Error("listen failed", "addr", cfg.MemcacheListen, "err", err)
+			return exitStartup
+		}
+		if tlsConfig != nil {
+			mcLn = tls.NewListener(mcLn, tlsConfig)
+		}
+		mcServer = controller.NewMemcacheServer(cfg.MemcacheDB)
+	}
+
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- app.Listener(ln)
+	}()
+	log.Info("listening", "addr", cfg.Listen, "tls", cfg.TLSCert != "", "pid", os.Getpid())
+
+	grpcErr := make(chan error, 1)
+	if grpcServer != nil {
+		go func() {
+			grpcErr <- grpcServer.Serve(grpcLn)
+		}()
+		log.Info("listening for grpc", "addr", cfg.GRPCListen, "tls", cfg.TLSCert != "")
+	}
+
+	mcErr := make(chan error, 1)
+	if mcServer != nil {
+		go func() {
+			mcErr <- mcServer.Serve(mcLn)
+		}()
+		log.Info("listening for memcached", "addr", cfg.MemcacheListen, "db", cfg.MemcacheDB, "tls", cfg.TLSCert != "")
+	}
+
+	status := exitOK
+	select {
+	case err := <-listenErr:
+		// The listener failed before any shutdown was requested
+		log.Error("listen failed", "addr", cfg.Listen, "err", err)
+		status = exitStartup
+		if grpcServer != nil {
+			grpcServer.Stop()
+		}
+		if mcServer != nil {
+			mcServer.Close(0)
+		}
+	case err := <-grpcErr:
+		log.Error("listen failed", "addr", cfg.GRPCListen, "err", err)
+		status = exitStartup
+		app.Shutdown()
+		<-listenErr
+		if mcServer != nil {
+			mcServer.Close(0)
+		}
+	case err := <-mcErr:
+		log.Error("listen failed", "addr", cfg.MemcacheListen, "err", err)
+		status = exitStartup
+		app.Shutdown()
+		<-listenErr
+		if grpcServer != nil {
+			grpcServer.Stop()
+		}
+	case <-ctx.Done():
+		timeout := settings.Config().ShutdownTimeout
+		log.Info("shutting down, draining requests", "timeout", timeout)
+		controller.CloseStreams()
+		if err := app.ShutdownWithTimeout(timeout); err != nil {
+			log.Error("drain requests failed", "err", err)
+			status = exitUnclean
+		}
+		<-listenErr
+		if grpcServer != nil && !stopGRPC(grpcServer, timeout) {
+			log.Error("drain grpc calls failed", "timeout", timeout)
+			status = exitUnclean
+		}
+		if mcServer != nil && !mcServer.Close(timeout) {
+			log.Error("drain memcached connections failed", "timeout", timeout)
+			status = exitUnclean
+		}
+	}
+
+	// Nothing can change the store from here on, so the final snapshot
+	// includes every acknowledged write
+	if node != nil {
+		if err := node.Stop(); err != nil {
+			log.Error("stop raft failed", "err", err)
+			status = max(status, exitUnclean)
+		}
+	}
+	dataStore.Close()
+	if persister != nil {
+		if err := persister.Stop(); err != nil {
+			log.Error("save snapshot failed", "path", cfg.PersistenceFile, "err", err)
+			status = max(status, exitUnclean)
+		}
+	}
+	return status
+}
+
+func startRaft(cfg config.Config, dataStore *store.DataObj, logger *slog.Logger) (*raft.Node, error) {
+	peers, err := parsePeers(cfg.RaftPeers)
+	if err != nil {
+		return nil, err
+	}
+	dir := cfg.RaftDir
+	if dir == "" {
+		dir = "raft-" + cfg.RaftID
+	}
+	advertise := cfg.RaftAdvertise
+	if advertise == "" {
+		advertise = localURL(cfg.Listen)
+	}
+
+	node, err := raft.NewNode(raft.Config{
+		ID:       cfg.RaftID,
+		RaftAddr: cfg.RaftAddr,
+		APIAddr:  advertise,
+		DataDir:  dir,
+		Peers:    peers,
+		Logger:   logger,
+	}, dataStore)
+	if err != nil {
+		return nil, err
+	}
+	if err := node.Start(); err != nil {
+		return nil, err
+	}
+	dataStore.SetReplicator(node)
+	return node, nil
+}
+
+// startTLS loads the server certificate and reloads it when the files
+// change or the process receives SIGHUP
+func startTLS(cfg config.Config, log *slog.Logger) (*certs.Reloader, error) {
+	reloader, err := certs.New(certs.Config{
+		CertFile:     cfg.TLSCert,
+		KeyFile:      cfg.TLSKey,
+		ClientCAFile: cfg.TLSClientCA,
+		ClientAuth:   cfg.TLSClientAuth,
+	}, log)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.TLSReloadInterval > 0 {
+		reloader.Watch(cfg.TLSReloadInterval)
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := reloader.Reload(); err != nil {
+				log.Error("reload certificates failed", "err", err)
+			} else {
+				log.Info("certificates reloaded")
+			}
+		}
+	}()
+	return reloader, nil
+}
+
+// stopGRPC lets running calls finish for up to timeout, then cancels the
+// rest. It reports whether they finished in time.
+func stopGRPC(srv *grpc.Server, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		srv.Stop()
+		<-done
+		return false
+	}
+}
+
+// parsePeers reads a comma separated list of id=host:port pairs
+func parsePeers(s string) ([]raft.Server, error) {
+	var peers []raft.Server
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, addr, ok := strings.Cut(part, "=")
+		if !ok || id == "" || addr == "" {
+			return nil, fmt.Errorf("invalid raft peer %q, want id=host:port", part)
+		}
+		peers = append(peers, raft.Server{ID: id, Addr: addr})
+	}
+	return peers, nil
+}
+
+// localURL turns a listen address such as ":3000" into a loopback base URL
+func localURL(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "http://" + addr
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port)
 }
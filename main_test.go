@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	cache "github.com/dhanushcrueiso/coding-test/pkg/gocache"
+)
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// outliving are goroutines of fasthttp that outlive a server by design:
+// the date updater runs for the life of the process, and the worker pool
+// cleaner only sees that the server stopped after sleeping out its idle
+// timeout
+var outliving = []string{"fasthttp.updateServerDate", "fasthttp.(*workerPool).Start"}
+
+// goroutines counts the running goroutines, leaving out outliving ones,
+// and returns their stacks
+func goroutines() (int, string) {
+	buf := make([]byte, 1<<20)
+	var kept []string
+	for _, g := range strings.Split(string(buf[:runtime.Stack(buf, true)]), "\n\n") {
+		ignore := false
+		for _, name := range outliving {
+			ignore = ignore || strings.Contains(g, name)
+		}
+		if !ignore {
+			kept = append(kept, g)
+		}
+	}
+	return len(kept), strings.Join(kept, "\n\n")
+}
+
+// settle waits for goroutines that are already on their way out, and
+// reports whether the count dropped to at most want
+func settle(want int) (int, string, bool) {
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+		n, stacks := goroutines()
+		if n <= want || time.Now().After(deadline) {
+			return n, stacks, n <= want
+		}
+	}
+}
+
+func waitListening(t *testing.T, addr string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("nothing listening on %s: %v", addr, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestShutdownStopsGoroutines runs the server with every listener, uses
+// each of them, and checks that once run returns it left no goroutine
+// behind: not the store's expiry loop, the persister, the raft node, nor
+// any connection handler.
+func TestShutdownStopsGoroutines(t *testing.T) {
+	tests := []struct {
+		name string
+		args func(dir string) []string
+	}{
+		{"persistence", func(dir string) []string {
+			return []string{
+				"-persistence-file", filepath.Join(dir, "snapshot.json"),
+				"-persistence-interval", "10ms",
+			}
+		}},
+		{"raft", func(dir string) []string {
+			addr := freeAddr(t)
+			return []string{
+				"-raft-id", "n1",
+				"-raft-addr", addr,
+				"-raft-peers", "n1=" + addr,
+				"-raft-dir", filepath.Join(dir, "raft"),
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			httpAddr, grpcAddr, mcAddr := freeAddr(t), freeAddr(t), freeAddr(t)
+			args := append([]string{
+				"-listen", httpAddr,
+				"-grpc-listen", grpcAddr,
+				"-memcache-listen", mcAddr,
+				"-expiry-interval", "10ms",
+				"-log-file", filepath.Join(dir, "server.log"),
+				"-shutdown-timeout", "2s",
+			}, tt.args(dir)...)
+
+			before, _ := goroutines()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			status := make(chan int, 1)
+			go func() {
+				status <- run(ctx, args)
+			}()
+			waitListening(t, httpAddr)
+			waitListening(t, grpcAddr)
+			waitListening(t, mcAddr)
+
+			hc := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+			client := cache.NewClient("http://"+httpAddr, cache.WithHTTPClient(hc), cache.WithGRPC(grpcAddr))
+			deadline := time.Now().Add(10 * time.Second)
+			for {
+				// A raft node only takes writes once it has elected itself
+				err := client.Set("grpc", "1", time.Minute)
+				if err == nil {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("set over grpc: %v", err)
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+			if v, err := cache.NewClient("http://"+httpAddr, cache.WithHTTPClient(hc)).Get("grpc"); err != nil || v != "1" {
+				t.Fatalf("get over http = %q, %v", v, err)
+			}
+			client.Close()
+
+			// One memcached connection is left open when shutting down
+			mc, err := net.Dial("tcp", mcAddr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mc.Close()
+			fmt.Fprint(mc, "set mc 0 0 1\r\nx\r\n")
+			if line, err := bufio.NewReader(mc).ReadString('\n'); err != nil || strings.TrimSpace(line) != "STORED" {
+				t.Fatalf("memcached set = %q, %v", line, err)
+			}
+
+			cancel()
+			select {
+			case got := <-status:
+				if got != exitOK {
+					t.Fatalf("run returned %d, want %d", got, exitOK)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("run did not return after shutdown")
+			}
+			mc.Close()
+
+			if n, stacks, ok := settle(before); !ok {
+				t.Fatalf("%d goroutines left after shutdown, started with %d:\n%s", n, before, stacks)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/dhanushcrueiso/coding-test/internal/metrics"
+	"github.com/dhanushcrueiso/coding-test/internal/raft"
+	"github.com/dhanushcrueiso/coding-test/internal/store"
+)
+
+// lockWaitMetric times acquisitions of the store lock. It is registered
+// before the store is created so the store can report into it.
+func lockWaitMetric(reg *metrics.Registry) func(mode string, wait time.Duration) {
+	waits := reg.NewHistogramVec("datastore_lock_wait_seconds",
+		"Time spent waiting for the store lock, by lock mode.",
+		[]float64{1e-6, 1e-5, 1e-4, 1e-3, 1e-2, .1, 1}, "mode")
+	read, write := waits.With("read"), waits.With("write")
+	return func(mode string, wait time.Duration) {
+		if mode == "read" {
+			read.Observe(wait.Seconds())
+		} else {
+			write.Observe(wait.Seconds())
+		}
+	}
+}
+
+// registerMetrics exposes store, persistence, replication and runtime
+// state. Values are read when /metrics is scraped.
+func registerMetrics(reg *metrics.Registry, s *store.DataObj, p *store.Persister, node *raft.Node) {
+	reg.NewGaugeFunc("datastore_keys", "Live keys in the store, by data type.", func() []metrics.Sample {
+		st := s.Stats()
+		out := make([]metrics.Sample, 0, len(store.DataTypes))
+		for _, t := range store.DataTypes {
+			out = append(out, metrics.Sample{Labels: []string{t.String()}, Value: float64(st.Keys[t])})
+		}
+		return out
+	}, "type")
+	reg.NewGaugeFunc("datastore_keys_with_ttl", "Live keys that have an expiration set.", func() []metrics.Sample {
+		return metrics.Value(float64(s.Stats().Expires))
+	})
+	reg.NewCounterFunc("datastore_expired_keys_total", "Keys removed because their TTL passed.", func() []metrics.Sample {
+		return metrics.Value(float64(s.Stats().Expired))
+	})
+	reg.NewCounterFunc("datastore_evicted_keys_total", "Keys removed to stay under memory.max.", func() []metrics.Sample {
+		return metrics.Value(float64(s.Stats().Evicted))
+	})
+	reg.NewGaugeFunc("datastore_memory_used_bytes", "Estimated size of stored data.", func() []metrics.Sample {
+		return metrics.Value(float64(s.UsedMemory()))
+	})
+	reg.NewGaugeFunc("datastore_memory_max_bytes", "Configured memory limit, 0 when unlimited.", func() []metrics.Sample {
+		return metrics.Value(float64(s.Stats().MaxMemory))
+	})
+
+	if p != nil {
+		reg.NewGaugeFunc("datastore_persistence_last_save_timestamp_seconds",
+			"Unix time of the last snapshot save attempt, 0 before the first.", func() []metrics.Sample {
+				last, _ := p.Status()
+				if last.IsZero() {
+					return metrics.Value(0)
+				}
+				return metrics.Value(float64(last.Unix()))
+			})
+		reg.NewGaugeFunc("datastore_persistence_last_save_success",
+			"Whether the last snapshot save succeeded.", func() []metrics.Sample {
+				_, err := p.Status()
+				return metrics.Value(boolValue(err == nil))
+			})
+	}
+
+	if node != nil {
+		reg.NewGaugeFunc("datastore_raft_term", "Current raft term.", func() []metrics.Sample {
+			return metrics.Value(float64(node.Status().Term))
+		})
+		reg.NewGaugeFunc("datastore_raft_commit_index", "Highest log index known to be committed.", func() []metrics.Sample {
+			return metrics.Value(float64(node.Status().CommitIndex))
+		})
+		reg.NewGaugeFunc("datastore_raft_applied_index", "Highest log index applied to the store.", func() []metrics.Sample {
+			return metrics.Value(float64(node.Status().LastApplied))
+		})
+		reg.NewGaugeFunc("datastore_raft_leader", "1 if this node is the leader.", func() []metrics.Sample {
+			return metrics.Value(boolValue(node.IsLeader()))
+		})
+		reg.NewGaugeFunc("datastore_raft_members", "Voting members in the current configuration.", func() []metrics.Sample {
+			return metrics.Value(float64(len(node.Status().Servers)))
+		})
+	}
+
+	reg.NewGaugeFunc("go_goroutines", "Number of goroutines that currently exist.", func() []metrics.Sample {
+		return metrics.Value(float64(runtime.NumGoroutine()))
+	})
+	reg.NewGaugeFunc("go_memstats_heap_alloc_bytes", "Bytes of allocated heap objects.", func() []metrics.Sample {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		return metrics.Value(float64(m.HeapAlloc))
+	})
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
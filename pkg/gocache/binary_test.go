@@ -0,0 +1,213 @@
+package gocache_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/dhanushcrueiso/coding-test/internal/store"
+	cache "github.com/dhanushcrueiso/coding-test/pkg/gocache"
+	"github.com/dhanushcrueiso/coding-test/src/handlers"
+	"github.com/dhanushcrueiso/coding-test/src/router"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// keys hold the bytes URLs and JSON treat specially
+var keys = []string{
+	"a/b/c",
+	"q?x=1&y=2",
+	"frag#ment",
+	"100%",
+	"%2F",
+	"with space",
+	"nul\x00byte",
+	"\xff\xfe",
+	"ünïcödé",
+	"/?# %\x00\xff",
+}
+
+// values hold bytes JSON would mangle
+var values = []string{
+	"plain",
+	"",
+	"\xff\x00\xfe",
+	"line\r\nbreak",
+	string(allBytes()),
+}
+
+func allBytes() []byte {
+	b := make([]byte, 256)
+	for i := range b {
+		b[i] = byte(i)
+	}
+	return b
+}
+
+// serve runs the HTTP and gRPC APIs over a fresh store and returns their
+// addresses
+func serve(t *testing.T) (string, string) {
+	t.Helper()
+	s := store.NewRedisMemoryStore()
+	h := handlers.NewServer(s)
+	app := fiber.New(fiber.Config{DisableStartupMessage: true, Immutable: true})
+	router.MountRoutes(app, h)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(ln)
+
+	grpcLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := h.NewGRPCServer()
+	go srv.Serve(grpcLn)
+
+	t.Cleanup(func() {
+		srv.Stop()
+		app.Shutdown()
+		s.Close()
+	})
+	return ln.Addr().String(), grpcLn.Addr().String()
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	httpAddr, grpcAddr := serve(t)
+	clients := map[string]*cache.Client{
+		"http": cache.NewClient("http://" + httpAddr),
+		"grpc": cache.NewClient("http://"+httpAddr, cache.WithGRPC(grpcAddr)),
+	}
+	defer clients["grpc"].Close()
+
+	for name, c := range clients {
+		t.Run(name, func(t *testing.T) {
+			for _, key := range keys {
+				key := name + ":" + key
+				for _, value := range values {
+					if err := c.Set(key, value, 0); err != nil {
+						t.Fatalf("Set(%q): %v", key, err)
+					}
+					got, err := c.Get(key)
+					if err != nil {
+						t.Fatalf("Get(%q): %v", key, err)
+					}
+					if got != value {
+						t.Fatalf("Get(%q) = %q, want %q", key, got, value)
+					}
+				}
+
+				list := key + ":list"
+				if err := c.CreateList(list, 0); err != nil {
+					t.Fatalf("CreateList(%q): %v", list, err)
+				}
+				for _, value := range values {
+					if err := c.Push(list, value); err != nil {
+						t.Fatalf("Push(%q): %v", list, err)
+					}
+				}
+				for i := len(values) - 1; i >= 0; i-- {
+					got, err := c.Pop(list)
+					if err != nil {
+						t.Fatalf("Pop(%q): %v", list, err)
+					}
+					if got != values[i] {
+						t.Fatalf("Pop(%q) = %q, want %q", list, got, values[i])
+					}
+				}
+
+				if err := c.Remove(key); err != nil {
+					t.Fatalf("Remove(%q): %v", key, err)
+				}
+				if _, err := c.Get(key); err == nil {
+					t.Fatalf("Get(%q) found the removed key", key)
+				}
+			}
+		})
+	}
+}
+
+// rawRequest sends value as the raw body of a request for key, encoded as
+// enc, and returns the raw response body
+func rawRequest(t *testing.T, method, base, key, enc string, value []byte) (int, []byte) {
+	t.Helper()
+	path := base + "/api/strings/"
+	if enc == "base64url" {
+		path += base64.RawURLEncoding.EncodeToString([]byte(key))
+	} else {
+		path += urlPathEscape(key)
+	}
+	var body io.Reader
+	if value != nil {
+		body = bytes.NewReader(value)
+	}
+	req, err := http.NewRequest(method, path, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(handlers.KeyEncodingHeader, enc)
+	req.Header.Set("Content-Type", handlers.OctetStream)
+	req.Header.Set("Accept", handlers.OctetStream)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, out
+}
+
+// urlPathEscape percent-encodes every byte outside the unreserved set, as
+// a client in another language might
+func urlPathEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-._~", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// TestKeyEncodings writes each key in one encoding and reads it back in the
+// other, with raw octet-stream bodies, so both name the same key
+func TestKeyEncodings(t *testing.T) {
+	httpAddr, _ := serve(t)
+	base := "http://" + httpAddr
+	client := cache.NewClient(base)
+	value := allBytes()
+
+	for _, key := range keys {
+		for _, enc := range [][2]string{{"percent", "base64url"}, {"base64url", "percent"}} {
+			write, read := enc[0], enc[1]
+			if status, body := rawRequest(t, http.MethodPost, base, key, write, value); status != 200 {
+				t.Fatalf("POST %q as %s: %d %s", key, write, status, body)
+			}
+			status, got := rawRequest(t, http.MethodGet, base, key, read, nil)
+			if status != 200 || !bytes.Equal(got, value) {
+				t.Fatalf("GET %q as %s after POST as %s = %d %q, want the value", key, read, write, status, got)
+			}
+			// The Go client escapes keys its own way and finds the same key
+			if got, err := client.Get(key); err != nil || got != string(value) {
+				t.Fatalf("client Get(%q) = %q, %v", key, got, err)
+			}
+		}
+	}
+
+	if status, _ := rawRequest(t, http.MethodGet, base, "x", "rot13", nil); status != 400 {
+		t.Errorf("unknown key encoding: status %d, want 400", status)
+	}
+}
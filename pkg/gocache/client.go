@@ -2,12 +2,18 @@ package gocache
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -15,461 +21,426 @@ import (
 type Client struct {
 	BaseURL string
 	client  *http.Client
+	logger  *slog.Logger
+	hooks   []RequestHook
+	// auth is the Authorization header value sent with every request
+	auth string
+	tls  *tls.Config
+	// rpc carries the calls of the gRPC service when WithGRPC is used
+	rpc *rpcTransport
+	// namespace is selected by WithNamespace
+	namespace string
 }
 
-// NewClient creates a new GoCache client
-func NewClient(baseURL string) *Client {
-	return &Client{
-		BaseURL: baseURL,
-		client: &http.Client{
-			Timeout: time.Second * 10,
-		},
+// DefaultTimeout bounds each request unless changed with WithTimeout
+const DefaultTimeout = time.Second * 10
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithTimeout sets the timeout for each request
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.client.Timeout = d
 	}
 }
 
-// responseBody is the structure for parsing server responses
-type responseBody struct {
-	Success bool            `json:"success"`
-	Data    json.RawMessage `json:"data,omitempty"`
-	Error   string          `json:"error,omitempty"`
+// WithHTTPClient replaces the underlying HTTP client
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.client = hc
+	}
 }
 
-type dataBody struct {
-	Key   string      `json:"key"`
-	Type  int         `json:"type"`
-	Value interface{} `json:"value"`
-	// Add any other fields that Fiber might include
+// WithLogger sets a logger for the client's debug output. By default
+// nothing is logged.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *Client) {
+		c.logger = l
+	}
 }
 
-type dataresponselist struct {
-	Data    string `json:"value"`
-	Message string `json:"messsage"`
+// RequestInfo describes one completed request for a RequestHook
+type RequestInfo struct {
+	// Method is the HTTP method, or "GRPC" for calls made with WithGRPC
+	Method string
+	// Path is the request path, e.g. /api/v2/strings/foo, or the full gRPC
+	// method name
+	Path string
+	// Status is the HTTP status code, 0 if no response was received or
+	// the call was made over gRPC
+	Status   int
+	Duration time.Duration
+	Err      error
 }
 
-// Get retrieves a string value by key
-func (c *Client) Get(key string) (string, error) {
-	url := fmt.Sprintf("%s/api/strings/%s", c.BaseURL, key)
-	resp, err := c.client.Get(url)
-	if err != nil {
-		return "", err
+// RequestHook is called after every request the client makes, for example
+// to feed client-side metrics
+type RequestHook func(RequestInfo)
+
+// WithRequestHook registers fn to observe every request
+func WithRequestHook(fn RequestHook) Option {
+	return func(c *Client) {
+		c.hooks = append(c.hooks, fn)
 	}
-	defer resp.Body.Close()
+}
 
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("server returned status %d: %s",
-			resp.StatusCode, string(bodyBytes))
+// WithBasicAuth authenticates every request as an ACL user with a password
+func WithBasicAuth(user, password string) Option {
+	return func(c *Client) {
+		c.auth = "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
 	}
+}
 
-	// Parse the response
-	var response dataBody
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("error parsing response: %w (body: %s)",
-			err, string(bodyBytes))
+// WithAPIKey authenticates every request with an API key issued by the
+// server
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.auth = "Bearer " + key
 	}
+}
 
-	// Convert the value to string
-	value, ok := response.Value.(string)
-	if !ok {
-		return "", fmt.Errorf("expected string value, got: %T", response.Value)
+// NewClient creates a new GoCache client
+func NewClient(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		BaseURL: baseURL,
+		client: &http.Client{
+			Timeout: DefaultTimeout,
+		},
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.applyTLS()
+	c.dialGRPC()
+	if len(c.hooks) > 0 || c.auth != "" {
+		// Copy so a client passed to WithHTTPClient is not modified
+		hc := *c.client
+		next := hc.Transport
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		hc.Transport = &transport{next: next, auth: c.auth, hooks: c.hooks}
+		c.client = &hc
 	}
+	return c
+}
 
-	return value, nil
+// transport adds credentials to each request and reports each round trip
+// to the client's hooks
+type transport struct {
+	next  http.RoundTripper
+	auth  string
+	hooks []RequestHook
 }
 
-// Set sets a string value with optional TTL
-func (c *Client) Set(key, value string, ttl time.Duration) error {
-	url := fmt.Sprintf("%s/api/strings/%s", c.BaseURL, key)
-	if ttl > 0 {
-		url = fmt.Sprintf("%s?ttl=%d", url, int(ttl.Seconds()))
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.auth != "" {
+		// A RoundTripper must not modify the caller's request
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", t.auth)
 	}
-
-	data := struct {
-		Value string `json:"value"`
-	}{
-		Value: value,
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	info := RequestInfo{
+		Method:   req.Method,
+		Path:     req.URL.Path,
+		Duration: time.Since(start),
+		Err:      err,
 	}
-
-	body, err := json.Marshal(data)
-	if err != nil {
-		return err
+	if resp != nil {
+		info.Status = resp.StatusCode
 	}
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
-	if err != nil {
-		return err
+	for _, fn := range t.hooks {
+		fn(info)
 	}
-	req.Header.Set("Content-Type", "application/json")
+	return resp, err
+}
 
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
+// octetStream is the content type of raw values
+const octetStream = "application/octet-stream"
 
-	if resp.StatusCode != http.StatusOK {
-		return c.parseError(resp.Body)
-	}
+// apiPrefix is the version of the server's API the client speaks
+const apiPrefix = "/api/v2"
 
-	return nil
+// PopResponse is the body of a pop in version 1 of the API
+type PopResponse struct {
+	Data    string `json:"data"`    // The popped string value
+	Message string `json:"message"` // Success message
 }
 
-// Update updates an existing string value
-func (c *Client) Update(key, value string) error {
-	url := fmt.Sprintf("%s/api/strings/%s", c.BaseURL, key)
+func listPath(key string) string {
+	return apiPrefix + "/list/" + url.PathEscape(key)
+}
 
-	data := struct {
-		Value string `json:"value"`
-	}{
-		Value: value,
-	}
+func ttlPath(key string) string {
+	return apiPrefix + "/ttl/" + url.PathEscape(key)
+}
 
-	body, err := json.Marshal(data)
-	if err != nil {
-		return err
+// Get retrieves a string value by key
+func (c *Client) Get(key string) (string, error) {
+	if c.rpc != nil {
+		return c.rpcGet(key)
 	}
+	// Ask for the raw bytes, which JSON would mangle if they are not UTF-8
+	value, err := c.raw(http.MethodGet, stringPath(key))
+	return string(value), err
+}
 
-	req, err := http.NewRequest("PUT", url, bytes.NewBuffer(body))
-	if err != nil {
+// Set sets a string value with optional TTL
+func (c *Client) Set(key, value string, ttl time.Duration) error {
+	if c.rpc != nil {
+		_, err := c.rpcSet(key, value, SetOptions{TTL: ttl})
 		return err
 	}
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return err
+	path := stringPath(key)
+	if ttl > 0 {
+		path = fmt.Sprintf("%s?px=%d", path, ttlMillis(ttl))
 	}
-	defer resp.Body.Close()
+	return c.doBody(context.Background(), http.MethodPost, path, octetStream, strings.NewReader(value), nil)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return c.parseError(resp.Body)
+// Update updates an existing string value
+func (c *Client) Update(key, value string) error {
+	if c.rpc != nil {
+		return c.rpcUpdate(key, value)
 	}
-
-	return nil
+	return c.doBody(context.Background(), http.MethodPut, stringPath(key), octetStream, strings.NewReader(value), nil)
 }
 
 // Remove deletes a key
 func (c *Client) Remove(key string) error {
-	url := fmt.Sprintf("%s/api/strings/%s", c.BaseURL, key)
-
-	req, err := http.NewRequest("DELETE", url, nil)
-	if err != nil {
-		return err
-	}
-
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return err
+	if c.rpc != nil {
+		return c.rpcDelete(key)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return c.parseError(resp.Body)
-	}
-
-	return nil
+	return c.do(http.MethodDelete, stringPath(key), nil, nil)
 }
 
 // CreateList initializes a new list with optional TTL
 func (c *Client) CreateList(key string, ttl time.Duration) error {
-	url := fmt.Sprintf("%s/api/list/%s", c.BaseURL, key)
-	if ttl > 0 {
-		url = fmt.Sprintf("%s?ttl=%d", url, int(ttl.Seconds()))
+	if c.rpc != nil {
+		return c.rpcCreateList(key, ttl)
 	}
-
-	req, err := http.NewRequest("POST", url, nil)
-	if err != nil {
-		return err
-	}
-
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return c.parseError(resp.Body)
+	path := listPath(key)
+	if ttl > 0 {
+		path = fmt.Sprintf("%s?px=%d", path, ttlMillis(ttl))
 	}
-
-	return nil
+	return c.do(http.MethodPost, path, nil, nil)
 }
 
 // GetList retrieves all items in a list
 func (c *Client) GetList(key string) ([]string, error) {
-	url := fmt.Sprintf("%s/api/list/%s", c.BaseURL, key)
-
-	resp, err := c.client.Get(url)
-	if err != nil {
-		fmt.Println("check oje")
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		fmt.Println("check two")
-		return nil, c.parseError(resp.Body)
-	}
-
-	// Parse the response
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("error reading response body: %w", err)
-	}
-
-	// Parse the Fiber response directly first
-	var fiberResponse struct {
-		Data    json.RawMessage `json:"data"`
-		Message string          `json:"message"`
-	}
-
-	if err := json.Unmarshal(bodyBytes, &fiberResponse); err != nil {
-		// If direct parsing fails, fall back to parseResponse
-		resp.Body = io.NopCloser(bytes.NewReader(bodyBytes))
-		response, err := c.parseResponse(resp.Body)
-		if err != nil {
-			return nil, err
-		}
-
-		var result []string
-		if err := json.Unmarshal(response.Data, &result); err != nil {
-			return nil, fmt.Errorf("error parsing response data: %w", err)
-		}
-
-		return result, nil
+	if c.rpc != nil {
+		return c.rpcGetList(key)
 	}
-
-	// If direct parsing succeeded, handle the data field
 	var result []string
-	if err := json.Unmarshal(fiberResponse.Data, &result); err != nil {
-		return nil, fmt.Errorf("error parsing data array: %w", err)
+	if err := c.do(http.MethodGet, listPath(key), nil, &result); err != nil {
+		c.logger.Debug("get list failed", "key", key, "err", err)
+		return nil, err
 	}
-
 	return result, nil
 }
 
 // Push adds a value to the end of a list
 func (c *Client) Push(key, value string) error {
-	url := fmt.Sprintf("%s/api/list/%s/push", c.BaseURL, key)
-
-	data := struct {
-		Value string `json:"value"`
-	}{
-		Value: value,
-	}
-
-	body, err := json.Marshal(data)
-	if err != nil {
-		return err
-	}
-
-	req, err := http.NewRequest("PATCH", url, bytes.NewBuffer(body))
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return c.parseError(resp.Body)
+	if c.rpc != nil {
+		return c.rpcPush(key, value)
 	}
-
-	return nil
-}
-
-type PopResponse struct {
-	Data    string `json:"data"`    // The popped string value
-	Message string `json:"message"` // Success message
+	return c.doBody(context.Background(), http.MethodPatch, listPath(key)+"/push", octetStream, strings.NewReader(value), nil)
 }
 
 // Pop removes and returns the last value from a list
 func (c *Client) Pop(key string) (string, error) {
-	url := fmt.Sprintf("%s/api/list/%s/pop", c.BaseURL, key)
-
-	req, err := http.NewRequest("PATCH", url, nil)
-	if err != nil {
-		return "", fmt.Errorf("error creating request: %w", err)
+	if c.rpc != nil {
+		return c.rpcPop(key)
 	}
+	value, err := c.raw(http.MethodPatch, listPath(key)+"/pop")
+	c.logger.Debug("pop", "key", key, "err", err)
+	return string(value), err
+}
 
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("request failed: %w", err)
+// RemoveList deletes a list
+func (c *Client) RemoveList(key string) error {
+	if c.rpc != nil {
+		return c.rpcDelete(key)
 	}
-	defer resp.Body.Close()
+	return c.do(http.MethodDelete, listPath(key), nil, nil)
+}
 
-	// Read the response body
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("error reading response body: %w", err)
+// GetTTL returns the remaining TTL for a key, or -1 if it has none
+func (c *Client) GetTTL(key string) (time.Duration, error) {
+	if c.rpc != nil {
+		return c.rpcGetTTL(key)
 	}
-
-	// Log the raw response for debugging
-	fmt.Printf("Pop response: %s\n", string(bodyBytes))
-
-	if resp.StatusCode != http.StatusOK {
-		// Create a new reader for the parseError function
-		resp.Body = io.NopCloser(bytes.NewReader(bodyBytes))
-		return "", c.parseError(resp.Body)
+	var out struct {
+		TTLMs int64 `json:"ttl_ms"`
 	}
-
-	// Parse the response into our structure
-	var popResponse PopResponse
-	if err := json.Unmarshal(bodyBytes, &popResponse); err != nil {
-		return "", fmt.Errorf("error parsing response: %w (body: %s)",
-			err, string(bodyBytes))
+	if err := c.do(http.MethodGet, ttlPath(key), nil, &out); err != nil {
+		return 0, err
 	}
-
-	// Check if we got a valid string value
-	if popResponse.Data == "" {
-		// Some APIs might return null/empty on an empty list
-		return "", fmt.Errorf("list is empty or returned empty value")
+	if out.TTLMs < 0 {
+		return -1, nil
 	}
-
-	return popResponse.Data, nil
+	return time.Duration(out.TTLMs) * time.Millisecond, nil
 }
 
-// RemoveList deletes a list
-func (c *Client) RemoveList(key string) error {
-	url := fmt.Sprintf("%s/api/list/%s", c.BaseURL, key)
-
-	req, err := http.NewRequest("DELETE", url, nil)
-	if err != nil {
+// SetTTL sets or updates the TTL for a key. A TTL of zero removes it.
+func (c *Client) SetTTL(key string, ttl time.Duration) error {
+	if c.rpc != nil {
+		_, err := c.rpcExpire(key, ttl, time.Time{}, ExpireOptions{})
 		return err
 	}
-
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return err
+	var ms int64
+	if ttl > 0 {
+		ms = ttlMillis(ttl)
 	}
-	defer resp.Body.Close()
+	q := url.Values{"px": {strconv.FormatInt(ms, 10)}}
+	return c.do(http.MethodPost, ttlPath(key)+"?"+q.Encode(), nil, nil)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return c.parseError(resp.Body)
-	}
+// Error codes the server sends. Error responses match these with
+// errors.Is, e.g. errors.Is(err, gocache.ErrNotFound).
+var (
+	ErrNotFound         = &Error{Code: "NOT_FOUND"}
+	ErrWrongType        = &Error{Code: "WRONGTYPE"}
+	ErrInvalidArgument  = &Error{Code: "INVALID_ARGUMENT"}
+	ErrConflict         = &Error{Code: "CONFLICT"}
+	ErrUnauthenticated  = &Error{Code: "UNAUTHENTICATED"}
+	ErrPermissionDenied = &Error{Code: "PERMISSION_DENIED"}
+	ErrRateLimited      = &Error{Code: "RATE_LIMITED"}
+	ErrQuotaExceeded    = &Error{Code: "QUOTA_EXCEEDED"}
+	ErrOutOfMemory      = &Error{Code: "OUT_OF_MEMORY"}
+	ErrUnavailable      = &Error{Code: "UNAVAILABLE"}
+	// ErrVersionMismatch is returned by the compare-and-swap calls when
+	// the key changed since the version was read
+	ErrVersionMismatch = &Error{Code: "PRECONDITION_FAILED"}
+)
 
-	return nil
+// Error is an error response from the server
+type Error struct {
+	// Status is the HTTP status code, 0 for errors from the gRPC transport
+	Status int
+	// Code is the stable error code, e.g. "NOT_FOUND"
+	Code    string
+	Message string
 }
 
-// GetTTL returns the remaining TTL for a key
-func (c *Client) GetTTL(key string) (time.Duration, error) {
-	url := fmt.Sprintf("%s/api/ttl/%s", c.BaseURL, key)
+func (e *Error) Error() string {
+	return "server error: " + e.Message
+}
 
-	resp, err := c.client.Get(url)
-	if err != nil {
-		return 0, fmt.Errorf("request failed: %w", err)
-	}
-	defer resp.Body.Close()
+// Is matches any error response with the same code as target
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code != "" && t.Code == e.Code
+}
 
-	// Read the response body
-	bodyBytes, err := io.ReadAll(resp.Body)
+// hasCode reports whether err is an error response with the code
+func hasCode(err error, code string) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Code == code
+}
+
+// envelope is the shape of every JSON response of the v2 API
+type envelope struct {
+	OK    bool            `json:"ok"`
+	Data  json.RawMessage `json:"data"`
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// send sends a request to the API and returns the response if it
+// succeeded. Otherwise it closes the response and returns its *Error.
+func (c *Client) send(ctx context.Context, method, path, contentType string, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
 	if err != nil {
-		return 0, fmt.Errorf("error reading response: %w", err)
+		return nil, err
 	}
-
-	// Check status code
-	if resp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("server returned error (status %d): %s",
-			resp.StatusCode, string(bodyBytes))
+	for name, values := range header {
+		req.Header[name] = values
 	}
-
-	// Parse the response
-	var response struct {
-		Message string  `json:"message"`
-		Data    float64 `json:"data"`
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
 	}
 
-	if err := json.Unmarshal(bodyBytes, &response); err != nil {
-		return 0, fmt.Errorf("error parsing response: %w", err)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
 	}
-
-	// Check for negative value indicating no expiration
-	if response.Data < 0 {
-		return -1, nil // No expiration
+	if resp.StatusCode < 300 {
+		return resp, nil
 	}
+	defer resp.Body.Close()
 
-	// Convert seconds to duration
-	return time.Duration(response.Data * float64(time.Second)), nil
+	e := &Error{Status: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	var env envelope
+	if json.NewDecoder(resp.Body).Decode(&env) == nil && env.Error != nil {
+		e.Code, e.Message = env.Error.Code, env.Error.Message
+	}
+	return nil, e
 }
 
-// SetTTL sets or updates the TTL for a key
-func (c *Client) SetTTL(key string, ttl time.Duration) error {
-	ttlSeconds := int(ttl.Seconds())
+// do sends body as JSON, if it is not nil, and decodes the data of a
+// successful response into out, if it is not nil
+func (c *Client) do(method, path string, body, out interface{}) error {
+	return c.doContext(context.Background(), method, path, body, out)
+}
 
-	// Build URL with properly encoded query parameter
-	baseURL := fmt.Sprintf("%s/api/ttl/%s", c.BaseURL, key)
-	reqURL, err := url.Parse(baseURL)
-	if err != nil {
-		return fmt.Errorf("error parsing URL: %w", err)
+// doContext is do with a request that is cancelled with ctx
+func (c *Client) doContext(ctx context.Context, method, path string, body, out interface{}) error {
+	var r io.Reader
+	contentType := ""
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r, contentType = bytes.NewReader(data), "application/json"
 	}
+	return c.doBody(ctx, method, path, contentType, r, out)
+}
 
-	// Add query parameters
-	query := reqURL.Query()
-	query.Set("ttl", strconv.Itoa(ttlSeconds))
-	reqURL.RawQuery = query.Encode()
-
-	// Create request
-	req, err := http.NewRequest(http.MethodPost, reqURL.String(), nil)
+// doBody is doContext with a body already encoded as contentType
+func (c *Client) doBody(ctx context.Context, method, path, contentType string, body io.Reader, out interface{}) error {
+	resp, err := c.send(ctx, method, path, contentType, body, nil)
 	if err != nil {
-		return fmt.Errorf("error creating request: %w", err)
+		return err
 	}
+	return decodeData(resp, out)
+}
 
-	// Set content type
-	req.Header.Set("Content-Type", "application/json")
-
-	// Execute request
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
-	}
+// decodeData decodes the data of a successful response into out, if it
+// is not nil, and closes the response
+func decodeData(resp *http.Response, out interface{}) error {
 	defer resp.Body.Close()
 
-	// Read the response body
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("error reading response: %w", err)
+	var env envelope
+	if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
+		return fmt.Errorf("error parsing response: %w", err)
 	}
-
-	// Check if successful
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned error (status %d): %s",
-			resp.StatusCode, string(bodyBytes))
+	if out == nil || len(env.Data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(env.Data, out); err != nil {
+		return fmt.Errorf("error parsing response: %w", err)
 	}
-
 	return nil
 }
 
-// Helper methods
-
-func (c *Client) parseResponse(body io.Reader) (*responseBody, error) {
-	var response responseBody
-	err := json.NewDecoder(body).Decode(&response)
+// raw sends a request for a raw value and returns its bytes
+func (c *Client) raw(method, path string) ([]byte, error) {
+	resp, err := c.send(context.Background(), method, path, "", nil, http.Header{"Accept": {octetStream}})
 	if err != nil {
-		return nil, fmt.Errorf("error parsing response: %w", err)
-	}
-
-	if !response.Success {
-		return nil, fmt.Errorf("server returned error: %s", response.Error)
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	return &response, nil
-}
-
-func (c *Client) parseError(body io.Reader) error {
-	var response responseBody
-	err := json.NewDecoder(body).Decode(&response)
+	value, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("error parsing error response: %w", err)
-	}
-
-	if response.Error != "" {
-		return fmt.Errorf("server error: %s", response.Error)
+		return nil, fmt.Errorf("error reading response: %w", err)
 	}
-
-	return fmt.Errorf("unknown server error")
+	return value, nil
 }
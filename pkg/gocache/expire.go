@@ -0,0 +1,98 @@
+package gocache
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ttlMillis converts a positive TTL to milliseconds, rounding up so a TTL
+// under a millisecond does not become "no expiration"
+func ttlMillis(ttl time.Duration) int64 {
+	return int64((ttl + time.Millisecond - 1) / time.Millisecond)
+}
+
+// ExpireOptions make Expire and ExpireAt conditional on the key's current
+// expiration. A key without one counts as expiring never.
+type ExpireOptions struct {
+	// NX only sets an expiration if the key has none, XX only if it has one
+	NX bool
+	XX bool
+	// GT only moves the expiration later, LT only earlier
+	GT bool
+	LT bool
+}
+
+func (o ExpireOptions) query(q url.Values) url.Values {
+	for name, on := range map[string]bool{"nx": o.NX, "xx": o.XX, "gt": o.GT, "lt": o.LT} {
+		if on {
+			q.Set(name, "true")
+		}
+	}
+	return q
+}
+
+type expireBody struct {
+	Updated bool `json:"updated"`
+}
+
+// Expire sets key to expire after ttl, with millisecond precision, if the
+// conditions in opts hold. It reports whether the expiration changed.
+func (c *Client) Expire(key string, ttl time.Duration, opts ExpireOptions) (bool, error) {
+	if c.rpc != nil {
+		return c.rpcExpire(key, ttl, time.Time{}, opts)
+	}
+	q := url.Values{"px": {"0"}}
+	if ttl > 0 {
+		q.Set("px", strconv.FormatInt(ttlMillis(ttl), 10))
+	}
+	var out expireBody
+	err := c.do(http.MethodPost, ttlPath(key)+"?"+opts.query(q).Encode(), nil, &out)
+	return out.Updated, err
+}
+
+// ExpireAt sets key to expire at t, with millisecond precision, if the
+// conditions in opts hold. A time in the past deletes the key. It reports
+// whether the expiration changed.
+func (c *Client) ExpireAt(key string, t time.Time, opts ExpireOptions) (bool, error) {
+	if c.rpc != nil {
+		return c.rpcExpire(key, 0, t, opts)
+	}
+	ms := t.UnixMilli()
+	if ms <= 0 {
+		ms = 1
+	}
+	q := url.Values{"pxat": {strconv.FormatInt(ms, 10)}}
+	var out expireBody
+	err := c.do(http.MethodPost, ttlPath(key)+"?"+opts.query(q).Encode(), nil, &out)
+	return out.Updated, err
+}
+
+// Persist removes the expiration of key. It reports false if the key had
+// none.
+func (c *Client) Persist(key string) (bool, error) {
+	if c.rpc != nil {
+		return c.rpcPersist(key)
+	}
+	var out expireBody
+	err := c.do(http.MethodDelete, ttlPath(key), nil, &out)
+	return out.Updated, err
+}
+
+// ExpireTime returns when key expires, or the zero time if it does not
+func (c *Client) ExpireTime(key string) (time.Time, error) {
+	if c.rpc != nil {
+		return c.rpcExpireTime(key)
+	}
+	var out struct {
+		ExpireTimeMs int64 `json:"expire_time_ms"`
+	}
+	if err := c.do(http.MethodGet, ttlPath(key), nil, &out); err != nil {
+		return time.Time{}, err
+	}
+	if out.ExpireTimeMs < 0 {
+		return time.Time{}, nil
+	}
+	return time.UnixMilli(out.ExpireTimeMs), nil
+}
@@ -0,0 +1,6 @@
+// Package gocachepb holds the gRPC service definition of the server and the
+// code generated from it. Most programs should use it through
+// gocache.WithGRPC rather than directly.
+package gocachepb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative gocache.proto
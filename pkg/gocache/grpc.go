@@ -0,0 +1,515 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	pb "github.com/dhanushcrueiso/coding-test/pkg/gocache/gocachepb"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrNoGRPC is returned by calls that only the gRPC transport supports,
+// such as Publish, on a client made without WithGRPC
+var ErrNoGRPC = errors.New("gocache: this call needs the gRPC transport, see WithGRPC")
+
+// WithGRPC sends the calls the gRPC service covers, those on strings,
+// lists, TTLs and keys, to the server's gRPC port at target, e.g.
+// "localhost:50051", instead of BaseURL. Other calls still use HTTP. The
+// TLS options apply to both; without them the gRPC connection is not
+// encrypted. Close the client when done with it.
+func WithGRPC(target string, opts ...grpc.DialOption) Option {
+	return func(c *Client) {
+		c.rpc = &rpcTransport{target: target, opts: opts}
+	}
+}
+
+// rpcTransport is the gRPC connection of a client
+type rpcTransport struct {
+	target string
+	opts   []grpc.DialOption
+	conn   *grpc.ClientConn
+	cache  pb.CacheClient
+	// err is why the connection could not be set up. Every call returns it.
+	err error
+}
+
+func (c *Client) dialGRPC() {
+	if c.rpc == nil {
+		return
+	}
+	creds := insecure.NewCredentials()
+	if c.tls != nil {
+		creds = credentials.NewTLS(c.tls)
+	}
+	opts := append([]grpc.DialOption{grpc.WithTransportCredentials(creds)}, c.rpc.opts...)
+	c.rpc.conn, c.rpc.err = grpc.NewClient(c.rpc.target, opts...)
+	if c.rpc.err == nil {
+		c.rpc.cache = pb.NewCacheClient(c.rpc.conn)
+	}
+}
+
+// Close closes the gRPC connection of a client made with WithGRPC, which
+// clients returned by WithNamespace share. It does nothing otherwise.
+func (c *Client) Close() error {
+	if c.rpc == nil || c.rpc.conn == nil {
+		return nil
+	}
+	return c.rpc.conn.Close()
+}
+
+// rpcContext adds the client's credentials and namespace to ctx
+func (c *Client) rpcContext(ctx context.Context) context.Context {
+	var md []string
+	if c.auth != "" {
+		md = append(md, "authorization", c.auth)
+	}
+	if c.namespace != "" {
+		md = append(md, NamespaceHeader, c.namespace)
+	}
+	return metadata.AppendToOutgoingContext(ctx, md...)
+}
+
+// call runs one unary call with the client's timeout, reports it to the
+// request hooks and converts its error into an *Error
+func (c *Client) call(method string, fn func(ctx context.Context, cache pb.CacheClient) error) error {
+	if c.rpc.err != nil {
+		return c.rpc.err
+	}
+	ctx := c.rpcContext(context.Background())
+	if c.client.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.client.Timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	err := rpcError(fn(ctx, c.rpc.cache))
+	info := RequestInfo{Method: "GRPC", Path: method, Duration: time.Since(start), Err: err}
+	for _, fn := range c.hooks {
+		fn(info)
+	}
+	return err
+}
+
+// rpcCodes names the gRPC status codes of errors without an error code,
+// such as connection failures
+var rpcCodes = map[codes.Code]string{
+	codes.InvalidArgument:   "INVALID_ARGUMENT",
+	codes.Unauthenticated:   "UNAUTHENTICATED",
+	codes.PermissionDenied:  "PERMISSION_DENIED",
+	codes.NotFound:          "NOT_FOUND",
+	codes.ResourceExhausted: "RATE_LIMITED",
+	codes.Unavailable:       "UNAVAILABLE",
+	codes.DeadlineExceeded:  "UNAVAILABLE",
+}
+
+// rpcError turns a gRPC status into an *Error with the server's error code
+func rpcError(err error) error {
+	if err == nil {
+		return nil
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	e := &Error{Code: rpcCodes[st.Code()], Message: st.Message()}
+	if e.Code == "" {
+		e.Code = "INTERNAL"
+	}
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok && info.Domain == "gocache" {
+			e.Code = info.Reason
+		}
+	}
+	return e
+}
+
+func (c *Client) rpcValue(method string, fn func(context.Context, pb.CacheClient) (*pb.ValueResponse, error)) (string, error) {
+	var value []byte
+	err := c.call(method, func(ctx context.Context, cache pb.CacheClient) error {
+		resp, err := fn(ctx, cache)
+		value = resp.GetValue()
+		return err
+	})
+	return string(value), err
+}
+
+func (c *Client) rpcGet(key string) (string, error) {
+	return c.rpcValue(pb.Cache_Get_FullMethodName, func(ctx context.Context, cache pb.CacheClient) (*pb.ValueResponse, error) {
+		return cache.Get(ctx, &pb.KeyRequest{Key: []byte(key)})
+	})
+}
+
+func (c *Client) rpcGetEx(key string, opts GetExOptions) (string, error) {
+	req := &pb.GetExRequest{Key: []byte(key), TtlMs: rpcMillis(opts.TTL), ExpireAtMs: rpcTime(opts.ExpireAt), Persist: opts.Persist}
+	return c.rpcValue(pb.Cache_GetEx_FullMethodName, func(ctx context.Context, cache pb.CacheClient) (*pb.ValueResponse, error) {
+		return cache.GetEx(ctx, req)
+	})
+}
+
+func (c *Client) rpcGetDel(key string) (string, error) {
+	return c.rpcValue(pb.Cache_GetDel_FullMethodName, func(ctx context.Context, cache pb.CacheClient) (*pb.ValueResponse, error) {
+		return cache.GetDel(ctx, &pb.KeyRequest{Key: []byte(key)})
+	})
+}
+
+func (c *Client) rpcSet(key, value string, opts SetOptions) (SetResult, error) {
+	req := &pb.SetRequest{
+		Key:        []byte(key),
+		Value:      []byte(value),
+		Nx:         opts.NX,
+		Xx:         opts.XX,
+		Get:        opts.Get,
+		KeepTtl:    opts.KeepTTL,
+		TtlMs:      rpcMillis(opts.TTL),
+		ExpireAtMs: rpcTime(opts.ExpireAt),
+	}
+	var res SetResult
+	err := c.call(pb.Cache_Set_FullMethodName, func(ctx context.Context, cache pb.CacheClient) error {
+		resp, err := cache.Set(ctx, req)
+		res = SetResult{Set: resp.GetSet(), Old: string(resp.GetOld()), Existed: resp.GetExisted()}
+		return err
+	})
+	return res, err
+}
+
+func (c *Client) rpcUpdate(key, value string) error {
+	return c.call(pb.Cache_Update_FullMethodName, func(ctx context.Context, cache pb.CacheClient) error {
+		_, err := cache.Update(ctx, &pb.UpdateRequest{Key: []byte(key), Value: []byte(value)})
+		return err
+	})
+}
+
+// rpcDelete fails with ErrNotFound for a missing key, like the HTTP routes
+func (c *Client) rpcDelete(key string) error {
+	var deleted bool
+	err := c.call(pb.Cache_Delete_FullMethodName, func(ctx context.Context, cache pb.CacheClient) error {
+		resp, err := cache.Delete(ctx, &pb.KeyRequest{Key: []byte(key)})
+		deleted = resp.GetDeleted()
+		return err
+	})
+	if err == nil && !deleted {
+		return &Error{Code: "NOT_FOUND", Message: "key not found"}
+	}
+	return err
+}
+
+func (c *Client) rpcCreateList(key string, ttl time.Duration) error {
+	return c.call(pb.Cache_CreateList_FullMethodName, func(ctx context.Context, cache pb.CacheClient) error {
+		_, err := cache.CreateList(ctx, &pb.CreateListRequest{Key: []byte(key), TtlMs: rpcMillis(ttl)})
+		return err
+	})
+}
+
+func (c *Client) rpcGetList(key string) ([]string, error) {
+	var list []string
+	err := c.call(pb.Cache_GetList_FullMethodName, func(ctx context.Context, cache pb.CacheClient) error {
+		resp, err := cache.GetList(ctx, &pb.KeyRequest{Key: []byte(key)})
+		for _, v := range resp.GetValues() {
+			list = append(list, string(v))
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []string{}
+	}
+	return list, nil
+}
+
+func (c *Client) rpcPush(key, value string) error {
+	return c.call(pb.Cache_Push_FullMethodName, func(ctx context.Context, cache pb.CacheClient) error {
+		_, err := cache.Push(ctx, &pb.PushRequest{Key: []byte(key), Value: []byte(value)})
+		return err
+	})
+}
+
+func (c *Client) rpcPop(key string) (string, error) {
+	return c.rpcValue(pb.Cache_Pop_FullMethodName, func(ctx context.Context, cache pb.CacheClient) (*pb.ValueResponse, error) {
+		return cache.Pop(ctx, &pb.KeyRequest{Key: []byte(key)})
+	})
+}
+
+func (c *Client) rpcGetTTL(key string) (time.Duration, error) {
+	var ms int64
+	err := c.call(pb.Cache_GetTTL_FullMethodName, func(ctx context.Context, cache pb.CacheClient) error {
+		resp, err := cache.GetTTL(ctx, &pb.KeyRequest{Key: []byte(key)})
+		ms = resp.GetTtlMs()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if ms < 0 {
+		return -1, nil
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+func (c *Client) rpcExpire(key string, ttl time.Duration, at time.Time, opts ExpireOptions) (bool, error) {
+	req := &pb.ExpireRequest{
+		Key:   []byte(key),
+		TtlMs: rpcMillis(ttl),
+		AtMs:  rpcTime(at),
+		Nx:    opts.NX,
+		Xx:    opts.XX,
+		Gt:    opts.GT,
+		Lt:    opts.LT,
+	}
+	var updated bool
+	err := c.call(pb.Cache_Expire_FullMethodName, func(ctx context.Context, cache pb.CacheClient) error {
+		resp, err := cache.Expire(ctx, req)
+		updated = resp.GetUpdated()
+		return err
+	})
+	return updated, err
+}
+
+func (c *Client) rpcPersist(key string) (bool, error) {
+	var updated bool
+	err := c.call(pb.Cache_Persist_FullMethodName, func(ctx context.Context, cache pb.CacheClient) error {
+		resp, err := cache.Persist(ctx, &pb.KeyRequest{Key: []byte(key)})
+		updated = resp.GetUpdated()
+		return err
+	})
+	return updated, err
+}
+
+func (c *Client) rpcExpireTime(key string) (time.Time, error) {
+	var ms int64
+	err := c.call(pb.Cache_ExpireTime_FullMethodName, func(ctx context.Context, cache pb.CacheClient) error {
+		resp, err := cache.ExpireTime(ctx, &pb.KeyRequest{Key: []byte(key)})
+		ms = resp.GetExpireAtMs()
+		return err
+	})
+	if err != nil || ms < 0 {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(ms), nil
+}
+
+func (c *Client) rpcDBSize() (int, error) {
+	var n int64
+	err := c.call(pb.Cache_DBSize_FullMethodName, func(ctx context.Context, cache pb.CacheClient) error {
+		resp, err := cache.DBSize(ctx, &pb.DBSizeRequest{})
+		n = resp.GetKeys()
+		return err
+	})
+	return int(n), err
+}
+
+// rpcMillis rounds a TTL up to whole milliseconds, as over HTTP
+func rpcMillis(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return ttlMillis(ttl)
+}
+
+func rpcTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	if ms := t.UnixMilli(); ms > 0 {
+		return ms
+	}
+	return 1
+}
+
+// Type returns the data type of key, e.g. "string" or "list". It needs
+// the gRPC transport.
+func (c *Client) Type(key string) (string, error) {
+	if c.rpc == nil {
+		return "", ErrNoGRPC
+	}
+	var t string
+	err := c.call(pb.Cache_Type_FullMethodName, func(ctx context.Context, cache pb.CacheClient) error {
+		resp, err := cache.Type(ctx, &pb.KeyRequest{Key: []byte(key)})
+		t = resp.GetType()
+		return err
+	})
+	return t, err
+}
+
+// Publish sends message to the subscribers of channel and returns how
+// many received it. Channels are shared by all namespaces. It needs the
+// gRPC transport.
+func (c *Client) Publish(channel, message string) (int, error) {
+	if c.rpc == nil {
+		return 0, ErrNoGRPC
+	}
+	var n int64
+	err := c.call(pb.Cache_Publish_FullMethodName, func(ctx context.Context, cache pb.CacheClient) error {
+		resp, err := cache.Publish(ctx, &pb.PublishRequest{Channel: channel, Message: []byte(message)})
+		n = resp.GetReceivers()
+		return err
+	})
+	return int(n), err
+}
+
+// PubSubMessage is a message received by a Subscription
+type PubSubMessage struct {
+	Channel string
+	// Pattern is the pattern that matched Channel, empty for a
+	// subscription to the channel itself
+	Pattern string
+	Payload string
+}
+
+// Subscription receives the messages of the channels it was made for
+type Subscription struct {
+	stream pb.Cache_SubscribeClient
+	cancel context.CancelFunc
+}
+
+// Subscribe receives the messages published to the channels until ctx is
+// done or the subscription is closed. It returns once the server has
+// subscribed, so messages published after that are not missed. It needs
+// the gRPC transport.
+func (c *Client) Subscribe(ctx context.Context, channels ...string) (*Subscription, error) {
+	return c.subscribe(ctx, &pb.SubscribeRequest{Channels: channels})
+}
+
+// PSubscribe is Subscribe for channels matching glob patterns such as
+// "news.*"
+func (c *Client) PSubscribe(ctx context.Context, patterns ...string) (*Subscription, error) {
+	return c.subscribe(ctx, &pb.SubscribeRequest{Patterns: patterns})
+}
+
+func (c *Client) subscribe(ctx context.Context, req *pb.SubscribeRequest) (*Subscription, error) {
+	if c.rpc == nil {
+		return nil, ErrNoGRPC
+	}
+	if c.rpc.err != nil {
+		return nil, c.rpc.err
+	}
+	ctx, cancel := context.WithCancel(c.rpcContext(ctx))
+	stream, err := c.rpc.cache.Subscribe(ctx, req)
+	if err == nil {
+		err = waitHeader(stream, &pb.Message{})
+	}
+	if err != nil {
+		cancel()
+		return nil, rpcError(err)
+	}
+	return &Subscription{stream: stream, cancel: cancel}, nil
+}
+
+// waitHeader waits for the server to accept a stream. A stream the server
+// rejects has no header, and its error is only seen on the first receive.
+func waitHeader(stream grpc.ClientStream, first proto.Message) error {
+	md, err := stream.Header()
+	if err != nil {
+		return err
+	}
+	if md == nil {
+		return stream.RecvMsg(first)
+	}
+	return nil
+}
+
+// Receive waits for the next message. It returns io.EOF once the
+// subscription ends.
+func (s *Subscription) Receive() (PubSubMessage, error) {
+	msg, err := s.stream.Recv()
+	if err != nil {
+		return PubSubMessage{}, streamError(err)
+	}
+	return PubSubMessage{Channel: msg.Channel, Pattern: msg.Pattern, Payload: string(msg.Payload)}, nil
+}
+
+// Close ends the subscription
+func (s *Subscription) Close() {
+	s.cancel()
+}
+
+// streamError reports the end of a stream, including one cancelled by the
+// client, as io.EOF
+func streamError(err error) error {
+	if errors.Is(err, io.EOF) || status.Code(err) == codes.Canceled {
+		return io.EOF
+	}
+	return rpcError(err)
+}
+
+// MonitorEvent is a command the server ran, as reported by MONITOR
+type MonitorEvent struct {
+	Time   time.Time
+	Client string
+	User   string
+	// Method is the HTTP method, or "GRPC" for gRPC calls
+	Method string
+	// Route is the HTTP route, or the full gRPC method name
+	Route string
+	DB    string
+	Key   string
+	Args  []string
+	// Status is the HTTP status, or its equivalent for gRPC calls
+	Status   int
+	Duration time.Duration
+}
+
+// Monitor streams every command the server runs
+type Monitor struct {
+	stream pb.Cache_MonitorClient
+	cancel context.CancelFunc
+}
+
+// Monitor starts receiving the commands the server runs, over HTTP or
+// gRPC, until ctx is done or the monitor is closed. It needs the gRPC
+// transport and the admin category.
+func (c *Client) Monitor(ctx context.Context) (*Monitor, error) {
+	if c.rpc == nil {
+		return nil, ErrNoGRPC
+	}
+	if c.rpc.err != nil {
+		return nil, c.rpc.err
+	}
+	ctx, cancel := context.WithCancel(c.rpcContext(ctx))
+	stream, err := c.rpc.cache.Monitor(ctx, &pb.MonitorRequest{})
+	if err == nil {
+		err = waitHeader(stream, &pb.CommandEvent{})
+	}
+	if err != nil {
+		cancel()
+		return nil, rpcError(err)
+	}
+	return &Monitor{stream: stream, cancel: cancel}, nil
+}
+
+// Next waits for the next command. It returns io.EOF once the monitor
+// ends.
+func (m *Monitor) Next() (MonitorEvent, error) {
+	e, err := m.stream.Recv()
+	if err != nil {
+		return MonitorEvent{}, streamError(err)
+	}
+	return MonitorEvent{
+		Time:     time.UnixMicro(e.TimeUnixMicros),
+		Client:   e.Client,
+		User:     e.User,
+		Method:   e.Method,
+		Route:    e.Route,
+		DB:       e.Db,
+		Key:      string(e.Key),
+		Args:     e.Args,
+		Status:   int(e.Status),
+		Duration: time.Duration(e.DurationUs) * time.Microsecond,
+	}, nil
+}
+
+// Close stops the monitor
+func (m *Monitor) Close() {
+	m.cancel()
+}
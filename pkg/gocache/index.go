@@ -0,0 +1,101 @@
+package gocache
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+)
+
+// IndexField is a field of an index: the values a JSON path selects in
+// each document, indexed as "tag", "numeric" or "text"
+type IndexField struct {
+	Name string `json:"name"`
+	// Path is the JSON path of the values, $.<name> by default
+	Path string `json:"path,omitempty"`
+	Type string `json:"type"`
+}
+
+// Index defines a secondary index over the JSON keys under Prefixes. Only
+// JSON documents are indexed; keys of other types are left out.
+type Index struct {
+	Name     string       `json:"name"`
+	Prefixes []string     `json:"prefixes,omitempty"`
+	Fields   []IndexField `json:"fields"`
+	// Docs is the number of keys the index holds, set by GetIndex
+	Docs int `json:"docs,omitempty"`
+}
+
+// QueryOptions are the ordering, paging and grouping of Query
+type QueryOptions struct {
+	// SortBy is a field to order keys by, or a group field or reducer to
+	// order groups by
+	SortBy string `json:"sort_by,omitempty"`
+	Desc   bool   `json:"desc,omitempty"`
+	Offset int    `json:"offset,omitempty"`
+	// Limit is the most keys or groups to return, 10 if zero. Use -1 to
+	// only count them.
+	Limit   int       `json:"-"`
+	GroupBy []string  `json:"group_by,omitempty"`
+	Reduce  []Reducer `json:"reduce,omitempty"`
+}
+
+// Reducer computes a value for each group: count, count_distinct, sum,
+// avg, min or max of a field
+type Reducer struct {
+	Op    string `json:"op"`
+	Field string `json:"field,omitempty"`
+	As    string `json:"as,omitempty"`
+}
+
+// QueryResult is what Query returns. Total counts every matching key, or
+// every group, before paging.
+type QueryResult struct {
+	Total  int                      `json:"total"`
+	Docs   []QueryDoc               `json:"docs"`
+	Groups []map[string]interface{} `json:"groups"`
+}
+
+// QueryDoc is a key a query found and its document
+type QueryDoc struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+func indexPath(name string) string {
+	return apiPrefix + "/indexes/" + url.PathEscape(name)
+}
+
+// CreateIndex defines an index and indexes the keys it covers
+func (c *Client) CreateIndex(index Index) error {
+	return c.do(http.MethodPost, indexPath(index.Name), index, nil)
+}
+
+// GetIndex returns the definition and size of an index
+func (c *Client) GetIndex(name string) (Index, error) {
+	var out Index
+	err := c.do(http.MethodGet, indexPath(name), nil, &out)
+	return out, err
+}
+
+// DropIndex deletes an index, keeping its keys
+func (c *Client) DropIndex(name string) error {
+	return c.do(http.MethodDelete, indexPath(name), nil, nil)
+}
+
+// Query finds keys of an index, e.g. "@user_id:{42} @age:[18 +inf]"
+func (c *Client) Query(index, query string, opts QueryOptions) (QueryResult, error) {
+	in := struct {
+		QueryOptions
+		Query string `json:"query"`
+		Limit *int   `json:"limit,omitempty"`
+	}{QueryOptions: opts, Query: query}
+	switch {
+	case opts.Limit < 0:
+		in.Limit = new(int)
+	case opts.Limit > 0:
+		in.Limit = &opts.Limit
+	}
+	var out QueryResult
+	err := c.do(http.MethodPost, indexPath(index)+"/query", in, &out)
+	return out, err
+}
@@ -0,0 +1,119 @@
+package gocache
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Info is the result of Client.Info. Sections that were not requested are
+// nil.
+type Info struct {
+	Server      *ServerInfo      `json:"server"`
+	Clients     *ClientsInfo     `json:"clients"`
+	Stats       *StatsInfo       `json:"stats"`
+	Memory      *MemoryInfo      `json:"memory"`
+	Keyspace    *KeyspaceInfo    `json:"keyspace"`
+	Persistence *PersistenceInfo `json:"persistence"`
+	Replication *ReplicationInfo `json:"replication"`
+}
+
+type ServerInfo struct {
+	Version       string    `json:"version"`
+	GoVersion     string    `json:"go_version"`
+	OS            string    `json:"os"`
+	ProcessID     int       `json:"process_id"`
+	StartedAt     time.Time `json:"started_at"`
+	UptimeSeconds int64     `json:"uptime_seconds"`
+}
+
+// Uptime returns how long the server has been running
+func (s *ServerInfo) Uptime() time.Duration {
+	return time.Duration(s.UptimeSeconds) * time.Second
+}
+
+type ClientsInfo struct {
+	ConnectedClients int `json:"connected_clients"`
+}
+
+type StatsInfo struct {
+	TotalCommandsProcessed     int64     `json:"total_commands_processed"`
+	ExpiredKeys                int64     `json:"expired_keys"`
+	EvictedKeys                int64     `json:"evicted_keys"`
+	LastCleanup                time.Time `json:"last_cleanup"`
+	LastCleanupDurationSeconds float64   `json:"last_cleanup_duration_seconds"`
+}
+
+// LastCleanupDuration returns how long the last expiry cleanup took
+func (s *StatsInfo) LastCleanupDuration() time.Duration {
+	return seconds(s.LastCleanupDurationSeconds)
+}
+
+type MemoryInfo struct {
+	UsedMemory     int64  `json:"used_memory"`
+	MaxMemory      int64  `json:"max_memory"`
+	EvictionPolicy string `json:"eviction_policy"`
+	HeapAlloc      uint64 `json:"heap_alloc"`
+	HeapSys        uint64 `json:"heap_sys"`
+}
+
+type KeyspaceInfo struct {
+	Keys          int            `json:"keys"`
+	KeysByType    map[string]int `json:"keys_by_type"`
+	Expires       int            `json:"expires"`
+	AvgTTLSeconds float64        `json:"avg_ttl_seconds"`
+	// Namespaces lists every namespace holding keys
+	Namespaces []NamespaceInfo `json:"namespaces"`
+}
+
+type NamespaceInfo struct {
+	Name string `json:"name"`
+	Keys int    `json:"keys"`
+}
+
+// AvgTTL returns the mean remaining TTL of keys that have one
+func (k *KeyspaceInfo) AvgTTL() time.Duration {
+	return seconds(k.AvgTTLSeconds)
+}
+
+type PersistenceInfo struct {
+	Enabled       bool      `json:"enabled"`
+	File          string    `json:"file"`
+	LastSave      time.Time `json:"last_save"`
+	LastSaveOK    bool      `json:"last_save_ok"`
+	LastSaveError string    `json:"last_save_error"`
+}
+
+type ReplicationInfo struct {
+	// Mode is "standalone" or "raft"; the other fields are only set in
+	// raft mode
+	Mode          string `json:"mode"`
+	NodeID        string `json:"node_id"`
+	Role          string `json:"role"`
+	Term          uint64 `json:"term"`
+	LeaderID      string `json:"leader_id"`
+	CommitIndex   uint64 `json:"commit_index"`
+	LastApplied   uint64 `json:"last_applied"`
+	SnapshotIndex uint64 `json:"snapshot_index"`
+	Members       int    `json:"members"`
+}
+
+// Info fetches server information. With no sections every section is
+// returned; otherwise only the named ones, e.g. "memory", "keyspace".
+func (c *Client) Info(sections ...string) (*Info, error) {
+	path := apiPrefix + "/info"
+	if len(sections) > 0 {
+		path += "?section=" + url.QueryEscape(strings.Join(sections, ","))
+	}
+
+	var info Info
+	if err := c.do(http.MethodGet, path, nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,170 @@
+package gocache
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+)
+
+// JSON documents are stored parsed, so parts of them can be read and
+// changed by path. Paths are JSONPath, e.g. "$.items[0].name", and may
+// select several values; calls on a path return one result per value, in
+// document order, with nil where the value has the wrong type. An empty
+// path is the root.
+
+// JSONSetOptions are the conditions of JSONSetWithOptions
+type JSONSetOptions struct {
+	// NX only sets the path if it does not exist, XX only if it does
+	NX bool
+	XX bool
+}
+
+func jsonPath(key, op, path string, q url.Values) string {
+	p := apiPrefix + "/json/" + url.PathEscape(key)
+	if op != "" {
+		p += "/" + op
+	}
+	if path != "" {
+		if q == nil {
+			q = url.Values{}
+		}
+		q.Set("path", path)
+	}
+	return p + encodeQuery(q)
+}
+
+// JSONSet stores value, encoded as JSON, at path in the document under
+// key. A new document is created by setting the root.
+func (c *Client) JSONSet(key, path string, value interface{}) error {
+	_, err := c.JSONSetWithOptions(key, path, value, JSONSetOptions{})
+	return err
+}
+
+// JSONSetWithOptions is JSONSet under the conditions in opts. It reports
+// whether the value was set.
+func (c *Client) JSONSetWithOptions(key, path string, value interface{}, opts JSONSetOptions) (bool, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+	q := url.Values{}
+	if opts.NX {
+		q.Set("nx", "true")
+	}
+	if opts.XX {
+		q.Set("xx", "true")
+	}
+	in := struct {
+		Value json.RawMessage `json:"value"`
+	}{data}
+	var out struct {
+		Set bool `json:"set"`
+	}
+	if err := c.do(http.MethodPost, jsonPath(key, "", path, q), in, &out); err != nil {
+		return false, err
+	}
+	return out.Set, nil
+}
+
+// JSONGet decodes the document under key into out
+func (c *Client) JSONGet(key string, out interface{}) error {
+	var result struct {
+		Value json.RawMessage `json:"value"`
+	}
+	if err := c.do(http.MethodGet, jsonPath(key, "", "", nil), nil, &result); err != nil {
+		return err
+	}
+	return json.Unmarshal(result.Value, out)
+}
+
+// JSONGetPath decodes the values path selects in the document under key
+// into out, which should point to a slice
+func (c *Client) JSONGetPath(key, path string, out interface{}) error {
+	var result struct {
+		Values json.RawMessage `json:"values"`
+	}
+	if err := c.do(http.MethodGet, jsonPath(key, "", path, nil), nil, &result); err != nil {
+		return err
+	}
+	return json.Unmarshal(result.Values, out)
+}
+
+// JSONDel deletes the values path selects, or the whole document for the
+// root, and returns how many it deleted
+func (c *Client) JSONDel(key, path string) (int, error) {
+	var out struct {
+		Deleted int `json:"deleted"`
+	}
+	err := c.do(http.MethodDelete, jsonPath(key, "", path, nil), nil, &out)
+	return out.Deleted, err
+}
+
+// JSONNumIncrBy adds by to the numbers path selects and returns their new
+// values
+func (c *Client) JSONNumIncrBy(key, path string, by float64) ([]*float64, error) {
+	in := struct {
+		By float64 `json:"by"`
+	}{by}
+	var out struct {
+		Values []*float64 `json:"values"`
+	}
+	err := c.do(http.MethodPost, jsonPath(key, "numincrby", path, nil), in, &out)
+	return out.Values, err
+}
+
+// JSONArrAppend appends values, encoded as JSON, to the arrays path
+// selects and returns their new lengths
+func (c *Client) JSONArrAppend(key, path string, values ...interface{}) ([]*int, error) {
+	in := struct {
+		Values []interface{} `json:"values"`
+	}{values}
+	var out struct {
+		Lengths []*int `json:"lengths"`
+	}
+	err := c.do(http.MethodPost, jsonPath(key, "arrappend", path, nil), in, &out)
+	return out.Lengths, err
+}
+
+// JSONArrPop removes the element at index, counting from the end if
+// negative, from the arrays path selects and decodes the removed elements
+// into out, which should point to a slice
+func (c *Client) JSONArrPop(key, path string, index int, out interface{}) error {
+	in := struct {
+		Index int `json:"index"`
+	}{index}
+	var result struct {
+		Values json.RawMessage `json:"values"`
+	}
+	if err := c.do(http.MethodPost, jsonPath(key, "arrpop", path, nil), in, &result); err != nil {
+		return err
+	}
+	return json.Unmarshal(result.Values, out)
+}
+
+// JSONStrLen returns the lengths in bytes of the strings path selects
+func (c *Client) JSONStrLen(key, path string) ([]*int, error) {
+	var out struct {
+		Lengths []*int `json:"lengths"`
+	}
+	err := c.do(http.MethodGet, jsonPath(key, "strlen", path, nil), nil, &out)
+	return out.Lengths, err
+}
+
+// JSONObjKeys returns the member names of the objects path selects
+func (c *Client) JSONObjKeys(key, path string) ([][]string, error) {
+	var out struct {
+		Keys [][]string `json:"keys"`
+	}
+	err := c.do(http.MethodGet, jsonPath(key, "objkeys", path, nil), nil, &out)
+	return out.Keys, err
+}
+
+// JSONType returns the types of the values path selects: object, array,
+// string, integer, number, boolean or null
+func (c *Client) JSONType(key, path string) ([]string, error) {
+	var out struct {
+		Types []string `json:"types"`
+	}
+	err := c.do(http.MethodGet, jsonPath(key, "type", path, nil), nil, &out)
+	return out.Types, err
+}
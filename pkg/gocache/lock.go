@@ -0,0 +1,282 @@
+package gocache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrLockHeld is returned when another owner holds a lock
+	ErrLockHeld = errors.New("lock is held by another owner")
+	// ErrLockNotHeld is returned when releasing or extending a lock the
+	// owner no longer holds, usually because its lease ran out
+	ErrLockNotHeld = errors.New("lock is not held by this owner")
+)
+
+// Lock is a lock held on the server. Token is its fencing token: it grows
+// with every acquisition, so a resource that remembers the largest token
+// it has seen can reject writes from an owner that lost the lock.
+type Lock struct {
+	Key       string    `json:"-"`
+	Owner     string    `json:"owner"`
+	Token     uint64    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func lockPath(key string) string {
+	return apiPrefix + "/lock/" + url.PathEscape(key)
+}
+
+type lockBody struct {
+	Owner  string `json:"owner,omitempty"`
+	TTLMs  int64  `json:"ttl_ms,omitempty"`
+	WaitMs int64  `json:"wait_ms,omitempty"`
+}
+
+func lockErr(err, conflict error) error {
+	if hasCode(err, "CONFLICT") {
+		return conflict
+	}
+	return err
+}
+
+// AcquireLock takes a lock for ttl. Owner identifies the holder and is
+// needed to release or extend the lock; if empty the server generates one.
+// If another owner holds the lock it waits up to wait, which must stay
+// below the client timeout, and then fails with ErrLockHeld.
+func (c *Client) AcquireLock(key, owner string, ttl, wait time.Duration) (Lock, error) {
+	return c.acquireLock(context.Background(), key, owner, ttl, wait)
+}
+
+// acquireLock is AcquireLock giving up when ctx is done
+func (c *Client) acquireLock(ctx context.Context, key, owner string, ttl, wait time.Duration) (Lock, error) {
+	in := lockBody{owner, ttl.Milliseconds(), wait.Milliseconds()}
+	l := Lock{Key: key}
+	if err := c.doContext(ctx, http.MethodPost, lockPath(key), in, &l); err != nil {
+		return Lock{}, lockErr(err, ErrLockHeld)
+	}
+	return l, nil
+}
+
+// ReleaseLock frees a lock held by owner
+func (c *Client) ReleaseLock(key, owner string) error {
+	return lockErr(c.do(http.MethodDelete, lockPath(key), lockBody{Owner: owner}, nil), ErrLockNotHeld)
+}
+
+// ExtendLock renews a lock held by owner to ttl from now
+func (c *Client) ExtendLock(key, owner string, ttl time.Duration) (Lock, error) {
+	return c.extendLock(context.Background(), key, owner, ttl)
+}
+
+// extendLock is ExtendLock giving up when ctx is done
+func (c *Client) extendLock(ctx context.Context, key, owner string, ttl time.Duration) (Lock, error) {
+	l := Lock{Key: key, Owner: owner}
+	err := c.doContext(ctx, http.MethodPost, lockPath(key)+"/extend", lockBody{Owner: owner, TTLMs: ttl.Milliseconds()}, &l)
+	if err != nil {
+		return Lock{}, lockErr(err, ErrLockNotHeld)
+	}
+	return l, nil
+}
+
+// Mutex is a lock on a server key that renews its lease in the background
+// while held. A Mutex is not reentrant; use one per critical section.
+type Mutex struct {
+	client *Client
+	key    string
+	ttl    time.Duration
+	// Wait is how long each acquire request waits on the server before it
+	// is retried; it must stay below the client timeout
+	Wait time.Duration
+
+	mu     sync.Mutex
+	lock   Lock
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewMutex returns a mutex on key whose lease is ttl. The lease is renewed
+// every ttl/3, so it only runs out if the holder cannot reach the server.
+func (c *Client) NewMutex(key string, ttl time.Duration) *Mutex {
+	return &Mutex{client: c, key: key, ttl: ttl, Wait: 5 * time.Second}
+}
+
+// Lock blocks until the mutex is acquired or ctx is done. It returns a
+// context derived from ctx that is cancelled when the lock is lost or
+// released; work done under the lock should use it. Its deadline is the
+// end of the lease, pushed forward every time the lease is renewed.
+func (m *Mutex) Lock(ctx context.Context) (context.Context, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	owner := hex.EncodeToString(b)
+
+	for {
+		sent := time.Now()
+		l, err := m.client.acquireLock(ctx, m.key, owner, m.ttl, m.Wait)
+		if err == nil && time.Since(sent) > leaseMargin(m.ttl) {
+			// The server may have waited for the lock before granting it,
+			// so the lease is measured from a renewal sent now instead
+			sent = time.Now()
+			if l, err = m.client.extendLock(ctx, m.key, owner, m.ttl); err != nil {
+				m.client.ReleaseLock(m.key, owner)
+				return nil, err
+			}
+		}
+		if err == nil {
+			return m.hold(ctx, l, leaseEnd(sent, m.ttl)), nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if !errors.Is(err, ErrLockHeld) {
+			return nil, err
+		}
+	}
+}
+
+// TryLock acquires the mutex if it is free and fails with ErrLockHeld
+// otherwise
+func (m *Mutex) TryLock() (context.Context, error) {
+	sent := time.Now()
+	l, err := m.client.AcquireLock(m.key, "", m.ttl, 0)
+	if err != nil {
+		return nil, err
+	}
+	return m.hold(context.Background(), l, leaseEnd(sent, m.ttl)), nil
+}
+
+// leaseMargin is how much earlier than the server a holder considers a
+// lease of ttl over, to allow for the clocks running at slightly different
+// rates
+func leaseMargin(ttl time.Duration) time.Duration {
+	return ttl / 10
+}
+
+// leaseEnd is when a lease of ttl requested at sent ends by the local
+// clock. The server starts the lease when the request arrives, after sent,
+// so this is never later than the server's expiry. The ExpiresAt the server
+// returns is not used as it is read off the server's clock, which may be
+// ahead of the local one.
+func leaseEnd(sent time.Time, ttl time.Duration) time.Time {
+	return sent.Add(ttl - leaseMargin(ttl))
+}
+
+// hold starts renewing l and returns the context of the lease, derived
+// from parent, which ends at expires unless renewed
+func (m *Mutex) hold(parent context.Context, l Lock, expires time.Time) context.Context {
+	ctx := newLeaseContext(parent, expires)
+	done := make(chan struct{})
+	m.mu.Lock()
+	m.lock, m.cancel, m.done = l, func() { ctx.cancel(context.Canceled) }, done
+	m.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		defer ctx.stop()
+		ticker := time.NewTicker(m.ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				// Released, or unreachable for so long the lease ran out
+				return
+			case <-ticker.C:
+			}
+			sent := time.Now()
+			_, err := m.client.extendLock(ctx, l.Key, l.Owner, m.ttl)
+			switch {
+			case err == nil:
+				ctx.extend(leaseEnd(sent, m.ttl))
+			case errors.Is(err, ErrLockNotHeld):
+				ctx.cancel(ErrLockNotHeld)
+				return
+			}
+		}
+	}()
+	return ctx
+}
+
+// leaseContext is the context of a held Mutex. It is done when the lease
+// runs out, and its deadline moves with the lease as it is renewed.
+// context.Cause tells a lost lock, ErrLockNotHeld, from a released one.
+type leaseContext struct {
+	context.Context
+	cancel context.CancelCauseFunc
+
+	mu       sync.Mutex
+	deadline time.Time
+	timer    *time.Timer
+}
+
+func newLeaseContext(parent context.Context, expires time.Time) *leaseContext {
+	ctx, cancel := context.WithCancelCause(parent)
+	c := &leaseContext{Context: ctx, cancel: cancel, deadline: expires}
+	c.timer = time.AfterFunc(time.Until(expires), func() {
+		cancel(context.DeadlineExceeded)
+	})
+	return c
+}
+
+// extend moves the deadline to expires, unless the lease already ran out
+func (c *leaseContext) extend(expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timer.Stop() {
+		c.deadline = expires
+		c.timer.Reset(time.Until(expires))
+	}
+}
+
+// stop cancels the context and its timer
+func (c *leaseContext) stop() {
+	c.timer.Stop()
+	c.cancel(context.Canceled)
+}
+
+// Deadline is the end of the lease, or the parent's deadline if earlier
+func (c *leaseContext) Deadline() (time.Time, bool) {
+	c.mu.Lock()
+	deadline := c.deadline
+	c.mu.Unlock()
+	if d, ok := c.Context.Deadline(); ok && d.Before(deadline) {
+		return d, true
+	}
+	return deadline, true
+}
+
+func (c *leaseContext) Err() error {
+	err := c.Context.Err()
+	if err != nil && errors.Is(context.Cause(c.Context), context.DeadlineExceeded) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// Token returns the fencing token of the held lock, or zero
+func (m *Mutex) Token() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lock.Token
+}
+
+// Unlock stops renewing and releases the lock. It returns ErrLockNotHeld
+// if the lock was already lost.
+func (m *Mutex) Unlock() error {
+	m.mu.Lock()
+	l, cancel, done := m.lock, m.cancel, m.done
+	m.lock, m.cancel, m.done = Lock{}, nil, nil
+	m.mu.Unlock()
+	if cancel == nil {
+		return ErrLockNotHeld
+	}
+	cancel()
+	<-done
+	return m.client.ReleaseLock(l.Key, l.Owner)
+}
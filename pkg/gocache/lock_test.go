@@ -0,0 +1,121 @@
+package gocache_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	cache "github.com/dhanushcrueiso/coding-test/pkg/gocache"
+)
+
+func TestMutex(t *testing.T) {
+	httpAddr, _ := serve(t)
+	client := cache.NewClient("http://" + httpAddr)
+	ttl := 300 * time.Millisecond
+
+	first := client.NewMutex("m", ttl)
+	ctx, err := first.Lock(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := first.Token()
+
+	// Renewals keep the lock past its first lease
+	time.Sleep(2 * ttl)
+	if ctx.Err() != nil {
+		t.Fatalf("lock lost while renewing: %v", context.Cause(ctx))
+	}
+	if _, err := client.NewMutex("m", ttl).TryLock(); !errors.Is(err, cache.ErrLockHeld) {
+		t.Fatalf("TryLock of a held mutex: err = %v, want ErrLockHeld", err)
+	}
+
+	second := client.NewMutex("m", ttl)
+	locked := make(chan error, 1)
+	go func() {
+		_, err := second.Lock(context.Background())
+		locked <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if err := first.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(context.Cause(ctx), context.Canceled) {
+		t.Errorf("cause after Unlock = %v, want context.Canceled", context.Cause(ctx))
+	}
+	if err := <-locked; err != nil {
+		t.Fatal(err)
+	}
+	if second.Token() <= token {
+		t.Errorf("second token %d not above first %d", second.Token(), token)
+	}
+	if err := second.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMutexLost(t *testing.T) {
+	httpAddr, _ := serve(t)
+	client := cache.NewClient("http://" + httpAddr)
+	m := client.NewMutex("lost", 150*time.Millisecond)
+	ctx, err := m.Lock(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Remove("lost"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("context not cancelled after the lock was lost")
+	}
+	if !errors.Is(context.Cause(ctx), cache.ErrLockNotHeld) {
+		t.Errorf("cause = %v, want ErrLockNotHeld", context.Cause(ctx))
+	}
+	if err := m.Unlock(); !errors.Is(err, cache.ErrLockNotHeld) {
+		t.Errorf("Unlock of a lost lock: err = %v, want ErrLockNotHeld", err)
+	}
+}
+
+// TestMutexClockSkew runs against a server whose clock is an hour ahead
+// and cannot be reached for renewals. The lease must still end on the
+// local clock, within the TTL.
+func TestMutexClockSkew(t *testing.T) {
+	ttl := 200 * time.Millisecond
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && !strings.HasSuffix(r.URL.Path, "/extend"):
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+				"owner":      "o",
+				"token":      1,
+				"expires_at": time.Now().Add(time.Hour + ttl),
+			}})
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":{"code":"UNAVAILABLE","message":"unavailable"}}`))
+		}
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	ctx, err := cache.NewClient(srv.URL).NewMutex("m", ttl).Lock(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, ok := ctx.Deadline(); !ok || d.After(start.Add(ttl)) {
+		t.Fatalf("deadline %v after the lease of %v, ok %v", d.Sub(start), ttl, ok)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(2 * ttl):
+		t.Fatal("context outlived the lease")
+	}
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		t.Errorf("err = %v, want DeadlineExceeded", ctx.Err())
+	}
+}
@@ -0,0 +1,65 @@
+package gocache
+
+import (
+	"net/http"
+)
+
+// NamespaceHeader selects the namespace a request works on
+const NamespaceHeader = "X-Namespace"
+
+// WithNamespace returns a copy of c whose calls all work on the namespace
+// called name instead of the default one. The copy shares c's connections.
+func (c *Client) WithNamespace(name string) *Client {
+	hc := *c.client
+	next := hc.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	hc.Transport = &namespaceTransport{next: next, name: name}
+
+	scoped := *c
+	scoped.client = &hc
+	scoped.namespace = name
+	return &scoped
+}
+
+type namespaceTransport struct {
+	next http.RoundTripper
+	name string
+}
+
+func (t *namespaceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set(NamespaceHeader, t.name)
+	return t.next.RoundTrip(req)
+}
+
+// DBSize returns the number of keys in the client's namespace
+func (c *Client) DBSize() (int, error) {
+	if c.rpc != nil {
+		return c.rpcDBSize()
+	}
+	var body struct {
+		Keys int `json:"keys"`
+	}
+	err := c.do(http.MethodGet, apiPrefix+"/dbsize", nil, &body)
+	return body.Keys, err
+}
+
+// FlushDB removes every key in the client's namespace and returns how many
+// were removed
+func (c *Client) FlushDB() (int, error) {
+	var body struct {
+		Removed int `json:"removed"`
+	}
+	err := c.do(http.MethodPost, apiPrefix+"/flushdb", nil, &body)
+	return body.Removed, err
+}
+
+// SwapDB exchanges the contents of namespaces a and b
+func (c *Client) SwapDB(a, b string) error {
+	return c.do(http.MethodPost, apiPrefix+"/swapdb", struct {
+		A string `json:"a"`
+		B string `json:"b"`
+	}{a, b}, nil)
+}
@@ -0,0 +1,259 @@
+package gocache
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Message is a message received from a queue. Receipt names the lease and
+// must be passed back to Ack, Nack or ExtendLease.
+type Message struct {
+	Queue      string    `json:"-"`
+	ID         string    `json:"id"`
+	Body       string    `json:"body"`
+	Attempts   int       `json:"attempts"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+	VisibleAt  time.Time `json:"visible_at"`
+	Receipt    string    `json:"receipt"`
+}
+
+// QueueConfig are the settings of a queue. Zero values use the server
+// defaults.
+type QueueConfig struct {
+	// Visibility is how long a received message stays hidden
+	Visibility time.Duration
+	// MaxAttempts is how often a message is delivered before it moves to
+	// DeadLetter; zero delivers it forever
+	MaxAttempts int
+	// DeadLetter is the queue dead messages move to; empty drops them
+	DeadLetter string
+}
+
+// QueueInfo describes a queue
+type QueueInfo struct {
+	QueueConfig
+	Ready    int
+	InFlight int
+	Delayed  int
+}
+
+func queuePath(key string) string {
+	return apiPrefix + "/queue/" + url.PathEscape(key)
+}
+
+func messagePath(key, id string) string {
+	return queuePath(key) + "/messages/" + url.PathEscape(id)
+}
+
+// Enqueue adds a message to a queue, creating it, and returns the message
+// ID. The message is not delivered before delay has passed.
+func (c *Client) Enqueue(key, body string, delay time.Duration) (string, error) {
+	in := struct {
+		Body    string `json:"body"`
+		DelayMs int64  `json:"delay_ms,omitempty"`
+	}{body, delay.Milliseconds()}
+	var out struct {
+		ID string `json:"id"`
+	}
+	err := c.do(http.MethodPost, queuePath(key), in, &out)
+	return out.ID, err
+}
+
+// Receive leases up to count messages for visibility, or the queue's
+// visibility timeout if zero. With no messages ready it waits up to wait,
+// which must stay below the client timeout.
+func (c *Client) Receive(key string, count int, visibility, wait time.Duration) ([]Message, error) {
+	in := struct {
+		Count        int   `json:"count"`
+		VisibilityMs int64 `json:"visibility_ms,omitempty"`
+		WaitMs       int64 `json:"wait_ms,omitempty"`
+	}{count, visibility.Milliseconds(), wait.Milliseconds()}
+	var out struct {
+		Messages []Message `json:"messages"`
+	}
+	if err := c.do(http.MethodPost, queuePath(key)+"/receive", in, &out); err != nil {
+		return nil, err
+	}
+	for i := range out.Messages {
+		out.Messages[i].Queue = key
+	}
+	return out.Messages, nil
+}
+
+// Ack removes a processed message. It fails if the lease already ended,
+// in which case the message may be processed again.
+func (c *Client) Ack(m Message) error {
+	in := struct {
+		Receipt string `json:"receipt"`
+	}{m.Receipt}
+	return c.do(http.MethodPost, messagePath(m.Queue, m.ID)+"/ack", in, nil)
+}
+
+// Nack returns a message to its queue to be delivered again after delay
+func (c *Client) Nack(m Message, delay time.Duration) error {
+	in := struct {
+		Receipt string `json:"receipt"`
+		DelayMs int64  `json:"delay_ms,omitempty"`
+	}{m.Receipt, delay.Milliseconds()}
+	return c.do(http.MethodPost, messagePath(m.Queue, m.ID)+"/nack", in, nil)
+}
+
+// ExtendLease keeps a message hidden for visibility from now
+func (c *Client) ExtendLease(m Message, visibility time.Duration) error {
+	in := struct {
+		Receipt      string `json:"receipt"`
+		VisibilityMs int64  `json:"visibility_ms,omitempty"`
+	}{m.Receipt, visibility.Milliseconds()}
+	return c.do(http.MethodPost, messagePath(m.Queue, m.ID)+"/extend", in, nil)
+}
+
+type queueConfigBody struct {
+	VisibilityMs int64  `json:"visibility_ms"`
+	MaxAttempts  int    `json:"max_attempts"`
+	DeadLetter   string `json:"dead_letter"`
+}
+
+// ConfigureQueue changes the settings of a queue, creating it
+func (c *Client) ConfigureQueue(key string, cfg QueueConfig) error {
+	in := queueConfigBody{cfg.Visibility.Milliseconds(), cfg.MaxAttempts, cfg.DeadLetter}
+	return c.do(http.MethodPut, queuePath(key), in, nil)
+}
+
+// QueueInfo describes a queue
+func (c *Client) QueueInfo(key string) (QueueInfo, error) {
+	var out struct {
+		queueConfigBody
+		Ready    int `json:"ready"`
+		InFlight int `json:"in_flight"`
+		Delayed  int `json:"delayed"`
+	}
+	if err := c.do(http.MethodGet, queuePath(key), nil, &out); err != nil {
+		return QueueInfo{}, err
+	}
+	return QueueInfo{
+		QueueConfig: QueueConfig{
+			Visibility:  time.Duration(out.VisibilityMs) * time.Millisecond,
+			MaxAttempts: out.MaxAttempts,
+			DeadLetter:  out.DeadLetter,
+		},
+		Ready:    out.Ready,
+		InFlight: out.InFlight,
+		Delayed:  out.Delayed,
+	}, nil
+}
+
+// Worker processes the messages of a queue with a fixed number of
+// goroutines. A message is acked when Handler returns nil and nacked
+// otherwise. Its lease is extended while Handler runs, so Handler may take
+// longer than Visibility.
+type Worker struct {
+	Client *Client
+	Queue  string
+	// Handler processes one message. The context is cancelled when the
+	// lease is lost.
+	Handler func(ctx context.Context, m Message) error
+	// Concurrency is how many messages are processed at once; default 1
+	Concurrency int
+	// Visibility is the lease taken on each message; default 30s
+	Visibility time.Duration
+	// Wait is how long each receive waits for a message; default 5s
+	Wait time.Duration
+	// RetryDelay is how long a failed message waits before redelivery
+	RetryDelay time.Duration
+	// OnError is called with errors talking to the server; may be nil
+	OnError func(error)
+}
+
+// Run processes messages until ctx is cancelled, then waits for the
+// handlers that are running to return
+func (w *Worker) Run(ctx context.Context) error {
+	n := w.Concurrency
+	if n <= 0 {
+		n = 1
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.loop(ctx)
+		}()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (w *Worker) visibility() time.Duration {
+	if w.Visibility > 0 {
+		return w.Visibility
+	}
+	return 30 * time.Second
+}
+
+func (w *Worker) loop(ctx context.Context) {
+	wait := w.Wait
+	if wait <= 0 {
+		wait = 5 * time.Second
+	}
+	for ctx.Err() == nil {
+		msgs, err := w.Client.Receive(w.Queue, 1, w.visibility(), wait)
+		if err != nil {
+			w.report(err)
+			// Back off so an unreachable server is not hammered
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		for _, m := range msgs {
+			w.process(ctx, m)
+		}
+	}
+}
+
+// process runs the handler on m, extending the lease at half the
+// visibility timeout until it returns
+func (w *Worker) process(ctx context.Context, m Message) {
+	hctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(w.visibility() / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-hctx.Done():
+				return
+			case <-ticker.C:
+				if err := w.Client.ExtendLease(m, w.visibility()); err != nil {
+					w.report(err)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	err := w.Handler(hctx, m)
+	cancel()
+	<-done
+	if err != nil {
+		err = w.Client.Nack(m, w.RetryDelay)
+	} else {
+		err = w.Client.Ack(m)
+	}
+	if err != nil {
+		w.report(err)
+	}
+}
+
+func (w *Worker) report(err error) {
+	if w.OnError != nil {
+		w.OnError(err)
+	}
+}
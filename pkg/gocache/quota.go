@@ -0,0 +1,34 @@
+package gocache
+
+import (
+	"net/http"
+)
+
+// Limits are the quotas of a namespace. Zero fields are unlimited.
+type Limits struct {
+	MaxKeys           int     `json:"max_keys"`
+	MaxBytes          int64   `json:"max_bytes"`
+	MaxValueSize      int     `json:"max_value_size"`
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	Burst             int     `json:"burst"`
+}
+
+// Usage is the result of Client.Usage
+type Usage struct {
+	Namespace string `json:"name"`
+	Limits    Limits `json:"limits"`
+	Usage     struct {
+		Keys  int   `json:"keys"`
+		Bytes int64 `json:"bytes"`
+	} `json:"usage"`
+}
+
+// Usage returns the quotas of the client's namespace and how much of them
+// is used
+func (c *Client) Usage() (*Usage, error) {
+	var u Usage
+	if err := c.do(http.MethodGet, apiPrefix+"/usage", nil, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
@@ -0,0 +1,89 @@
+package gocache
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// SearchIndex defines a full-text index over the words of the string and
+// JSON keys under Prefixes
+type SearchIndex struct {
+	Name     string   `json:"name"`
+	Prefixes []string `json:"prefixes,omitempty"`
+	// Paths are the JSONPaths of the text in JSON documents, every string
+	// by default
+	Paths []string `json:"paths,omitempty"`
+	// Docs and Terms are the number of keys and distinct words the index
+	// holds, set by GetSearchIndex
+	Docs  int `json:"docs,omitempty"`
+	Terms int `json:"terms,omitempty"`
+}
+
+// SearchOptions are the paging and highlighting of Search
+type SearchOptions struct {
+	Offset int `json:"offset,omitempty"`
+	// Limit is the most keys to return, 10 if zero. Use -1 to only count
+	// them.
+	Limit int `json:"-"`
+	// Highlight returns a fragment of each key's text with the words found
+	// between PreTag and PostTag, <b> and </b> by default
+	Highlight bool   `json:"highlight,omitempty"`
+	PreTag    string `json:"pre_tag,omitempty"`
+	PostTag   string `json:"post_tag,omitempty"`
+}
+
+// SearchResult is what Search returns. Total counts every matching key
+// before paging.
+type SearchResult struct {
+	Total int         `json:"total"`
+	Hits  []SearchHit `json:"hits"`
+}
+
+// SearchHit is a key Search found, its BM25 score and, if asked for, the
+// highlighted fragment of its text
+type SearchHit struct {
+	Key       string  `json:"key"`
+	Score     float64 `json:"score"`
+	Highlight string  `json:"highlight"`
+}
+
+func searchPath(name string) string {
+	return apiPrefix + "/search/" + url.PathEscape(name)
+}
+
+// CreateSearchIndex defines a full-text index and indexes the keys it
+// covers
+func (c *Client) CreateSearchIndex(index SearchIndex) error {
+	return c.do(http.MethodPost, searchPath(index.Name), index, nil)
+}
+
+// GetSearchIndex returns the definition and size of a full-text index
+func (c *Client) GetSearchIndex(name string) (SearchIndex, error) {
+	var out SearchIndex
+	err := c.do(http.MethodGet, searchPath(name), nil, &out)
+	return out, err
+}
+
+// DropSearchIndex deletes a full-text index, keeping its keys
+func (c *Client) DropSearchIndex(name string) error {
+	return c.do(http.MethodDelete, searchPath(name), nil, nil)
+}
+
+// Search finds the keys of a full-text index by their words, best first,
+// e.g. `wireless "noise cancelling" head* -refurbished`
+func (c *Client) Search(index, query string, opts SearchOptions) (SearchResult, error) {
+	in := struct {
+		SearchOptions
+		Query string `json:"query"`
+		Limit *int   `json:"limit,omitempty"`
+	}{SearchOptions: opts, Query: query}
+	switch {
+	case opts.Limit < 0:
+		in.Limit = new(int)
+	case opts.Limit > 0:
+		in.Limit = &opts.Limit
+	}
+	var out SearchResult
+	err := c.do(http.MethodPost, searchPath(index)+"/query", in, &out)
+	return out, err
+}
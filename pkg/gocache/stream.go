@@ -0,0 +1,287 @@
+package gocache
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// StreamEntry is one entry of a stream. IDs have the form "ms-seq".
+type StreamEntry struct {
+	ID     string            `json:"id"`
+	Fields map[string]string `json:"fields"`
+}
+
+// XAddOptions are the options of XAdd
+type XAddOptions struct {
+	// ID is empty to let the server generate one
+	ID string `json:"id,omitempty"`
+	// NoMkStream fails instead of creating a missing stream
+	NoMkStream bool `json:"nomkstream,omitempty"`
+	// MaxLen and MinID trim the stream after the entry is added
+	MaxLen int    `json:"maxlen,omitempty"`
+	MinID  string `json:"minid,omitempty"`
+}
+
+func streamPath(key string) string {
+	return apiPrefix + "/stream/" + url.PathEscape(key)
+}
+
+func groupPath(key, group string) string {
+	return streamPath(key) + "/groups/" + url.PathEscape(group)
+}
+
+type entriesBody struct {
+	Entries []StreamEntry `json:"entries"`
+}
+
+// XAdd appends an entry to a stream and returns its ID
+func (c *Client) XAdd(key string, fields map[string]string, opts XAddOptions) (string, error) {
+	body := struct {
+		XAddOptions
+		Fields map[string]string `json:"fields"`
+	}{opts, fields}
+	var out struct {
+		ID string `json:"id"`
+	}
+	err := c.do(http.MethodPost, streamPath(key), body, &out)
+	return out.ID, err
+}
+
+// XRange returns up to count entries with IDs from start to end, where "-"
+// and "+" are the smallest and largest IDs. A count of zero returns all.
+func (c *Client) XRange(key, start, end string, count int) ([]StreamEntry, error) {
+	return c.xrange(key, start, end, count, false)
+}
+
+// XRevRange is like XRange, newest entry first
+func (c *Client) XRevRange(key, start, end string, count int) ([]StreamEntry, error) {
+	return c.xrange(key, start, end, count, true)
+}
+
+func (c *Client) xrange(key, start, end string, count int, rev bool) ([]StreamEntry, error) {
+	q := url.Values{"start": {start}, "end": {end}, "count": {strconv.Itoa(count)}}
+	if rev {
+		q.Set("rev", "true")
+	}
+	var out entriesBody
+	err := c.do(http.MethodGet, streamPath(key)+"?"+q.Encode(), nil, &out)
+	return out.Entries, err
+}
+
+// XRead returns up to count entries added after the ID after, or "$" for
+// only new entries. With no such entries it waits up to block, which must
+// stay below the client timeout.
+func (c *Client) XRead(key, after string, count int, block time.Duration) ([]StreamEntry, error) {
+	q := url.Values{"after": {after}, "count": {strconv.Itoa(count)},
+		"block": {strconv.FormatInt(block.Milliseconds(), 10)}}
+	var out entriesBody
+	err := c.do(http.MethodGet, streamPath(key)+"/read?"+q.Encode(), nil, &out)
+	return out.Entries, err
+}
+
+// XDel removes entries and returns how many existed
+func (c *Client) XDel(key string, ids ...string) (int, error) {
+	var out struct {
+		Deleted int `json:"deleted"`
+	}
+	err := c.do(http.MethodDelete, streamPath(key)+"/entries", map[string][]string{"ids": ids}, &out)
+	return out.Deleted, err
+}
+
+// XTrim drops the oldest entries beyond maxLen and those below minID, and
+// returns how many were dropped
+func (c *Client) XTrim(key string, maxLen int, minID string) (int, error) {
+	body := map[string]interface{}{"maxlen": maxLen, "minid": minID}
+	var out struct {
+		Trimmed int `json:"trimmed"`
+	}
+	err := c.do(http.MethodPost, streamPath(key)+"/trim", body, &out)
+	return out.Trimmed, err
+}
+
+// StreamInfo is the result of XInfoStream
+type StreamInfo struct {
+	Length       int          `json:"length"`
+	LastID       string       `json:"last_generated_id"`
+	EntriesAdded uint64       `json:"entries_added"`
+	Groups       int          `json:"groups"`
+	FirstEntry   *StreamEntry `json:"first_entry"`
+	LastEntry    *StreamEntry `json:"last_entry"`
+}
+
+func (c *Client) XInfoStream(key string) (*StreamInfo, error) {
+	var out StreamInfo
+	if err := c.do(http.MethodGet, streamPath(key)+"/info", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GroupInfo describes a consumer group
+type GroupInfo struct {
+	Name            string `json:"name"`
+	Consumers       int    `json:"consumers"`
+	Pending         int    `json:"pending"`
+	LastDeliveredID string `json:"last_delivered_id"`
+	Lag             int    `json:"lag"`
+}
+
+func (c *Client) XInfoGroups(key string) ([]GroupInfo, error) {
+	var out struct {
+		Groups []GroupInfo `json:"groups"`
+	}
+	err := c.do(http.MethodGet, streamPath(key)+"/groups", nil, &out)
+	return out.Groups, err
+}
+
+// ConsumerInfo describes a consumer of a group
+type ConsumerInfo struct {
+	Name       string `json:"name"`
+	Pending    int    `json:"pending"`
+	IdleMs     int64  `json:"idle_ms"`
+	InactiveMs int64  `json:"inactive_ms"`
+}
+
+func (c *Client) XInfoConsumers(key, group string) ([]ConsumerInfo, error) {
+	var out struct {
+		Consumers []ConsumerInfo `json:"consumers"`
+	}
+	err := c.do(http.MethodGet, groupPath(key, group)+"/consumers", nil, &out)
+	return out.Consumers, err
+}
+
+// XGroupCreate creates a consumer group that starts after id, or "$" for
+// only new entries. With mkStream a missing stream is created.
+func (c *Client) XGroupCreate(key, group, id string, mkStream bool) error {
+	body := map[string]interface{}{"group": group, "id": id, "mkstream": mkStream}
+	return c.do(http.MethodPost, streamPath(key)+"/groups", body, nil)
+}
+
+func (c *Client) XGroupDestroy(key, group string) error {
+	return c.do(http.MethodDelete, groupPath(key, group), nil, nil)
+}
+
+// XGroupDelConsumer removes a consumer and returns how many entries it had
+// pending
+func (c *Client) XGroupDelConsumer(key, group, consumer string) (int, error) {
+	var out struct {
+		Pending int `json:"pending"`
+	}
+	err := c.do(http.MethodDelete, groupPath(key, group)+"/consumers/"+url.PathEscape(consumer), nil, &out)
+	return out.Pending, err
+}
+
+// XReadGroupOptions are the options of XReadGroup
+type XReadGroupOptions struct {
+	// ID is ">" or empty for entries never delivered to the group, or an
+	// ID to reread the consumer's pending entries after it
+	ID    string
+	Count int
+	// Block waits up to this long for new entries
+	Block time.Duration
+	// NoAck does not track the entries as pending
+	NoAck bool
+}
+
+// XReadGroup reads entries as consumer of group
+func (c *Client) XReadGroup(key, group, consumer string, opts XReadGroupOptions) ([]StreamEntry, error) {
+	body := map[string]interface{}{
+		"consumer": consumer,
+		"id":       opts.ID,
+		"count":    opts.Count,
+		"block_ms": opts.Block.Milliseconds(),
+		"noack":    opts.NoAck,
+	}
+	var out entriesBody
+	err := c.do(http.MethodPost, groupPath(key, group)+"/read", body, &out)
+	return out.Entries, err
+}
+
+// XAck acknowledges entries and returns how many were pending
+func (c *Client) XAck(key, group string, ids ...string) (int, error) {
+	var out struct {
+		Acked int `json:"acked"`
+	}
+	err := c.do(http.MethodPost, groupPath(key, group)+"/ack", map[string][]string{"ids": ids}, &out)
+	return out.Acked, err
+}
+
+// PendingSummary is the result of XPending
+type PendingSummary struct {
+	Count     int            `json:"count"`
+	Min       string         `json:"min"`
+	Max       string         `json:"max"`
+	Consumers map[string]int `json:"consumers"`
+}
+
+func (c *Client) XPending(key, group string) (*PendingSummary, error) {
+	var out PendingSummary
+	if err := c.do(http.MethodGet, groupPath(key, group)+"/pending", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PendingEntry is one entry of a pending list
+type PendingEntry struct {
+	ID         string `json:"id"`
+	Consumer   string `json:"consumer"`
+	IdleMs     int64  `json:"idle_ms"`
+	Deliveries int    `json:"deliveries"`
+}
+
+// XPendingOptions select the entries XPendingRange returns
+type XPendingOptions struct {
+	Start, End string
+	Count      int
+	Consumer   string
+	MinIdle    time.Duration
+}
+
+func (c *Client) XPendingRange(key, group string, opts XPendingOptions) ([]PendingEntry, error) {
+	q := url.Values{"count": {strconv.Itoa(opts.Count)},
+		"min_idle_ms": {strconv.FormatInt(opts.MinIdle.Milliseconds(), 10)}}
+	if opts.Start != "" {
+		q.Set("start", opts.Start)
+	}
+	if opts.End != "" {
+		q.Set("end", opts.End)
+	}
+	if opts.Consumer != "" {
+		q.Set("consumer", opts.Consumer)
+	}
+	var out struct {
+		Pending []PendingEntry `json:"pending"`
+	}
+	err := c.do(http.MethodGet, groupPath(key, group)+"/pending?"+q.Encode(), nil, &out)
+	return out.Pending, err
+}
+
+// XClaim takes over pending entries idle for at least minIdle
+func (c *Client) XClaim(key, group, consumer string, minIdle time.Duration, ids ...string) ([]StreamEntry, error) {
+	body := map[string]interface{}{"consumer": consumer, "min_idle_ms": minIdle.Milliseconds(), "ids": ids}
+	var out entriesBody
+	err := c.do(http.MethodPost, groupPath(key, group)+"/claim", body, &out)
+	return out.Entries, err
+}
+
+// AutoClaimResult is the result of XAutoClaim. Next is "0-0" once the
+// whole pending list was scanned.
+type AutoClaimResult struct {
+	Next    string        `json:"next"`
+	Entries []StreamEntry `json:"entries"`
+	Deleted []string      `json:"deleted"`
+}
+
+// XAutoClaim scans the pending list from start and claims up to count
+// entries idle for at least minIdle
+func (c *Client) XAutoClaim(key, group, consumer string, minIdle time.Duration, start string, count int) (*AutoClaimResult, error) {
+	body := map[string]interface{}{"consumer": consumer, "min_idle_ms": minIdle.Milliseconds(), "start": start, "count": count}
+	var out AutoClaimResult
+	if err := c.do(http.MethodPost, groupPath(key, group)+"/autoclaim", body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,126 @@
+package gocache
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// SetOptions are the conditions and expiration of SetWithOptions
+type SetOptions struct {
+	// NX only sets the key if it does not exist, XX only if it does
+	NX bool
+	XX bool
+	// Get returns the previous value
+	Get bool
+	// KeepTTL keeps the expiration of an existing key
+	KeepTTL bool
+	// TTL expires the key after a duration with millisecond precision,
+	// ExpireAt at a point in time. Set at most one.
+	TTL      time.Duration
+	ExpireAt time.Time
+}
+
+// SetResult is the outcome of SetWithOptions. Old and Existed describe the
+// previous value when SetOptions.Get was given.
+type SetResult struct {
+	Set     bool
+	Old     string
+	Existed bool
+}
+
+func stringPath(key string) string {
+	return apiPrefix + "/strings/" + url.PathEscape(key)
+}
+
+// expiryQuery adds an expiration to q as milliseconds
+func expiryQuery(q url.Values, ttl time.Duration, at time.Time) {
+	if ttl > 0 {
+		q.Set("px", strconv.FormatInt(ttlMillis(ttl), 10))
+	}
+	if !at.IsZero() {
+		q.Set("pxat", strconv.FormatInt(at.UnixMilli(), 10))
+	}
+}
+
+func encodeQuery(q url.Values) string {
+	if len(q) == 0 {
+		return ""
+	}
+	return "?" + q.Encode()
+}
+
+// SetWithOptions stores a string value under the conditions in opts
+func (c *Client) SetWithOptions(key, value string, opts SetOptions) (SetResult, error) {
+	if c.rpc != nil {
+		return c.rpcSet(key, value, opts)
+	}
+	q := url.Values{}
+	for name, on := range map[string]bool{"nx": opts.NX, "xx": opts.XX, "get": opts.Get, "keepttl": opts.KeepTTL} {
+		if on {
+			q.Set(name, "true")
+		}
+	}
+	expiryQuery(q, opts.TTL, opts.ExpireAt)
+
+	in := struct {
+		Value string `json:"value"`
+	}{value}
+	var out struct {
+		Set bool    `json:"set"`
+		Old *string `json:"old"`
+	}
+	if err := c.do(http.MethodPost, stringPath(key)+encodeQuery(q), in, &out); err != nil {
+		return SetResult{}, err
+	}
+	res := SetResult{Set: out.Set}
+	if out.Old != nil {
+		res.Old, res.Existed = *out.Old, true
+	}
+	return res, nil
+}
+
+// SetNX stores value only if key does not exist and reports whether it did
+func (c *Client) SetNX(key, value string, ttl time.Duration) (bool, error) {
+	res, err := c.SetWithOptions(key, value, SetOptions{NX: true, TTL: ttl})
+	return res.Set, err
+}
+
+// GetExOptions change the expiration of a key read with GetEx. Set at most
+// one.
+type GetExOptions struct {
+	TTL      time.Duration
+	ExpireAt time.Time
+	// Persist removes the expiration
+	Persist bool
+}
+
+// GetEx returns a string value and changes its expiration
+func (c *Client) GetEx(key string, opts GetExOptions) (string, error) {
+	if c.rpc != nil {
+		return c.rpcGetEx(key, opts)
+	}
+	q := url.Values{}
+	expiryQuery(q, opts.TTL, opts.ExpireAt)
+	if opts.Persist {
+		q.Set("persist", "true")
+	}
+	var out struct {
+		Value string `json:"value"`
+	}
+	err := c.do(http.MethodGet, stringPath(key)+encodeQuery(q), nil, &out)
+	return out.Value, err
+}
+
+// GetDel deletes a string value and returns it
+func (c *Client) GetDel(key string) (string, error) {
+	if c.rpc != nil {
+		return c.rpcGetDel(key)
+	}
+	var out struct {
+		Value string `json:"value"`
+	}
+	err := c.do(http.MethodDelete, stringPath(key)+"?get=true", nil, &out)
+	return out.Value, err
+}
@@ -0,0 +1,80 @@
+package gocache
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// WithTLSConfig uses cfg for HTTPS connections. The other TLS options
+// change this configuration, so apply it first when combining them.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *Client) {
+		c.tls = cfg.Clone()
+	}
+}
+
+// WithRootCAs verifies the server certificate against pool instead of the
+// system roots
+func WithRootCAs(pool *x509.CertPool) Option {
+	return func(c *Client) {
+		c.tlsConfig().RootCAs = pool
+	}
+}
+
+// WithClientCertificate presents cert to servers that verify client
+// certificates. The server maps its common name to an ACL user.
+func WithClientCertificate(cert tls.Certificate) Option {
+	return func(c *Client) {
+		cfg := c.tlsConfig()
+		cfg.Certificates = append(cfg.Certificates, cert)
+	}
+}
+
+// WithServerName sets the name the server certificate is checked against,
+// for when BaseURL uses an IP address or a different host name
+func WithServerName(name string) Option {
+	return func(c *Client) {
+		c.tlsConfig().ServerName = name
+	}
+}
+
+// LoadCertPool reads a PEM bundle of CA certificates for WithRootCAs
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates in %s", file)
+	}
+	return pool, nil
+}
+
+func (c *Client) tlsConfig() *tls.Config {
+	if c.tls == nil {
+		c.tls = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return c.tls
+}
+
+// applyTLS installs the TLS configuration on a copy of the client's
+// transport
+func (c *Client) applyTLS() {
+	if c.tls == nil {
+		return
+	}
+	base, ok := c.client.Transport.(*http.Transport)
+	if !ok || base == nil {
+		base = http.DefaultTransport.(*http.Transport)
+	}
+	t := base.Clone()
+	t.TLSClientConfig = c.tls
+
+	hc := *c.client
+	hc.Transport = t
+	c.client = &hc
+}
@@ -0,0 +1,86 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Every key has a version that changes whenever its value does. The
+// server sends it as the ETag of reads and writes, and these calls send it
+// back in If-Match so a write fails with ErrVersionMismatch, rather than
+// overwriting, if another client changed the key in between. They always
+// use HTTP, even with WithGRPC.
+
+// versionHeader returns the condition on the version of a key for a write.
+// Version 0 requires the key not to exist.
+func versionHeader(version uint64) http.Header {
+	if version == 0 {
+		return http.Header{"If-None-Match": {"*"}}
+	}
+	return http.Header{"If-Match": {`"` + strconv.FormatUint(version, 10) + `"`}}
+}
+
+// parseETag returns the version in the ETag of a response
+func parseETag(resp *http.Response) (uint64, error) {
+	tag := strings.Trim(resp.Header.Get("ETag"), `"`)
+	version, err := strconv.ParseUint(tag, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ETag %q", resp.Header.Get("ETag"))
+	}
+	return version, nil
+}
+
+// GetVersion retrieves a string value and its version
+func (c *Client) GetVersion(key string) (string, uint64, error) {
+	resp, err := c.send(context.Background(), http.MethodGet, stringPath(key), "", nil, http.Header{"Accept": {octetStream}})
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	value, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, fmt.Errorf("error reading response: %w", err)
+	}
+	version, err := parseETag(resp)
+	if err != nil {
+		return "", 0, err
+	}
+	return string(value), version, nil
+}
+
+// CompareAndSwap sets key to value if it is still at version, as returned
+// by GetVersion, and returns its new version. Version 0 only sets the key
+// if it does not exist. It keeps the key's expiration.
+func (c *Client) CompareAndSwap(key, value string, version uint64) (uint64, error) {
+	method := http.MethodPut
+	if version == 0 {
+		method = http.MethodPost
+	}
+	resp, err := c.send(context.Background(), method, stringPath(key), octetStream, strings.NewReader(value), versionHeader(version))
+	if err != nil {
+		return 0, err
+	}
+	newVersion, err := parseETag(resp)
+	if err := decodeData(resp, nil); err != nil {
+		return 0, err
+	}
+	return newVersion, err
+}
+
+// CompareAndDelete deletes key if it is still at version
+func (c *Client) CompareAndDelete(key string, version uint64) error {
+	if version == 0 {
+		return errors.New("a version is required to compare and delete")
+	}
+	resp, err := c.send(context.Background(), http.MethodDelete, stringPath(key), "", nil, versionHeader(version))
+	if err != nil {
+		return err
+	}
+	return decodeData(resp, nil)
+}
@@ -0,0 +1,180 @@
+package gocache_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	cache "github.com/dhanushcrueiso/coding-test/pkg/gocache"
+)
+
+func TestCompareAndSwap(t *testing.T) {
+	httpAddr, _ := serve(t)
+	client := cache.NewClient("http://" + httpAddr)
+
+	v1, err := client.CompareAndSwap("k", "a", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CompareAndSwap("k", "b", 0); !errors.Is(err, cache.ErrVersionMismatch) {
+		t.Errorf("creating an existing key: err = %v, want ErrVersionMismatch", err)
+	}
+	value, version, err := client.GetVersion("k")
+	if err != nil || value != "a" || version != v1 {
+		t.Fatalf("GetVersion = %q, %d, %v, want a, %d", value, version, err, v1)
+	}
+
+	v2, err := client.CompareAndSwap("k", "b", v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v2 == v1 {
+		t.Errorf("version unchanged at %d by a write", v2)
+	}
+	if _, err := client.CompareAndSwap("k", "c", v1); !errors.Is(err, cache.ErrVersionMismatch) {
+		t.Errorf("swap at a stale version: err = %v, want ErrVersionMismatch", err)
+	}
+	if err := client.CompareAndDelete("k", v1); !errors.Is(err, cache.ErrVersionMismatch) {
+		t.Errorf("delete at a stale version: err = %v, want ErrVersionMismatch", err)
+	}
+	if value, _, _ := client.GetVersion("k"); value != "b" {
+		t.Errorf("value after failed writes = %q, want b", value)
+	}
+	if err := client.CompareAndDelete("k", v2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CompareAndSwap("k", "d", v2); !errors.Is(err, cache.ErrVersionMismatch) {
+		t.Errorf("swap of a deleted key: err = %v, want ErrVersionMismatch", err)
+	}
+}
+
+// etagClient sends requests with conditional headers to a server
+type etagClient struct {
+	t    *testing.T
+	base string
+}
+
+// do sends a request and returns its status, ETag and body
+func (c etagClient) do(method, path, body string, header ...string) (int, string, string) {
+	c.t.Helper()
+	req, err := http.NewRequest(method, c.base+path, strings.NewReader(body))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return resp.StatusCode, resp.Header.Get("ETag"), string(b)
+}
+
+func TestETagConditionalRequests(t *testing.T) {
+	httpAddr, _ := serve(t)
+	c := etagClient{t: t, base: "http://" + httpAddr + "/api/v2"}
+
+	// If-Match on a missing key fails, even with *
+	if status, _, _ := c.do("PUT", "/strings/k", `{"value":"a"}`, "If-Match", "*"); status != 412 {
+		t.Errorf("PUT If-Match * on a missing key: %d, want 412", status)
+	}
+	status, tag, _ := c.do("POST", "/strings/k", `{"value":"a"}`, "If-None-Match", "*")
+	if status != 200 || tag == "" {
+		t.Fatalf("POST If-None-Match * on a missing key: %d, ETag %q", status, tag)
+	}
+	if status, _, _ := c.do("POST", "/strings/k", `{"value":"b"}`, "If-None-Match", "*"); status != 412 {
+		t.Errorf("POST If-None-Match * on an existing key: %d, want 412", status)
+	}
+
+	// Reads send the ETag and honour If-None-Match, weak tags included
+	if status, got, _ := c.do("GET", "/strings/k", ""); status != 200 || got != tag {
+		t.Errorf("GET: %d, ETag %q, want %q", status, got, tag)
+	}
+	for _, inm := range []string{tag, "W/" + tag, `"0", ` + tag, "*"} {
+		if status, _, body := c.do("GET", "/strings/k", "", "If-None-Match", inm); status != 304 || body != "" {
+			t.Errorf("GET If-None-Match %s: %d %q, want 304 and no body", inm, status, body)
+		}
+	}
+	if status, _, _ := c.do("GET", "/strings/k", "", "If-None-Match", `"0"`); status != 200 {
+		t.Errorf("GET If-None-Match of another version: %d, want 200", status)
+	}
+
+	// Writes with If-Match need the current strong tag
+	if status, _, _ := c.do("PUT", "/strings/k", `{"value":"b"}`, "If-Match", "W/"+tag); status != 412 {
+		t.Errorf("PUT If-Match with a weak tag: %d, want 412", status)
+	}
+	status, next, _ := c.do("PUT", "/strings/k", `{"value":"b"}`, "If-Match", `"0", `+tag)
+	if status != 200 || next == "" || next == tag {
+		t.Fatalf("PUT If-Match of the current version: %d, ETag %q after %q", status, next, tag)
+	}
+	if status, _, _ := c.do("PUT", "/strings/k", `{"value":"c"}`, "If-Match", tag); status != 412 {
+		t.Errorf("PUT If-Match of a stale version: %d, want 412", status)
+	}
+	if status, _, _ := c.do("DELETE", "/strings/k", "", "If-Match", tag); status != 412 {
+		t.Errorf("DELETE If-Match of a stale version: %d, want 412", status)
+	}
+	if status, _, body := c.do("GET", "/strings/k", ""); status != 200 || !strings.Contains(body, `"b"`) {
+		t.Errorf("GET after failed writes: %d %s", status, body)
+	}
+	if status, _, _ := c.do("DELETE", "/strings/k", "", "If-Match", next); status != 200 {
+		t.Errorf("DELETE If-Match of the current version: %d, want 200", status)
+	}
+	if status, _, _ := c.do("GET", "/strings/k", ""); status != 404 {
+		t.Errorf("GET after DELETE: %d, want 404", status)
+	}
+}
+
+func TestETagLists(t *testing.T) {
+	httpAddr, _ := serve(t)
+	c := etagClient{t: t, base: "http://" + httpAddr + "/api/v2"}
+
+	if status, _, _ := c.do("POST", "/list/l", ""); status != 200 {
+		t.Fatalf("create list: %d", status)
+	}
+	_, tag, _ := c.do("GET", "/list/l", "")
+	if status, _, _ := c.do("PATCH", "/list/l/push", `{"value":"x"}`); status != 200 {
+		t.Fatalf("push: %d", status)
+	}
+	status, pushed, _ := c.do("GET", "/list/l", "", "If-None-Match", tag)
+	if status != 200 || pushed == tag {
+		t.Errorf("GET of a list changed since %s: %d, ETag %q", tag, status, pushed)
+	}
+	if status, _, _ := c.do("DELETE", "/list/l", "", "If-Match", tag); status != 412 {
+		t.Errorf("DELETE list If-Match of a stale version: %d, want 412", status)
+	}
+	if status, _, _ := c.do("DELETE", "/list/l", "", "If-Match", pushed); status != 200 {
+		t.Errorf("DELETE list If-Match of the current version: %d, want 200", status)
+	}
+}
+
+func TestETagDocuments(t *testing.T) {
+	httpAddr, _ := serve(t)
+	c := etagClient{t: t, base: "http://" + httpAddr + "/api/v2"}
+
+	if status, _, _ := c.do("POST", "/json/d", `{"value":{"a":1,"b":[1]}}`); status != 200 {
+		t.Fatalf("create document: %d", status)
+	}
+	_, tag, _ := c.do("GET", "/json/d", "")
+	// The ETag is the document's, whatever part of it is read
+	if status, _, _ := c.do("GET", "/json/d?path=$.a", "", "If-None-Match", tag); status != 304 {
+		t.Errorf("GET of a path If-None-Match of the document: %d, want 304", status)
+	}
+	if status, _, _ := c.do("POST", "/json/d/arrappend?path=$.b", `{"values":[2]}`); status != 200 {
+		t.Fatalf("arrappend: %d", status)
+	}
+	status, next, _ := c.do("GET", "/json/d", "", "If-None-Match", tag)
+	if status != 200 || next == tag {
+		t.Errorf("GET of a document changed since %s: %d, ETag %q", tag, status, next)
+	}
+}
@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dhanushcrueiso/coding-test/internal/acl"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const userLocal = "user"
+
+// public are the paths served without credentials
+var public = map[string]bool{
+	"/api/health":           true,
+	APIv2Prefix + "/health": true,
+	OpenAPIPath:             true,
+	DocsPath:                true,
+}
+
+// APIKeyHeader carries an API key as an alternative to a bearer token
+const APIKeyHeader = "X-API-Key"
+
+// WithACL checks every request against the users in r
+func WithACL(r *acl.Registry) Option {
+	return func(h *Handler) {
+		h.acl = r
+	}
+}
+
+// Authenticate identifies the user making the request from HTTP basic
+// auth, a bearer token or an X-API-Key header, or else from the common
+// name of a verified TLS client certificate. Requests without credentials
+// run as the default user while it is enabled and has no password. The
+// health check and the API docs are always allowed, see public.
+func (h *Handler) Authenticate(c *fiber.Ctx) error {
+	if h.acl == nil || public[c.Path()] {
+		return c.Next()
+	}
+
+	user, err := h.credentials(c)
+	if err != nil {
+		c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="datastore"`)
+		return c.Status(401).JSON(fiber.Map{
+			"error": err.Error()})
+	}
+	c.Locals(userLocal, user)
+	c.Locals(loggerLocal, h.log(c).With("user", user.Name))
+	return c.Next()
+}
+
+func (h *Handler) credentials(c *fiber.Ctx) (*acl.User, error) {
+	return h.identify(c.Get(APIKeyHeader), c.Get(fiber.HeaderAuthorization), c.Context().TLSConnectionState())
+}
+
+// identify finds the user for an API key, else an Authorization header
+// value, else the client certificate of a TLS connection, which may be
+// nil. It is shared by HTTP and gRPC.
+func (h *Handler) identify(key, auth string, state *tls.ConnectionState) (*acl.User, error) {
+	if key != "" {
+		return h.acl.AuthenticateKey(key)
+	}
+
+	if token, ok := cutPrefixFold(auth, "Bearer "); ok {
+		return h.acl.AuthenticateKey(strings.TrimSpace(token))
+	}
+	if encoded, ok := cutPrefixFold(auth, "Basic "); ok {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, acl.ErrBadCredentials
+		}
+		name, password, ok := strings.Cut(string(decoded), ":")
+		if !ok {
+			return nil, acl.ErrBadCredentials
+		}
+		return h.acl.Authenticate(name, password)
+	}
+	if auth != "" {
+		return nil, acl.ErrBadCredentials
+	}
+
+	if state != nil && len(state.VerifiedChains) > 0 {
+		name := state.VerifiedChains[0][0].Subject.CommonName
+		user, err := h.acl.Identify(name)
+		if err != nil {
+			return nil, fmt.Errorf("client certificate %q: %w", name, err)
+		}
+		return user, nil
+	}
+
+	user, ok := h.acl.Anonymous()
+	if !ok {
+		return nil, errors.New("authentication required")
+	}
+	return user, nil
+}
+
+// Allow only lets the request through if the user holds every category in
+// need, may use the selected namespace and, for routes with a :key param,
+// may access that key. It also rejects malformed keys, as every keyed
+// route passes through it.
+func (h *Handler) Allow(need ...acl.Category) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := checkKey(c); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error()})
+		}
+		user := currentUser(c)
+		if user == nil {
+			return c.Next()
+		}
+		if !user.Can(need...) {
+			return c.Status(403).JSON(fiber.Map{
+				"error": "user " + user.Name + " has no permission to run this command"})
+		}
+		if db, ok := c.Locals(namespaceLocal).(string); ok && !user.CanUseNamespace(db) {
+			return c.Status(403).JSON(fiber.Map{
+				"error": "user " + user.Name + " has no permission to use namespace " + db})
+		}
+		if key := keyParam(c); key != "" && !user.CanAccess(key) {
+			return c.Status(403).JSON(fiber.Map{
+				"error": "user " + user.Name + " has no permission to access this key"})
+		}
+		return c.Next()
+	}
+}
+
+// currentUser is nil when ACLs are not enabled
+func currentUser(c *fiber.Ctx) *acl.User {
+	u, _ := c.Locals(userLocal).(*acl.User)
+	return u
+}
+
+// userView is a user as shown by the API, without secret hashes
+type userView struct {
+	Name       string         `json:"name"`
+	Enabled    bool           `json:"enabled"`
+	NoPass     bool           `json:"nopass"`
+	Passwords  int            `json:"passwords"`
+	APIKeys    int            `json:"api_keys"`
+	Categories []acl.Category `json:"categories"`
+	Keys       []string       `json:"keys"`
+	Namespaces []string       `json:"namespaces,omitempty"`
+}
+
+func viewUser(u *acl.User) userView {
+	return userView{
+		Name:       u.Name,
+		Enabled:    u.Enabled,
+		NoPass:     u.NoPass,
+		Passwords:  len(u.Passwords),
+		APIKeys:    len(u.APIKeys),
+		Categories: u.Categories,
+		Keys:       u.Keys,
+		Namespaces: u.Namespaces,
+	}
+}
+
+func (h *Handler) WhoAmI(c *fiber.Ctx) error {
+	user := currentUser(c)
+	if user == nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ACLs are not enabled"})
+	}
+	return c.Status(200).JSON(viewUser(user))
+}
+
+func (h *Handler) ListUsers(c *fiber.Ctx) error {
+	if h.acl == nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ACLs are not enabled"})
+	}
+	users := h.acl.Users()
+	views := make([]userView, len(users))
+	for i, u := range users {
+		views[i] = viewUser(u)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"data": views})
+}
+
+func (h *Handler) GetUser(c *fiber.Ctx) error {
+	if h.acl == nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ACLs are not enabled"})
+	}
+	u, ok := h.acl.Lookup(c.Params("name"))
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "user not found"})
+	}
+	return c.Status(200).JSON(viewUser(u))
+}
+
+func (h *Handler) SetUser(c *fiber.Ctx) error {
+	if h.acl == nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ACLs are not enabled"})
+	}
+	var spec acl.Spec
+	if err := c.BodyParser(&spec); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body"})
+	}
+	u, err := h.acl.SetUser(c.Params("name"), spec)
+	if err != nil {
+		return h.aclError(c, err)
+	}
+	return c.Status(200).JSON(viewUser(u))
+}
+
+func (h *Handler) DeleteUser(c *fiber.Ctx) error {
+	if h.acl == nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ACLs are not enabled"})
+	}
+	if err := h.acl.DeleteUser(c.Params("name")); err != nil {
+		return h.aclError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"message": "user deleted"})
+}
+
+// CreateAPIKey generates an API key for a user. It is only shown once.
+func (h *Handler) CreateAPIKey(c *fiber.Ctx) error {
+	if h.acl == nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ACLs are not enabled"})
+	}
+	key, err := h.acl.NewAPIKey(c.Params("name"))
+	if err != nil {
+		return h.aclError(c, err)
+	}
+	return c.Status(201).JSON(fiber.Map{
+		"api_key": key})
+}
+
+func (h *Handler) RevokeAPIKeys(c *fiber.Ctx) error {
+	if h.acl == nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ACLs are not enabled"})
+	}
+	if err := h.acl.RevokeAPIKeys(c.Params("name")); err != nil {
+		return h.aclError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"message": "api keys revoked"})
+}
+
+func (h *Handler) aclError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, acl.ErrUnknownUser):
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, acl.ErrUnknownCategory), errors.Is(err, acl.ErrInvalidPattern),
+		errors.Is(err, acl.ErrInvalidPassword):
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	h.log(c).Error("save acl failed", "err", err)
+	return c.Status(500).JSON(fiber.Map{"error": "failed to save users"})
+}
+
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix) {
+		return s[len(prefix):], true
+	}
+	return "", false
+}
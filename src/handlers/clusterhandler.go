@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/dhanushcrueiso/coding-test/internal/raft"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Consistency sends mutations to the raft leader and fences reads with a
+// read index, so every response reflects all acknowledged writes. It is a
+// no-op when the store is not replicated.
+func (h *Handler) Consistency(c *fiber.Ctx) error {
+	if h.cluster == nil {
+		return c.Next()
+	}
+
+	// GETEX changes the key, so it goes to the leader like other writes
+	if (c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead) && !isGetEx(c) {
+		if err := h.cluster.ReadBarrier(); err != nil {
+			return c.Status(503).JSON(fiber.Map{
+				"error": "cluster unavailable: " + err.Error()})
+		}
+		return c.Next()
+	}
+
+	if !h.cluster.IsLeader() {
+		_, leaderAPI := h.cluster.Leader()
+		if leaderAPI == "" {
+			return c.Status(503).JSON(fiber.Map{
+				"error": "no leader elected"})
+		}
+		return c.Redirect(leaderAPI+c.OriginalURL(), fiber.StatusTemporaryRedirect)
+	}
+	return c.Next()
+}
+
+func (h *Handler) GetClusterStatus(c *fiber.Ctx) error {
+	if h.cluster == nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "replication is not enabled"})
+	}
+	return c.Status(200).JSON(h.cluster.Status())
+}
+
+func (h *Handler) AddClusterMember(c *fiber.Ctx) error {
+	if h.cluster == nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "replication is not enabled"})
+	}
+
+	var member raft.Server
+	if err := c.BodyParser(&member); err != nil || member.ID == "" || member.Addr == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "id and addr are required"})
+	}
+
+	if err := h.cluster.AddServer(member); err != nil {
+		return h.clusterError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"message": "member added"})
+}
+
+func (h *Handler) RemoveClusterMember(c *fiber.Ctx) error {
+	if h.cluster == nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "replication is not enabled"})
+	}
+
+	if err := h.cluster.RemoveServer(c.Params("id")); err != nil {
+		return h.clusterError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"message": "member removed"})
+}
+
+func (h *Handler) clusterError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, raft.ErrUnknownServer):
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, raft.ErrConfigInProgress):
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(503).JSON(fiber.Map{"error": err.Error()})
+}
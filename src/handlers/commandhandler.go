@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxArgLen caps how much of a request body is kept in slow log entries and
+// MONITOR events
+const maxArgLen = 128
+
+// command describes one request to a data route
+type command struct {
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"-"`
+	Client   string        `json:"client"`
+	User     string        `json:"user,omitempty"`
+	Method   string        `json:"method"`
+	Route    string        `json:"route"`
+	DB       string        `json:"db"`
+	Key      string        `json:"key,omitempty"`
+	Args     []string      `json:"args,omitempty"`
+	Status   int           `json:"status"`
+	// DurationMicros mirrors Duration for JSON output
+	DurationMicros int64 `json:"duration_us"`
+}
+
+// Commands wraps the data routes. It counts requests for INFO, publishes
+// them to MONITOR subscribers and records the ones slower than the slow
+// log threshold.
+func (h *Handler) Commands(c *fiber.Ctx) error {
+	h.commands.Add(1)
+	start := time.Now()
+	err := c.Next()
+	elapsed := time.Since(start)
+
+	monitored := h.monitor.active()
+	slow := h.slowlog.exceeds(elapsed)
+	if !monitored && !slow {
+		return err
+	}
+
+	// The route and its params are only known once the request has been
+	// routed, so commands are reported after they complete
+	cmd := newCommand(c, start, elapsed)
+	if err != nil {
+		cmd.Status = errorStatus(err)
+	}
+	if monitored {
+		h.monitor.publish(cmd)
+	}
+	if slow {
+		h.slowlog.add(cmd)
+	}
+	return err
+}
+
+// newCommand copies what it needs from c, whose strings are only valid
+// until the handler returns
+func newCommand(c *fiber.Ctx, at time.Time, elapsed time.Duration) command {
+	cmd := command{
+		Time:           at,
+		Duration:       elapsed,
+		DurationMicros: elapsed.Microseconds(),
+		Client:         c.Context().RemoteAddr().String(),
+		Method:         strings.Clone(c.Method()),
+		Route:          c.Route().Path,
+		DB:             namespace(c),
+		Key:            keyParam(c),
+		Status:         c.Response().StatusCode(),
+	}
+	if u := currentUser(c); u != nil {
+		cmd.User = u.Name
+	}
+	if op := c.Params("operation"); op != "" {
+		cmd.Args = append(cmd.Args, strings.Clone(op))
+	}
+	if q := c.Context().QueryArgs().String(); q != "" {
+		cmd.Args = append(cmd.Args, truncate(q))
+	}
+	if body := c.Body(); len(body) > 0 {
+		cmd.Args = append(cmd.Args, truncate(string(body)))
+	}
+	return cmd
+}
+
+func truncate(s string) string {
+	if len(s) <= maxArgLen {
+		return s
+	}
+	return s[:maxArgLen] + "..."
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/dhanushcrueiso/coding-test/internal/config"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func (h *Handler) GetConfig(c *fiber.Ctx) error {
+	if h.config == nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "runtime config is not enabled"})
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"data": h.config.Get(c.Query("pattern")),
+	})
+}
+
+func (h *Handler) SetConfig(c *fiber.Ctx) error {
+	if h.config == nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "runtime config is not enabled"})
+	}
+	var data struct {
+		Value *string `json:"value"`
+	}
+	if err := c.BodyParser(&data); err != nil || data.Value == nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "value is required"})
+	}
+
+	err := h.config.Set(c.Params("name"), *data.Value)
+	switch {
+	case errors.Is(err, config.ErrUnknownSetting):
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"message": "config updated"})
+}
+
+func (h *Handler) RewriteConfig(c *fiber.Ctx) error {
+	if h.config == nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "runtime config is not enabled"})
+	}
+	err := h.config.Rewrite()
+	switch {
+	case errors.Is(err, config.ErrNoConfigFile):
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"message": "config file rewritten"})
+}
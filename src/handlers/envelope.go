@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/dhanushcrueiso/coding-test/internal/raft"
+	"github.com/dhanushcrueiso/coding-test/internal/store"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Error codes name the kind of failure in an error response. Unlike the
+// messages they are stable, so clients can branch on them.
+const (
+	CodeInvalidArgument    = "INVALID_ARGUMENT"
+	CodeUnauthenticated    = "UNAUTHENTICATED"
+	CodePermissionDenied   = "PERMISSION_DENIED"
+	CodeNotFound           = "NOT_FOUND"
+	CodeNotAcceptable      = "NOT_ACCEPTABLE"
+	CodeConflict           = "CONFLICT"
+	CodeWrongType          = "WRONGTYPE"
+	CodeValueTooLarge      = "VALUE_TOO_LARGE"
+	CodeRateLimited        = "RATE_LIMITED"
+	CodeInternal           = "INTERNAL"
+	CodeUnavailable        = "UNAVAILABLE"
+	CodeQuotaExceeded      = "QUOTA_EXCEEDED"
+	CodeOutOfMemory        = "OUT_OF_MEMORY"
+	CodePreconditionFailed = "PRECONDITION_FAILED"
+)
+
+// codeStatus is the status /api/v2 responds with for each code
+var codeStatus = map[string]int{
+	CodeInvalidArgument:    400,
+	CodeUnauthenticated:    401,
+	CodePermissionDenied:   403,
+	CodeNotFound:           404,
+	CodeNotAcceptable:      406,
+	CodeConflict:           409,
+	CodeWrongType:          409,
+	CodeValueTooLarge:      413,
+	CodeRateLimited:        429,
+	CodeInternal:           500,
+	CodeUnavailable:        503,
+	CodeQuotaExceeded:      507,
+	CodeOutOfMemory:        507,
+	CodePreconditionFailed: 412,
+}
+
+// statusCode is the code of an error response that does not name one
+func statusCode(status int) string {
+	switch status {
+	case 401:
+		return CodeUnauthenticated
+	case 403:
+		return CodePermissionDenied
+	case 404:
+		return CodeNotFound
+	case 406:
+		return CodeNotAcceptable
+	case 409:
+		return CodeConflict
+	case 412:
+		return CodePreconditionFailed
+	case 413:
+		return CodeValueTooLarge
+	case 429:
+		return CodeRateLimited
+	case 503:
+		return CodeUnavailable
+	case 507:
+		return CodeQuotaExceeded
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeInvalidArgument
+}
+
+// errorCode is the code for an error returned by the store, or "" when
+// the status of the response decides it
+func errorCode(err error) string {
+	switch {
+	case errors.Is(err, store.ErrWrongType):
+		return CodeWrongType
+	case errors.Is(err, store.ErrNoSuchKey), errors.Is(err, store.ErrNoGroup),
+		errors.Is(err, store.ErrNoMessage), errors.Is(err, store.ErrNoSuchIndex):
+		return CodeNotFound
+	case errors.Is(err, store.ErrValueTooLarge):
+		return CodeValueTooLarge
+	case errors.Is(err, store.ErrOutOfMemory):
+		return CodeOutOfMemory
+	case errors.Is(err, store.ErrKeyQuota), errors.Is(err, store.ErrByteQuota):
+		return CodeQuotaExceeded
+	case errors.Is(err, store.ErrVersionMismatch):
+		return CodePreconditionFailed
+	case errors.Is(err, store.ErrConflictingOptions), errors.Is(err, store.ErrInvalidTTL),
+		errors.Is(err, errInvalidExpiration), errors.Is(err, store.ErrInvalidPath),
+		errors.Is(err, store.ErrInvalidJSON), errors.Is(err, store.ErrNumberRange),
+		errors.Is(err, store.ErrInvalidIndex), errors.Is(err, store.ErrInvalidQuery):
+		return CodeInvalidArgument
+	case errors.Is(err, raft.ErrNotLeader), errors.Is(err, raft.ErrNoLeader), errors.Is(err, raft.ErrTimeout):
+		// The command may still be applied; the client has to check
+		return CodeUnavailable
+	}
+	return ""
+}
+
+// fail sends an error response with a code. status is the status of /api;
+// /api/v2 derives its status from the code instead.
+func fail(c *fiber.Ctx, status int, code, msg string) error {
+	if code == "" {
+		code = statusCode(status)
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"error": msg,
+		"code":  code})
+}
+
+// failWith sends err as an error response, coded by errorCode
+func failWith(c *fiber.Ctx, status int, err error) error {
+	return fail(c, status, errorCode(err), err.Error())
+}
+
+// missing responds for a key that a command found missing or holding
+// another type than want, which the store does not tell apart
+func (h *Handler) missing(c *fiber.Ctx, status int, key string, want store.DataType) error {
+	if _, t, found := h.db(c).Get(key); found && t != want {
+		return failWith(c, status, store.ErrWrongType)
+	}
+	return fail(c, status, CodeNotFound, "key not found")
+}
+
+// APIv2Prefix is where version 2 of the API is mounted
+const APIv2Prefix = "/api/v2"
+
+// envelope is the body of every JSON response of /api/v2
+type envelope struct {
+	OK    bool           `json:"ok"`
+	Data  interface{}    `json:"data,omitempty"`
+	Error *envelopeError `json:"error,omitempty"`
+}
+
+type envelopeError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Details has the other fields of the error response, if any
+	Details map[string]json.RawMessage `json:"details,omitempty"`
+}
+
+// Envelope rewrites the JSON responses of /api/v2 into one shape:
+//
+//	{"ok": true, "data": ...}
+//	{"ok": false, "error": {"code": "NOT_FOUND", "message": "..."}}
+//
+// The status of an error follows from its code, so a code is always sent
+// with the same status. Streams and raw values are left alone. It runs
+// before Authenticate so that its errors are wrapped too.
+func (h *Handler) Envelope(c *fiber.Ctx) error {
+	if p := c.Path(); p != APIv2Prefix && !strings.HasPrefix(p, APIv2Prefix+"/") {
+		return c.Next()
+	}
+	if err := c.Next(); err != nil {
+		code, msg := statusCode(errorStatus(err)), "internal error"
+		var fe *fiber.Error
+		if errors.As(err, &fe) {
+			msg = fe.Message
+		} else {
+			h.log(c).Error("request failed", "err", err)
+		}
+		return c.Status(codeStatus[code]).JSON(envelope{
+			Error: &envelopeError{Code: code, Message: msg}})
+	}
+
+	resp := c.Response()
+	if resp.IsBodyStream() || !strings.HasPrefix(string(resp.Header.ContentType()), fiber.MIMEApplicationJSON) {
+		return nil
+	}
+	status, body := resp.StatusCode(), resp.Body()
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		// An array or scalar is data as it is
+		if status < 400 {
+			return c.Status(status).JSON(envelope{OK: true, Data: json.RawMessage(body)})
+		}
+		fields = map[string]json.RawMessage{}
+	}
+
+	if status >= 400 {
+		var code, msg string
+		json.Unmarshal(fields["code"], &code)
+		if json.Unmarshal(fields["error"], &msg) != nil || msg == "" {
+			json.Unmarshal(fields["message"], &msg)
+		}
+		if code == "" {
+			code = statusCode(status)
+		}
+		delete(fields, "error")
+		delete(fields, "code")
+		delete(fields, "message")
+		e := &envelopeError{Code: code, Message: msg}
+		if len(fields) > 0 {
+			e.Details = fields
+		}
+		if s, ok := codeStatus[code]; ok {
+			status = s
+		}
+		return c.Status(status).JSON(envelope{Error: e})
+	}
+
+	// message only repeats the route for people; a lone data is unwrapped
+	delete(fields, "message")
+	var data interface{} = fields
+	if d, ok := fields["data"]; ok && len(fields) == 1 {
+		data = d
+	} else if len(fields) == 0 {
+		data = nil
+	}
+	return c.Status(status).JSON(envelope{OK: true, Data: data})
+}
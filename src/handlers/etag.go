@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/dhanushcrueiso/coding-test/internal/logging"
+	"github.com/dhanushcrueiso/coding-test/internal/store"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Every key has a version that changes whenever its value does. Reads send
+// it as a strong ETag, and writes honour If-Match and If-None-Match, so a
+// client can change a key without overwriting a change it has not seen.
+
+func etag(version uint64) string {
+	return `"` + strconv.FormatUint(version, 10) + `"`
+}
+
+// etagMatch reports whether header, the value of If-Match or
+// If-None-Match, names version. Weak tags only match when weak is set, as
+// for If-None-Match.
+func etagMatch(header string, version uint64, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if t, ok := strings.CutPrefix(tag, "W/"); ok {
+			if !weak {
+				continue
+			}
+			tag = t
+		}
+		if tag == etag(version) {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified sets the ETag of a read and reports whether the request's
+// If-None-Match already names it, in which case the caller responds with
+// 304 and no body
+func notModified(c *fiber.Ctx, version uint64) bool {
+	c.Set(fiber.HeaderETag, etag(version))
+	if inm := c.Get(fiber.HeaderIfNoneMatch); inm != "" && etagMatch(inm, version, true) {
+		c.Status(fiber.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// precondition is what the conditional headers of a write require of its
+// key
+type precondition struct {
+	// version is the version the key must still be at, 0 for any
+	version uint64
+	// absent requires the key not to exist, from If-None-Match: *
+	absent bool
+}
+
+// preconditions checks the If-Match and If-None-Match headers of a write
+// to key. It responds with 412 and returns false if they fail. Otherwise
+// the write must be made conditional on the returned precondition, so a
+// change between the check and the write fails it too.
+func (h *Handler) preconditions(c *fiber.Ctx, key string) (precondition, bool) {
+	ifMatch, ifNoneMatch := c.Get(fiber.HeaderIfMatch), c.Get(fiber.HeaderIfNoneMatch)
+	var p precondition
+	if ifMatch == "" && ifNoneMatch == "" {
+		return p, true
+	}
+	version, found := h.db(c).Version(key)
+	if ifMatch != "" {
+		if !found || !etagMatch(ifMatch, version, false) {
+			return p, false
+		}
+		p.version = version
+	}
+	if ifNoneMatch != "" && found && etagMatch(ifNoneMatch, version, true) {
+		return p, false
+	}
+	p.absent = strings.TrimSpace(ifNoneMatch) == "*"
+	return p, true
+}
+
+// preconditionFailed responds to a write whose conditional headers failed
+func preconditionFailed(c *fiber.Ctx) error {
+	return fail(c, fiber.StatusPreconditionFailed, CodePreconditionFailed, store.ErrVersionMismatch.Error())
+}
+
+// removeVersion deletes key for a DELETE with If-Match, if it is still at
+// version, and responds with message
+func (h *Handler) removeVersion(c *fiber.Ctx, key string, version uint64, message string) error {
+	deleted, err := h.db(c).RemoveVersion(key, version)
+	if status, ok := storageStatus(err); ok {
+		return failWith(c, status, err)
+	}
+	if err != nil && !errors.Is(err, store.ErrVersionMismatch) {
+		h.log(c).Error("delete failed", logging.KeyAttr, key, "err", err)
+		return fail(c, 500, CodeInternal, "failed to delete data")
+	}
+	if !deleted {
+		return preconditionFailed(c)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"message": message})
+}
@@ -0,0 +1,609 @@
+package handlers
+
+import (
+	"context"
+	"crypto/tls"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/dhanushcrueiso/coding-test/internal/acl"
+	"github.com/dhanushcrueiso/coding-test/internal/store"
+	pb "github.com/dhanushcrueiso/coding-test/pkg/gocache/gocachepb"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorDomain is the domain of the google.rpc.ErrorInfo detail of gRPC
+// errors. Its reason is one of the Code constants.
+const ErrorDomain = "gocache"
+
+// grpcCodes maps error codes to gRPC status codes
+var grpcCodes = map[string]codes.Code{
+	CodeInvalidArgument:    codes.InvalidArgument,
+	CodeUnauthenticated:    codes.Unauthenticated,
+	CodePermissionDenied:   codes.PermissionDenied,
+	CodeNotFound:           codes.NotFound,
+	CodeNotAcceptable:      codes.InvalidArgument,
+	CodeConflict:           codes.FailedPrecondition,
+	CodeWrongType:          codes.FailedPrecondition,
+	CodeValueTooLarge:      codes.ResourceExhausted,
+	CodeRateLimited:        codes.ResourceExhausted,
+	CodeInternal:           codes.Internal,
+	CodeUnavailable:        codes.Unavailable,
+	CodeQuotaExceeded:      codes.ResourceExhausted,
+	CodeOutOfMemory:        codes.ResourceExhausted,
+	CodePreconditionFailed: codes.FailedPrecondition,
+}
+
+// rpcFail builds a gRPC error carrying code as its ErrorInfo reason
+func rpcFail(code, msg string) error {
+	st := status.New(grpcCodes[code], msg)
+	if detailed, err := st.WithDetails(&errdetails.ErrorInfo{Reason: code, Domain: ErrorDomain}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// rpcCode returns the error code of an error built by rpcFail
+func rpcCode(err error) string {
+	for _, d := range status.Convert(err).Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok && info.Domain == ErrorDomain {
+			return info.Reason
+		}
+	}
+	return CodeInternal
+}
+
+// grpcMethod describes a method of the Cache service
+type grpcMethod struct {
+	need []acl.Category
+	// data methods work on a namespace, count against rate limits and
+	// follow the consistency rules of the data routes
+	data  bool
+	write bool
+}
+
+func rpcRead(cats ...acl.Category) grpcMethod {
+	return grpcMethod{need: append([]acl.Category{acl.Read}, cats...), data: true}
+}
+
+func rpcWrite(cats ...acl.Category) grpcMethod {
+	return grpcMethod{need: append([]acl.Category{acl.Write}, cats...), data: true, write: true}
+}
+
+// grpcMethods lists the ACL categories and kind of each method, as the
+// router does for the HTTP routes
+var grpcMethods = map[string]grpcMethod{
+	"Set":        rpcWrite(acl.String),
+	"Get":        rpcRead(acl.String),
+	"GetEx":      rpcWrite(acl.String),
+	"GetDel":     rpcWrite(acl.String),
+	"Update":     rpcWrite(acl.String),
+	"CreateList": rpcWrite(acl.List),
+	"GetList":    rpcRead(acl.List),
+	"Push":       rpcWrite(acl.List),
+	"Pop":        rpcWrite(acl.List),
+	"GetTTL":     rpcRead(),
+	"Expire":     rpcWrite(),
+	"Persist":    rpcWrite(),
+	"ExpireTime": rpcRead(),
+	"Delete":     rpcWrite(),
+	"Type":       rpcRead(),
+	"DBSize":     rpcRead(),
+	"Publish":    {need: []acl.Category{acl.Write, acl.PubSub}},
+	"Subscribe":  {need: []acl.Category{acl.Read, acl.PubSub}},
+	"Monitor":    {need: []acl.Category{acl.Admin}},
+}
+
+// rpcCall is what the interceptors learn about a call before it runs
+type rpcCall struct {
+	user *acl.User
+	db   string
+}
+
+type rpcCallKey struct{}
+
+func callOf(ctx context.Context) rpcCall {
+	call, _ := ctx.Value(rpcCallKey{}).(rpcCall)
+	return call
+}
+
+// keyed is implemented by every request that names a key
+type keyed interface {
+	GetKey() []byte
+}
+
+// NewGRPCServer returns a gRPC server for the Cache service. It shares
+// the store, users, quotas, INFO counters, MONITOR and slow log of h, so a
+// command behaves the same whichever protocol carries it.
+func (h *Handler) NewGRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(h.unaryInterceptor),
+		grpc.ChainStreamInterceptor(h.streamInterceptor))
+	srv := grpc.NewServer(opts...)
+	pb.RegisterCacheServer(srv, &cacheService{h: h})
+	return srv
+}
+
+// admit authenticates a call and checks it against the ACL, rate limits
+// and, for a replicated store, the consistency rules. req is nil for
+// streams.
+func (h *Handler) admit(ctx context.Context, fullMethod string, req interface{}) (context.Context, error) {
+	method, ok := grpcMethods[path.Base(fullMethod)]
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "unknown method "+fullMethod)
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	call := rpcCall{db: store.DefaultDB}
+	if v := firstValue(md, NamespaceHeader); v != "" {
+		call.db = v
+	}
+	if !store.ValidDBName(call.db) {
+		return nil, rpcFail(CodeInvalidArgument, store.ErrInvalidDB.Error())
+	}
+	var key string
+	if k, ok := req.(keyed); ok {
+		key = string(k.GetKey())
+		if key == "" {
+			return nil, rpcFail(CodeInvalidArgument, "key is required")
+		}
+	}
+
+	if h.acl != nil {
+		var state *tls.ConnectionState
+		if p, ok := peer.FromContext(ctx); ok {
+			if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+				state = &info.State
+			}
+		}
+		user, err := h.identify(firstValue(md, APIKeyHeader), firstValue(md, "authorization"), state)
+		if err != nil {
+			return nil, rpcFail(CodeUnauthenticated, err.Error())
+		}
+		call.user = user
+		switch {
+		case !user.Can(method.need...):
+			return nil, rpcFail(CodePermissionDenied, "user "+user.Name+" has no permission to run this command")
+		case method.data && !user.CanUseNamespace(call.db):
+			return nil, rpcFail(CodePermissionDenied, "user "+user.Name+" has no permission to use namespace "+call.db)
+		case key != "" && !user.CanAccess(key):
+			return nil, rpcFail(CodePermissionDenied, "user "+user.Name+" has no permission to access this key")
+		}
+	}
+
+	if method.data {
+		if code, msg := h.admitData(call.db, call.user, method.write); code != "" {
+			return nil, rpcFail(code, msg)
+		}
+	}
+	return context.WithValue(ctx, rpcCallKey{}, call), nil
+}
+
+// admitData applies the rate limits and, for a replicated store, the
+// consistency rules to a command on db. It returns the code and message of
+// the error to fail the command with, or an empty code.
+func (h *Handler) admitData(db string, user *acl.User, write bool) (string, string) {
+	if h.quotas != nil {
+		var name string
+		if user != nil {
+			name = user.Name
+		}
+		if err := h.quotas.Allow(db, name, time.Now()); err != nil {
+			return CodeRateLimited, err.Error()
+		}
+	}
+
+	if h.cluster != nil {
+		if !write {
+			if err := h.cluster.ReadBarrier(); err != nil {
+				return CodeUnavailable, "cluster unavailable: " + err.Error()
+			}
+		} else if !h.cluster.IsLeader() {
+			leader, _ := h.cluster.Leader()
+			if leader == "" {
+				return CodeUnavailable, "no leader elected"
+			}
+			return CodeUnavailable, "not the leader, send writes to " + leader
+		}
+	}
+	return "", ""
+}
+
+func firstValue(md metadata.MD, name string) string {
+	if v := md.Get(name); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (h *Handler) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	h.commands.Add(1)
+	start := time.Now()
+	var resp interface{}
+	admitted, err := h.admit(ctx, info.FullMethod, req)
+	if err == nil {
+		ctx = admitted
+		resp, err = handler(ctx, req)
+	}
+	elapsed := time.Since(start)
+
+	monitored := h.monitor.active()
+	slow := h.slowlog.exceeds(elapsed)
+	if monitored || slow {
+		cmd := rpcCommand(ctx, info.FullMethod, req, start, elapsed, err)
+		if monitored {
+			h.monitor.publish(cmd)
+		}
+		if slow {
+			h.slowlog.add(cmd)
+		}
+	}
+	return resp, err
+}
+
+// rpcCommand describes a gRPC call for MONITOR and the slow log, with the
+// status an HTTP request failing the same way would have had
+func rpcCommand(ctx context.Context, fullMethod string, req interface{}, at time.Time, elapsed time.Duration, err error) command {
+	cmd := command{
+		Time:           at,
+		Duration:       elapsed,
+		DurationMicros: elapsed.Microseconds(),
+		Method:         "GRPC",
+		Route:          fullMethod,
+		DB:             store.DefaultDB,
+		Status:         200,
+	}
+	if call, ok := ctx.Value(rpcCallKey{}).(rpcCall); ok {
+		cmd.DB = call.db
+		if call.user != nil {
+			cmd.User = call.user.Name
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		cmd.Client = p.Addr.String()
+	}
+	if k, ok := req.(keyed); ok {
+		cmd.Key = string(k.GetKey())
+	}
+	if v, ok := req.(interface{ GetValue() []byte }); ok && len(v.GetValue()) > 0 {
+		cmd.Args = append(cmd.Args, truncate(string(v.GetValue())))
+	}
+	if err != nil {
+		cmd.Status = codeStatus[rpcCode(err)]
+	}
+	return cmd
+}
+
+// serverStream lets the stream interceptor replace the context of a stream
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (h *Handler) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := h.admit(ss.Context(), info.FullMethod, nil)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &serverStream{ss, ctx})
+}
+
+// cacheService implements the Cache service. Its methods follow the
+// handlers of the matching HTTP routes.
+type cacheService struct {
+	pb.UnimplementedCacheServer
+	h *Handler
+}
+
+func (s *cacheService) db(ctx context.Context) *store.DB {
+	return s.h.store.DB(callOf(ctx).db)
+}
+
+// fail turns an error from the store into a gRPC error
+func (s *cacheService) fail(ctx context.Context, op string, err error) error {
+	if code := errorCode(err); code != "" {
+		return rpcFail(code, err.Error())
+	}
+	s.h.logger.Error(op+" failed", "db", callOf(ctx).db, "err", err)
+	return rpcFail(CodeInternal, op+" failed")
+}
+
+// missing is the error for a key that does not exist or holds another type
+func (s *cacheService) missing(ctx context.Context, key string, want store.DataType) error {
+	if t, found := s.db(ctx).Type(key); found && t != want {
+		return rpcFail(CodeWrongType, store.ErrWrongType.Error())
+	}
+	return rpcFail(CodeNotFound, "key not found")
+}
+
+// rpcMillis converts a duration in milliseconds from a request
+func rpcMillis(ms int64, field string) (time.Duration, error) {
+	if ms < 0 {
+		return 0, rpcFail(CodeInvalidArgument, field+" must not be negative")
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// rpcTime converts a Unix time in milliseconds from a request, where 0
+// is no time
+func rpcTime(ms int64, field string) (time.Time, error) {
+	switch {
+	case ms < 0:
+		return time.Time{}, rpcFail(CodeInvalidArgument, field+" must not be negative")
+	case ms == 0:
+		return time.Time{}, nil
+	}
+	return time.UnixMilli(ms), nil
+}
+
+func (s *cacheService) Set(ctx context.Context, req *pb.SetRequest) (*pb.SetResponse, error) {
+	ttl, err := rpcMillis(req.TtlMs, "ttl_ms")
+	if err != nil {
+		return nil, err
+	}
+	at, err := rpcTime(req.ExpireAtMs, "expire_at_ms")
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.db(ctx).SetWith(string(req.Key), string(req.Value), store.SetOptions{
+		NX: req.Nx, XX: req.Xx, Get: req.Get, KeepTTL: req.KeepTtl, TTL: ttl, ExpireAt: at,
+	})
+	if err != nil {
+		return nil, s.fail(ctx, "set string", err)
+	}
+	return &pb.SetResponse{Set: res.Set, Old: []byte(res.Old), Existed: res.Existed}, nil
+}
+
+func (s *cacheService) Get(ctx context.Context, req *pb.KeyRequest) (*pb.ValueResponse, error) {
+	return s.GetEx(ctx, &pb.GetExRequest{Key: req.Key})
+}
+
+func (s *cacheService) GetEx(ctx context.Context, req *pb.GetExRequest) (*pb.ValueResponse, error) {
+	ttl, err := rpcMillis(req.TtlMs, "ttl_ms")
+	if err != nil {
+		return nil, err
+	}
+	at, err := rpcTime(req.ExpireAtMs, "expire_at_ms")
+	if err != nil {
+		return nil, err
+	}
+	value, ok, err := s.db(ctx).GetEx(string(req.Key), store.GetExOptions{TTL: ttl, ExpireAt: at, Persist: req.Persist})
+	if err != nil {
+		return nil, s.fail(ctx, "get string", err)
+	}
+	if !ok {
+		return nil, rpcFail(CodeNotFound, "key not found")
+	}
+	return &pb.ValueResponse{Value: []byte(value)}, nil
+}
+
+func (s *cacheService) GetDel(ctx context.Context, req *pb.KeyRequest) (*pb.ValueResponse, error) {
+	value, ok, err := s.db(ctx).GetDel(string(req.Key))
+	if err != nil {
+		return nil, s.fail(ctx, "get and delete string", err)
+	}
+	if !ok {
+		return nil, rpcFail(CodeNotFound, "key not found")
+	}
+	return &pb.ValueResponse{Value: []byte(value)}, nil
+}
+
+func (s *cacheService) Update(ctx context.Context, req *pb.UpdateRequest) (*pb.UpdateResponse, error) {
+	ok, err := s.db(ctx).Update(string(req.Key), string(req.Value))
+	if err != nil {
+		return nil, s.fail(ctx, "update string", err)
+	}
+	if !ok {
+		return nil, s.missing(ctx, string(req.Key), store.StringType)
+	}
+	return &pb.UpdateResponse{}, nil
+}
+
+func (s *cacheService) CreateList(ctx context.Context, req *pb.CreateListRequest) (*pb.CreateListResponse, error) {
+	ttl, err := rpcMillis(req.TtlMs, "ttl_ms")
+	if err != nil {
+		return nil, err
+	}
+	ok, err := s.db(ctx).CreateList(string(req.Key), ttl)
+	if err != nil {
+		return nil, s.fail(ctx, "create list", err)
+	}
+	if !ok {
+		return nil, rpcFail(CodeConflict, "Failed to create list, key exists")
+	}
+	return &pb.CreateListResponse{}, nil
+}
+
+func (s *cacheService) GetList(ctx context.Context, req *pb.KeyRequest) (*pb.GetListResponse, error) {
+	list, err := s.db(ctx).GetList(string(req.Key))
+	if err != nil {
+		return nil, s.missing(ctx, string(req.Key), store.ListType)
+	}
+	values := make([][]byte, len(list))
+	for i, v := range list {
+		values[i] = []byte(v)
+	}
+	return &pb.GetListResponse{Values: values}, nil
+}
+
+func (s *cacheService) Push(ctx context.Context, req *pb.PushRequest) (*pb.PushResponse, error) {
+	ok, err := s.db(ctx).Push(string(req.Key), string(req.Value))
+	if err != nil {
+		return nil, s.fail(ctx, "push", err)
+	}
+	if !ok {
+		return nil, s.missing(ctx, string(req.Key), store.ListType)
+	}
+	return &pb.PushResponse{}, nil
+}
+
+func (s *cacheService) Pop(ctx context.Context, req *pb.KeyRequest) (*pb.ValueResponse, error) {
+	value, ok, err := s.db(ctx).Pop(string(req.Key))
+	if err != nil {
+		return nil, s.fail(ctx, "pop", err)
+	}
+	if !ok {
+		if t, found := s.db(ctx).Type(string(req.Key)); found && t == store.ListType {
+			return nil, rpcFail(CodeNotFound, "list is empty")
+		}
+		return nil, s.missing(ctx, string(req.Key), store.ListType)
+	}
+	return &pb.ValueResponse{Value: []byte(value)}, nil
+}
+
+func (s *cacheService) GetTTL(ctx context.Context, req *pb.KeyRequest) (*pb.GetTTLResponse, error) {
+	ttl, ok := s.db(ctx).GetTTL(string(req.Key))
+	if !ok {
+		return nil, rpcFail(CodeNotFound, "key not found")
+	}
+	if ttl < 0 {
+		return &pb.GetTTLResponse{TtlMs: -1}, nil
+	}
+	return &pb.GetTTLResponse{TtlMs: ttl.Milliseconds()}, nil
+}
+
+func (s *cacheService) Expire(ctx context.Context, req *pb.ExpireRequest) (*pb.ExpireResponse, error) {
+	ttl, err := rpcMillis(req.TtlMs, "ttl_ms")
+	if err != nil {
+		return nil, err
+	}
+	at, err := rpcTime(req.AtMs, "at_ms")
+	if err != nil {
+		return nil, err
+	}
+	ok, err := s.db(ctx).Expire(string(req.Key), ttl, store.ExpireOptions{
+		NX: req.Nx, XX: req.Xx, GT: req.Gt, LT: req.Lt, At: at,
+	})
+	if err != nil {
+		return nil, s.fail(ctx, "set ttl", err)
+	}
+	return &pb.ExpireResponse{Updated: ok}, nil
+}
+
+func (s *cacheService) Persist(ctx context.Context, req *pb.KeyRequest) (*pb.ExpireResponse, error) {
+	ok, err := s.db(ctx).Persist(string(req.Key))
+	if err != nil {
+		return nil, s.fail(ctx, "persist", err)
+	}
+	return &pb.ExpireResponse{Updated: ok}, nil
+}
+
+func (s *cacheService) ExpireTime(ctx context.Context, req *pb.KeyRequest) (*pb.ExpireTimeResponse, error) {
+	at, ok := s.db(ctx).ExpireTime(string(req.Key))
+	if !ok {
+		return nil, rpcFail(CodeNotFound, "key not found")
+	}
+	if at.IsZero() {
+		return &pb.ExpireTimeResponse{ExpireAtMs: -1}, nil
+	}
+	return &pb.ExpireTimeResponse{ExpireAtMs: at.UnixMilli()}, nil
+}
+
+func (s *cacheService) Delete(ctx context.Context, req *pb.KeyRequest) (*pb.DeleteResponse, error) {
+	deleted, err := s.db(ctx).Remove(string(req.Key))
+	if err != nil {
+		return nil, s.fail(ctx, "delete", err)
+	}
+	return &pb.DeleteResponse{Deleted: deleted}, nil
+}
+
+func (s *cacheService) Type(ctx context.Context, req *pb.KeyRequest) (*pb.TypeResponse, error) {
+	t, ok := s.db(ctx).Type(string(req.Key))
+	if !ok {
+		return nil, rpcFail(CodeNotFound, "key not found")
+	}
+	return &pb.TypeResponse{Type: t.String()}, nil
+}
+
+func (s *cacheService) DBSize(ctx context.Context, _ *pb.DBSizeRequest) (*pb.DBSizeResponse, error) {
+	return &pb.DBSizeResponse{Keys: int64(s.db(ctx).Size())}, nil
+}
+
+func (s *cacheService) Publish(ctx context.Context, req *pb.PublishRequest) (*pb.PublishResponse, error) {
+	if req.Channel == "" {
+		return nil, rpcFail(CodeInvalidArgument, "channel is required")
+	}
+	n := s.h.store.Publish(req.Channel, string(req.Message))
+	return &pb.PublishResponse{Receivers: int64(n)}, nil
+}
+
+func (s *cacheService) Subscribe(req *pb.SubscribeRequest, stream pb.Cache_SubscribeServer) error {
+	if len(req.Channels) == 0 && len(req.Patterns) == 0 {
+		return rpcFail(CodeInvalidArgument, "at least one channel or pattern is required")
+	}
+	sub, err := s.h.store.Subscribe(req.Channels, req.Patterns)
+	if err != nil {
+		return rpcFail(CodeInvalidArgument, "invalid pattern: "+err.Error())
+	}
+	defer sub.Close()
+
+	// Send the headers right away so the client knows it is subscribed
+	if err := stream.SendHeader(nil); err != nil {
+		return err
+	}
+	ctx := stream.Context()
+	for {
+		select {
+		case msg := <-sub.C:
+			err := stream.Send(&pb.Message{Channel: msg.Channel, Pattern: msg.Pattern, Payload: []byte(msg.Payload)})
+			if err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		case <-s.h.monitor.closed:
+			return nil
+		}
+	}
+}
+
+func (s *cacheService) Monitor(_ *pb.MonitorRequest, stream pb.Cache_MonitorServer) error {
+	ch := s.h.monitor.subscribe()
+	defer s.h.monitor.unsubscribe(ch)
+
+	if err := stream.SendHeader(nil); err != nil {
+		return err
+	}
+	ctx := stream.Context()
+	for {
+		select {
+		case cmd := <-ch:
+			// Args are strings in the proto, so like the JSON of MONITOR
+			// over HTTP they cannot carry invalid UTF-8
+			args := make([]string, len(cmd.Args))
+			for i, a := range cmd.Args {
+				args[i] = strings.ToValidUTF8(a, "\uFFFD")
+			}
+			err := stream.Send(&pb.CommandEvent{
+				TimeUnixMicros: cmd.Time.UnixMicro(),
+				Client:         cmd.Client,
+				User:           cmd.User,
+				Method:         cmd.Method,
+				Route:          cmd.Route,
+				Db:             cmd.DB,
+				Key:            []byte(cmd.Key),
+				Args:           args,
+				Status:         int32(cmd.Status),
+				DurationUs:     cmd.DurationMicros,
+			})
+			if err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		case <-s.h.monitor.closed:
+			return nil
+		}
+	}
+}
@@ -1,24 +1,80 @@
 package handlers
 
 import (
-	"fmt"
-	"strconv"
+	"errors"
+	"log/slog"
+	"sync/atomic"
 	"time"
 
+	"github.com/dhanushcrueiso/coding-test/internal/acl"
+	"github.com/dhanushcrueiso/coding-test/internal/config"
+	"github.com/dhanushcrueiso/coding-test/internal/logging"
+	"github.com/dhanushcrueiso/coding-test/internal/openapi"
+	"github.com/dhanushcrueiso/coding-test/internal/quota"
+	"github.com/dhanushcrueiso/coding-test/internal/raft"
 	"github.com/dhanushcrueiso/coding-test/internal/store"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 type Handler struct {
-	store *store.DataObj
+	store   *store.DataObj
+	cluster *raft.Node
+	config  *config.Manager
+	logger  *slog.Logger
+	metrics *httpMetrics
+
+	persister *store.Persister
+	version   string
+	started   time.Time
+	commands  atomic.Int64
+	slowlog   *slowLog
+	monitor   *monitor
+	acl       *acl.Registry
+	quotas    *quota.Registry
+	spec      []byte
+	specIndex *openapi.Index
+}
+
+// Option configures optional parts of the Handler
+type Option func(*Handler)
+
+// WithCluster enables the cluster routes and read/write routing for a store
+// replicated with raft
+func WithCluster(node *raft.Node) Option {
+	return func(h *Handler) {
+		h.cluster = node
+	}
+}
+
+// WithConfig enables the runtime config routes
+func WithConfig(m *config.Manager) Option {
+	return func(h *Handler) {
+		h.config = m
+	}
+}
+
+// WithLogger sets the logger used for request and error logs
+func WithLogger(l *slog.Logger) Option {
+	return func(h *Handler) {
+		h.logger = l
+	}
 }
 
 // NewServer creates a new HTTP server with the store
-func NewServer() *Handler {
-	return &Handler{
-		store: store.NewRedisMemoryStore(),
+func NewServer(s *store.DataObj, opts ...Option) *Handler {
+	h := &Handler{
+		store:   s,
+		logger:  logging.Discard(),
+		version: "dev",
+		started: time.Now(),
+		slowlog: newSlowLog(0, 0),
+		monitor: newMonitor(),
+	}
+	for _, opt := range opts {
+		opt(h)
 	}
+	return h
 }
 
 func (h *Handler) GetHealth(c *fiber.Ctx) error {
@@ -28,16 +84,13 @@ func (h *Handler) GetHealth(c *fiber.Ctx) error {
 
 }
 
+// SetStringData stores a string. The query options of SET are accepted,
+// see parseSetOptions.
 func (h *Handler) SetStringData(c *fiber.Ctx) error {
-	var ttl time.Duration = 0
-	ttlStr := c.Query("ttl")
-	if ttlStr != "" {
-		ttlSeconds, err := strconv.Atoi(ttlStr)
-		if err != nil || ttlSeconds < 0 {
-			return c.Status(400).JSON(fiber.Map{
-				"error": "invalid ttl value"})
-		}
-		ttl = time.Duration(ttlSeconds) * time.Second
+	opts, err := parseSetOptions(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error()})
 	}
 
 	if c.Body() == nil {
@@ -45,34 +98,82 @@ func (h *Handler) SetStringData(c *fiber.Ctx) error {
 			"error": "request body is required"})
 	}
 
-	var data struct {
-		Value string `json:"value"`
-	}
-	if err := c.BodyParser(&data); err != nil {
+	value, err := bodyValue(c)
+	if err != nil {
 		return c.Status(400).JSON(fiber.Map{
 			"error": "invalid request body"})
 	}
-	fmt.Println(ttl)
-	err := h.store.Set(c.Params("key"), data.Value, &ttl)
+	p, ok := h.preconditions(c, keyParam(c))
+	if !ok {
+		return preconditionFailed(c)
+	}
+	opts.IfVersion, opts.NX = p.version, opts.NX || p.absent
+	h.log(c).Debug("set string", logging.KeyAttr, keyParam(c), "ttl", opts.TTL)
+	res, err := h.db(c).SetWith(keyParam(c), value, opts)
+	if status, ok := storageStatus(err); ok {
+		return failWith(c, status, err)
+	}
+	if errors.Is(err, store.ErrVersionMismatch) || errors.Is(err, store.ErrNoSuchKey) || (p.absent && !res.Set) {
+		// The key changed after the preconditions were checked
+		return preconditionFailed(c)
+	}
+	if errors.Is(err, store.ErrConflictingOptions) || errors.Is(err, store.ErrWrongType) {
+		return stringError(c, err)
+	}
 	if err != nil {
+		h.log(c).Error("set string failed", logging.KeyAttr, keyParam(c), "err", err)
 		return c.Status(500).JSON(fiber.Map{
 			"error": "failed to set data"})
 	}
-	return c.Status(200).JSON(fiber.Map{
-		"message": "data set successfully"})
+
+	if res.Set {
+		c.Set(fiber.HeaderETag, etag(res.Version))
+	}
+	out := fiber.Map{
+		"message": "data set successfully",
+		"set":     res.Set,
+	}
+	if !res.Set {
+		out["message"] = "data not set"
+	}
+	if opts.Get {
+		out["old"] = nil
+		if res.Existed {
+			out["old"] = res.Old
+		}
+	}
+	return c.Status(200).JSON(out)
 }
 
 func (h *Handler) GetStringData(c *fiber.Ctx) error {
-	key := c.Params("key")
+	key := keyParam(c)
 	if key == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error": "key is required"})
 	}
-	value, dataType, found := h.store.Get(key)
+	e, err := parseExpiration(c)
+	if err != nil {
+		return stringError(c, err)
+	}
+	if e.given > 0 || c.QueryBool("persist") {
+		return h.getEx(c, key, e)
+	}
+	value, dataType, version, found := h.db(c).GetVersioned(key)
 	if !found {
 		return c.Status(404).JSON(fiber.Map{
 			"error": "data not found"})
 	}
+	if notModified(c, version) {
+		return nil
+	}
+	if wantsRaw(c) {
+		s, ok := value.(string)
+		if !ok {
+			return c.Status(406).JSON(fiber.Map{
+				"error": "only string values can be sent as " + OctetStream})
+		}
+		return sendRaw(c, s)
+	}
 	return c.JSON(fiber.Map{
 		"key":   key,
 		"value": value,
@@ -81,37 +182,64 @@ func (h *Handler) GetStringData(c *fiber.Ctx) error {
 }
 
 func (h *Handler) UpdateStringData(c *fiber.Ctx) error {
-	key := c.Params("key")
+	key := keyParam(c)
 	if key == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error": "key is required"})
 	}
 
-	var data struct {
-		Value string `json:"value"`
-	}
-	if err := c.BodyParser(&data); err != nil {
+	value, err := bodyValue(c)
+	if err != nil {
 		return c.Status(400).JSON(fiber.Map{
 			"error": "invalid request body"})
 	}
 
-	if h.store.Update(key, data.Value) {
+	p, ok := h.preconditions(c, key)
+	if !ok {
+		return preconditionFailed(c)
+	}
+	if p.absent {
+		// Only an existing key can be updated
+		return preconditionFailed(c)
+	}
+	version, ok, err := h.db(c).UpdateVersion(key, value, p.version)
+	if status, full := storageStatus(err); full {
+		return failWith(c, status, err)
+	}
+	if errors.Is(err, store.ErrVersionMismatch) || (p.version != 0 && !ok) {
+		return preconditionFailed(c)
+	}
+	if ok {
+		c.Set(fiber.HeaderETag, etag(version))
 		return c.Status(200).JSON(fiber.Map{
 			"message": "data updated successfully"})
 	} else {
-		return c.Status(404).JSON(fiber.Map{
-			"error": "data not found"})
+		return h.missing(c, 404, key, store.StringType)
 	}
 
 }
 
 func (h *Handler) DeleteStringData(c *fiber.Ctx) error {
-	key := c.Params("key")
+	key := keyParam(c)
 	if key == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error": "key is required"})
 	}
-	if h.store.Remove(key) {
+	p, ok := h.preconditions(c, key)
+	if !ok {
+		return preconditionFailed(c)
+	}
+	if c.QueryBool("get") {
+		return h.getDel(c, key, p.version)
+	}
+	if p.version != 0 {
+		return h.removeVersion(c, key, p.version, "data deleted successfully")
+	}
+	removed, err := h.db(c).Remove(key)
+	if err != nil {
+		return stringError(c, err)
+	}
+	if removed {
 		return c.Status(200).JSON(fiber.Map{
 			"message": "data deleted successfully"})
 	} else {
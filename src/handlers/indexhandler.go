@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/dhanushcrueiso/coding-test/internal/store"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// defaultQueryLimit is how many keys or groups a query returns unless it
+// asks for another number
+const defaultQueryLimit = 10
+
+// indexError responds to a failed index command
+func indexError(c *fiber.Ctx, err error) error {
+	status := 500
+	if s, ok := storageStatus(err); ok {
+		status = s
+	} else {
+		switch {
+		case errors.Is(err, store.ErrInvalidIndex), errors.Is(err, store.ErrInvalidQuery):
+			status = 400
+		case errors.Is(err, store.ErrNoSuchIndex):
+			status = 404
+		case errors.Is(err, store.ErrIndexExists):
+			status = 409
+		}
+	}
+	return failWith(c, status, err)
+}
+
+func (h *Handler) ListIndexes(c *fiber.Ctx) error {
+	return c.Status(200).JSON(h.db(c).Indexes())
+}
+
+func (h *Handler) GetIndex(c *fiber.Ctx) error {
+	info, err := h.db(c).Index(c.Params("name"))
+	if err != nil {
+		return indexError(c, err)
+	}
+	return c.Status(200).JSON(info)
+}
+
+// CreateIndex defines an index named in the path over the body's
+// prefixes and fields
+func (h *Handler) CreateIndex(c *fiber.Ctx) error {
+	var def store.IndexDef
+	if err := c.BodyParser(&def); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body"})
+	}
+	def.Name = c.Params("name")
+	if err := h.db(c).CreateIndex(def); err != nil {
+		return indexError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"message": "index created"})
+}
+
+func (h *Handler) DropIndex(c *fiber.Ctx) error {
+	if err := h.db(c).DropIndex(c.Params("name")); err != nil {
+		return indexError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"message": "index dropped"})
+}
+
+// QueryIndex runs the body's query. Keys the user may not access are left
+// out, from the counts and groups too.
+func (h *Handler) QueryIndex(c *fiber.Ctx) error {
+	var data struct {
+		store.QueryOptions
+		Query string `json:"query"`
+		Limit *int   `json:"limit"`
+	}
+	if err := c.BodyParser(&data); err != nil || data.Query == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body"})
+	}
+	opts := data.QueryOptions
+	opts.Limit = defaultQueryLimit
+	if data.Limit != nil {
+		opts.Limit = *data.Limit
+	}
+	if user := currentUser(c); user != nil {
+		opts.Allow = user.CanAccess
+	}
+	res, err := h.db(c).Query(c.Params("name"), data.Query, opts)
+	if err != nil {
+		return indexError(c, err)
+	}
+	if len(opts.GroupBy) > 0 || len(opts.Reduce) > 0 {
+		return c.Status(200).JSON(fiber.Map{
+			"total":  res.Total,
+			"groups": res.Groups})
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"total": res.Total,
+		"docs":  res.Docs})
+}
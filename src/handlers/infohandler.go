@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/dhanushcrueiso/coding-test/internal/store"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// infoSections are reported in this order when no section is requested
+var infoSections = []string{"server", "clients", "stats", "memory", "keyspace", "persistence", "replication"}
+
+// WithPersister reports the state of p in the persistence INFO section
+func WithPersister(p *store.Persister) Option {
+	return func(h *Handler) {
+		h.persister = p
+	}
+}
+
+// WithVersion sets the version reported in the server INFO section
+func WithVersion(v string) Option {
+	return func(h *Handler) {
+		h.version = v
+	}
+}
+
+// GetInfo reports server state in the sections named by the comma
+// separated section query parameter, or all of them
+func (h *Handler) GetInfo(c *fiber.Ctx) error {
+	sections := infoSections
+	if q := c.Query("section"); q != "" && q != "all" {
+		sections = nil
+		for _, name := range strings.Split(q, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if !validSection(name) {
+				return c.Status(400).JSON(fiber.Map{
+					"error": "unknown section: " + name})
+			}
+			sections = append(sections, name)
+		}
+	}
+
+	out := fiber.Map{}
+	var stats *store.Stats
+	keyStats := func() store.Stats {
+		if stats == nil {
+			st := h.store.Stats()
+			stats = &st
+		}
+		return *stats
+	}
+	for _, name := range sections {
+		switch name {
+		case "server":
+			out[name] = h.serverInfo()
+		case "clients":
+			out[name] = fiber.Map{
+				"connected_clients": c.App().Server().GetOpenConnectionsCount(),
+			}
+		case "stats":
+			st := keyStats()
+			out[name] = fiber.Map{
+				"total_commands_processed":      h.commands.Load(),
+				"expired_keys":                  st.Expired,
+				"evicted_keys":                  st.Evicted,
+				"last_cleanup":                  formatTime(st.LastCleanup),
+				"last_cleanup_duration_seconds": st.LastCleanupDuration.Seconds(),
+			}
+		case "memory":
+			st := keyStats()
+			var m runtime.MemStats
+			runtime.ReadMemStats(&m)
+			out[name] = fiber.Map{
+				"used_memory":     st.UsedMemory,
+				"max_memory":      st.MaxMemory,
+				"eviction_policy": h.evictionPolicy(),
+				"heap_alloc":      m.HeapAlloc,
+				"heap_sys":        m.HeapSys,
+			}
+		case "keyspace":
+			st := keyStats()
+			keys := fiber.Map{}
+			total := 0
+			for _, t := range store.DataTypes {
+				keys[t.String()] = st.Keys[t]
+				total += st.Keys[t]
+			}
+			out[name] = fiber.Map{
+				"keys":            total,
+				"keys_by_type":    keys,
+				"expires":         st.Expires,
+				"avg_ttl_seconds": st.AvgTTL.Seconds(),
+				"namespaces":      h.store.Namespaces(),
+			}
+		case "persistence":
+			out[name] = h.persistenceInfo()
+		case "replication":
+			out[name] = h.replicationInfo()
+		}
+	}
+	return c.Status(200).JSON(out)
+}
+
+func validSection(name string) bool {
+	for _, s := range infoSections {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Handler) serverInfo() fiber.Map {
+	uptime := time.Since(h.started)
+	return fiber.Map{
+		"version":        h.version,
+		"go_version":     runtime.Version(),
+		"os":             runtime.GOOS + "/" + runtime.GOARCH,
+		"process_id":     os.Getpid(),
+		"started_at":     formatTime(h.started),
+		"uptime_seconds": int64(uptime.Seconds()),
+	}
+}
+
+func (h *Handler) evictionPolicy() string {
+	if h.config == nil {
+		return store.PolicyNoEviction
+	}
+	return h.config.Config().EvictionPolicy
+}
+
+func (h *Handler) persistenceInfo() fiber.Map {
+	if h.persister == nil {
+		return fiber.Map{"enabled": false}
+	}
+	last, err := h.persister.Status()
+	info := fiber.Map{
+		"enabled":      true,
+		"file":         h.persister.Path(),
+		"last_save":    formatTime(last),
+		"last_save_ok": err == nil,
+	}
+	if err != nil {
+		info["last_save_error"] = err.Error()
+	}
+	return info
+}
+
+func (h *Handler) replicationInfo() fiber.Map {
+	if h.cluster == nil {
+		return fiber.Map{"mode": "standalone"}
+	}
+	st := h.cluster.Status()
+	return fiber.Map{
+		"mode":           "raft",
+		"node_id":        st.ID,
+		"role":           st.State,
+		"term":           st.Term,
+		"leader_id":      st.LeaderID,
+		"commit_index":   st.CommitIndex,
+		"last_applied":   st.LastApplied,
+		"snapshot_index": st.SnapshotIndex,
+		"members":        len(st.Servers),
+	}
+}
+
+// formatTime renders t as RFC 3339, or null for the zero time
+func formatTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/dhanushcrueiso/coding-test/internal/store"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// jsonError responds to a failed JSON command
+func jsonError(c *fiber.Ctx, err error) error {
+	status := 500
+	if s, ok := storageStatus(err); ok {
+		status = s
+	} else {
+		switch {
+		case errors.Is(err, store.ErrInvalidPath), errors.Is(err, store.ErrInvalidJSON),
+			errors.Is(err, store.ErrNumberRange), errors.Is(err, store.ErrConflictingOptions):
+			status = 400
+		case errors.Is(err, store.ErrNoSuchKey):
+			status = 404
+		case errors.Is(err, store.ErrWrongType):
+			status = 409
+		}
+	}
+	return failWith(c, status, err)
+}
+
+// GetJSON returns the document under the key, or with ?path the values
+// the path selects in it
+func (h *Handler) GetJSON(c *fiber.Ctx) error {
+	key, path := keyParam(c), c.Query("path")
+	values, version, err := h.db(c).JSONGet(key, path)
+	if err != nil {
+		return jsonError(c, err)
+	}
+	if notModified(c, version) {
+		return nil
+	}
+	if path == "" {
+		return c.JSON(fiber.Map{
+			"key":   key,
+			"value": values[0],
+			"type":  store.JSONType,
+		})
+	}
+	return c.JSON(fiber.Map{
+		"key":    key,
+		"path":   path,
+		"values": values,
+	})
+}
+
+// SetJSON sets the body's value at ?path, the root if none is given, under
+// the conditions ?nx and ?xx
+func (h *Handler) SetJSON(c *fiber.Ctx) error {
+	var data struct {
+		Value json.RawMessage `json:"value"`
+	}
+	if err := c.BodyParser(&data); err != nil || len(data.Value) == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body"})
+	}
+	set, err := h.db(c).JSONSet(keyParam(c), c.Query("path"), string(data.Value), store.JSONSetOptions{
+		NX: c.QueryBool("nx"),
+		XX: c.QueryBool("xx"),
+	})
+	if err != nil {
+		return jsonError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"message": "data set successfully",
+		"set":     set})
+}
+
+// DeleteJSON deletes the values ?path selects, or the key without a path
+func (h *Handler) DeleteJSON(c *fiber.Ctx) error {
+	n, err := h.db(c).JSONDel(keyParam(c), c.Query("path"))
+	if err != nil {
+		return jsonError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"deleted": n})
+}
+
+func (h *Handler) JSONNumIncrBy(c *fiber.Ctx) error {
+	var data struct {
+		By json.Number `json:"by"`
+	}
+	if err := c.BodyParser(&data); err != nil || data.By == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body"})
+	}
+	values, err := h.db(c).JSONNumIncrBy(keyParam(c), c.Query("path"), data.By)
+	if err != nil {
+		return jsonError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"values": values})
+}
+
+func (h *Handler) JSONArrAppend(c *fiber.Ctx) error {
+	var data struct {
+		Values []json.RawMessage `json:"values"`
+	}
+	if err := c.BodyParser(&data); err != nil || len(data.Values) == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body"})
+	}
+	values := make([]string, len(data.Values))
+	for i, v := range data.Values {
+		values[i] = string(v)
+	}
+	lengths, err := h.db(c).JSONArrAppend(keyParam(c), c.Query("path"), values...)
+	if err != nil {
+		return jsonError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"lengths": lengths})
+}
+
+// JSONArrPop pops the element at the body's index, the last one by default
+func (h *Handler) JSONArrPop(c *fiber.Ctx) error {
+	data := struct {
+		Index *int `json:"index"`
+	}{}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&data); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "invalid request body"})
+		}
+	}
+	index := -1
+	if data.Index != nil {
+		index = *data.Index
+	}
+	values, err := h.db(c).JSONArrPop(keyParam(c), c.Query("path"), index)
+	if err != nil {
+		return jsonError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"values": values})
+}
+
+func (h *Handler) JSONStrLen(c *fiber.Ctx) error {
+	lengths, err := h.db(c).JSONStrLen(keyParam(c), c.Query("path"))
+	if err != nil {
+		return jsonError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"lengths": lengths})
+}
+
+func (h *Handler) JSONObjKeys(c *fiber.Ctx) error {
+	keys, err := h.db(c).JSONObjKeys(keyParam(c), c.Query("path"))
+	if err != nil {
+		return jsonError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"keys": keys})
+}
+
+func (h *Handler) JSONType(c *fiber.Ctx) error {
+	types, err := h.db(c).JSONTypes(keyParam(c), c.Query("path"))
+	if err != nil {
+		return jsonError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"types": types})
+}
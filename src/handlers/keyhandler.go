@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// KeyEncodingHeader selects how the :key route param is encoded. Keys are
+// percent-encoded by default; with "base64url" they are unpadded base64url.
+// Either way a key may hold any bytes, including "/".
+const KeyEncodingHeader = "X-Key-Encoding"
+
+// OctetStream is the content type of raw string values. Sending a value with
+// it, or asking for it in Accept, skips JSON so values may hold any bytes.
+const OctetStream = fiber.MIMEOctetStream
+
+const keyLocal = "key"
+
+var errInvalidKey = errors.New("invalid key encoding")
+
+func decodeKey(c *fiber.Ctx) (string, error) {
+	raw := c.Params("key")
+	switch enc := strings.ToLower(c.Get(KeyEncodingHeader)); enc {
+	case "", "percent":
+		k, err := url.PathUnescape(raw)
+		if err != nil {
+			return "", errInvalidKey
+		}
+		return k, nil
+	case "base64url":
+		k, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(raw, "="))
+		if err != nil {
+			return "", errInvalidKey
+		}
+		return string(k), nil
+	}
+	return "", errors.New("unknown " + KeyEncodingHeader + " value")
+}
+
+// keyParam returns the decoded :key param of the request
+func keyParam(c *fiber.Ctx) string {
+	if k, ok := c.Locals(keyLocal).(string); ok {
+		return k
+	}
+	k, _ := decodeKey(c)
+	return k
+}
+
+// checkKey decodes the :key param once and keeps it for keyParam. It
+// fails for a malformed key.
+func checkKey(c *fiber.Ctx) error {
+	if c.Params("key") == "" {
+		return nil
+	}
+	k, err := decodeKey(c)
+	if err != nil {
+		return err
+	}
+	c.Locals(keyLocal, k)
+	return nil
+}
+
+// param returns a percent-decoded route param such as a stream group name
+func param(c *fiber.Ctx, name string) string {
+	raw := c.Params(name)
+	if v, err := url.PathUnescape(raw); err == nil {
+		return v
+	}
+	return raw
+}
+
+// wantsRaw reports whether the client asked for raw value bytes
+func wantsRaw(c *fiber.Ctx) bool {
+	accept := c.Get(fiber.HeaderAccept)
+	return strings.Contains(accept, OctetStream) && !strings.Contains(accept, "json")
+}
+
+// sendRaw responds with the bytes of value
+func sendRaw(c *fiber.Ctx, value string) error {
+	c.Set(fiber.HeaderContentType, OctetStream)
+	return c.Status(200).SendString(value)
+}
+
+// isRaw reports whether the request body is a raw value
+func isRaw(c *fiber.Ctx) bool {
+	return strings.HasPrefix(c.Get(fiber.HeaderContentType), OctetStream)
+}
+
+// bodyValue reads the value of a string or list write: the body itself for
+// application/octet-stream, else the "value" field of a JSON body
+func bodyValue(c *fiber.Ctx) (string, error) {
+	if isRaw(c) {
+		return string(c.Body()), nil
+	}
+	var data struct {
+		Value string `json:"value"`
+	}
+	if err := c.BodyParser(&data); err != nil {
+		return "", err
+	}
+	return data.Value, nil
+}
@@ -1,19 +1,22 @@
 package handlers
 
 import (
-	"strconv"
 	"time"
 
+	"github.com/dhanushcrueiso/coding-test/internal/store"
+
 	"github.com/gofiber/fiber/v2"
 )
 
 func (h *Handler) GetListData(c *fiber.Ctx) error {
-	key := c.Params("key")
-	data, err := h.store.GetList(key)
-	if err != nil {
-		return c.Status(404).JSON(fiber.Map{
-			"error": "Data Not found",
-		})
+	key := keyParam(c)
+	value, dataType, version, found := h.db(c).GetVersioned(key)
+	data, ok := value.([]string)
+	if !found || dataType != store.ListType || !ok {
+		return h.missing(c, 404, key, store.ListType)
+	}
+	if notModified(c, version) {
+		return nil
 	}
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "List data retrieved successfully",
@@ -22,66 +25,91 @@ func (h *Handler) GetListData(c *fiber.Ctx) error {
 }
 
 func (h *Handler) SetListData(c *fiber.Ctx) error {
-	key := c.Params("key")
-	var ttl time.Duration = 0
-	ttlStr := c.Query("ttl")
-	if ttlStr != "" {
-		ttlSeconds, err := strconv.Atoi(ttlStr)
-		if err != nil || ttlSeconds < 0 {
+	key := keyParam(c)
+	e, err := parseExpiration(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error()})
+	}
+	ttl := e.TTL
+	if !e.At.IsZero() {
+		if ttl = time.Until(e.At); ttl <= 0 {
 			return c.Status(400).JSON(fiber.Map{
-				"error": "invalid ttl value"})
+				"error": "expiration is in the past"})
 		}
-		ttl = time.Duration(ttlSeconds) * time.Second
 	}
 
-	if h.store.CreateList(key, ttl) {
+	ok, err := h.db(c).CreateList(key, ttl)
+	if status, full := storageStatus(err); full {
+		return failWith(c, status, err)
+	}
+	if ok {
 		return c.Status(200).JSON(fiber.Map{
 			"message": "List created successfully"})
 	} else {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Failed to create list"})
+		return fail(c, 400, CodeConflict, "Failed to create list, key exists")
 	}
 }
 
 func (h *Handler) DeleteListData(c *fiber.Ctx) error {
-	key := c.Params("key")
-	if h.store.Remove(key) {
+	key := keyParam(c)
+	p, ok := h.preconditions(c, key)
+	if !ok {
+		return preconditionFailed(c)
+	}
+	if p.version != 0 {
+		return h.removeVersion(c, key, p.version, "List deleted successfully")
+	}
+	removed, err := h.db(c).Remove(key)
+	if err != nil {
+		return stringError(c, err)
+	}
+	if removed {
 		return c.Status(200).JSON(fiber.Map{
 			"message": "List deleted successfully"})
 	} else {
-		return c.Status(400).JSON(fiber.Map{"message": "Failed to delete list,key not found"})
+		return fail(c, 400, CodeNotFound, "Failed to delete list,key not found")
 	}
 
 }
 
 func (h *Handler) UpdateListData(c *fiber.Ctx) error {
-	key := c.Params("key")
+	key := keyParam(c)
 	operation := c.Params("operation")
 	if operation == "push" {
 		if c.Body() == nil {
 			return c.Status(400).JSON(fiber.Map{
 				"error": "request body is required"})
 		}
-		var data struct {
-			Value string `json:"value"`
-		}
-		if err := c.BodyParser(&data); err != nil {
+		value, err := bodyValue(c)
+		if err != nil {
 			return c.Status(400).JSON(fiber.Map{
 				"error": "invalid request body"})
 		}
-		if h.store.Push(key, data.Value) {
+		ok, err := h.db(c).Push(key, value)
+		if status, full := storageStatus(err); full {
+			return failWith(c, status, err)
+		}
+		if ok {
 			return c.Status(200).JSON(fiber.Map{
 				"message": "added to list successfully"})
 		} else {
-			return c.Status(400).JSON(fiber.Map{
-				"error": "Failed to add to list"})
+			return h.missing(c, 400, key, store.ListType)
 		}
 
 	} else {
-		value, success := h.store.Pop(key)
+		value, success, err := h.db(c).Pop(key)
+		if err != nil {
+			return stringError(c, err)
+		}
 		if !success {
-			return c.Status(400).JSON(fiber.Map{
-				"error": "Failed to pop from list or key not found"})
+			if _, t, found := h.db(c).Get(key); found && t == store.ListType {
+				return fail(c, 400, CodeNotFound, "list is empty")
+			}
+			return h.missing(c, 400, key, store.ListType)
+		}
+		if wantsRaw(c) {
+			return sendRaw(c, value)
 		}
 		return c.Status(200).JSON(fiber.Map{
 			"message": "Popped from list successfully",
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/dhanushcrueiso/coding-test/internal/store"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// lockError responds to a failed lock command
+func lockError(c *fiber.Ctx, err error) error {
+	status := 500
+	if s, ok := storageStatus(err); ok {
+		status = s
+	} else {
+		switch {
+		case errors.Is(err, store.ErrInvalidTTL):
+			status = 400
+		case errors.Is(err, store.ErrNoSuchKey):
+			status = 404
+		case errors.Is(err, store.ErrLockHeld), errors.Is(err, store.ErrLockNotHeld),
+			errors.Is(err, store.ErrWrongType):
+			status = 409
+		}
+	}
+	return failWith(c, status, err)
+}
+
+type lockRequest struct {
+	Owner  string `json:"owner"`
+	TTLMs  int    `json:"ttl_ms"`
+	WaitMs int    `json:"wait_ms"`
+}
+
+func grantJSON(owner string, g store.LockGrant) fiber.Map {
+	m := fiber.Map{
+		"token":      g.Token,
+		"expires_at": g.ExpiresAt,
+		"ttl_ms":     time.Until(g.ExpiresAt).Milliseconds(),
+	}
+	if owner != "" {
+		m["owner"] = owner
+	}
+	return m
+}
+
+// AcquireLock takes the lock for owner, generating an owner when none is
+// given, and waits up to wait_ms for it when it is held
+func (h *Handler) AcquireLock(c *fiber.Ctx) error {
+	var data lockRequest
+	if err := c.BodyParser(&data); err != nil || data.TTLMs <= 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body"})
+	}
+	block, err := parseBlock(data.WaitMs)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid wait_ms value"})
+	}
+	if data.Owner == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		data.Owner = hex.EncodeToString(b)
+	}
+	grant, err := h.db(c).Acquire(c.Context(), keyParam(c), data.Owner,
+		time.Duration(data.TTLMs)*time.Millisecond, block)
+	if err != nil {
+		return lockError(c, err)
+	}
+	return c.Status(200).JSON(grantJSON(data.Owner, grant))
+}
+
+func (h *Handler) ReleaseLock(c *fiber.Ctx) error {
+	var data lockRequest
+	if err := c.BodyParser(&data); err != nil || data.Owner == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body"})
+	}
+	if err := h.db(c).Release(keyParam(c), data.Owner); err != nil {
+		return lockError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"message": "lock released"})
+}
+
+func (h *Handler) ExtendLock(c *fiber.Ctx) error {
+	var data lockRequest
+	if err := c.BodyParser(&data); err != nil || data.Owner == "" || data.TTLMs <= 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body"})
+	}
+	grant, err := h.db(c).Extend(keyParam(c), data.Owner, time.Duration(data.TTLMs)*time.Millisecond)
+	if err != nil {
+		return lockError(c, err)
+	}
+	return c.Status(200).JSON(grantJSON("", grant))
+}
+
+func (h *Handler) GetLock(c *fiber.Ctx) error {
+	grant, err := h.db(c).LockInfo(keyParam(c))
+	if err != nil {
+		return lockError(c, err)
+	}
+	return c.Status(200).JSON(grantJSON("", grant))
+}
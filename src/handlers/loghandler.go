@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/dhanushcrueiso/coding-test/internal/logging"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequestIDHeader carries the request id. A value sent by the client is
+// kept, otherwise one is generated; either way it is echoed in the response.
+const RequestIDHeader = "X-Request-ID"
+
+const loggerLocal = "logger"
+
+// RequestLogger gives every request an id and a logger carrying it, and
+// logs the request once it has been handled
+func (h *Handler) RequestLogger(c *fiber.Ctx) error {
+	start := time.Now()
+
+	id := c.Get(RequestIDHeader)
+	if id == "" {
+		id = newRequestID()
+	}
+	c.Set(RequestIDHeader, id)
+	logger := h.logger.With("request_id", id)
+	c.Locals(loggerLocal, logger)
+
+	err := c.Next()
+
+	status := c.Response().StatusCode()
+	if err != nil {
+		status = errorStatus(err)
+	}
+
+	level := slog.LevelInfo
+	if status >= 500 {
+		level = slog.LevelError
+	}
+	// The path is not logged, since it holds the key; the key is logged on
+	// its own, where redaction can hide it
+	route := c.Route().Path
+	if route == "/" && c.Path() != "/" {
+		route = "unmatched"
+	}
+	attrs := []any{
+		"method", c.Method(),
+		"route", route,
+		"status", status,
+		"duration", time.Since(start),
+	}
+	if c.Params("key") != "" {
+		attrs = append(attrs, logging.KeyAttr, keyParam(c))
+	}
+	if err != nil {
+		attrs = append(attrs, "err", err)
+	}
+	logger.Log(c.UserContext(), level, "request", attrs...)
+	return err
+}
+
+// errorStatus is the status code the error handler will send for err
+func errorStatus(err error) int {
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return fe.Code
+	}
+	return fiber.StatusInternalServerError
+}
+
+// log returns the request's logger, falling back to the handler's own for
+// routes mounted without RequestLogger
+func (h *Handler) log(c *fiber.Ctx) *slog.Logger {
+	if l, ok := c.Locals(loggerLocal).(*slog.Logger); ok {
+		return l
+	}
+	return h.logger
+}
+
+func newRequestID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
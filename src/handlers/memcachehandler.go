@@ -0,0 +1,831 @@
+package handlers
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dhanushcrueiso/coding-test/internal/acl"
+	"github.com/dhanushcrueiso/coding-test/internal/store"
+)
+
+const (
+	// memcacheMaxLine bounds a command line; get may name many keys
+	memcacheMaxLine = 64 << 10
+	// memcacheMaxItem is the largest value accepted, memcached's default
+	memcacheMaxItem = 1 << 20
+	memcacheMaxKey  = 250
+	// memcacheRelative is the largest exptime taken as seconds from now.
+	// Larger ones are Unix times, as in memcached.
+	memcacheRelative = 60 * 60 * 24 * 30
+	// memcacheHandshake bounds the TLS handshake of a new connection
+	memcacheHandshake = 10 * time.Second
+)
+
+// MemcacheServer serves the memcached text and meta protocols on the
+// string keys of one namespace. Commands share the store, users, quotas,
+// INFO counters, MONITOR and slow log of the Handler with the HTTP and
+// gRPC APIs. CAS tokens are item versions and client flags are stored with
+// the value.
+//
+// memcached has no credentials in its text protocol, so a connection acts
+// as the user of its TLS client certificate, or as the default user.
+type MemcacheServer struct {
+	h  *Handler
+	db string
+
+	mu sync.Mutex
+	ln net.Listener
+	// conns maps each open connection to whether it is running a command
+	conns map[net.Conn]bool
+	// timers are the pending delayed flush_all commands
+	timers map[*time.Timer]struct{}
+	closed bool
+	wg     sync.WaitGroup
+	total  atomic.Int64
+}
+
+// NewMemcacheServer returns a memcached server for namespace db
+func (h *Handler) NewMemcacheServer(db string) *MemcacheServer {
+	return &MemcacheServer{h: h, db: db, conns: make(map[net.Conn]bool), timers: make(map[*time.Timer]struct{})}
+}
+
+// Serve accepts connections on ln until Close is called, when it returns
+// nil
+func (m *MemcacheServer) Serve(ln net.Listener) error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return ln.Close()
+	}
+	m.ln = ln
+	m.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			m.mu.Lock()
+			closed := m.closed
+			m.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		m.mu.Lock()
+		if m.closed {
+			m.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		m.conns[conn] = false
+		m.wg.Add(1)
+		m.mu.Unlock()
+		m.total.Add(1)
+		go m.serve(conn)
+	}
+}
+
+// Close stops accepting connections and commands, cancels delayed
+// flush_all commands and closes the open connections once their current
+// command is done, waiting up to timeout before closing them regardless.
+// It reports whether they finished in time.
+func (m *MemcacheServer) Close(timeout time.Duration) bool {
+	m.mu.Lock()
+	m.closed = true
+	if m.ln != nil {
+		m.ln.Close()
+	}
+	for t := range m.timers {
+		t.Stop()
+		delete(m.timers, t)
+	}
+	// Waiting for the next command fails at once. A command being run,
+	// which may still be reading its data block, is left to finish.
+	for conn, busy := range m.conns {
+		if !busy {
+			conn.SetReadDeadline(time.Now())
+		}
+	}
+	m.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		m.mu.Lock()
+		for conn := range m.conns {
+			conn.Close()
+		}
+		m.mu.Unlock()
+		<-done
+		return false
+	}
+}
+
+// begin marks conn as running a command. It reports false once Close was
+// called, when no new command is started.
+func (m *MemcacheServer) begin(conn net.Conn) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return false
+	}
+	m.conns[conn] = true
+	return true
+}
+
+// end marks conn as waiting for its next command. It reports false once
+// Close was called.
+func (m *MemcacheServer) end(conn net.Conn) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.conns[conn] = false
+	return !m.closed
+}
+
+// flush empties the namespace through the same store call as POST
+// /flushdb
+func (m *MemcacheServer) flush() (int, error) {
+	return m.h.store.DB(m.db).Flush()
+}
+
+// flushAfter flushes the namespace after delay unless the server is closed
+// first. Close waits for a flush that has started.
+func (m *MemcacheServer) flushAfter(delay time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return
+	}
+	var t *time.Timer
+	t = time.AfterFunc(delay, func() {
+		m.mu.Lock()
+		if _, pending := m.timers[t]; !pending {
+			// Cancelled by Close
+			m.mu.Unlock()
+			return
+		}
+		delete(m.timers, t)
+		m.wg.Add(1)
+		m.mu.Unlock()
+		defer m.wg.Done()
+
+		if _, err := m.flush(); err != nil {
+			m.h.logger.Error("delayed flush_all failed", "db", m.db, "err", err)
+		}
+	})
+	m.timers[t] = struct{}{}
+}
+
+// mcConn is one client connection
+type mcConn struct {
+	m      *MemcacheServer
+	h      *Handler
+	r      *bufio.Reader
+	w      *bufio.Writer
+	client string
+	user   *acl.User
+	// authErr is why the connection has no user when ACLs are enabled
+	authErr error
+
+	// state of the command being run
+	cmd     command
+	code    string
+	noreply bool
+}
+
+func (m *MemcacheServer) serve(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		m.mu.Lock()
+		delete(m.conns, conn)
+		m.mu.Unlock()
+		m.wg.Done()
+	}()
+
+	c := &mcConn{
+		m:      m,
+		h:      m.h,
+		r:      bufio.NewReaderSize(conn, memcacheMaxLine),
+		w:      bufio.NewWriter(conn),
+		client: conn.RemoteAddr().String(),
+	}
+	var state *tls.ConnectionState
+	if tc, ok := conn.(*tls.Conn); ok {
+		tc.SetDeadline(time.Now().Add(memcacheHandshake))
+		if err := tc.Handshake(); err != nil {
+			return
+		}
+		tc.SetDeadline(time.Time{})
+		cs := tc.ConnectionState()
+		state = &cs
+	}
+	if m.h.acl != nil {
+		c.user, c.authErr = m.h.identify("", "", state)
+	}
+
+	for {
+		line, err := c.r.ReadSlice('\n')
+		if err != nil {
+			if errors.Is(err, bufio.ErrBufferFull) {
+				c.w.WriteString("CLIENT_ERROR line too long\r\n")
+				c.w.Flush()
+			}
+			return
+		}
+		if !m.begin(conn) {
+			return
+		}
+		keep := c.dispatch(strings.TrimRight(string(line), "\r\n"))
+		if open := m.end(conn); !keep || !open {
+			c.w.Flush()
+			return
+		}
+		// Replies to pipelined commands go out together
+		if c.r.Buffered() == 0 {
+			if err := c.w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// mcHandler runs a command on its arguments. It returns false to close
+// the connection.
+type mcHandler func(c *mcConn, args []string) bool
+
+// mcCommands lists the commands by name
+var mcCommands = map[string]mcHandler{
+	"get":       mcGet(false, false),
+	"gets":      mcGet(true, false),
+	"gat":       mcGet(false, true),
+	"gats":      mcGet(true, true),
+	"set":       mcStore("set"),
+	"add":       mcStore("add"),
+	"replace":   mcStore("replace"),
+	"append":    mcStore("append"),
+	"prepend":   mcStore("prepend"),
+	"cas":       mcStore("cas"),
+	"incr":      mcIncr(false),
+	"decr":      mcIncr(true),
+	"delete":    mcDelete,
+	"touch":     mcTouch,
+	"flush_all": mcFlushAll,
+	"version":   mcVersion,
+	"verbosity": mcVerbosity,
+	"stats":     mcStats,
+	"mg":        mcMetaGet,
+	"ms":        mcMetaSet,
+	"md":        mcMetaDelete,
+	"ma":        mcMetaArithmetic,
+	"mn":        mcMetaNoop,
+}
+
+// dispatch runs one command line. It returns false to close the
+// connection.
+func (c *mcConn) dispatch(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		c.w.WriteString("ERROR\r\n")
+		return true
+	}
+	name := fields[0]
+	if name == "quit" {
+		return false
+	}
+	run, ok := mcCommands[name]
+	if !ok {
+		c.w.WriteString("ERROR\r\n")
+		return true
+	}
+
+	c.h.commands.Add(1)
+	start := time.Now()
+	c.cmd = command{
+		Time:   start,
+		Client: c.client,
+		Method: "MEMCACHE",
+		Route:  name,
+		DB:     c.m.db,
+		Status: 200,
+	}
+	if c.user != nil {
+		c.cmd.User = c.user.Name
+	}
+	c.code, c.noreply = "", false
+	keep := run(c, fields[1:])
+
+	elapsed := time.Since(start)
+	monitored := c.h.monitor.active()
+	slow := c.h.slowlog.exceeds(elapsed)
+	if monitored || slow {
+		cmd := c.cmd
+		cmd.Duration, cmd.DurationMicros = elapsed, elapsed.Microseconds()
+		if c.code != "" {
+			cmd.Status = codeStatus[c.code]
+		}
+		if monitored {
+			c.h.monitor.publish(cmd)
+		}
+		if slow {
+			c.h.slowlog.add(cmd)
+		}
+	}
+	return keep
+}
+
+// reply writes a response line unless the command asked for noreply
+func (c *mcConn) reply(format string, args ...interface{}) {
+	if c.noreply {
+		return
+	}
+	fmt.Fprintf(c.w, format, args...)
+	c.w.WriteString("\r\n")
+}
+
+// fail replies with an error line and records code for MONITOR
+func (c *mcConn) fail(code, line string) {
+	c.code = code
+	c.reply("%s", line)
+}
+
+func (c *mcConn) badFormat() bool {
+	c.fail(CodeInvalidArgument, "CLIENT_ERROR bad command line format")
+	return true
+}
+
+// storeError replies to an error from the store
+func (c *mcConn) storeError(op string, err error) {
+	code := errorCode(err)
+	switch {
+	case errors.Is(err, store.ErrValueTooLarge):
+		c.fail(code, "SERVER_ERROR object too large for cache")
+	case errors.Is(err, store.ErrOutOfMemory):
+		c.fail(code, "SERVER_ERROR out of memory storing object")
+	case code == CodeWrongType || code == CodeInvalidArgument:
+		c.fail(code, "CLIENT_ERROR "+err.Error())
+	case code != "":
+		c.fail(code, "SERVER_ERROR "+err.Error())
+	default:
+		c.h.logger.Error(op+" failed", "db", c.m.db, "err", err)
+		c.fail(CodeInternal, "SERVER_ERROR "+op+" failed")
+	}
+}
+
+// allow checks a command against the ACL, rate limits and consistency
+// rules, replying with an error if it is refused
+func (c *mcConn) allow(write bool, need []acl.Category, keys ...string) bool {
+	if c.h.acl != nil {
+		if c.authErr != nil {
+			c.fail(CodeUnauthenticated, "CLIENT_ERROR "+c.authErr.Error())
+			return false
+		}
+		if !c.user.Can(need...) {
+			c.fail(CodePermissionDenied, "CLIENT_ERROR user "+c.user.Name+" has no permission to run this command")
+			return false
+		}
+		if !c.user.CanUseNamespace(c.m.db) {
+			c.fail(CodePermissionDenied, "CLIENT_ERROR user "+c.user.Name+" has no permission to use namespace "+c.m.db)
+			return false
+		}
+		for _, key := range keys {
+			if !c.user.CanAccess(key) {
+				c.fail(CodePermissionDenied, "CLIENT_ERROR user "+c.user.Name+" has no permission to access this key")
+				return false
+			}
+		}
+	}
+	if code, msg := c.h.admitData(c.m.db, c.user, write); code != "" {
+		c.fail(code, "SERVER_ERROR "+msg)
+		return false
+	}
+	return true
+}
+
+var (
+	mcRead  = []acl.Category{acl.Read, acl.String}
+	mcWrite = []acl.Category{acl.Write, acl.String}
+)
+
+func (c *mcConn) db() *store.DB {
+	return c.h.store.DB(c.m.db)
+}
+
+// validKey reports whether key is acceptable to memcached: at most 250
+// bytes without spaces or control characters
+func validKey(key string) bool {
+	if key == "" || len(key) > memcacheMaxKey {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// readData reads a data block of n bytes and its terminating CRLF. A block
+// over memcacheMaxItem is skipped and reported with ok false.
+func (c *mcConn) readData(n int) (data string, ok bool, err error) {
+	if n > memcacheMaxItem {
+		_, err := c.r.Discard(n + 2)
+		c.fail(CodeValueTooLarge, "SERVER_ERROR object too large for cache")
+		return "", false, err
+	}
+	buf := make([]byte, n+2)
+	if _, err := io.ReadFull(c.r, buf); err != nil {
+		return "", false, err
+	}
+	if string(buf[n:]) != "\r\n" {
+		// Like memcached, skip what is left of the line before reading the
+		// next command
+		if buf[n+1] != '\n' {
+			if _, err := c.r.ReadString('\n'); err != nil {
+				return "", false, err
+			}
+		}
+		c.fail(CodeInvalidArgument, "CLIENT_ERROR bad data chunk")
+		return "", false, nil
+	}
+	return string(buf[:n]), true, nil
+}
+
+// mcExpiry converts a memcached exptime. Zero never expires, up to 30 days
+// is seconds from now, anything larger a Unix time, and a negative one has
+// already expired.
+func mcExpiry(exptime int64) (time.Duration, time.Time) {
+	switch {
+	case exptime == 0:
+		return 0, time.Time{}
+	case exptime < 0:
+		return 0, time.Unix(1, 0)
+	case exptime <= memcacheRelative:
+		return time.Duration(exptime) * time.Second, time.Time{}
+	}
+	return 0, time.Unix(exptime, 0)
+}
+
+func parseExptime(s string) (int64, bool) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	return n, err == nil
+}
+
+// mcStore runs set, add, replace, append, prepend and cas:
+//
+//	<cmd> <key> <flags> <exptime> <bytes> [<cas unique>] [noreply]
+func mcStore(name string) mcHandler {
+	n := 4
+	if name == "cas" {
+		n = 5
+	}
+	return func(c *mcConn, args []string) bool {
+		if len(args) != n && len(args) != n+1 {
+			return c.badFormat()
+		}
+		size, err := strconv.Atoi(args[3])
+		if err != nil || size < 0 {
+			return c.badFormat()
+		}
+		c.noreply = len(args) == n+1 && args[n] == "noreply"
+		data, ok, err := c.readData(size)
+		if err != nil {
+			return false
+		}
+		if !ok {
+			return true
+		}
+
+		key := args[0]
+		flags, ferr := strconv.ParseUint(args[1], 10, 32)
+		exptime, eok := parseExptime(args[2])
+		var unique uint64
+		if name == "cas" {
+			unique, err = strconv.ParseUint(args[4], 10, 64)
+		}
+		if !validKey(key) || ferr != nil || !eok || err != nil {
+			return c.badFormat()
+		}
+		c.cmd.Key = key
+		c.cmd.Args = []string{truncate(data)}
+		if !c.allow(true, mcWrite, key) {
+			return true
+		}
+
+		if name == "append" || name == "prepend" {
+			// As in memcached, the flags and exptime are ignored
+			_, ok, err := c.db().Append(key, data, store.AppendOptions{Prepend: name == "prepend"})
+			switch {
+			case err != nil:
+				c.storeError(name, err)
+			case !ok:
+				c.reply("NOT_STORED")
+			default:
+				c.reply("STORED")
+			}
+			return true
+		}
+
+		opts := store.SetOptions{
+			NX:        name == "add",
+			XX:        name == "replace",
+			IfVersion: unique,
+			Flags:     uint32(flags),
+		}
+		opts.TTL, opts.ExpireAt = mcExpiry(exptime)
+		if name == "cas" && unique == 0 {
+			// No item has version zero
+			if _, found, _ := c.db().GetString(key); found {
+				c.reply("EXISTS")
+			} else {
+				c.reply("NOT_FOUND")
+			}
+			return true
+		}
+		res, err := c.db().SetWith(key, data, opts)
+		switch {
+		case errors.Is(err, store.ErrNoSuchKey):
+			c.reply("NOT_FOUND")
+		case errors.Is(err, store.ErrVersionMismatch):
+			c.reply("EXISTS")
+		case err != nil:
+			c.storeError(name, err)
+		case !res.Set:
+			c.reply("NOT_STORED")
+		default:
+			c.reply("STORED")
+		}
+		return true
+	}
+}
+
+// mcGet runs get and gets, and with touch gat and gats:
+//
+//	get <key>*
+//	gat <exptime> <key>*
+func mcGet(cas, touch bool) mcHandler {
+	return func(c *mcConn, args []string) bool {
+		var opts store.GetExOptions
+		if touch {
+			if len(args) == 0 {
+				c.fail(CodeInvalidArgument, "ERROR")
+				return true
+			}
+			exptime, ok := parseExptime(args[0])
+			if !ok {
+				return c.badFormat()
+			}
+			opts.TTL, opts.ExpireAt = mcExpiry(exptime)
+			opts.Persist = exptime == 0
+			args = args[1:]
+		}
+		if len(args) == 0 {
+			c.fail(CodeInvalidArgument, "ERROR")
+			return true
+		}
+		for _, key := range args {
+			if !validKey(key) {
+				return c.badFormat()
+			}
+		}
+		c.cmd.Key = args[0]
+		need := mcRead
+		if touch {
+			need = mcWrite
+		}
+		if !c.allow(touch, need, args...) {
+			return true
+		}
+
+		db := c.db()
+		for _, key := range args {
+			var v store.StringValue
+			var found bool
+			var err error
+			if touch {
+				v, found, err = db.GetStringEx(key, opts)
+			} else {
+				v, found, err = db.GetString(key)
+			}
+			if errors.Is(err, store.ErrWrongType) {
+				// Keys of other types are invisible to memcached clients
+				continue
+			}
+			if err != nil {
+				c.storeError("get", err)
+				return true
+			}
+			if !found {
+				continue
+			}
+			if cas {
+				fmt.Fprintf(c.w, "VALUE %s %d %d %d\r\n", key, v.Flags, len(v.Value), v.Version)
+			} else {
+				fmt.Fprintf(c.w, "VALUE %s %d %d\r\n", key, v.Flags, len(v.Value))
+			}
+			c.w.WriteString(v.Value)
+			c.w.WriteString("\r\n")
+		}
+		c.reply("END")
+		return true
+	}
+}
+
+// mcIncr runs incr and decr:
+//
+//	incr <key> <value> [noreply]
+func mcIncr(decr bool) mcHandler {
+	return func(c *mcConn, args []string) bool {
+		if len(args) != 2 && len(args) != 3 {
+			return c.badFormat()
+		}
+		c.noreply = len(args) == 3 && args[2] == "noreply"
+		key := args[0]
+		if !validKey(key) {
+			return c.badFormat()
+		}
+		delta, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			c.fail(CodeInvalidArgument, "CLIENT_ERROR invalid numeric delta argument")
+			return true
+		}
+		c.cmd.Key, c.cmd.Args = key, []string{args[1]}
+		if !c.allow(true, mcWrite, key) {
+			return true
+		}
+		res, ok, err := c.db().Incr(key, store.IncrOptions{Delta: delta, Decr: decr})
+		switch {
+		case errors.Is(err, store.ErrNotCounter), errors.Is(err, store.ErrWrongType):
+			c.fail(CodeInvalidArgument, "CLIENT_ERROR cannot increment or decrement non-numeric value")
+		case err != nil:
+			c.storeError(c.cmd.Route, err)
+		case !ok:
+			c.reply("NOT_FOUND")
+		default:
+			c.reply("%d", res.Value)
+		}
+		return true
+	}
+}
+
+// mcDelete runs delete. The legacy time argument is accepted if it is 0.
+//
+//	delete <key> [0] [noreply]
+func mcDelete(c *mcConn, args []string) bool {
+	if len(args) > 1 && args[len(args)-1] == "noreply" {
+		c.noreply = true
+		args = args[:len(args)-1]
+	}
+	if len(args) == 2 && args[1] == "0" {
+		args = args[:1]
+	}
+	if len(args) != 1 {
+		c.fail(CodeInvalidArgument, "CLIENT_ERROR bad command line format.  Usage: delete <key> [noreply]")
+		return true
+	}
+	key := args[0]
+	if !validKey(key) {
+		return c.badFormat()
+	}
+	c.cmd.Key = key
+	if !c.allow(true, mcWrite, key) {
+		return true
+	}
+	removed, err := c.db().Remove(key)
+	switch {
+	case err != nil:
+		c.storeError("delete", err)
+	case removed:
+		c.reply("DELETED")
+	default:
+		c.reply("NOT_FOUND")
+	}
+	return true
+}
+
+// mcTouch runs touch:
+//
+//	touch <key> <exptime> [noreply]
+func mcTouch(c *mcConn, args []string) bool {
+	if len(args) != 2 && len(args) != 3 {
+		return c.badFormat()
+	}
+	c.noreply = len(args) == 3 && args[2] == "noreply"
+	key := args[0]
+	exptime, ok := parseExptime(args[1])
+	if !validKey(key) || !ok {
+		return c.badFormat()
+	}
+	c.cmd.Key, c.cmd.Args = key, []string{args[1]}
+	if !c.allow(true, mcWrite, key) {
+		return true
+	}
+	ttl, at := mcExpiry(exptime)
+	touched, err := c.db().Expire(key, ttl, store.ExpireOptions{At: at})
+	switch {
+	case err != nil:
+		c.storeError("touch", err)
+	case !touched:
+		c.reply("NOT_FOUND")
+	default:
+		c.reply("TOUCHED")
+	}
+	return true
+}
+
+// mcFlushAll runs flush_all, which empties the namespace now or after a
+// delay in seconds. It needs the admin category, like POST /flushdb.
+//
+//	flush_all [delay] [noreply]
+func mcFlushAll(c *mcConn, args []string) bool {
+	if len(args) > 0 && args[len(args)-1] == "noreply" {
+		c.noreply = true
+		args = args[:len(args)-1]
+	}
+	var delay int64
+	if len(args) > 1 {
+		return c.badFormat()
+	}
+	if len(args) == 1 {
+		var err error
+		if delay, err = strconv.ParseInt(args[0], 10, 64); err != nil || delay < 0 {
+			return c.badFormat()
+		}
+		c.cmd.Args = args
+	}
+	if !c.allow(true, []acl.Category{acl.Write, acl.Admin}) {
+		return true
+	}
+	if delay > 0 {
+		c.m.flushAfter(time.Duration(delay) * time.Second)
+		c.reply("OK")
+		return true
+	}
+	if _, err := c.m.flush(); err != nil {
+		c.storeError("flush_all", err)
+		return true
+	}
+	c.reply("OK")
+	return true
+}
+
+func mcVersion(c *mcConn, args []string) bool {
+	c.reply("VERSION %s", c.h.version)
+	return true
+}
+
+// mcVerbosity accepts verbosity for compatibility; the log level is set
+// through the config instead
+func mcVerbosity(c *mcConn, args []string) bool {
+	if len(args) > 0 && args[len(args)-1] == "noreply" {
+		c.noreply = true
+	}
+	c.reply("OK")
+	return true
+}
+
+// mcStats reports the general statistics memcached clients commonly read.
+// Subcommands such as "stats items" are not supported.
+func mcStats(c *mcConn, args []string) bool {
+	if len(args) > 0 {
+		c.fail(CodeInvalidArgument, "ERROR")
+		return true
+	}
+	now := time.Now()
+	c.m.mu.Lock()
+	conns := len(c.m.conns)
+	c.m.mu.Unlock()
+	items := c.db().Size()
+	for _, stat := range []struct {
+		name  string
+		value interface{}
+	}{
+		{"pid", os.Getpid()},
+		{"uptime", int64(now.Sub(c.h.started).Seconds())},
+		{"time", now.Unix()},
+		{"version", c.h.version},
+		{"curr_connections", conns},
+		{"total_connections", c.m.total.Load()},
+		{"curr_items", items},
+		{"bytes", c.h.store.UsedMemory()},
+	} {
+		fmt.Fprintf(c.w, "STAT %s %v\r\n", stat.name, stat.value)
+	}
+	c.reply("END")
+	return true
+}
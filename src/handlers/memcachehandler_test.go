@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dhanushcrueiso/coding-test/internal/store"
+)
+
+// startMemcache serves the memcached protocol on the default namespace of
+// a fresh store
+func startMemcache(t *testing.T) (*MemcacheServer, string, *store.DataObj) {
+	t.Helper()
+	s := store.NewRedisMemoryStore()
+	m := NewServer(s).NewMemcacheServer(store.DefaultDB)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- m.Serve(ln) }()
+	t.Cleanup(func() {
+		m.Close(time.Second)
+		if err := <-served; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+		s.Close()
+	})
+	return m, ln.Addr().String(), s
+}
+
+type mcClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialMemcache(t *testing.T, addr string) *mcClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &mcClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+func (c *mcClient) send(s string) {
+	c.t.Helper()
+	if _, err := io.WriteString(c.conn, s); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// expect reads one reply line per entry of want
+func (c *mcClient) expect(request string, want ...string) {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, w := range want {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			c.t.Fatalf("%q: reading %q: %v", request, w, err)
+		}
+		if got := strings.TrimSuffix(line, "\r\n"); got != w {
+			c.t.Fatalf("%q: got %q, want %q", request, got, w)
+		}
+	}
+}
+
+// do sends a request and expects the reply lines want
+func (c *mcClient) do(request string, want ...string) {
+	c.t.Helper()
+	c.send(request)
+	c.expect(request, want...)
+}
+
+// cas returns the CAS unique of key
+func (c *mcClient) cas(key string) string {
+	c.t.Helper()
+	c.send("gets " + key + "\r\n")
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	fields := strings.Fields(line)
+	if len(fields) != 5 || fields[0] != "VALUE" {
+		c.t.Fatalf("gets %s: %q", key, line)
+	}
+	c.r.ReadString('\n')
+	c.expect("gets", "END")
+	return fields[4]
+}
+
+func TestMemcacheStorage(t *testing.T) {
+	_, addr, _ := startMemcache(t)
+	c := dialMemcache(t, addr)
+
+	c.do("get k\r\n", "END")
+	c.do("set k 42 0 5\r\nhello\r\n", "STORED")
+	c.do("get k missing\r\n", "VALUE k 42 5", "hello", "END")
+	c.do("add k 0 0 1\r\nx\r\n", "NOT_STORED")
+	c.do("add n 0 0 1\r\n1\r\n", "STORED")
+	c.do("replace missing 0 0 1\r\nx\r\n", "NOT_STORED")
+	c.do("replace n 0 0 2\r\n10\r\n", "STORED")
+	c.do("append k 0 0 1\r\n!\r\n", "STORED")
+	c.do("prepend k 0 0 1\r\n>\r\n", "STORED")
+	c.do("append missing 0 0 1\r\n!\r\n", "NOT_STORED")
+	c.do("get k\r\n", "VALUE k 42 7", ">hello!", "END")
+
+	unique := c.cas("k")
+	c.do("cas k 1 0 3 "+unique+"\r\nnew\r\n", "STORED")
+	c.do("cas k 1 0 3 "+unique+"\r\nold\r\n", "EXISTS")
+	c.do("cas missing 0 0 1 1\r\nx\r\n", "NOT_FOUND")
+	c.do("get k\r\n", "VALUE k 1 3", "new", "END")
+
+	c.do("incr n 5\r\n", "15")
+	c.do("decr n 20\r\n", "0")
+	c.do("incr missing 1\r\n", "NOT_FOUND")
+	c.do("incr k 1\r\n", "CLIENT_ERROR cannot increment or decrement non-numeric value")
+
+	c.do("touch k 100\r\n", "TOUCHED")
+	c.do("touch missing 100\r\n", "NOT_FOUND")
+	c.do("gat 0 k\r\n", "VALUE k 1 3", "new", "END")
+	c.do("set gone 0 -1 1\r\nx\r\n", "STORED")
+	c.do("get gone\r\n", "END")
+
+	c.do("delete k\r\n", "DELETED")
+	c.do("delete k\r\n", "NOT_FOUND")
+
+	// noreply commands answer nothing, so the next reply is the get's
+	c.do("set q 0 0 1 noreply\r\nq\r\ndelete missing noreply\r\nget q\r\n", "VALUE q 0 1", "q", "END")
+
+	// Pipelined commands are answered in order
+	c.do("set a 0 0 1\r\na\r\nset b 0 0 1\r\nb\r\nget a b\r\n", "STORED", "STORED", "VALUE a 0 1", "a", "VALUE b 0 1", "b", "END")
+}
+
+func TestMemcacheErrors(t *testing.T) {
+	_, addr, _ := startMemcache(t)
+	c := dialMemcache(t, addr)
+
+	c.do("bogus\r\n", "ERROR")
+	c.do("set k 0 0\r\n", "CLIENT_ERROR bad command line format")
+	c.do("set k 0 0 2\r\nabc\r\n", "CLIENT_ERROR bad data chunk")
+	c.do("get "+strings.Repeat("k", memcacheMaxKey+1)+"\r\n", "CLIENT_ERROR bad command line format")
+	c.do(fmt.Sprintf("set big 0 0 %d\r\n%s\r\n", memcacheMaxItem+1, strings.Repeat("x", memcacheMaxItem+1)), "SERVER_ERROR object too large for cache")
+	// The connection is still in step after each error
+	c.do("set k 0 0 1\r\nv\r\n", "STORED")
+
+	c.do("quit\r\n")
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.r.ReadByte(); err != io.EOF {
+		t.Errorf("read after quit: %v, want EOF", err)
+	}
+}
+
+func TestMemcacheMeta(t *testing.T) {
+	_, addr, _ := startMemcache(t)
+	c := dialMemcache(t, addr)
+
+	c.do("ms k 5 F7 T0\r\nhello\r\n", "HD")
+	c.do("mg k v f s t\r\n", "VA 5 f7 s5 t-1", "hello")
+	c.do("mg missing v\r\n", "EN")
+	c.do("mg missing v q\r\nmn\r\n", "MN")
+	c.do("mg k k O123\r\n", "HD kk O123")
+
+	unique := c.cas("k")
+	c.do("ms k 1 C"+unique+"\r\nx\r\n", "HD")
+	c.do("ms k 1 C"+unique+"\r\ny\r\n", "EX")
+	c.do("ms k 1 ME\r\nz\r\n", "NS")
+	c.do("ms missing 1 MR\r\nz\r\n", "NS")
+	c.do("ms k 1 MA\r\n!\r\n", "HD")
+	c.do("mg k v\r\n", "VA 2", "x!")
+
+	c.do("ma n\r\n", "NF")
+	c.do("ma n N0 J10 v\r\n", "VA 2", "10")
+	c.do("ma n D5 MD v\r\n", "VA 1", "5")
+	c.do("ma k\r\n", "CLIENT_ERROR cannot increment or decrement non-numeric value")
+
+	// Keys may be sent base64 encoded
+	c.do("ms a2V5 1 b\r\nv\r\n", "HD")
+	c.do("mg key v\r\n", "VA 1", "v")
+
+	c.do("md k q\r\nmd k\r\n", "NF")
+	c.do("md key C1\r\n", "EX")
+	c.do("md key\r\n", "HD")
+	c.do("mg key v\r\n", "EN")
+	c.do("mg k x\r\n", "CLIENT_ERROR invalid flag")
+}
+
+func TestMemcacheFlushAll(t *testing.T) {
+	_, addr, s := startMemcache(t)
+	c := dialMemcache(t, addr)
+
+	c.do("set a 0 0 1\r\na\r\n", "STORED")
+	c.do("flush_all\r\n", "OK")
+	c.do("get a\r\n", "END")
+
+	c.do("set a 0 0 1\r\na\r\n", "STORED")
+	c.do("flush_all 1\r\n", "OK")
+	c.do("get a\r\n", "VALUE a 0 1", "a", "END")
+	deadline := time.Now().Add(5 * time.Second)
+	for s.DB(store.DefaultDB).Size() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("delayed flush_all did not run")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// TestMemcacheCloseCancelsDelayedFlush checks that a pending flush_all
+// does not fire once the server is closed
+func TestMemcacheCloseCancelsDelayedFlush(t *testing.T) {
+	m, addr, s := startMemcache(t)
+	c := dialMemcache(t, addr)
+	c.do("set a 0 0 1\r\na\r\n", "STORED")
+	c.do("flush_all 1\r\n", "OK")
+	if !m.Close(time.Second) {
+		t.Fatal("Close timed out")
+	}
+	time.Sleep(1500 * time.Millisecond)
+	if n := s.DB(store.DefaultDB).Size(); n != 1 {
+		t.Fatalf("%d keys after Close, want the delayed flush cancelled", n)
+	}
+}
+
+// TestMemcacheCloseFinishesCommand closes the server while a command is
+// waiting for the rest of its data block, and checks that the command
+// completes while an idle connection is closed at once
+func TestMemcacheCloseFinishesCommand(t *testing.T) {
+	m, addr, s := startMemcache(t)
+	busy, idle := dialMemcache(t, addr), dialMemcache(t, addr)
+	idle.do("version\r\n", "VERSION dev")
+
+	busy.send("set k 0 0 10\r\nhello")
+	time.Sleep(50 * time.Millisecond)
+	closed := make(chan bool, 1)
+	go func() { closed <- m.Close(5 * time.Second) }()
+
+	idle.conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := idle.r.ReadByte(); err != io.EOF {
+		t.Errorf("idle connection: read %v, want EOF", err)
+	}
+	select {
+	case <-closed:
+		t.Fatal("Close returned while a command was reading its data")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	busy.do("world\r\n", "STORED")
+	if ok := <-closed; !ok {
+		t.Error("Close reports the command did not finish in time")
+	}
+	if v, _, ok := s.DB(store.DefaultDB).Get("k"); !ok || v != "helloworld" {
+		t.Errorf("k = %q, %v", v, ok)
+	}
+	busy.conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := busy.r.ReadByte(); err != io.EOF {
+		t.Errorf("busy connection after its command: read %v, want EOF", err)
+	}
+}
@@ -0,0 +1,423 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dhanushcrueiso/coding-test/internal/store"
+)
+
+// metaRequest is a parsed meta command: its key and flags. Flags are a
+// letter, optionally followed by a token, such as "T30" or "v".
+type metaRequest struct {
+	key string
+	// raw is the key as sent, base64 encoded with the b flag
+	raw   string
+	flags []string
+	set   map[byte]string
+}
+
+func (r *metaRequest) has(flag byte) bool {
+	_, ok := r.set[flag]
+	return ok
+}
+
+// parseMeta parses the key and flags of a meta command. allowed lists the
+// flags the command supports; memcached flags this server does not
+// implement, such as stale item invalidation, are refused rather than
+// ignored.
+func (c *mcConn) parseMeta(args []string, allowed string) (*metaRequest, bool) {
+	if len(args) == 0 {
+		c.badFormat()
+		return nil, false
+	}
+	r := &metaRequest{key: args[0], raw: args[0], flags: args[1:], set: make(map[byte]string)}
+	for _, f := range r.flags {
+		if !strings.Contains(allowed, f[:1]) {
+			c.fail(CodeInvalidArgument, "CLIENT_ERROR invalid flag")
+			return nil, false
+		}
+		r.set[f[0]] = f[1:]
+	}
+	if r.has('b') {
+		key, err := base64.StdEncoding.DecodeString(r.raw)
+		if err != nil {
+			c.fail(CodeInvalidArgument, "CLIENT_ERROR error decoding key")
+			return nil, false
+		}
+		r.key = string(key)
+		if r.key == "" || len(r.key) > memcacheMaxKey {
+			c.badFormat()
+			return nil, false
+		}
+	} else if !validKey(r.key) {
+		c.badFormat()
+		return nil, false
+	}
+	c.cmd.Key = r.key
+	return r, true
+}
+
+// metaNumber parses the token of a numeric flag, or returns def if the
+// flag is absent
+func (c *mcConn) metaNumber(r *metaRequest, flag byte, def int64) (int64, bool) {
+	token, ok := r.set[flag]
+	if !ok {
+		return def, true
+	}
+	n, err := strconv.ParseInt(token, 10, 64)
+	if err != nil {
+		c.fail(CodeInvalidArgument, "CLIENT_ERROR bad token in command line format")
+		return 0, false
+	}
+	return n, true
+}
+
+// metaItem is what the return flags of a reply may describe
+type metaItem struct {
+	value     string
+	flags     uint32
+	version   uint64
+	expiresAt time.Time
+}
+
+// returnFlags renders the flags a reply echoes or answers, in the order
+// they were requested
+func (r *metaRequest) returnFlags(item metaItem) string {
+	var out []string
+	for _, f := range r.flags {
+		switch f[0] {
+		case 'O':
+			out = append(out, f)
+		case 'k':
+			out = append(out, "k"+r.raw)
+			if r.has('b') {
+				out = append(out, "b")
+			}
+		case 'c':
+			out = append(out, "c"+strconv.FormatUint(item.version, 10))
+		case 'f':
+			out = append(out, "f"+strconv.FormatUint(uint64(item.flags), 10))
+		case 's':
+			out = append(out, "s"+strconv.Itoa(len(item.value)))
+		case 't':
+			ttl := int64(-1)
+			if !item.expiresAt.IsZero() {
+				ttl = max(0, int64(time.Until(item.expiresAt).Round(time.Second)/time.Second))
+			}
+			out = append(out, "t"+strconv.FormatInt(ttl, 10))
+		}
+	}
+	if len(out) == 0 {
+		return ""
+	}
+	return " " + strings.Join(out, " ")
+}
+
+// metaReply writes a status line with the return flags. With the q flag
+// the statuses in quiet are left out.
+func (c *mcConn) metaReply(r *metaRequest, status string, item metaItem, quiet ...string) {
+	if r.has('q') {
+		for _, q := range quiet {
+			if q == status {
+				return
+			}
+		}
+	}
+	c.reply("%s%s", status, r.returnFlags(item))
+}
+
+// metaValue writes a VA reply carrying the value
+func (c *mcConn) metaValue(r *metaRequest, item metaItem) {
+	fmt.Fprintf(c.w, "VA %d%s\r\n", len(item.value), r.returnFlags(item))
+	c.w.WriteString(item.value)
+	c.w.WriteString("\r\n")
+}
+
+// mcMetaGet runs mg, which reads a key and returns what its flags ask for:
+// v the value, c the CAS token, f the client flags, s the size, t the
+// remaining TTL and k the key. T also changes the TTL.
+//
+//	mg <key> <flags>*
+func mcMetaGet(c *mcConn, args []string) bool {
+	// h, l and u report or skip access tracking, which is not kept
+	r, ok := c.parseMeta(args, "bcfhklOqstuvT")
+	if !ok {
+		return true
+	}
+	var opts store.GetExOptions
+	touch := r.has('T')
+	if touch {
+		exptime, ok := c.metaNumber(r, 'T', 0)
+		if !ok {
+			return true
+		}
+		opts.TTL, opts.ExpireAt = mcExpiry(exptime)
+		opts.Persist = exptime == 0
+	}
+	need := mcRead
+	if touch {
+		need = mcWrite
+	}
+	if !c.allow(touch, need, r.key) {
+		return true
+	}
+
+	var v store.StringValue
+	var found bool
+	var err error
+	if touch {
+		v, found, err = c.db().GetStringEx(r.key, opts)
+	} else {
+		v, found, err = c.db().GetString(r.key)
+	}
+	if err != nil && !errors.Is(err, store.ErrWrongType) {
+		c.storeError("mg", err)
+		return true
+	}
+	if !found {
+		if !r.has('q') {
+			c.reply("EN")
+		}
+		return true
+	}
+	item := metaItem{value: v.Value, flags: v.Flags, version: v.Version, expiresAt: v.ExpiresAt}
+	if r.has('v') {
+		c.metaValue(r, item)
+		return true
+	}
+	c.metaReply(r, "HD", item)
+	return true
+}
+
+// mcMetaSet runs ms. M picks the mode: S set (the default), E add, R
+// replace, A append or P prepend. C only stores if the CAS token matches,
+// F sets the client flags and T the TTL.
+//
+//	ms <key> <datalen> <flags>*
+func mcMetaSet(c *mcConn, args []string) bool {
+	if len(args) < 2 {
+		return c.badFormat()
+	}
+	size, err := strconv.Atoi(args[1])
+	if err != nil || size < 0 {
+		return c.badFormat()
+	}
+	data, ok, err := c.readData(size)
+	if err != nil {
+		return false
+	}
+	if !ok {
+		return true
+	}
+	r, ok := c.parseMeta(append([]string{args[0]}, args[2:]...), "bcCFkOqTM")
+	if !ok {
+		return true
+	}
+	unique, ok1 := c.metaNumber(r, 'C', 0)
+	flags, ok2 := c.metaNumber(r, 'F', 0)
+	exptime, ok3 := c.metaNumber(r, 'T', 0)
+	if !ok1 || !ok2 || !ok3 {
+		return true
+	}
+	if flags < 0 || flags > 1<<32-1 || unique < 0 {
+		c.fail(CodeInvalidArgument, "CLIENT_ERROR bad token in command line format")
+		return true
+	}
+	mode := strings.ToUpper(r.set['M'])
+	if mode == "" {
+		mode = "S"
+	}
+	if len(mode) != 1 || !strings.Contains("SERAP", mode) {
+		c.fail(CodeInvalidArgument, "CLIENT_ERROR invalid mode for ms")
+		return true
+	}
+	c.cmd.Args = []string{"M" + mode, truncate(data)}
+	if !c.allow(true, mcWrite, r.key) {
+		return true
+	}
+
+	if mode == "A" || mode == "P" {
+		version, ok, err := c.db().Append(r.key, data, store.AppendOptions{
+			Prepend:   mode == "P",
+			IfVersion: uint64(unique),
+		})
+		switch {
+		case errors.Is(err, store.ErrVersionMismatch):
+			c.metaReply(r, "EX", metaItem{})
+		case err != nil:
+			c.storeError("ms", err)
+		case !ok:
+			c.metaReply(r, "NS", metaItem{})
+		default:
+			c.metaReply(r, "HD", metaItem{version: version}, "HD")
+		}
+		return true
+	}
+
+	opts := store.SetOptions{
+		NX:        mode == "E",
+		XX:        mode == "R",
+		IfVersion: uint64(unique),
+		Flags:     uint32(flags),
+	}
+	opts.TTL, opts.ExpireAt = mcExpiry(exptime)
+	if r.has('C') && unique == 0 {
+		// No item has version zero
+		if _, found, _ := c.db().GetString(r.key); found {
+			c.metaReply(r, "EX", metaItem{})
+		} else {
+			c.metaReply(r, "NF", metaItem{})
+		}
+		return true
+	}
+	res, err := c.db().SetWith(r.key, data, opts)
+	switch {
+	case errors.Is(err, store.ErrNoSuchKey):
+		c.metaReply(r, "NF", metaItem{})
+	case errors.Is(err, store.ErrVersionMismatch):
+		c.metaReply(r, "EX", metaItem{})
+	case errors.Is(err, store.ErrConflictingOptions):
+		c.fail(CodeInvalidArgument, "CLIENT_ERROR CAS cannot be used with mode E")
+	case err != nil:
+		c.storeError("ms", err)
+	case !res.Set:
+		c.metaReply(r, "NS", metaItem{})
+	default:
+		c.metaReply(r, "HD", metaItem{value: data, flags: uint32(flags), version: res.Version}, "HD")
+	}
+	return true
+}
+
+// mcMetaDelete runs md. C only deletes if the CAS token matches.
+//
+//	md <key> <flags>*
+func mcMetaDelete(c *mcConn, args []string) bool {
+	r, ok := c.parseMeta(args, "bCkOq")
+	if !ok {
+		return true
+	}
+	unique, ok := c.metaNumber(r, 'C', 0)
+	if !ok {
+		return true
+	}
+	if !c.allow(true, mcWrite, r.key) {
+		return true
+	}
+
+	var deleted bool
+	var err error
+	switch {
+	case r.has('C') && unique <= 0:
+		// No item has version zero
+		_, deleted, _ = c.db().GetString(r.key)
+		if deleted {
+			err = store.ErrVersionMismatch
+		}
+	case r.has('C'):
+		deleted, err = c.db().RemoveVersion(r.key, uint64(unique))
+	default:
+		deleted, err = c.db().Remove(r.key)
+	}
+	switch {
+	case errors.Is(err, store.ErrVersionMismatch):
+		c.metaReply(r, "EX", metaItem{})
+	case err != nil:
+		c.storeError("md", err)
+	case !deleted:
+		c.metaReply(r, "NF", metaItem{}, "NF")
+	default:
+		c.metaReply(r, "HD", metaItem{}, "HD")
+	}
+	return true
+}
+
+// mcMetaArithmetic runs ma. M picks the mode, I or + to increment (the
+// default) and D or - to decrement, by D, which defaults to 1. N creates a
+// missing key with the TTL given, holding J or 0. C only changes the key if
+// the CAS token matches.
+//
+//	ma <key> <flags>*
+func mcMetaArithmetic(c *mcConn, args []string) bool {
+	r, ok := c.parseMeta(args, "bCNJDMqOtcvk")
+	if !ok {
+		return true
+	}
+	unique, ok1 := c.metaNumber(r, 'C', 0)
+	ttl, ok2 := c.metaNumber(r, 'N', 0)
+	initial, ok3 := c.metaNumber(r, 'J', 0)
+	if !ok1 || !ok2 || !ok3 {
+		return true
+	}
+	delta := uint64(1)
+	if token, ok := r.set['D']; ok {
+		var err error
+		if delta, err = strconv.ParseUint(token, 10, 64); err != nil {
+			c.fail(CodeInvalidArgument, "CLIENT_ERROR invalid numeric delta argument")
+			return true
+		}
+	}
+	var decr bool
+	switch strings.ToUpper(r.set['M']) {
+	case "", "I", "+":
+	case "D", "-":
+		decr = true
+	default:
+		c.fail(CodeInvalidArgument, "CLIENT_ERROR invalid mode for ma")
+		return true
+	}
+	if unique < 0 || initial < 0 {
+		c.fail(CodeInvalidArgument, "CLIENT_ERROR bad token in command line format")
+		return true
+	}
+	c.cmd.Args = []string{strconv.FormatUint(delta, 10)}
+	if !c.allow(true, mcWrite, r.key) {
+		return true
+	}
+
+	opts := store.IncrOptions{
+		Delta:     delta,
+		Decr:      decr,
+		IfVersion: uint64(unique),
+		Create:    r.has('N'),
+		Initial:   uint64(initial),
+	}
+	var at time.Time
+	if opts.TTL, at = mcExpiry(ttl); !at.IsZero() {
+		opts.TTL = time.Until(at)
+	}
+	res, found, err := c.db().Incr(r.key, opts)
+	switch {
+	case errors.Is(err, store.ErrVersionMismatch):
+		c.metaReply(r, "EX", metaItem{})
+	case errors.Is(err, store.ErrNotCounter), errors.Is(err, store.ErrWrongType):
+		c.fail(CodeInvalidArgument, "CLIENT_ERROR cannot increment or decrement non-numeric value")
+	case err != nil:
+		c.storeError("ma", err)
+	case !found:
+		c.metaReply(r, "NF", metaItem{}, "NF")
+	default:
+		item := metaItem{
+			value:     strconv.FormatUint(res.Value, 10),
+			version:   res.Version,
+			expiresAt: res.ExpiresAt,
+		}
+		if r.has('v') {
+			c.metaValue(r, item)
+			return true
+		}
+		c.metaReply(r, "HD", item, "HD")
+	}
+	return true
+}
+
+// mcMetaNoop runs mn, which clients send after quiet commands to learn
+// that every reply before it has arrived
+func mcMetaNoop(c *mcConn, args []string) bool {
+	c.reply("MN")
+	return true
+}
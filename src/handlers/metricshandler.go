@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/dhanushcrueiso/coding-test/internal/metrics"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// httpMetrics are the request metrics recorded by the Metrics middleware
+type httpMetrics struct {
+	registry *metrics.Registry
+	requests *metrics.CounterVec
+	latency  *metrics.HistogramVec
+}
+
+// WithMetrics records request metrics into r and serves r on /metrics
+func WithMetrics(r *metrics.Registry) Option {
+	return func(h *Handler) {
+		h.metrics = &httpMetrics{
+			registry: r,
+			requests: r.NewCounterVec("datastore_http_requests_total",
+				"HTTP requests handled, by route and status code.",
+				"method", "route", "status"),
+			latency: r.NewHistogramVec("datastore_http_request_duration_seconds",
+				"Time taken to handle HTTP requests, by route.",
+				metrics.DefBuckets, "method", "route"),
+		}
+	}
+}
+
+// Metrics counts requests and their latency per route. Requests that match
+// no route only pass through the global middleware mounted on "/", and are
+// grouped under "unmatched" to keep label values bounded.
+func (h *Handler) Metrics(c *fiber.Ctx) error {
+	if h.metrics == nil {
+		return c.Next()
+	}
+	start := time.Now()
+	err := c.Next()
+	elapsed := time.Since(start)
+
+	status := c.Response().StatusCode()
+	if err != nil {
+		status = errorStatus(err)
+	}
+	route := c.Route().Path
+	if route == "/" && c.Path() != "/" {
+		route = "unmatched"
+	}
+	h.metrics.requests.With(c.Method(), route, strconv.Itoa(status)).Inc()
+	h.metrics.latency.With(c.Method(), route).Observe(elapsed.Seconds())
+	return err
+}
+
+// GetMetrics serves all metrics in the Prometheus text format
+func (h *Handler) GetMetrics(c *fiber.Ctx) error {
+	if h.metrics == nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "metrics are not enabled"})
+	}
+	c.Set(fiber.HeaderContentType, metrics.ContentType)
+	_, err := h.metrics.registry.WriteTo(c.Response().BodyWriter())
+	return err
+}
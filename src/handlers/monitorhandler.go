@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// monitorBuffer is how many events a subscriber may fall behind before
+// further events are dropped for it
+const monitorBuffer = 256
+
+// monitorKeepAlive is how often idle streams are written to, so clients
+// that went away are noticed
+const monitorKeepAlive = 15 * time.Second
+
+// monitor fans commands out to MONITOR subscribers
+type monitor struct {
+	mu     sync.Mutex
+	subs   map[chan command]struct{}
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newMonitor() *monitor {
+	return &monitor{
+		subs:   make(map[chan command]struct{}),
+		closed: make(chan struct{}),
+	}
+}
+
+func (m *monitor) active() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.subs) > 0
+}
+
+func (m *monitor) subscribe() chan command {
+	ch := make(chan command, monitorBuffer)
+	m.mu.Lock()
+	m.subs[ch] = struct{}{}
+	m.mu.Unlock()
+	return ch
+}
+
+func (m *monitor) unsubscribe(ch chan command) {
+	m.mu.Lock()
+	delete(m.subs, ch)
+	m.mu.Unlock()
+}
+
+// publish never blocks; a subscriber that cannot keep up misses events
+func (m *monitor) publish(cmd command) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for ch := range m.subs {
+		select {
+		case ch <- cmd:
+		default:
+		}
+	}
+}
+
+// close ends every stream so shutdown does not wait on them
+func (m *monitor) close() {
+	m.once.Do(func() { close(m.closed) })
+}
+
+// CloseStreams ends open MONITOR streams. Call it before shutting the
+// server down.
+func (h *Handler) CloseStreams() {
+	h.monitor.close()
+}
+
+// Monitor streams every command processed by the data routes as
+// newline-delimited JSON until the client disconnects
+func (h *Handler) Monitor(c *fiber.Ctx) error {
+	ch := h.monitor.subscribe()
+	closed := h.monitor.closed
+
+	c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer h.monitor.unsubscribe(ch)
+		enc := json.NewEncoder(w)
+		keepAlive := time.NewTicker(monitorKeepAlive)
+		defer keepAlive.Stop()
+
+		// Send the headers right away so the client knows it is subscribed
+		if err := w.Flush(); err != nil {
+			return
+		}
+		for {
+			select {
+			case cmd := <-ch:
+				if err := enc.Encode(cmd); err != nil {
+					return
+				}
+			case <-keepAlive.C:
+				if _, err := w.WriteString("\n"); err != nil {
+					return
+				}
+			case <-closed:
+				return
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"github.com/dhanushcrueiso/coding-test/internal/store"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// NamespaceHeader selects the namespace for routes that are not under
+// /api/db/:db
+const NamespaceHeader = "X-Namespace"
+
+const namespaceLocal = "db"
+
+// Namespace selects the keyspace a request works on, from the :db path
+// segment, the X-Namespace header or else the default namespace
+func (h *Handler) Namespace(c *fiber.Ctx) error {
+	name := c.Params("db")
+	if name == "" {
+		name = c.Get(NamespaceHeader)
+	}
+	if name == "" {
+		name = store.DefaultDB
+	}
+	if !store.ValidDBName(name) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": store.ErrInvalidDB.Error()})
+	}
+	c.Locals(namespaceLocal, name)
+	return c.Next()
+}
+
+// namespace is the name selected by the Namespace middleware
+func namespace(c *fiber.Ctx) string {
+	if name, ok := c.Locals(namespaceLocal).(string); ok {
+		return name
+	}
+	return store.DefaultDB
+}
+
+// db returns the store view for the request's namespace
+func (h *Handler) db(c *fiber.Ctx) *store.DB {
+	return h.store.DB(namespace(c))
+}
+
+func (h *Handler) DBSize(c *fiber.Ctx) error {
+	return c.Status(200).JSON(fiber.Map{
+		"db":   namespace(c),
+		"keys": h.db(c).Size()})
+}
+
+func (h *Handler) FlushDB(c *fiber.Ctx) error {
+	n, err := h.db(c).Flush()
+	if status, ok := storageStatus(err); ok {
+		return failWith(c, status, err)
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to flush namespace"})
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"message": "namespace flushed",
+		"removed": n})
+}
+
+func (h *Handler) SwapDB(c *fiber.Ctx) error {
+	var data struct {
+		A string `json:"a"`
+		B string `json:"b"`
+	}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body"})
+	}
+	if !store.ValidDBName(data.A) || !store.ValidDBName(data.B) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": store.ErrInvalidDB.Error()})
+	}
+	if err := h.store.SwapDB(data.A, data.B); err != nil {
+		if status, ok := storageStatus(err); ok {
+			return failWith(c, status, err)
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to swap namespaces"})
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"message": "namespaces swapped"})
+}
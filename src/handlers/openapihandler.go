@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	_ "embed"
+	"encoding/json"
+
+	"github.com/dhanushcrueiso/coding-test/internal/openapi"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Paths of the OpenAPI document and the docs page rendering it. Like the
+// health check they need no credentials.
+const (
+	OpenAPIPath = "/api/openapi.json"
+	DocsPath    = "/api/docs"
+)
+
+//go:embed docs.html
+var docsPage []byte
+
+// SetAPISpec serves doc at OpenAPIPath and makes Validate check requests
+// against it
+func (h *Handler) SetAPISpec(doc *openapi.Document) error {
+	doc.Info.Version = h.version
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	h.spec, h.specIndex = data, openapi.NewIndex(doc)
+	return nil
+}
+
+func (h *Handler) GetOpenAPI(c *fiber.Ctx) error {
+	if h.spec == nil {
+		return fail(c, 404, CodeNotFound, "no API description")
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+	return c.Send(h.spec)
+}
+
+func (h *Handler) GetDocs(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return c.Send(docsPage)
+}
+
+// Validate rejects with 400 a request whose query parameters or JSON body
+// do not match its operation in the OpenAPI document. Requests the
+// document does not describe are left to the router.
+func (h *Handler) Validate(c *fiber.Ctx) error {
+	if h.specIndex == nil {
+		return c.Next()
+	}
+	op := h.specIndex.Find(c.Method(), c.Path())
+	if op == nil {
+		return c.Next()
+	}
+	err := op.ValidateQuery(c.Queries())
+	if err == nil {
+		err = op.ValidateBody(c.Get(fiber.HeaderContentType), c.Body())
+	}
+	if err != nil {
+		return fail(c, 400, CodeInvalidArgument, err.Error())
+	}
+	return c.Next()
+}
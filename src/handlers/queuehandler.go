@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dhanushcrueiso/coding-test/internal/store"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// queueError responds to a failed queue command
+func queueError(c *fiber.Ctx, err error) error {
+	status := 500
+	if s, ok := storageStatus(err); ok {
+		status = s
+	} else {
+		switch {
+		case errors.Is(err, store.ErrNoSuchKey), errors.Is(err, store.ErrNoMessage):
+			status = 404
+		case errors.Is(err, store.ErrWrongType), errors.Is(err, store.ErrStaleReceipt):
+			status = 409
+		}
+	}
+	return failWith(c, status, err)
+}
+
+// millis reads a non-negative duration in milliseconds
+func millis(ms int) (time.Duration, bool) {
+	return time.Duration(ms) * time.Millisecond, ms >= 0
+}
+
+func (h *Handler) Enqueue(c *fiber.Ctx) error {
+	var data struct {
+		Body    string `json:"body"`
+		DelayMs int    `json:"delay_ms"`
+	}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body"})
+	}
+	delay, ok := millis(data.DelayMs)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid delay_ms value"})
+	}
+	id, err := h.db(c).Enqueue(keyParam(c), data.Body, delay)
+	if err != nil {
+		return queueError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"id": id})
+}
+
+// Receive leases up to count messages, waiting up to wait_ms for one when
+// none are ready
+func (h *Handler) Receive(c *fiber.Ctx) error {
+	var data struct {
+		Count        int `json:"count"`
+		VisibilityMs int `json:"visibility_ms"`
+		WaitMs       int `json:"wait_ms"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&data); err != nil || data.Count < 0 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "invalid request body"})
+		}
+	}
+	lease, ok := millis(data.VisibilityMs)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid visibility_ms value"})
+	}
+	block, err := parseBlock(data.WaitMs)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid wait_ms value"})
+	}
+	msgs, err := h.db(c).Receive(c.Context(), keyParam(c), data.Count, lease, block)
+	if err != nil {
+		return queueError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"messages": msgs})
+}
+
+// leaseRequest is the body of the ack, nack and extend routes
+type leaseRequest struct {
+	Receipt      string `json:"receipt"`
+	DelayMs      int    `json:"delay_ms"`
+	VisibilityMs int    `json:"visibility_ms"`
+}
+
+func parseLease(c *fiber.Ctx) (leaseRequest, bool) {
+	var data leaseRequest
+	err := c.BodyParser(&data)
+	return data, err == nil && data.Receipt != "" && data.DelayMs >= 0 && data.VisibilityMs >= 0
+}
+
+func (h *Handler) Ack(c *fiber.Ctx) error {
+	data, ok := parseLease(c)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body"})
+	}
+	if err := h.db(c).Ack(keyParam(c), param(c, "id"), data.Receipt); err != nil {
+		return queueError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"message": "message acknowledged"})
+}
+
+// Nack returns a message to the queue, to be delivered again after
+// delay_ms
+func (h *Handler) Nack(c *fiber.Ctx) error {
+	data, ok := parseLease(c)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body"})
+	}
+	delay, _ := millis(data.DelayMs)
+	if err := h.db(c).Nack(keyParam(c), param(c, "id"), data.Receipt, delay); err != nil {
+		return queueError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"message": "message returned"})
+}
+
+func (h *Handler) ExtendLease(c *fiber.Ctx) error {
+	data, ok := parseLease(c)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body"})
+	}
+	lease, _ := millis(data.VisibilityMs)
+	if err := h.db(c).ExtendLease(keyParam(c), param(c, "id"), data.Receipt, lease); err != nil {
+		return queueError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"message": "lease extended"})
+}
+
+func (h *Handler) QueueInfo(c *fiber.Ctx) error {
+	info, err := h.db(c).QueueInfo(keyParam(c))
+	if err != nil {
+		return queueError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"ready":         info.Ready,
+		"in_flight":     info.InFlight,
+		"delayed":       info.Delayed,
+		"visibility_ms": info.Visibility.Milliseconds(),
+		"max_attempts":  info.MaxAttempts,
+		"dead_letter":   info.DeadLetter,
+	})
+}
+
+func (h *Handler) ConfigureQueue(c *fiber.Ctx) error {
+	var data struct {
+		VisibilityMs int    `json:"visibility_ms"`
+		MaxAttempts  int    `json:"max_attempts"`
+		DeadLetter   string `json:"dead_letter"`
+	}
+	if err := c.BodyParser(&data); err != nil || data.VisibilityMs < 0 || data.MaxAttempts < 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body"})
+	}
+	// Dead messages are written to the dead-letter key, so the user needs
+	// access to it as well as to the queue
+	if user := currentUser(c); user != nil && data.DeadLetter != "" && !user.CanAccess(data.DeadLetter) {
+		return c.Status(403).JSON(fiber.Map{
+			"error": "user " + user.Name + " has no permission to access the dead-letter key"})
+	}
+	err := h.db(c).ConfigureQueue(keyParam(c), store.QueueConfig{
+		Visibility:  time.Duration(data.VisibilityMs) * time.Millisecond,
+		MaxAttempts: data.MaxAttempts,
+		DeadLetter:  data.DeadLetter,
+	})
+	if err != nil {
+		return queueError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"message": "queue configured"})
+}
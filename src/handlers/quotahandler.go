@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/dhanushcrueiso/coding-test/internal/quota"
+	"github.com/dhanushcrueiso/coding-test/internal/raft"
+	"github.com/dhanushcrueiso/coding-test/internal/store"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// WithQuotas enables per-tenant rate limits and the quota routes
+func WithQuotas(r *quota.Registry) Option {
+	return func(h *Handler) {
+		h.quotas = r
+	}
+}
+
+// storageStatus maps store errors caused by memory limits and quotas, and
+// commands a replicated store could not commit, to a response status
+func storageStatus(err error) (int, bool) {
+	switch {
+	case errors.Is(err, store.ErrValueTooLarge):
+		return 413, true
+	case errors.Is(err, store.ErrOutOfMemory),
+		errors.Is(err, store.ErrKeyQuota),
+		errors.Is(err, store.ErrByteQuota):
+		return 507, true
+	case errors.Is(err, raft.ErrNotLeader), errors.Is(err, raft.ErrNoLeader),
+		errors.Is(err, raft.ErrTimeout):
+		return 503, true
+	}
+	return 0, false
+}
+
+// RateLimit rejects the request with 429 when the user or the namespace it
+// selects has used up its request rate. It must run after Namespace and
+// Allow, so requests the user may not make are not charged.
+func (h *Handler) RateLimit(c *fiber.Ctx) error {
+	if h.quotas == nil {
+		return c.Next()
+	}
+	var name string
+	if user := currentUser(c); user != nil {
+		name = user.Name
+	}
+	err := h.quotas.Allow(namespace(c), name, time.Now())
+	var limited *quota.RateLimited
+	if errors.As(err, &limited) {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(limited.Wait.Seconds()))))
+		return c.Status(429).JSON(fiber.Map{
+			"error": err.Error()})
+	}
+	return c.Next()
+}
+
+type quotaUsage struct {
+	Kind   quota.Kind   `json:"kind"`
+	Name   string       `json:"name"`
+	Limits quota.Limits `json:"limits"`
+	// Usage is only reported for namespaces
+	Usage *store.Usage `json:"usage,omitempty"`
+}
+
+func (h *Handler) quotaUsage(kind quota.Kind, name string, l quota.Limits) quotaUsage {
+	q := quotaUsage{Kind: kind, Name: name, Limits: l}
+	if kind == quota.Namespace && name != quota.Default {
+		u := h.store.DB(name).Usage()
+		q.Usage = &u
+	}
+	return q
+}
+
+// GetUsage reports the limits and usage of the selected namespace
+func (h *Handler) GetUsage(c *fiber.Ctx) error {
+	var l quota.Limits
+	if h.quotas != nil {
+		l, _ = h.quotas.Get(quota.Namespace, namespace(c))
+	}
+	return c.Status(200).JSON(h.quotaUsage(quota.Namespace, namespace(c), l))
+}
+
+func (h *Handler) ListQuotas(c *fiber.Ctx) error {
+	if h.quotas == nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "quotas are not enabled"})
+	}
+	entries := h.quotas.All()
+	out := make([]quotaUsage, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, h.quotaUsage(e.Kind, e.Name, e.Limits))
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"quotas": out})
+}
+
+func (h *Handler) GetQuota(c *fiber.Ctx) error {
+	if h.quotas == nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "quotas are not enabled"})
+	}
+	kind, err := quota.ParseKind(c.Params("kind"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error()})
+	}
+	l, ok := h.quotas.Get(kind, c.Params("name"))
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "no limits set"})
+	}
+	return c.Status(200).JSON(h.quotaUsage(kind, c.Params("name"), l))
+}
+
+func (h *Handler) SetQuota(c *fiber.Ctx) error {
+	if h.quotas == nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "quotas are not enabled"})
+	}
+	kind, err := quota.ParseKind(c.Params("kind"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error()})
+	}
+	var l quota.Limits
+	if err := c.BodyParser(&l); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body"})
+	}
+	if err := h.quotas.Set(kind, c.Params("name"), l); err != nil {
+		if errors.Is(err, quota.ErrInvalid) {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error()})
+		}
+		h.log(c).Error("set quota failed", "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to save quotas"})
+	}
+	return c.Status(200).JSON(h.quotaUsage(kind, c.Params("name"), l))
+}
+
+func (h *Handler) DeleteQuota(c *fiber.Ctx) error {
+	if h.quotas == nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "quotas are not enabled"})
+	}
+	kind, err := quota.ParseKind(c.Params("kind"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error()})
+	}
+	if err := h.quotas.Delete(kind, c.Params("name")); err != nil {
+		if errors.Is(err, quota.ErrNotFound) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": err.Error()})
+		}
+		h.log(c).Error("delete quota failed", "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to save quotas"})
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"message": "quota removed"})
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"github.com/dhanushcrueiso/coding-test/internal/store"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func (h *Handler) ListSearchIndexes(c *fiber.Ctx) error {
+	return c.Status(200).JSON(h.db(c).FullTextIndexes())
+}
+
+func (h *Handler) GetSearchIndex(c *fiber.Ctx) error {
+	info, err := h.db(c).FullTextIndex(c.Params("name"))
+	if err != nil {
+		return indexError(c, err)
+	}
+	return c.Status(200).JSON(info)
+}
+
+// CreateSearchIndex defines a full-text index named in the path over the
+// body's prefixes and paths
+func (h *Handler) CreateSearchIndex(c *fiber.Ctx) error {
+	var def store.FullTextDef
+	if err := c.BodyParser(&def); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body"})
+	}
+	def.Name = c.Params("name")
+	if err := h.db(c).CreateFullText(def); err != nil {
+		return indexError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"message": "index created"})
+}
+
+func (h *Handler) DropSearchIndex(c *fiber.Ctx) error {
+	if err := h.db(c).DropFullText(c.Params("name")); err != nil {
+		return indexError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"message": "index dropped"})
+}
+
+// Search runs the body's full-text query. Keys the user may not access are
+// left out, from the total too.
+func (h *Handler) Search(c *fiber.Ctx) error {
+	var data struct {
+		store.SearchOptions
+		Query string `json:"query"`
+		Limit *int   `json:"limit"`
+	}
+	if err := c.BodyParser(&data); err != nil || data.Query == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body"})
+	}
+	opts := data.SearchOptions
+	opts.Limit = defaultQueryLimit
+	if data.Limit != nil {
+		opts.Limit = *data.Limit
+	}
+	if user := currentUser(c); user != nil {
+		opts.Allow = user.CanAccess
+	}
+	res, err := h.db(c).Search(c.Params("name"), data.Query, opts)
+	if err != nil {
+		return indexError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"total": res.Total,
+		"hits":  res.Hits})
+}
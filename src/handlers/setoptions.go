@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/dhanushcrueiso/coding-test/internal/acl"
+	"github.com/dhanushcrueiso/coding-test/internal/store"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// expiration is an expiry given in the query string as ?ttl seconds, ?px
+// milliseconds, or a Unix time in ?exat seconds or ?pxat milliseconds
+type expiration struct {
+	TTL   time.Duration
+	At    time.Time
+	given int
+}
+
+var errInvalidExpiration = errors.New("invalid ttl, px, exat or pxat value")
+
+func parseExpiration(c *fiber.Ctx) (expiration, error) {
+	var e expiration
+	for _, p := range []struct {
+		name string
+		unit time.Duration
+		abs  bool
+	}{
+		{"ttl", time.Second, false},
+		{"px", time.Millisecond, false},
+		{"exat", time.Second, true},
+		{"pxat", time.Millisecond, true},
+	} {
+		v := c.Query(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 || (p.abs && n == 0) {
+			return expiration{}, errInvalidExpiration
+		}
+		e.given++
+		if p.abs {
+			e.At = time.UnixMilli(n * int64(p.unit/time.Millisecond))
+		} else {
+			e.TTL = time.Duration(n) * p.unit
+		}
+	}
+	if e.given > 1 {
+		return expiration{}, store.ErrConflictingOptions
+	}
+	return e, nil
+}
+
+// parseSetOptions reads the options of SET from the query string:
+// ?nx, ?xx, ?get, ?keepttl and an expiration
+func parseSetOptions(c *fiber.Ctx) (store.SetOptions, error) {
+	e, err := parseExpiration(c)
+	if err != nil {
+		return store.SetOptions{}, err
+	}
+	return store.SetOptions{
+		NX:       c.QueryBool("nx"),
+		XX:       c.QueryBool("xx"),
+		Get:      c.QueryBool("get"),
+		KeepTTL:  c.QueryBool("keepttl"),
+		TTL:      e.TTL,
+		ExpireAt: e.At,
+	}, nil
+}
+
+// stringError responds to a failed string command
+func stringError(c *fiber.Ctx, err error) error {
+	status := 500
+	if s, ok := storageStatus(err); ok {
+		status = s
+	} else {
+		switch {
+		case errors.Is(err, store.ErrConflictingOptions), errors.Is(err, errInvalidExpiration):
+			status = 400
+		case errors.Is(err, store.ErrWrongType):
+			status = 409
+		case errors.Is(err, store.ErrVersionMismatch):
+			status = 412
+		}
+	}
+	return failWith(c, status, err)
+}
+
+// isGetEx reports whether a GET has ?ttl, ?px, ?exat, ?pxat or ?persist,
+// which make it GETEX: a write, since it changes the key's expiration
+func isGetEx(c *fiber.Ctx) bool {
+	for _, name := range []string{"ttl", "px", "exat", "pxat"} {
+		if c.Query(name) != "" {
+			return true
+		}
+	}
+	return c.QueryBool("persist")
+}
+
+// getEx is GET with ?ttl, ?px, ?exat, ?pxat or ?persist, which also
+// changes the key's expiration
+func (h *Handler) getEx(c *fiber.Ctx, key string, e expiration) error {
+	if user := currentUser(c); user != nil && !user.Can(acl.Write) {
+		return c.Status(403).JSON(fiber.Map{
+			"error": "user " + user.Name + " has no permission to run this command"})
+	}
+	v, found, err := h.db(c).GetStringEx(key, store.GetExOptions{
+		TTL:      e.TTL,
+		ExpireAt: e.At,
+		Persist:  c.QueryBool("persist"),
+	})
+	if err != nil {
+		return stringError(c, err)
+	}
+	if !found {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "data not found"})
+	}
+	// The expiration changed but the value did not, so the version stands
+	if notModified(c, v.Version) {
+		return nil
+	}
+	if wantsRaw(c) {
+		return sendRaw(c, v.Value)
+	}
+	return c.JSON(fiber.Map{
+		"key":   key,
+		"value": v.Value,
+		"type":  store.StringType,
+	})
+}
+
+// getDel is DELETE with ?get=true, which returns the deleted string. A
+// non-zero version only deletes the key at that version.
+func (h *Handler) getDel(c *fiber.Ctx, key string, version uint64) error {
+	value, found, err := h.db(c).GetDelVersion(key, version)
+	if err != nil {
+		return stringError(c, err)
+	}
+	if !found && version != 0 {
+		return preconditionFailed(c)
+	}
+	if !found {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "data not found"})
+	}
+	if wantsRaw(c) {
+		return sendRaw(c, value)
+	}
+	return c.JSON(fiber.Map{
+		"key":   key,
+		"value": value,
+		"type":  store.StringType,
+	})
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// slowLogEntry is a command that took longer than the threshold
+type slowLogEntry struct {
+	ID uint64 `json:"id"`
+	command
+}
+
+// slowLog keeps the most recent slow commands, newest first
+type slowLog struct {
+	mu        sync.Mutex
+	threshold time.Duration
+	maxLen    int
+	nextID    uint64
+	entries   []slowLogEntry
+}
+
+func newSlowLog(threshold time.Duration, maxLen int) *slowLog {
+	return &slowLog{threshold: threshold, maxLen: maxLen}
+}
+
+// SetSlowLog changes the slow log threshold and how many entries it keeps.
+// A length of zero disables the slow log.
+func (h *Handler) SetSlowLog(threshold time.Duration, maxLen int) {
+	l := h.slowlog
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.threshold, l.maxLen = threshold, maxLen
+	if len(l.entries) > maxLen {
+		l.entries = l.entries[:maxLen]
+	}
+}
+
+func (l *slowLog) exceeds(d time.Duration) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.maxLen > 0 && d >= l.threshold
+}
+
+func (l *slowLog) add(cmd command) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxLen == 0 {
+		return
+	}
+	e := slowLogEntry{ID: l.nextID, command: cmd}
+	l.nextID++
+	if len(l.entries) < l.maxLen {
+		l.entries = append(l.entries, slowLogEntry{})
+	}
+	copy(l.entries[1:], l.entries)
+	l.entries[0] = e
+}
+
+// GetSlowLog returns the newest slow log entries, up to count if given
+func (h *Handler) GetSlowLog(c *fiber.Ctx) error {
+	l := h.slowlog
+	l.mu.Lock()
+	entries := append([]slowLogEntry{}, l.entries...)
+	threshold := l.threshold
+	l.mu.Unlock()
+
+	if s := c.Query("count"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "invalid count"})
+		}
+		if n < len(entries) {
+			entries = entries[:n]
+		}
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"threshold_us": threshold.Microseconds(),
+		"len":          len(entries),
+		"entries":      entries,
+	})
+}
+
+// ResetSlowLog drops every slow log entry
+func (h *Handler) ResetSlowLog(c *fiber.Ctx) error {
+	l := h.slowlog
+	l.mu.Lock()
+	l.entries = nil
+	l.mu.Unlock()
+	return c.Status(200).JSON(fiber.Map{
+		"message": "slow log reset"})
+}
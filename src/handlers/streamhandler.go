@@ -0,0 +1,367 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dhanushcrueiso/coding-test/internal/store"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxBlock caps how long a blocking stream read may wait
+const maxBlock = time.Minute
+
+// streamError responds to a failed stream command
+func streamError(c *fiber.Ctx, err error) error {
+	status := 500
+	if s, ok := storageStatus(err); ok {
+		status = s
+	} else {
+		switch {
+		case errors.Is(err, store.ErrInvalidStreamID),
+			errors.Is(err, store.ErrStreamIDTooSmall),
+			errors.Is(err, store.ErrNoFields):
+			status = 400
+		case errors.Is(err, store.ErrNoSuchKey), errors.Is(err, store.ErrNoGroup):
+			status = 404
+		case errors.Is(err, store.ErrWrongType), errors.Is(err, store.ErrGroupExists):
+			status = 409
+		}
+	}
+	return failWith(c, status, err)
+}
+
+func parseIDs(ids []string) ([]store.StreamID, error) {
+	out := make([]store.StreamID, 0, len(ids))
+	for _, s := range ids {
+		id, err := store.ParseStreamID(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, nil
+}
+
+// parseBlock reads a block time in milliseconds
+func parseBlock(ms int) (time.Duration, error) {
+	if ms < 0 {
+		return 0, errors.New("invalid block value")
+	}
+	block := time.Duration(ms) * time.Millisecond
+	if block > maxBlock {
+		block = maxBlock
+	}
+	return block, nil
+}
+
+func (h *Handler) XAdd(c *fiber.Ctx) error {
+	var data store.XAddArgs
+	if err := c.BodyParser(&data); err != nil || data.MaxLen < 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body"})
+	}
+	id, err := h.db(c).XAdd(keyParam(c), data)
+	if err != nil {
+		return streamError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"id": id})
+}
+
+// XRange returns entries between ?start and ?end, newest first with
+// ?rev=true
+func (h *Handler) XRange(c *fiber.Ctx) error {
+	count := c.QueryInt("count", 0)
+	if count < 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid count value"})
+	}
+	entries, err := h.db(c).XRange(keyParam(c),
+		c.Query("start", "-"), c.Query("end", "+"), count, c.QueryBool("rev"))
+	if err != nil {
+		return streamError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"entries": entries})
+}
+
+// XRead returns entries after ?after, waiting up to ?block milliseconds
+// for one when there are none
+func (h *Handler) XRead(c *fiber.Ctx) error {
+	count := c.QueryInt("count", 0)
+	if count < 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid count value"})
+	}
+	block, err := parseBlock(c.QueryInt("block", 0))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error()})
+	}
+	entries, err := h.db(c).XRead(c.Context(), keyParam(c), c.Query("after", "$"), count, block)
+	if err != nil {
+		return streamError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"entries": entries})
+}
+
+func (h *Handler) XDel(c *fiber.Ctx) error {
+	var data struct {
+		IDs []string `json:"ids"`
+	}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body"})
+	}
+	ids, err := parseIDs(data.IDs)
+	if err != nil {
+		return streamError(c, err)
+	}
+	n, err := h.db(c).XDel(keyParam(c), ids...)
+	if err != nil {
+		return streamError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"deleted": n})
+}
+
+func (h *Handler) XTrim(c *fiber.Ctx) error {
+	var data struct {
+		MaxLen int    `json:"maxlen"`
+		MinID  string `json:"minid"`
+	}
+	if err := c.BodyParser(&data); err != nil || data.MaxLen < 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body"})
+	}
+	n, err := h.db(c).XTrim(keyParam(c), data.MaxLen, data.MinID)
+	if err != nil {
+		return streamError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"trimmed": n})
+}
+
+func (h *Handler) XInfoStream(c *fiber.Ctx) error {
+	info, err := h.db(c).XInfoStream(keyParam(c))
+	if err != nil {
+		return streamError(c, err)
+	}
+	return c.Status(200).JSON(info)
+}
+
+func (h *Handler) XInfoGroups(c *fiber.Ctx) error {
+	groups, err := h.db(c).XInfoGroups(keyParam(c))
+	if err != nil {
+		return streamError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"groups": groups})
+}
+
+func (h *Handler) XGroupCreate(c *fiber.Ctx) error {
+	var data struct {
+		Group    string `json:"group"`
+		ID       string `json:"id"`
+		MkStream bool   `json:"mkstream"`
+	}
+	if err := c.BodyParser(&data); err != nil || data.Group == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body"})
+	}
+	if data.ID == "" {
+		data.ID = "$"
+	}
+	if err := h.db(c).XGroupCreate(keyParam(c), data.Group, data.ID, data.MkStream); err != nil {
+		return streamError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"message": "group created"})
+}
+
+func (h *Handler) XGroupDestroy(c *fiber.Ctx) error {
+	ok, err := h.db(c).XGroupDestroy(keyParam(c), param(c, "group"))
+	if err != nil {
+		return streamError(c, err)
+	}
+	if !ok {
+		return streamError(c, store.ErrNoGroup)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"message": "group destroyed"})
+}
+
+func (h *Handler) XInfoConsumers(c *fiber.Ctx) error {
+	consumers, err := h.db(c).XInfoConsumers(keyParam(c), param(c, "group"))
+	if err != nil {
+		return streamError(c, err)
+	}
+	out := make([]fiber.Map, 0, len(consumers))
+	for _, ci := range consumers {
+		inactive := int64(-1)
+		if ci.Inactive >= 0 {
+			inactive = ci.Inactive.Milliseconds()
+		}
+		out = append(out, fiber.Map{
+			"name":        ci.Name,
+			"pending":     ci.Pending,
+			"idle_ms":     ci.Idle.Milliseconds(),
+			"inactive_ms": inactive,
+		})
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"consumers": out})
+}
+
+func (h *Handler) XGroupDelConsumer(c *fiber.Ctx) error {
+	n, err := h.db(c).XGroupDelConsumer(keyParam(c), param(c, "group"), param(c, "consumer"))
+	if err != nil {
+		return streamError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"pending": n})
+}
+
+func (h *Handler) XReadGroup(c *fiber.Ctx) error {
+	var data struct {
+		Consumer string `json:"consumer"`
+		ID       string `json:"id"`
+		Count    int    `json:"count"`
+		BlockMs  int    `json:"block_ms"`
+		NoAck    bool   `json:"noack"`
+	}
+	if err := c.BodyParser(&data); err != nil || data.Consumer == "" || data.Count < 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body"})
+	}
+	block, err := parseBlock(data.BlockMs)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error()})
+	}
+	entries, err := h.db(c).XReadGroup(c.Context(), keyParam(c), store.XReadGroupArgs{
+		Group:    param(c, "group"),
+		Consumer: data.Consumer,
+		ID:       data.ID,
+		Count:    data.Count,
+		NoAck:    data.NoAck,
+	}, block)
+	if err != nil {
+		return streamError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"entries": entries})
+}
+
+func (h *Handler) XAck(c *fiber.Ctx) error {
+	var data struct {
+		IDs []string `json:"ids"`
+	}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body"})
+	}
+	ids, err := parseIDs(data.IDs)
+	if err != nil {
+		return streamError(c, err)
+	}
+	n, err := h.db(c).XAck(keyParam(c), param(c, "group"), ids...)
+	if err != nil {
+		return streamError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"acked": n})
+}
+
+// XPending summarises the group's pending entries, or lists them when any
+// of ?start, ?end, ?count, ?consumer or ?min_idle_ms is given
+func (h *Handler) XPending(c *fiber.Ctx) error {
+	key, group := keyParam(c), param(c, "group")
+	if len(c.Request().URI().QueryString()) == 0 {
+		sum, err := h.db(c).XPending(key, group)
+		if err != nil {
+			return streamError(c, err)
+		}
+		return c.Status(200).JSON(sum)
+	}
+
+	count, minIdle := c.QueryInt("count", 0), c.QueryInt("min_idle_ms", 0)
+	if count < 0 || minIdle < 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid count or min_idle_ms value"})
+	}
+	pending, err := h.db(c).XPendingRange(key, group, store.XPendingArgs{
+		Start:    c.Query("start", "-"),
+		End:      c.Query("end", "+"),
+		Count:    count,
+		Consumer: c.Query("consumer"),
+		MinIdle:  time.Duration(minIdle) * time.Millisecond,
+	})
+	if err != nil {
+		return streamError(c, err)
+	}
+	out := make([]fiber.Map, 0, len(pending))
+	for _, p := range pending {
+		out = append(out, fiber.Map{
+			"id":         p.ID,
+			"consumer":   p.Consumer,
+			"idle_ms":    p.Idle.Milliseconds(),
+			"deliveries": p.Deliveries,
+		})
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"pending": out})
+}
+
+func (h *Handler) XClaim(c *fiber.Ctx) error {
+	var data struct {
+		Consumer  string   `json:"consumer"`
+		MinIdleMs int      `json:"min_idle_ms"`
+		IDs       []string `json:"ids"`
+	}
+	if err := c.BodyParser(&data); err != nil || data.Consumer == "" || data.MinIdleMs < 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body"})
+	}
+	ids, err := parseIDs(data.IDs)
+	if err != nil {
+		return streamError(c, err)
+	}
+	entries, err := h.db(c).XClaim(keyParam(c), param(c, "group"), data.Consumer,
+		time.Duration(data.MinIdleMs)*time.Millisecond, ids...)
+	if err != nil {
+		return streamError(c, err)
+	}
+	return c.Status(200).JSON(fiber.Map{
+		"entries": entries})
+}
+
+func (h *Handler) XAutoClaim(c *fiber.Ctx) error {
+	var data struct {
+		Consumer  string `json:"consumer"`
+		MinIdleMs int    `json:"min_idle_ms"`
+		Start     string `json:"start"`
+		Count     int    `json:"count"`
+	}
+	if err := c.BodyParser(&data); err != nil || data.Consumer == "" || data.MinIdleMs < 0 || data.Count < 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body"})
+	}
+	var start store.StreamID
+	if data.Start != "" && data.Start != "0" {
+		id, err := store.ParseStreamID(data.Start)
+		if err != nil {
+			return streamError(c, err)
+		}
+		start = id
+	}
+	res, err := h.db(c).XAutoClaim(keyParam(c), param(c, "group"), data.Consumer,
+		time.Duration(data.MinIdleMs)*time.Millisecond, start, data.Count)
+	if err != nil {
+		return streamError(c, err)
+	}
+	return c.Status(200).JSON(res)
+}
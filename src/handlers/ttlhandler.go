@@ -1,48 +1,100 @@
 package handlers
 
 import (
-	"strconv"
 	"time"
 
+	"github.com/dhanushcrueiso/coding-test/internal/store"
+
 	"github.com/gofiber/fiber/v2"
 )
 
+// GetTtlData reports the remaining TTL in seconds as data, rounded to the
+// nearest second, and in milliseconds as ttl_ms. expire_time and
+// expire_time_ms are the Unix time the key expires at. All are -1 for a
+// key without an expiration.
 func (h *Handler) GetTtlData(c *fiber.Ctx) error {
-	key := c.Params("key")
+	key := keyParam(c)
 
-	ttl, bool := h.store.GetTTL(key)
-	if !bool {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Failed to set TTL/data not found",
+	at, found := h.db(c).ExpireTime(key)
+	if !found {
+		return fail(c, 400, CodeNotFound, "key not found")
+	}
+	if at.IsZero() {
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message":        "key has no ttl",
+			"data":           -1,
+			"ttl_ms":         -1,
+			"expire_time":    -1,
+			"expire_time_ms": -1,
 		})
 	}
 
+	ttl := time.Until(at)
+	if ttl < 0 {
+		ttl = 0
+	}
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"message": "TTL set successfully",
-		"data":    int(ttl.Seconds()),
+		"message":        "ttl retrieved",
+		"data":           int64(ttl.Round(time.Second).Seconds()),
+		"ttl_ms":         ttl.Milliseconds(),
+		"expire_time":    at.Unix(),
+		"expire_time_ms": at.UnixMilli(),
 	})
 }
 
+// SetTtlData sets the expiration from ?ttl seconds, ?px milliseconds or a
+// Unix time in ?exat or ?pxat, if the ?nx, ?xx, ?gt or ?lt condition holds.
+// A relative TTL of zero removes the expiration.
 func (h *Handler) SetTtlData(c *fiber.Ctx) error {
-	key := c.Params("key")
-	ttlStr := c.Query("ttl")
-	if ttlStr == "" {
+	key := keyParam(c)
+	e, err := parseExpiration(c)
+	if err == nil && e.given == 0 {
+		err = errInvalidExpiration
+	}
+	if err != nil {
 		return c.Status(400).JSON(fiber.Map{
-			"error": "invalid ttl value"})
+			"error": err.Error()})
 	}
 
-	ttlSeconds, err := strconv.Atoi(ttlStr)
-	if err != nil || ttlSeconds < 0 {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "invalid ttl value"})
+	ok, err := h.db(c).Expire(key, e.TTL, store.ExpireOptions{
+		NX: c.QueryBool("nx"),
+		XX: c.QueryBool("xx"),
+		GT: c.QueryBool("gt"),
+		LT: c.QueryBool("lt"),
+		At: e.At,
+	})
+	if err != nil {
+		return stringError(c, err)
+	}
+	if ok {
+		return c.Status(200).JSON(fiber.Map{
+			"message": "ttl updated",
+			"updated": true})
+	}
+	if _, found := h.db(c).ExpireTime(key); found {
+		return c.Status(200).JSON(fiber.Map{
+			"message": "ttl not updated",
+			"updated": false})
 	}
-	ttl := time.Duration(ttlSeconds) * time.Second
+	return fail(c, 400, CodeNotFound, "key not found")
+}
 
-	if h.store.SetTTL(key, ttl) {
+// PersistTtlData removes the expiration of a key
+func (h *Handler) PersistTtlData(c *fiber.Ctx) error {
+	key := keyParam(c)
+	ok, err := h.db(c).Persist(key)
+	if err != nil {
+		return stringError(c, err)
+	}
+	if ok {
 		return c.Status(200).JSON(fiber.Map{
-			"message": "ttl updated"})
-	} else {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "key not found"})
+			"message": "ttl removed",
+			"updated": true})
+	}
+	if _, found := h.db(c).ExpireTime(key); found {
+		return c.Status(200).JSON(fiber.Map{
+			"message": "key has no ttl",
+			"updated": false})
 	}
+	return fail(c, 400, CodeNotFound, "key not found")
 }
@@ -1,33 +1,189 @@
 package router
 
 import (
+	"github.com/dhanushcrueiso/coding-test/internal/acl"
 	"github.com/dhanushcrueiso/coding-test/src/handlers"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func MountRoutes(app *fiber.App) {
-	apiGroup := app.Group("/api")
-	controller := handlers.NewServer()
+// MountRoutes registers every route. Each route lists the ACL categories a
+// user needs to call it.
+func MountRoutes(app *fiber.App, controller *handlers.Handler) {
+	admin := controller.Allow(acl.Admin)
+
+	app.Use(controller.RequestLogger, controller.Metrics, controller.Envelope, controller.Authenticate, controller.Validate)
+	app.Get("/metrics", admin, controller.GetMetrics)
+	// v2 has the same routes as v1, with responses in one envelope and
+	// statuses that follow the error codes
+	mountAPI(app.Group(handlers.APIv2Prefix), controller)
+	mountAPI(app.Group("/api"), controller)
+
+	// The document is built from the routes above, so a route added
+	// without describing it in operations fails at startup
+	doc, err := buildSpec(app)
+	if err == nil {
+		err = controller.SetAPISpec(doc)
+	}
+	if err != nil {
+		panic(err)
+	}
+	app.Get(handlers.OpenAPIPath, controller.GetOpenAPI)
+	app.Get(handlers.DocsPath, controller.GetDocs)
+}
+
+// mountAPI registers the API routes under r
+func mountAPI(apiGroup fiber.Router, controller *handlers.Handler) {
+	admin := controller.Allow(acl.Admin)
+
 	apiGroup.Get("/health", controller.GetHealth)
-	stringsGroup := apiGroup.Group("/strings")
+	apiGroup.Get("/info", admin, controller.GetInfo)
+	apiGroup.Get("/monitor", admin, controller.Monitor)
+	SlowLogGroup := apiGroup.Group("/slowlog", admin)
+	{
+		SlowLogGroup.Get("/", controller.GetSlowLog)
+		SlowLogGroup.Delete("/", controller.ResetSlowLog)
+	}
+	mountData(apiGroup, controller)
+	mountData(apiGroup.Group("/db/:db"), controller)
+	apiGroup.Post("/swapdb", admin, controller.Consistency, controller.SwapDB)
+	ClusterGroup := apiGroup.Group("/cluster", admin)
+	{
+		ClusterGroup.Get("/", controller.GetClusterStatus)
+		ClusterGroup.Post("/members", controller.Consistency, controller.AddClusterMember)
+		ClusterGroup.Delete("/members/:id", controller.Consistency, controller.RemoveClusterMember)
+	}
+	ConfigGroup := apiGroup.Group("/config", admin)
 	{
-		stringsGroup.Post("/:key", controller.SetStringData)
-		stringsGroup.Get("/:key", controller.GetStringData)
-		stringsGroup.Put("/:key", controller.UpdateStringData)
-		stringsGroup.Delete("/:key", controller.DeleteStringData)
+		ConfigGroup.Get("/", controller.GetConfig)
+		ConfigGroup.Put("/:name", controller.SetConfig)
+		ConfigGroup.Post("/rewrite", controller.RewriteConfig)
 	}
-	TtlGroup := apiGroup.Group("/ttl")
+	QuotaGroup := apiGroup.Group("/quotas", admin)
 	{
-		TtlGroup.Get("/:key", controller.GetTtlData)
-		TtlGroup.Post("/:key", controller.SetTtlData)
+		QuotaGroup.Get("/", controller.ListQuotas)
+		QuotaGroup.Get("/:kind/:name", controller.GetQuota)
+		QuotaGroup.Put("/:kind/:name", controller.SetQuota)
+		QuotaGroup.Delete("/:kind/:name", controller.DeleteQuota)
 	}
-	ListGroup := apiGroup.Group("/list")
+	apiGroup.Get("/acl/whoami", controller.WhoAmI)
+	ACLGroup := apiGroup.Group("/acl/users", admin)
 	{
-		ListGroup.Get("/:key", controller.GetListData)
-		ListGroup.Post("/:key", controller.SetListData)
-		ListGroup.Delete("/:key", controller.DeleteListData)
-		ListGroup.Patch("/:key/:operation", controller.UpdateListData)
+		ACLGroup.Get("/", controller.ListUsers)
+		ACLGroup.Get("/:name", controller.GetUser)
+		ACLGroup.Put("/:name", controller.SetUser)
+		ACLGroup.Delete("/:name", controller.DeleteUser)
+		ACLGroup.Post("/:name/keys", controller.CreateAPIKey)
+		ACLGroup.Delete("/:name/keys", controller.RevokeAPIKeys)
+	}
+}
+
+// mountData registers the data routes under r. They are mounted at /api,
+// where the namespace comes from the X-Namespace header, and again at
+// /api/db/:db.
+func mountData(r fiber.Router, controller *handlers.Handler) {
+	allow := controller.Allow
+	// data checks a command's permissions before it is rate limited,
+	// counted and routed to the leader, so refused requests are not
+	// charged to the tenant
+	data := func(need ...acl.Category) func(fiber.Handler) []fiber.Handler {
+		return func(h fiber.Handler) []fiber.Handler {
+			return []fiber.Handler{controller.Namespace, allow(need...), controller.RateLimit, controller.Commands, controller.Consistency, h}
+		}
 	}
 
+	r.Get("/dbsize", controller.Namespace, controller.Consistency, allow(acl.Read), controller.DBSize)
+	r.Get("/usage", controller.Namespace, allow(acl.Read), controller.GetUsage)
+	r.Post("/flushdb", data(acl.Write, acl.Admin)(controller.FlushDB)...)
+	stringsGroup := r.Group("/strings")
+	{
+		stringsGroup.Post("/:key", data(acl.Write, acl.String)(controller.SetStringData)...)
+		stringsGroup.Get("/:key", data(acl.Read, acl.String)(controller.GetStringData)...)
+		stringsGroup.Put("/:key", data(acl.Write, acl.String)(controller.UpdateStringData)...)
+		stringsGroup.Delete("/:key", data(acl.Write, acl.String)(controller.DeleteStringData)...)
+	}
+	TtlGroup := r.Group("/ttl")
+	{
+		TtlGroup.Get("/:key", data(acl.Read)(controller.GetTtlData)...)
+		TtlGroup.Post("/:key", data(acl.Write)(controller.SetTtlData)...)
+		TtlGroup.Delete("/:key", data(acl.Write)(controller.PersistTtlData)...)
+	}
+	ListGroup := r.Group("/list")
+	{
+		ListGroup.Get("/:key", data(acl.Read, acl.List)(controller.GetListData)...)
+		ListGroup.Post("/:key", data(acl.Write, acl.List)(controller.SetListData)...)
+		ListGroup.Delete("/:key", data(acl.Write, acl.List)(controller.DeleteListData)...)
+		ListGroup.Patch("/:key/:operation", data(acl.Write, acl.List)(controller.UpdateListData)...)
+	}
+	read, write := data(acl.Read, acl.Stream), data(acl.Write, acl.Stream)
+	StreamGroup := r.Group("/stream")
+	{
+		StreamGroup.Post("/:key", write(controller.XAdd)...)
+		StreamGroup.Get("/:key", read(controller.XRange)...)
+		StreamGroup.Delete("/:key", write(controller.DeleteStringData)...)
+		StreamGroup.Get("/:key/read", read(controller.XRead)...)
+		StreamGroup.Get("/:key/info", read(controller.XInfoStream)...)
+		StreamGroup.Post("/:key/trim", write(controller.XTrim)...)
+		StreamGroup.Delete("/:key/entries", write(controller.XDel)...)
+		StreamGroup.Get("/:key/groups", read(controller.XInfoGroups)...)
+		StreamGroup.Post("/:key/groups", write(controller.XGroupCreate)...)
+		StreamGroup.Delete("/:key/groups/:group", write(controller.XGroupDestroy)...)
+		StreamGroup.Get("/:key/groups/:group/consumers", read(controller.XInfoConsumers)...)
+		StreamGroup.Delete("/:key/groups/:group/consumers/:consumer", write(controller.XGroupDelConsumer)...)
+		StreamGroup.Post("/:key/groups/:group/read", write(controller.XReadGroup)...)
+		StreamGroup.Post("/:key/groups/:group/ack", write(controller.XAck)...)
+		StreamGroup.Get("/:key/groups/:group/pending", read(controller.XPending)...)
+		StreamGroup.Post("/:key/groups/:group/claim", write(controller.XClaim)...)
+		StreamGroup.Post("/:key/groups/:group/autoclaim", write(controller.XAutoClaim)...)
+	}
+	read, write = data(acl.Read, acl.Queue), data(acl.Write, acl.Queue)
+	QueueGroup := r.Group("/queue")
+	{
+		QueueGroup.Post("/:key", write(controller.Enqueue)...)
+		QueueGroup.Get("/:key", read(controller.QueueInfo)...)
+		QueueGroup.Put("/:key", write(controller.ConfigureQueue)...)
+		QueueGroup.Delete("/:key", write(controller.DeleteStringData)...)
+		QueueGroup.Post("/:key/receive", write(controller.Receive)...)
+		QueueGroup.Post("/:key/messages/:id/ack", write(controller.Ack)...)
+		QueueGroup.Post("/:key/messages/:id/nack", write(controller.Nack)...)
+		QueueGroup.Post("/:key/messages/:id/extend", write(controller.ExtendLease)...)
+	}
+	read, write = data(acl.Read, acl.Lock), data(acl.Write, acl.Lock)
+	LockGroup := r.Group("/lock")
+	{
+		LockGroup.Post("/:key", write(controller.AcquireLock)...)
+		LockGroup.Get("/:key", read(controller.GetLock)...)
+		LockGroup.Delete("/:key", write(controller.ReleaseLock)...)
+		LockGroup.Post("/:key/extend", write(controller.ExtendLock)...)
+	}
+	read, write = data(acl.Read, acl.JSON), data(acl.Write, acl.JSON)
+	JSONGroup := r.Group("/json")
+	{
+		JSONGroup.Get("/:key", read(controller.GetJSON)...)
+		JSONGroup.Post("/:key", write(controller.SetJSON)...)
+		JSONGroup.Delete("/:key", write(controller.DeleteJSON)...)
+		JSONGroup.Post("/:key/numincrby", write(controller.JSONNumIncrBy)...)
+		JSONGroup.Post("/:key/arrappend", write(controller.JSONArrAppend)...)
+		JSONGroup.Post("/:key/arrpop", write(controller.JSONArrPop)...)
+		JSONGroup.Get("/:key/strlen", read(controller.JSONStrLen)...)
+		JSONGroup.Get("/:key/objkeys", read(controller.JSONObjKeys)...)
+		JSONGroup.Get("/:key/type", read(controller.JSONType)...)
+	}
+	read, write = data(acl.Read, acl.Search), data(acl.Write, acl.Search)
+	IndexGroup := r.Group("/indexes")
+	{
+		IndexGroup.Get("/", read(controller.ListIndexes)...)
+		IndexGroup.Get("/:name", read(controller.GetIndex)...)
+		IndexGroup.Post("/:name", write(controller.CreateIndex)...)
+		IndexGroup.Delete("/:name", write(controller.DropIndex)...)
+		IndexGroup.Post("/:name/query", read(controller.QueryIndex)...)
+	}
+	SearchGroup := r.Group("/search")
+	{
+		SearchGroup.Get("/", read(controller.ListSearchIndexes)...)
+		SearchGroup.Get("/:name", read(controller.GetSearchIndex)...)
+		SearchGroup.Post("/:name", write(controller.CreateSearchIndex)...)
+		SearchGroup.Delete("/:name", write(controller.DropSearchIndex)...)
+		SearchGroup.Post("/:name/query", read(controller.Search)...)
+	}
 }
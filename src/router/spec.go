@@ -0,0 +1,468 @@
+package router
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dhanushcrueiso/coding-test/internal/openapi"
+	"github.com/dhanushcrueiso/coding-test/src/handlers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// operation documents a route. Routes are keyed by method and path
+// relative to the API root, so one entry covers /api, /api/v2 and their
+// /db/:db forms.
+type operation struct {
+	id      string
+	tag     string
+	summary string
+	query   []openapi.Parameter
+	// body is the JSON request body, required unless optionalBody
+	body         *openapi.Schema
+	optionalBody bool
+	// raw routes also take or return values as application/octet-stream
+	raw bool
+	// conditional routes send the key's ETag and honour If-Match and
+	// If-None-Match
+	conditional bool
+}
+
+func query(name string, s *openapi.Schema, description string) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Description: description, Schema: s}
+}
+
+// fields are the properties of an object schema
+type fields = map[string]*openapi.Schema
+
+var (
+	str, integer, boolean = openapi.String, openapi.Integer, openapi.Boolean
+	object, array         = openapi.Object, openapi.Array
+
+	millis = func(d string) *openapi.Schema { return integer().Min(0).Describe(d) }
+
+	expiration = []openapi.Parameter{
+		query("ttl", integer().Min(0), "Expire after this many seconds"),
+		query("px", integer().Min(0), "Expire after this many milliseconds"),
+		query("exat", integer().Min(1), "Expire at this Unix time in seconds"),
+		query("pxat", integer().Min(1), "Expire at this Unix time in milliseconds"),
+	}
+	valueBody = object(fields{"value": str()}, "value")
+	idsBody   = object(fields{"ids": array(str())}, "ids")
+	leaseBody = object(fields{
+		"receipt":       str().NonEmpty(),
+		"delay_ms":      millis("Delay before the message is delivered again"),
+		"visibility_ms": millis("New lease of the message"),
+	}, "receipt")
+	lockBody = object(fields{
+		"owner":   str(),
+		"ttl_ms":  integer().Min(1),
+		"wait_ms": millis("How long to wait for a held lock"),
+	})
+	rangeQuery = []openapi.Parameter{
+		query("start", str(), "First entry ID, - for the first"),
+		query("end", str(), "Last entry ID, + for the last"),
+		query("count", integer().Min(0), "Most entries to return"),
+	}
+)
+
+// conditionalHeaders are the parameters of conditional routes
+var conditionalHeaders = []openapi.Parameter{
+	{Name: fiber.HeaderIfMatch, In: "header", Schema: str(),
+		Description: "Only write if the key's ETag is one of these; 412 otherwise"},
+	{Name: fiber.HeaderIfNoneMatch, In: "header", Schema: str(),
+		Description: "Only write if the key's ETag is none of these, or with * if the key does not exist; 412 otherwise. A read answers 304 if the ETag is unchanged."},
+}
+
+func with(params []openapi.Parameter, more ...openapi.Parameter) []openapi.Parameter {
+	return append(append([]openapi.Parameter{}, params...), more...)
+}
+
+var operations = map[string]operation{
+	"GET /health":     {id: "GetHealth", tag: "server", summary: "Health check, always allowed"},
+	"GET /info":       {id: "GetInfo", tag: "server", summary: "Server information", query: []openapi.Parameter{query("section", str(), "Comma separated sections, e.g. memory,keyspace")}},
+	"GET /monitor":    {id: "Monitor", tag: "server", summary: "Stream every command as newline-delimited JSON"},
+	"GET /metrics":    {id: "GetMetrics", tag: "server", summary: "Prometheus metrics"},
+	"GET /slowlog":    {id: "GetSlowLog", tag: "server", summary: "Slowest recent commands", query: []openapi.Parameter{query("count", integer().Min(0), "Most entries to return")}},
+	"DELETE /slowlog": {id: "ResetSlowLog", tag: "server", summary: "Clear the slow log"},
+	"POST /swapdb":    {id: "SwapDB", tag: "namespaces", summary: "Swap the contents of two namespaces", body: object(fields{"a": str().NonEmpty(), "b": str().NonEmpty()}, "a", "b")},
+
+	"GET /cluster":                 {id: "GetClusterStatus", tag: "cluster", summary: "Raft status of this node"},
+	"POST /cluster/members":        {id: "AddClusterMember", tag: "cluster", summary: "Add a member", body: object(fields{"id": str().NonEmpty(), "addr": str().NonEmpty(), "api": str()}, "id", "addr")},
+	"DELETE /cluster/members/:id":  {id: "RemoveClusterMember", tag: "cluster", summary: "Remove a member"},
+	"GET /config":                  {id: "GetConfig", tag: "config", summary: "Current settings", query: []openapi.Parameter{query("pattern", str(), "Glob the setting names must match")}},
+	"PUT /config/:name":            {id: "SetConfig", tag: "config", summary: "Change a setting at runtime", body: object(fields{"value": str()}, "value")},
+	"POST /config/rewrite":         {id: "RewriteConfig", tag: "config", summary: "Write the current settings to the config file"},
+	"GET /quotas":                  {id: "ListQuotas", tag: "quotas", summary: "Every configured quota"},
+	"GET /quotas/:kind/:name":      {id: "GetQuota", tag: "quotas", summary: "Limits of a namespace or user"},
+	"PUT /quotas/:kind/:name":      {id: "SetQuota", tag: "quotas", summary: "Set the limits of a namespace or user", body: quotaBody},
+	"DELETE /quotas/:kind/:name":   {id: "DeleteQuota", tag: "quotas", summary: "Remove the limits of a namespace or user"},
+	"GET /acl/whoami":              {id: "WhoAmI", tag: "acl", summary: "The authenticated user"},
+	"GET /acl/users":               {id: "ListUsers", tag: "acl", summary: "Every ACL user"},
+	"GET /acl/users/:name":         {id: "GetUser", tag: "acl", summary: "An ACL user"},
+	"PUT /acl/users/:name":         {id: "SetUser", tag: "acl", summary: "Create or replace an ACL user", body: userBody},
+	"DELETE /acl/users/:name":      {id: "DeleteUser", tag: "acl", summary: "Delete an ACL user"},
+	"POST /acl/users/:name/keys":   {id: "CreateAPIKey", tag: "acl", summary: "Issue an API key, shown only once"},
+	"DELETE /acl/users/:name/keys": {id: "RevokeAPIKeys", tag: "acl", summary: "Revoke every API key of a user"},
+
+	"GET /dbsize":   {id: "DBSize", tag: "namespaces", summary: "Number of keys in the namespace"},
+	"GET /usage":    {id: "GetUsage", tag: "namespaces", summary: "Quotas of the namespace and how much is used"},
+	"POST /flushdb": {id: "FlushDB", tag: "namespaces", summary: "Remove every key in the namespace"},
+
+	"POST /strings/:key": {id: "SetString", tag: "strings", raw: true, conditional: true, summary: "Set a string",
+		body: valueBody, query: with(expiration,
+			query("nx", boolean(), "Only set if the key does not exist"),
+			query("xx", boolean(), "Only set if the key exists"),
+			query("get", boolean(), "Return the old value"),
+			query("keepttl", boolean(), "Keep the key's expiration"))},
+	"GET /strings/:key": {id: "GetString", tag: "strings", raw: true, conditional: true, summary: "Get a value, changing its expiration if asked to",
+		query: with(expiration, query("persist", boolean(), "Remove the expiration"))},
+	"PUT /strings/:key": {id: "UpdateString", tag: "strings", raw: true, conditional: true, summary: "Replace an existing string", body: valueBody},
+	"DELETE /strings/:key": {id: "DeleteKey", tag: "strings", raw: true, conditional: true, summary: "Delete a key",
+		query: []openapi.Parameter{query("get", boolean(), "Return the deleted string")}},
+
+	"GET /ttl/:key": {id: "GetTTL", tag: "ttl", summary: "Remaining time to live"},
+	"POST /ttl/:key": {id: "SetTTL", tag: "ttl", summary: "Set the expiration",
+		query: with(expiration,
+			query("nx", boolean(), "Only if the key has no expiration"),
+			query("xx", boolean(), "Only if the key has an expiration"),
+			query("gt", boolean(), "Only if the new expiration is later"),
+			query("lt", boolean(), "Only if the new expiration is earlier"))},
+	"DELETE /ttl/:key": {id: "Persist", tag: "ttl", summary: "Remove the expiration"},
+
+	"GET /list/:key":    {id: "GetList", tag: "lists", conditional: true, summary: "Every element of a list"},
+	"POST /list/:key":   {id: "CreateList", tag: "lists", summary: "Create an empty list", query: expiration},
+	"DELETE /list/:key": {id: "DeleteList", tag: "lists", conditional: true, summary: "Delete a list"},
+	"PATCH /list/:key/:operation": {id: "UpdateList", tag: "lists", raw: true, optionalBody: true,
+		summary: "push appends the body's value, pop removes and returns the last element", body: valueBody},
+
+	"POST /stream/:key": {id: "XAdd", tag: "streams", summary: "Append an entry", body: object(fields{
+		"id":         str().Describe("* or empty to generate, ms-* to generate the sequence"),
+		"fields":     openapi.Map(str()),
+		"nomkstream": boolean(),
+		"maxlen":     integer().Min(0),
+		"minid":      str(),
+	}, "fields")},
+	"GET /stream/:key": {id: "XRange", tag: "streams", summary: "Entries in an ID range",
+		query: with(rangeQuery, query("rev", boolean(), "Newest first"))},
+	"DELETE /stream/:key": {id: "DeleteStream", tag: "streams", summary: "Delete a stream"},
+	"GET /stream/:key/read": {id: "XRead", tag: "streams", summary: "Entries after an ID, waiting for new ones if asked to",
+		query: []openapi.Parameter{
+			query("after", str(), "Return entries after this ID, $ for only new ones"),
+			query("count", integer().Min(0), "Most entries to return"),
+			query("block", integer().Min(0), "Milliseconds to wait for entries"),
+		}},
+	"GET /stream/:key/info":       {id: "XInfoStream", tag: "streams", summary: "Length, IDs and groups of a stream"},
+	"POST /stream/:key/trim":      {id: "XTrim", tag: "streams", summary: "Trim a stream", body: object(fields{"maxlen": integer().Min(0), "minid": str()})},
+	"DELETE /stream/:key/entries": {id: "XDel", tag: "streams", summary: "Delete entries", body: idsBody},
+	"GET /stream/:key/groups":     {id: "XInfoGroups", tag: "streams", summary: "Consumer groups of a stream"},
+	"POST /stream/:key/groups": {id: "XGroupCreate", tag: "streams", summary: "Create a consumer group", body: object(fields{
+		"group": str().NonEmpty(), "id": str(), "mkstream": boolean(),
+	}, "group")},
+	"DELETE /stream/:key/groups/:group":                     {id: "XGroupDestroy", tag: "streams", summary: "Delete a consumer group"},
+	"GET /stream/:key/groups/:group/consumers":              {id: "XInfoConsumers", tag: "streams", summary: "Consumers of a group"},
+	"DELETE /stream/:key/groups/:group/consumers/:consumer": {id: "XGroupDelConsumer", tag: "streams", summary: "Remove a consumer from a group"},
+	"POST /stream/:key/groups/:group/read": {id: "XReadGroup", tag: "streams", summary: "Read entries as a consumer of a group", body: object(fields{
+		"consumer": str().NonEmpty(), "id": str(), "count": integer().Min(0), "block_ms": integer().Min(0), "noack": boolean(),
+	}, "consumer")},
+	"POST /stream/:key/groups/:group/ack": {id: "XAck", tag: "streams", summary: "Acknowledge entries", body: idsBody},
+	"GET /stream/:key/groups/:group/pending": {id: "XPending", tag: "streams", summary: "Pending entries, summarized without a query",
+		query: with(rangeQuery,
+			query("min_idle_ms", integer().Min(0), "Only entries idle this long"),
+			query("consumer", str(), "Only entries of this consumer"))},
+	"POST /stream/:key/groups/:group/claim": {id: "XClaim", tag: "streams", summary: "Take over pending entries", body: object(fields{
+		"consumer": str().NonEmpty(), "min_idle_ms": integer().Min(0), "ids": array(str()),
+	}, "consumer", "ids")},
+	"POST /stream/:key/groups/:group/autoclaim": {id: "XAutoClaim", tag: "streams", summary: "Take over idle pending entries", body: object(fields{
+		"consumer": str().NonEmpty(), "min_idle_ms": integer().Min(0), "start": str(), "count": integer().Min(0),
+	}, "consumer")},
+
+	"POST /queue/:key": {id: "Enqueue", tag: "queues", summary: "Add a message", body: object(fields{
+		"body": str(), "delay_ms": millis("Delay before the message is first delivered"),
+	}, "body")},
+	"GET /queue/:key": {id: "QueueInfo", tag: "queues", summary: "Configuration and counts of a queue"},
+	"PUT /queue/:key": {id: "ConfigureQueue", tag: "queues", summary: "Configure a queue", body: object(fields{
+		"visibility_ms": millis("Default lease of received messages"),
+		"max_attempts":  integer().Min(0),
+		"dead_letter":   str(),
+	})},
+	"DELETE /queue/:key": {id: "DeleteQueue", tag: "queues", summary: "Delete a queue"},
+	"POST /queue/:key/receive": {id: "Receive", tag: "queues", summary: "Lease messages, waiting for them if asked to", optionalBody: true,
+		body: object(fields{
+			"count": integer().Min(0), "visibility_ms": millis("Lease of the messages"), "wait_ms": millis("How long to wait for a message"),
+		})},
+	"POST /queue/:key/messages/:id/ack":    {id: "Ack", tag: "queues", summary: "Delete a received message", body: leaseBody},
+	"POST /queue/:key/messages/:id/nack":   {id: "Nack", tag: "queues", summary: "Return a received message to the queue", body: leaseBody},
+	"POST /queue/:key/messages/:id/extend": {id: "ExtendLease", tag: "queues", summary: "Extend the lease of a received message", body: leaseBody},
+
+	"POST /lock/:key":        {id: "AcquireLock", tag: "locks", summary: "Acquire a lock, waiting for it if asked to", body: object(lockBody.Properties, "ttl_ms")},
+	"GET /lock/:key":         {id: "GetLock", tag: "locks", summary: "Token and expiry of a held lock"},
+	"DELETE /lock/:key":      {id: "ReleaseLock", tag: "locks", summary: "Release a lock", body: object(lockBody.Properties, "owner")},
+	"POST /lock/:key/extend": {id: "ExtendLock", tag: "locks", summary: "Renew the lease of a lock", body: object(lockBody.Properties, "owner", "ttl_ms")},
+
+	"GET /json/:key": {id: "GetJSON", tag: "json", conditional: true, summary: "A document, or the values a path selects in it", query: jsonPath},
+	"POST /json/:key": {id: "SetJSON", tag: "json", summary: "Set a value at a path, creating the document at the root",
+		body: object(fields{"value": anyValue}, "value"), query: with(jsonPath,
+			query("nx", boolean(), "Only set if the path does not exist"),
+			query("xx", boolean(), "Only set if the path exists"))},
+	"DELETE /json/:key": {id: "DeleteJSON", tag: "json", summary: "Delete the values a path selects, or the document", query: jsonPath},
+	"POST /json/:key/numincrby": {id: "JSONNumIncrBy", tag: "json", summary: "Add to numbers", query: jsonPath,
+		body: object(fields{"by": openapi.Number()}, "by")},
+	"POST /json/:key/arrappend": {id: "JSONArrAppend", tag: "json", summary: "Append values to arrays", query: jsonPath,
+		body: object(fields{"values": array(anyValue)}, "values")},
+	"POST /json/:key/arrpop": {id: "JSONArrPop", tag: "json", summary: "Remove and return an element of arrays", query: jsonPath, optionalBody: true,
+		body: object(fields{"index": integer().Describe("Negative counts from the end; the last element by default")})},
+	"GET /json/:key/strlen":  {id: "JSONStrLen", tag: "json", summary: "Lengths of strings", query: jsonPath},
+	"GET /json/:key/objkeys": {id: "JSONObjKeys", tag: "json", summary: "Member names of objects", query: jsonPath},
+	"GET /json/:key/type":    {id: "JSONType", tag: "json", summary: "Types of values", query: jsonPath},
+
+	"GET /indexes":              {id: "ListIndexes", tag: "indexes", summary: "Every index of the namespace"},
+	"GET /indexes/:name":        {id: "GetIndex", tag: "indexes", summary: "Definition and size of an index"},
+	"POST /indexes/:name":       {id: "CreateIndex", tag: "indexes", summary: "Index the JSON documents under prefixes", body: indexBody},
+	"DELETE /indexes/:name":     {id: "DropIndex", tag: "indexes", summary: "Delete an index, keeping its keys"},
+	"POST /indexes/:name/query": {id: "QueryIndex", tag: "indexes", summary: "Find, sort, page and group keys", body: queryBody},
+
+	"GET /search":              {id: "ListSearchIndexes", tag: "search", summary: "Every full-text index of the namespace"},
+	"GET /search/:name":        {id: "GetSearchIndex", tag: "search", summary: "Definition and size of a full-text index"},
+	"POST /search/:name":       {id: "CreateSearchIndex", tag: "search", summary: "Index the words of the string and JSON keys under prefixes", body: searchIndexBody},
+	"DELETE /search/:name":     {id: "DropSearchIndex", tag: "search", summary: "Delete a full-text index, keeping its keys"},
+	"POST /search/:name/query": {id: "Search", tag: "search", summary: "Find keys by their words, best first", body: searchBody},
+}
+
+var (
+	indexBody = object(fields{
+		"prefixes": array(str()).Describe("Key prefixes the index covers, every key if none"),
+		"fields": array(object(fields{
+			"name": str().NonEmpty(),
+			"path": str().Describe("JSONPath of the values, $.<name> by default"),
+			"type": str().OneOf("tag", "numeric", "text"),
+		}, "name", "type")),
+	}, "fields").Describe("Only JSON documents are indexed; keys of other types under the prefixes are left out")
+	queryBody = object(fields{
+		"query":    str().NonEmpty().Describe(`e.g. @user_id:{42} @age:[18 +inf] -@status:{closed}`),
+		"sort_by":  str(),
+		"desc":     boolean(),
+		"offset":   integer().Min(0),
+		"limit":    integer().Min(0).Describe("10 by default"),
+		"group_by": array(str()),
+		"reduce": array(object(fields{
+			"op":    str().OneOf("count", "count_distinct", "sum", "avg", "min", "max"),
+			"field": str(),
+			"as":    str(),
+		}, "op")),
+	}, "query")
+	searchIndexBody = object(fields{
+		"prefixes": array(str()).Describe("Key prefixes the index covers, every key if none"),
+		"paths":    array(str()).Describe("JSONPaths of the text in JSON documents, every string by default"),
+	})
+	searchBody = object(fields{
+		"query":     str().NonEmpty().Describe(`e.g. wireless "noise cancelling" head* -refurbished`),
+		"offset":    integer().Min(0),
+		"limit":     integer().Min(0).Describe("10 by default"),
+		"highlight": boolean(),
+		"pre_tag":   str().Describe("<b> by default"),
+		"post_tag":  str().Describe("</b> by default"),
+	}, "query")
+	jsonPath = []openapi.Parameter{query("path", str(), "JSONPath of the values, e.g. $.items[0].name; the root by default")}
+	anyValue = (&openapi.Schema{}).Describe("Any JSON value")
+)
+
+var (
+	quotaBody = object(fields{
+		"max_keys":            integer().Min(0),
+		"max_bytes":           integer().Min(0),
+		"max_value_size":      integer().Min(0),
+		"requests_per_second": openapi.Number().Min(0),
+		"burst":               integer().Min(0),
+	})
+	userBody = object(fields{
+		"enabled":    boolean(),
+		"nopass":     boolean(),
+		"passwords":  array(str()),
+		"categories": array(str().Describe("read, write, admin, list, string, stream, queue, lock, json, search, pubsub or all")),
+		"keys":       array(str().Describe("Glob of the keys the user may access")),
+		"namespaces": array(str()),
+	})
+)
+
+var tags = []openapi.Tag{
+	{Name: "strings"}, {Name: "ttl"}, {Name: "lists"}, {Name: "streams"},
+	{Name: "queues"}, {Name: "locks"}, {Name: "json"}, {Name: "indexes"}, {Name: "search"},
+	{Name: "namespaces"},
+	{Name: "server"}, {Name: "cluster"}, {Name: "config"}, {Name: "quotas"}, {Name: "acl"},
+}
+
+const specDescription = `Every route is served under /api/v2, where responses are wrapped in
+{"ok": true, "data": ...} or {"ok": false, "error": {"code": ..., "message": ...}},
+and under /api, the deprecated version 1. Data routes work on the namespace
+in the X-Namespace header, or on the one in the path under /db/{db}. Keys
+are percent-encoded, or base64url with X-Key-Encoding: base64url.`
+
+// buildSpec describes the routes registered on app. It fails for a route
+// without an entry in operations, so the document cannot fall behind.
+func buildSpec(app *fiber.App) (*openapi.Document, error) {
+	doc := &openapi.Document{
+		OpenAPI: openapi.Version,
+		Info: openapi.Info{
+			Title:       "GoCache API",
+			Description: specDescription,
+		},
+		Paths: map[string]openapi.PathItem{},
+		Tags:  tags,
+		Components: &openapi.Components{
+			Schemas: map[string]*openapi.Schema{
+				"Envelope": object(fields{
+					"ok":   boolean(),
+					"data": {Description: "The result, absent if there is none", Nullable: true},
+					"error": object(fields{
+						"code":    str().OneOf(errorCodes...),
+						"message": str(),
+						"details": {Type: "object", Description: "Other fields of the error, such as retry hints"},
+					}, "code", "message"),
+				}, "ok"),
+			},
+			SecuritySchemes: map[string]openapi.SecurityScheme{
+				"basic":  {Type: "http", Scheme: "basic"},
+				"bearer": {Type: "http", Scheme: "bearer"},
+			},
+		},
+		// Credentials are optional while the default user needs none
+		Security: []map[string][]string{{}, {"basic": {}}, {"bearer": {}}},
+	}
+
+	type route struct {
+		fiber.Route
+		rel      string
+		v1, inDB bool
+	}
+	var routes []route
+	// Routes also mounted under /db/:db take the namespace from a header
+	// elsewhere
+	namespaced := map[string]bool{}
+	for _, r := range app.GetRoutes(true) {
+		if r.Method == fiber.MethodHead {
+			continue
+		}
+		rt := route{Route: r, rel: strings.TrimSuffix(r.Path, "/")}
+		switch {
+		case strings.HasPrefix(rt.rel, handlers.APIv2Prefix+"/"):
+			rt.rel = strings.TrimPrefix(rt.rel, handlers.APIv2Prefix)
+		case strings.HasPrefix(rt.rel, "/api/"):
+			rt.rel, rt.v1 = strings.TrimPrefix(rt.rel, "/api"), true
+		}
+		if strings.HasPrefix(rt.rel, "/db/:db/") {
+			rt.rel, rt.inDB = strings.TrimPrefix(rt.rel, "/db/:db"), true
+			namespaced[r.Method+" "+rt.rel] = true
+		}
+		routes = append(routes, rt)
+	}
+
+	var missing []string
+	for _, r := range routes {
+		o, ok := operations[r.Method+" "+r.rel]
+		if !ok {
+			missing = append(missing, r.Method+" "+r.Path)
+			continue
+		}
+		v1, inDB := r.v1, r.inDB
+
+		path, params := openAPIPath(strings.TrimSuffix(r.Path, "/"))
+		if !inDB && namespaced[r.Method+" "+r.rel] {
+			params = append(params, openapi.Parameter{
+				Name: handlers.NamespaceHeader, In: "header", Schema: str(),
+				Description: "Namespace to work on, the default one if absent"})
+		}
+		op := &openapi.Operation{
+			OperationID: o.id,
+			Summary:     o.summary,
+			Tags:        []string{o.tag},
+			Deprecated:  v1,
+			Parameters:  append(params, o.query...),
+			Responses:   responses(v1, o.raw),
+		}
+		if o.conditional {
+			op.Parameters = append(op.Parameters, conditionalHeaders...)
+		}
+		if inDB {
+			op.OperationID += "InDB"
+		}
+		if v1 {
+			op.OperationID += "V1"
+		}
+		if o.body != nil {
+			op.RequestBody = &openapi.RequestBody{
+				Required: !o.optionalBody,
+				Content:  map[string]openapi.MediaType{fiber.MIMEApplicationJSON: {Schema: o.body}},
+			}
+			if o.raw {
+				op.RequestBody.Content[handlers.OctetStream] = openapi.MediaType{Schema: &openapi.Schema{Type: "string", Format: "binary"}}
+			}
+		}
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = openapi.PathItem{}
+		}
+		doc.Paths[path][strings.ToLower(r.Method)] = op
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("routes missing from the OpenAPI operations: %s", strings.Join(missing, ", "))
+	}
+	return doc, nil
+}
+
+// openAPIPath turns a fiber path into an OpenAPI one, /strings/:key into
+// /strings/{key}, and returns its path parameters
+func openAPIPath(path string) (string, []openapi.Parameter) {
+	var params []openapi.Parameter
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if !strings.HasPrefix(s, ":") {
+			continue
+		}
+		name := strings.TrimSuffix(s[1:], "?")
+		segments[i] = "{" + name + "}"
+		p := openapi.Parameter{Name: name, In: "path", Required: true, Schema: str()}
+		switch name {
+		case "key":
+			p.Description = "Percent-encoded key, or base64url with X-Key-Encoding: base64url"
+		case "db":
+			p.Description = "Namespace"
+		case "operation":
+			p.Schema = str().OneOf("push", "pop")
+		case "kind":
+			p.Schema = str().OneOf("namespace", "user")
+		}
+		params = append(params, p)
+	}
+	return strings.Join(segments, "/"), params
+}
+
+var errorCodes = []string{
+	handlers.CodeInvalidArgument, handlers.CodeUnauthenticated, handlers.CodePermissionDenied,
+	handlers.CodeNotFound, handlers.CodeNotAcceptable, handlers.CodeConflict, handlers.CodeWrongType,
+	handlers.CodeValueTooLarge, handlers.CodeRateLimited, handlers.CodeInternal,
+	handlers.CodeUnavailable, handlers.CodeQuotaExceeded, handlers.CodeOutOfMemory,
+	handlers.CodePreconditionFailed,
+}
+
+func responses(v1, raw bool) map[string]openapi.Response {
+	if v1 {
+		return map[string]openapi.Response{
+			"200":     {Description: "Success"},
+			"default": {Description: `Error, with "error" and "code" fields`},
+		}
+	}
+	envelope := map[string]openapi.MediaType{fiber.MIMEApplicationJSON: {Schema: openapi.Ref("Envelope")}}
+	ok := openapi.Response{Description: "Success", Content: envelope}
+	if raw {
+		ok.Content = map[string]openapi.MediaType{
+			fiber.MIMEApplicationJSON: {Schema: openapi.Ref("Envelope")},
+			handlers.OctetStream:      {Schema: &openapi.Schema{Type: "string", Format: "binary"}},
+		}
+	}
+	return map[string]openapi.Response{
+		"200":     ok,
+		"default": {Description: "Error", Content: envelope},
+	}
+}